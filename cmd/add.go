@@ -23,6 +23,8 @@ import (
 	"github.com/spf13/viper"
 )
 
+var addIntentToAdd bool
+
 // addCmd represents the add command
 var addCmd = &cobra.Command{
 	Use:   "add",
@@ -34,7 +36,10 @@ var addCmd = &cobra.Command{
 		email := viper.GetString("email")
 
 		rootPath, _ := os.Getwd()
-		if err := src.StartAdd(rootPath, name, email, message, args); err != nil {
+		option := &src.AddOption{
+			IntentToAdd: addIntentToAdd,
+		}
+		if err := src.StartAddWithOption(rootPath, name, email, message, args, option); err != nil {
 			return err
 		}
 
@@ -43,5 +48,6 @@ var addCmd = &cobra.Command{
 }
 
 func init() {
+	addCmd.Flags().BoolVarP(&addIntentToAdd, "intent-to-add", "N", false, "record only the fact that the path will be added later")
 	rootCmd.AddCommand(addCmd)
 }
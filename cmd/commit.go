@@ -24,6 +24,7 @@ import (
 )
 
 var message string
+var commitSign bool
 
 // commitCmd represents the commit command
 var commitCmd = &cobra.Command{
@@ -42,7 +43,10 @@ to quickly create a Cobra application.`,
 		rootPath, _ := os.Getwd()
 		w := os.Stdout
 
-		if err := src.StartCommit(rootPath, name, email, message, w); err != nil {
+		option := &src.CommitOption{
+			Sign: commitSign,
+		}
+		if err := src.StartCommitWithOption(rootPath, name, email, message, option, w); err != nil {
 			return err
 		}
 
@@ -52,5 +56,6 @@ to quickly create a Cobra application.`,
 
 func init() {
 	commitCmd.Flags().StringVarP(&message, "message", "m", "", "commit message")
+	commitCmd.Flags().BoolVarP(&commitSign, "gpg-sign", "S", false, "sign the commit with user.signingkey")
 	rootCmd.AddCommand(commitCmd)
 }
@@ -0,0 +1,54 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"mygit/src"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var configOption = &src.ConfigOption{}
+
+// configCmd represents the config command
+var configCmd = &cobra.Command{
+	Use:   "config [<name> [<value>]]",
+	Short: "get and set repository or global options",
+	Long: `read and write git-format config files.
+without --system, --global or --local, values are read from all of them (local wins)
+and written to .git/config`,
+	Args: cobra.RangeArgs(0, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rootPath, _ := os.Getwd()
+		if err := src.StartConfig(rootPath, args, configOption, os.Stdout); err != nil {
+			return err
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	configCmd.Flags().BoolVar(&configOption.Get, "get", false, "get the value for a given key")
+	configCmd.Flags().BoolVar(&configOption.Set, "set", false, "set the value for a given key")
+	configCmd.Flags().BoolVar(&configOption.Unset, "unset", false, "remove the given key")
+	configCmd.Flags().BoolVarP(&configOption.List, "list", "l", false, "list all variables with their values")
+	configCmd.Flags().BoolVar(&configOption.Global, "global", false, "use the global config file")
+	configCmd.Flags().BoolVar(&configOption.System, "system", false, "use the system-wide config file")
+	configCmd.Flags().BoolVar(&configOption.Local, "local", false, "use the repository config file")
+	rootCmd.AddCommand(configCmd)
+}
@@ -0,0 +1,43 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"mygit/src"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// fsmonitorCmd represents the fsmonitor command
+var fsmonitorCmd = &cobra.Command{
+	Use:   "fsmonitor",
+	Short: "watch the work tree to speed up status",
+	Long:  `run (fsmonitor run) a daemon that watches the work tree with inotify, stop it (fsmonitor stop) or show whether it is running (fsmonitor status). status uses it when core.fsmonitor is true`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rootPath, _ := os.Getwd()
+		if err := src.StartFsmonitor(rootPath, args, os.Stdout); err != nil {
+			return err
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(fsmonitorCmd)
+}
@@ -0,0 +1,48 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"mygit/src"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var gcDryRun bool
+var gcPrune string
+
+// gcCmd represents the gc command
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "remove unreachable objects",
+	Long:  `remove unreachable loose objects older than --prune (or gc.pruneExpire) and stale temporary files`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rootPath, _ := os.Getwd()
+		if err := src.StartGc(rootPath, &src.GcOption{DryRun: gcDryRun, Prune: gcPrune}, os.Stdout); err != nil {
+			return err
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	gcCmd.Flags().BoolVarP(&gcDryRun, "dry-run", "n", false, "only report what would be removed")
+	gcCmd.Flags().StringVarP(&gcPrune, "prune", "", "", "prune loose objects older than this (default gc.pruneExpire or 2.weeks.ago)")
+	rootCmd.AddCommand(gcCmd)
+}
@@ -0,0 +1,55 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"mygit/src"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+var httpBackendListen string
+
+// httpBackendCmd represents the http-backend command
+var httpBackendCmd = &cobra.Command{
+	Use:   "http-backend [path]",
+	Short: "serve a repository over the smart HTTP protocol",
+	Long:  `serve fetch and push of a repository over the smart HTTP protocol; the current directory is served when no path is given; push is refused unless http.receivepack is set to true in the served repository`,
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rootPath, _ := os.Getwd()
+		if len(args) > 0 {
+			path, err := filepath.Abs(args[0])
+			if err != nil {
+				return err
+			}
+			rootPath = path
+		}
+
+		if err := src.StartHTTPBackend(rootPath, httpBackendListen, os.Stdout); err != nil {
+			return err
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	httpBackendCmd.Flags().StringVarP(&httpBackendListen, "listen", "l", ":8080", "address to listen on")
+	rootCmd.AddCommand(httpBackendCmd)
+}
@@ -22,6 +22,11 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var (
+	initBare         bool
+	initObjectFormat string
+)
+
 // initCmd represents the init command
 var initCmd = &cobra.Command{
 	Use:   "init [path to init]",
@@ -31,7 +36,11 @@ var initCmd = &cobra.Command{
 	RunE: func(cmd *cobra.Command, args []string) error {
 
 		w := os.Stdout
-		if err := src.StartInit(args, w); err != nil {
+		option := &src.InitOption{
+			Bare:         initBare,
+			ObjectFormat: initObjectFormat,
+		}
+		if err := src.StartInit(args, option, w); err != nil {
 			return err
 		}
 
@@ -40,5 +49,7 @@ var initCmd = &cobra.Command{
 }
 
 func init() {
+	initCmd.Flags().BoolVar(&initBare, "bare", false, "create a bare repository without a working tree")
+	initCmd.Flags().StringVar(&initObjectFormat, "object-format", "", "the hash algorithm to use (sha1 or sha256)")
 	rootCmd.AddCommand(initCmd)
 }
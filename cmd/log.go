@@ -26,6 +26,7 @@ var abbrev bool
 var oneline bool
 var pretty string
 var format string
+var showSignature bool
 
 // logCmd represents the log command
 var logCmd = &cobra.Command{
@@ -67,6 +68,8 @@ to quickly create a Cobra application.`,
 		o := &src.LogOption{
 			IsAbbrev: hasAbbr,
 			Format:   useFormat,
+
+			ShowSignature: showSignature,
 		}
 
 		err = src.StartLog(cur, args, o, w)
@@ -83,5 +86,6 @@ func init() {
 	diffCmd.Flags().BoolVarP(&oneline, "oneline", "on", true, "oneline")
 	commitCmd.Flags().StringVarP(&pretty, "pretty", "p", "", "pretty")
 	commitCmd.Flags().StringVarP(&format, "format", "f", "", "format")
+	logCmd.Flags().BoolVar(&showSignature, "show-signature", false, "check the signature of signed commits")
 	rootCmd.AddCommand(logCmd)
 }
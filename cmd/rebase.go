@@ -0,0 +1,61 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"mygit/src"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var rebaseOnto string
+var rebaseInteractive bool
+var rebaseContinue bool
+var rebaseAbort bool
+var rebaseQuit bool
+
+// rebaseCmd represents the rebase command
+var rebaseCmd = &cobra.Command{
+	Use:   "rebase",
+	Short: "reapply commits on top of another base",
+	Long:  `reapply the commits in upstream..HEAD on top of upstream (or --onto newbase) and move the branch`,
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rootPath, _ := os.Getwd()
+		option := &src.RebaseOption{
+			Onto:        rebaseOnto,
+			Interactive: rebaseInteractive,
+			Continue:    rebaseContinue,
+			Abort:       rebaseAbort,
+			Quit:        rebaseQuit,
+		}
+		if err := src.StartRebase(rootPath, args, option, os.Stdout); err != nil {
+			return err
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rebaseCmd.Flags().StringVar(&rebaseOnto, "onto", "", "starting point at which to create the new commits")
+	rebaseCmd.Flags().BoolVarP(&rebaseInteractive, "interactive", "i", false, "let the user edit the list of commits to rebase")
+	rebaseCmd.Flags().BoolVar(&rebaseContinue, "continue", false, "continue after resolving a conflict")
+	rebaseCmd.Flags().BoolVar(&rebaseAbort, "abort", false, "abort and check out the original branch")
+	rebaseCmd.Flags().BoolVar(&rebaseQuit, "quit", false, "abort but keep HEAD where it is")
+	rootCmd.AddCommand(rebaseCmd)
+}
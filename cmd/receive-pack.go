@@ -0,0 +1,48 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"mygit/src"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+// receivePackCmd represents the receive-pack command
+var receivePackCmd = &cobra.Command{
+	Use:   "receive-pack <directory>",
+	Short: "receive what is pushed into the repository over stdin/stdout",
+	Long:  `speak the pkt-line pack protocol on stdin/stdout; started by a fetching or pushing client through ssh or another command`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, err := filepath.Abs(args[0])
+		if err != nil {
+			return err
+		}
+
+		if err := src.StartReceivePack(path, os.Stdin, os.Stdout); err != nil {
+			return err
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(receivePackCmd)
+}
@@ -0,0 +1,46 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"mygit/src"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var deleteLoose bool
+
+// repackCmd represents the repack command
+var repackCmd = &cobra.Command{
+	Use:   "repack",
+	Short: "pack loose objects",
+	Long:  `pack reachable loose objects that are not yet packed into a single packfile`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rootPath, _ := os.Getwd()
+		if err := src.StartRepack(rootPath, &src.RepackOption{DeleteLoose: deleteLoose}, os.Stdout); err != nil {
+			return err
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	repackCmd.Flags().BoolVarP(&deleteLoose, "delete", "d", false, "remove loose objects that are now packed")
+	rootCmd.AddCommand(repackCmd)
+}
@@ -16,16 +16,15 @@ limitations under the License.
 package cmd
 
 import (
-	"fmt"
+	"errors"
+	"mygit/src"
 	"os"
+	"os/exec"
 
 	"github.com/spf13/cobra"
-
-	homedir "github.com/mitchellh/go-homedir"
 	"github.com/spf13/viper"
 )
 
-var cfgFile string
 var name string
 var email string
 
@@ -36,41 +35,35 @@ var rootCmd = &cobra.Command{
 }
 
 func Execute() {
+	//commandでない名前はconfigのalias.xxxとして展開する
+	rootPath, _ := os.Getwd()
+	rootCmd.InitDefaultHelpCmd()
+	alias, err := src.ExpandAlias(rootPath, os.Args[1:], isCommand)
+	cobra.CheckErr(err)
+
+	if alias.Shell != "" {
+		err := src.RunShellAlias(alias.Shell, alias.Args)
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.ExitCode())
+		}
+		cobra.CheckErr(err)
+		return
+	}
+
+	rootCmd.SetArgs(alias.Args)
 	cobra.CheckErr(rootCmd.Execute())
 }
 
-func init() {
+func isCommand(name string) bool {
+	c, _, err := rootCmd.Find([]string{name})
+	return err == nil && c != rootCmd
+}
 
-	cobra.OnInitialize(initConfig)
-	rootCmd.PersistentFlags().StringP("name", "", "", "username")
-	rootCmd.PersistentFlags().StringP("email", "", "", "userEmail")
+//user.name,user.emailはgitと同じconfigから読むので、ここでは--name,--emailの上書きだけ受け付ける
+func init() {
+	rootCmd.PersistentFlags().StringP("name", "", "", "username (overrides user.name)")
+	rootCmd.PersistentFlags().StringP("email", "", "", "userEmail (overrides user.email)")
 	viper.BindPFlag("name", rootCmd.PersistentFlags().Lookup("name"))
 	viper.BindPFlag("email", rootCmd.PersistentFlags().Lookup("email"))
-
-}
-
-// initConfig reads in config file and ENV variables if set.
-func initConfig() {
-	if cfgFile != "" {
-		// Use config file from the flag.
-		viper.SetConfigFile(cfgFile)
-	} else {
-		// Find home directory.
-		home, err := homedir.Dir()
-		cobra.CheckErr(err)
-
-		// Search config in home directory with name ".mygit" (without extension).
-		viper.AddConfigPath(home)
-		viper.SetConfigType("yaml")
-		viper.SetConfigName(".mygit")
-	}
-	viper.BindEnv("name", "USER_NAME")
-	viper.BindEnv("email", "USER_EMAIl")
-
-	viper.AutomaticEnv() // read in environment variables that match
-
-	// If a config file is found, read it in.
-	if err := viper.ReadInConfig(); err == nil {
-		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
-	}
 }
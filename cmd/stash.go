@@ -0,0 +1,53 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"mygit/src"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var stashMessage string
+
+// stashCmd represents the stash command
+var stashCmd = &cobra.Command{
+	Use:   "stash",
+	Short: "stash the changes in a dirty working directory away",
+	Long:  `stash push/pop/apply/list/drop, record the index and working tree as commits under refs/stash`,
+	Args:  cobra.MaximumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := viper.GetString("name")
+		email := viper.GetString("email")
+
+		rootPath, _ := os.Getwd()
+		option := &src.StashOption{
+			Message: stashMessage,
+		}
+		if err := src.StartStash(rootPath, name, email, args, option, os.Stdout); err != nil {
+			return err
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	stashCmd.Flags().StringVarP(&stashMessage, "message", "m", "", "stash message")
+	rootCmd.AddCommand(stashCmd)
+}
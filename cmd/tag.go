@@ -0,0 +1,65 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"mygit/src"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var tagAnnotate bool
+var tagSign bool
+var tagMessage string
+var tagDelete bool
+var tagForce bool
+
+// tagCmd represents the tag command
+var tagCmd = &cobra.Command{
+	Use:   "tag",
+	Short: "create, list and delete tags",
+	Long:  `create, list and delete tags`,
+	Args:  cobra.ArbitraryArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := viper.GetString("name")
+		email := viper.GetString("email")
+
+		rootPath, _ := os.Getwd()
+		option := &src.TagOption{
+			Annotate: tagAnnotate,
+			Sign:     tagSign,
+			Message:  tagMessage,
+			Delete:   tagDelete,
+			Force:    tagForce,
+		}
+		if err := src.StartTag(rootPath, name, email, args, option, os.Stdout); err != nil {
+			return err
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	tagCmd.Flags().BoolVarP(&tagAnnotate, "annotate", "a", false, "make an annotated tag object")
+	tagCmd.Flags().BoolVarP(&tagSign, "sign", "s", false, "make a signed tag with user.signingkey")
+	tagCmd.Flags().StringVarP(&tagMessage, "message", "m", "", "tag message")
+	tagCmd.Flags().BoolVarP(&tagDelete, "delete", "d", false, "delete tags")
+	tagCmd.Flags().BoolVarP(&tagForce, "force", "f", false, "replace an existing tag")
+	rootCmd.AddCommand(tagCmd)
+}
@@ -5,7 +5,6 @@ go 1.16
 require (
 	github.com/google/go-cmp v0.5.6
 	github.com/hexops/gotextdiff v1.0.3
-	github.com/mitchellh/go-homedir v1.1.0
 	github.com/pkg/errors v0.8.1
 	github.com/spf13/cobra v1.1.3
 	github.com/spf13/viper v1.8.0
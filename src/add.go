@@ -1,18 +1,38 @@
 package src
 
 import (
+	"fmt"
 	data "mygit/src/database"
 	con "mygit/src/database/content"
 	"mygit/src/database/lock"
+	"mygit/src/errors"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
+type AddOption struct {
+	//-N、中身はaddせずに空のentryだけ作り、diffやstatusに新しいファイルとして出す
+	IntentToAdd bool
+}
+
 //Addの時にindexとworkspaceを比較してdeletedなファイルの場合は、indexからも削除
 func StartAdd(rootPath, uName, uEmail, message string, selectedPath []string) error {
-	gitPath := filepath.Join(rootPath, ".git")
-	dbPath := filepath.Join(gitPath, "objects")
-	repo := GenerateRepository(rootPath, gitPath, dbPath)
+	return StartAddWithOption(rootPath, uName, uEmail, message, selectedPath, &AddOption{})
+}
+
+func StartAddWithOption(rootPath, uName, uEmail, message string, selectedPath []string, option *AddOption) error {
+	addIndex := AddIndex
+	if option.IntentToAdd {
+		addIndex = AddIntentToAdd
+	}
+
+	repo, err := DiscoverWorkTree(rootPath)
+	if err != nil {
+		return err
+	}
+	//cwdからの相対pathで指定される
+	selectedPath = repo.Pathspecs(selectedPath)
 
 	// w := &WorkSpace{
 	// 	Path: rootPath,
@@ -38,9 +58,61 @@ func StartAdd(rootPath, uName, uEmail, message string, selectedPath []string) er
 		}
 	}
 
+	sparse, err := LoadSparseCheckout(repo)
+	if err != nil {
+		return err
+	}
+	//sparse-checkoutの外のpathはaddせずに最後にまとめて知らせる
+	var sparsePaths []string
+	addPath := addIndex
+	addIndex = func(path string, repo *Repository) error {
+		if !sparse.Includes(path) {
+			sparsePaths = append(sparsePaths, path)
+			return nil
+		}
+		return addPath(path, repo)
+	}
+
+	var ignoredPaths []string
+
 	for _, path := range selectedPath {
 		//selectedPathに"."を指定した場合,filepath.Join("aaa/bbb",".")="aaa/bbb"となる
-		absPath := filepath.Join(rootPath, path)
+		absPath := filepath.Join(repo.w.Path, path)
+
+		//.gitignoreで除外されているpathを直接指定した場合はaddせずに最後にまとめて知らせる
+		//すでにindexに入っているものは本家と同じくそのままaddできる
+		if stat, err := os.Lstat(absPath); err == nil {
+			relPath := filepath.Clean(path)
+			if repo.w.IsIgnored(relPath, stat.IsDir()) && !repo.i.IsIndexed(relPath) {
+				ignoredPaths = append(ignoredPaths, relPath)
+				continue
+			}
+
+			//submoduleは中身ではなくgitlinkとしてaddする
+			if stat.IsDir() && repo.w.IsNestedRepository(relPath) {
+				err = addIndex(relPath, repo)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
+			if stat.IsDir() {
+				pathList, err := repo.w.ListFiles(absPath)
+				if err != nil {
+					return err
+				}
+
+				for _, innerPath := range pathList {
+					err = addIndex(filepath.Join(path, innerPath), repo)
+					if err != nil {
+						return err
+					}
+				}
+				continue
+			}
+		}
+
 		pathList, err := repo.w.ListFiles(absPath)
 
 		if err != nil {
@@ -49,7 +121,7 @@ func StartAdd(rootPath, uName, uEmail, message string, selectedPath []string) er
 
 		if len(pathList) == 0 {
 			//file
-			err = AddIndex(path, repo)
+			err = addIndex(path, repo)
 			if err != nil {
 				return err
 			}
@@ -57,7 +129,7 @@ func StartAdd(rootPath, uName, uEmail, message string, selectedPath []string) er
 			//dir
 			for _, innerPath := range pathList {
 				relPathFromRoot := filepath.Join(path, innerPath)
-				err = AddIndex(relPathFromRoot, repo)
+				err = addIndex(relPathFromRoot, repo)
 				if err != nil {
 					return err
 				}
@@ -69,7 +141,7 @@ func StartAdd(rootPath, uName, uEmail, message string, selectedPath []string) er
 	//workspaceから削除されたファイルをindexからも削除
 	s := GenerateStatus()
 	//指定したcommitObjIdでstatusをみる
-	err := s.IntitializeStatus(repo)
+	err = s.IntitializeStatus(repo)
 	if err != nil {
 		return err
 	}
@@ -83,10 +155,51 @@ func StartAdd(rootPath, uName, uEmail, message string, selectedPath []string) er
 
 	repo.i.Write(repo.i.Path)
 
+	if len(ignoredPaths) > 0 {
+		return &errors.IgnoredPathOnAddError{
+			Message: fmt.Sprintf("The following paths are ignored by one of your .gitignore files:\n%s\n", strings.Join(ignoredPaths, "\n")),
+		}
+	}
+	if len(sparsePaths) > 0 {
+		return sparsePathError(sparsePaths)
+	}
+
 	return nil
 }
 
+//本家と同じくすでにindexにあるものはそのままにする
+//objIdは空のblobにしておき、commitするtreeには入れない
+func AddIntentToAdd(path string, repo *Repository) error {
+	if repo.i.IsIndexedFile(path) {
+		return nil
+	}
+
+	b := &con.Blob{}
+	repo.d.Store(b)
+
+	stat, err := repo.w.StatFile(path)
+	if err != nil {
+		return err
+	}
+
+	//本家と同じくstatは0のままにしてmodeだけ入れる
+	return repo.i.Add(path, b.ObjId, stat, func(path, objId string, state con.FileState) *con.Entry {
+		e := &con.Entry{
+			Mode:  data.ModeForStat(state),
+			ObjId: objId,
+			Flags: con.CreateFlags(0, path),
+			Path:  path,
+		}
+		e.SetIntentToAdd(true)
+		return e
+	})
+}
+
 func AddIndex(path string, repo *Repository) error {
+	if repo.w.IsNestedRepository(path) {
+		return AddGitlink(path, repo)
+	}
+
 	c, err := repo.w.ReadFile(path)
 
 	if err != nil {
@@ -1,7 +1,102 @@
 package src
 
-import "testing"
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
 
 func Test_DiscardConflict(t *testing.T) {
 
 }
+
+func TestAddIntentToAdd(t *testing.T) {
+	SetConfigHomeForTest(t)
+	tempPath, repo := PrepareRebaseRepo(t)
+	var buf bytes.Buffer
+
+	CommitFileForTest(t, tempPath, "hello.txt", "hello\n", "first")
+	CreateFiles(t, tempPath, "new.txt", "new\n")
+	err := StartAddWithOption(tempPath, "test", "test@example.com", "", []string{"new.txt", "hello.txt"}, &AddOption{IntentToAdd: true})
+	assert.NoError(t, err)
+
+	//中身はaddしていないので作業ディレクトリの変更として出る
+	err = StartStatus(&buf, tempPath, false)
+	assert.NoError(t, err)
+	assert.Equal(t, " A new.txt\n", buf.String())
+
+	buf.Reset()
+	err = StartStatus(&buf, tempPath, true)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), fmt.Sprintf("Changes not staged for commit:\n\t%*s%s", 20, "new file:", "new.txt"))
+	assert.NotContains(t, buf.String(), "Changes to be Commited")
+
+	buf.Reset()
+	err = StartDiff(&buf, tempPath, &DiffOption{})
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "new file mode 100644\n")
+	assert.Contains(t, buf.String(), "+new\n")
+	buf.Reset()
+	err = StartDiff(&buf, tempPath, &DiffOption{Cached: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "", buf.String())
+
+	//すでにindexにあるhello.txtはそのまま、拡張flagsがあるのでv3で書かれる
+	err = repo.i.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(3), repo.i.Version)
+	hello, ok := repo.i.EntryForPath("hello.txt")
+	assert.True(t, ok)
+	assert.False(t, hello.IsIntentToAdd())
+
+	//commitのtreeには入らない
+	CreateFiles(t, tempPath, "hello.txt", "changed\n")
+	err = StartAdd(tempPath, "test", "test@example.com", "", []string{"hello.txt"})
+	assert.NoError(t, err)
+	err = StartCommit(tempPath, "test", "test@example.com", "second", &buf)
+	assert.NoError(t, err)
+	tree, err := repo.d.LoadTreeList(ResolveForTest(t, "HEAD", repo))
+	assert.NoError(t, err)
+	_, ok = tree["new.txt"]
+	assert.False(t, ok)
+
+	//普通にaddすれば中身が入りcommitできる
+	err = StartAdd(tempPath, "test", "test@example.com", "", []string{"new.txt"})
+	assert.NoError(t, err)
+	buf.Reset()
+	err = StartStatus(&buf, tempPath, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "A  new.txt\n", buf.String())
+}
+
+func TestAddIndexVersionConfig(t *testing.T) {
+	SetConfigHomeForTest(t)
+	tempPath, repo := PrepareRebaseRepo(t)
+	var buf bytes.Buffer
+
+	err := StartConfig(tempPath, []string{"index.version", "4"}, &ConfigOption{}, &buf)
+	assert.NoError(t, err)
+	CreateFiles(t, tempPath, "hello.txt", "hello\n")
+	err = StartAdd(tempPath, "test", "test@example.com", "", []string{"."})
+	assert.NoError(t, err)
+
+	err = repo.i.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(4), repo.i.Version)
+
+	t.Setenv("GIT_INDEX_VERSION", "2")
+	CreateFiles(t, tempPath, "hello.txt", "again\n")
+	err = StartAdd(tempPath, "test", "test@example.com", "", []string{"."})
+	assert.NoError(t, err)
+	repo.i = repo.i.Clear()
+	err = repo.i.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(2), repo.i.Version)
+
+	buf.Reset()
+	err = StartStatus(&buf, tempPath, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "A  hello.txt\n", buf.String())
+}
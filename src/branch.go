@@ -6,7 +6,6 @@ import (
 	"math"
 	data "mygit/src/database"
 	con "mygit/src/database/content"
-	"path/filepath"
 	"strings"
 )
 
@@ -106,10 +105,10 @@ func formatRef(s, currentRef *data.SymRef) string {
 }
 
 func StartBranch(rootPath string, args []string, option *BranchOption, w io.Writer) error {
-	//gitPathとかdbPathはまとめた方がよさそう
-	gitPath := filepath.Join(rootPath, ".git")
-	dbPath := filepath.Join(gitPath, "objects")
-	repo := GenerateRepository(rootPath, gitPath, dbPath)
+	repo, err := DiscoverRepository(rootPath)
+	if err != nil {
+		return err
+	}
 
 	if option.HasD {
 		err := DeleteBranches(rootPath, args, option, repo, w)
@@ -128,7 +127,7 @@ func StartBranch(rootPath string, args []string, option *BranchOption, w io.Writ
 		if err != nil {
 			return err
 		}
-		err = repo.r.CreateBranch(branchName, startObjId)
+		err = repo.r.WithReason("branch: Created from HEAD").CreateBranch(branchName, startObjId)
 		if err != nil {
 			return err
 		}
@@ -146,7 +145,7 @@ func StartBranch(rootPath string, args []string, option *BranchOption, w io.Writ
 			return err
 		}
 
-		err = repo.r.CreateBranch(branchName, startObjId)
+		err = repo.r.WithReason(fmt.Sprintf("branch: Created from %s", start_point)).CreateBranch(branchName, startObjId)
 		if err != nil {
 			return err
 		}
@@ -6,14 +6,13 @@ import (
 	"mygit/src/database"
 	con "mygit/src/database/content"
 	"mygit/src/database/lock"
-	"path/filepath"
 )
 
 func StartCheckout(rootPath string, args []string, w io.Writer) error {
-	gitPath := filepath.Join(rootPath, ".git")
-	dbPath := filepath.Join(gitPath, "objects")
-	indexPath := filepath.Join(gitPath, "index")
-	repo := GenerateRepository(rootPath, gitPath, dbPath)
+	repo, err := DiscoverWorkTree(rootPath)
+	if err != nil {
+		return err
+	}
 
 	target := args[0]
 
@@ -26,7 +25,7 @@ func StartCheckout(rootPath string, args []string, w io.Writer) error {
 		return err
 	}
 
-	l := lock.NewFileLock(indexPath)
+	l := lock.NewFileLock(repo.i.Path)
 	l.Lock()
 	defer l.Unlock()
 
@@ -63,7 +62,7 @@ func StartCheckout(rootPath string, args []string, w io.Writer) error {
 		return err
 	}
 	//updateHeadと、indexとworkspaceの違いがないかをtest
-	err = repo.r.SetHead(target, targetObjId)
+	err = repo.r.WithReason(CheckoutReflogMessage(currentRef, currentObjId, target)).SetHead(target, targetObjId)
 	if err != nil {
 		return err
 	}
@@ -88,6 +87,16 @@ func StartCheckout(rootPath string, args []string, w io.Writer) error {
 	return nil
 }
 
+//checkout: moving from master to xxx、detachedの時はfromにobjIdを書く
+func CheckoutReflogMessage(currentRef *database.SymRef, currentObjId, target string) string {
+	from := currentRef.ShortName()
+	if currentRef.IsHead() {
+		from = currentObjId
+	}
+
+	return fmt.Sprintf("checkout: moving from %s to %s", from, target)
+}
+
 func PrintPreviousHead(currentObjId, targetObjId string, currentRef *database.SymRef, repo *Repository, w io.Writer) error {
 	//previousHeadはHEADがdirectCommitのときで、HEADが指しているCommitを離れてしまうと参照が難しくなるから
 	if currentRef.IsHead() && currentObjId != targetObjId {
@@ -79,7 +79,7 @@ func TestPrintDetach(t *testing.T) {
 
 	is := []string{tempPath}
 	var buf bytes.Buffer
-	err = StartInit(is, &buf)
+	err = StartInit(is, &InitOption{}, &buf)
 	assert.NoError(t, err)
 	ss := []string{"."}
 	err = StartAdd(tempPath, "test", "test@example.com", "test", ss)
@@ -143,7 +143,7 @@ func TestPrintPreviousHead(t *testing.T) {
 
 	is := []string{tempPath}
 	var buf bytes.Buffer
-	err = StartInit(is, &buf)
+	err = StartInit(is, &InitOption{}, &buf)
 	assert.NoError(t, err)
 	ss := []string{"."}
 	err = StartAdd(tempPath, "test", "test@example.com", "test", ss)
@@ -201,3 +201,60 @@ func TestPrintPreviousHead(t *testing.T) {
 	assert.Equal(t, bufp.String()+"Switched to branch 'to'\n", str)
 
 }
+
+func TestCheckoutSymlink(t *testing.T) {
+	fn := Prepare(t)
+	t.Cleanup(fn)
+
+	curDir, err := os.Getwd()
+	assert.NoError(t, err)
+	rootPath := filepath.Join(curDir, "tempDir")
+	helloPath := filepath.Join(rootPath, "hello.txt")
+	linkPath := filepath.Join(rootPath, "link")
+
+	//hello.txtをsymlinkに置き換え、dirへのsymlinkも足す
+	err = os.Remove(helloPath)
+	assert.NoError(t, err)
+	err = os.Symlink("xxx/dummy.txt", helloPath)
+	assert.NoError(t, err)
+	err = os.Symlink("xxx", linkPath)
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	err = StartAdd(rootPath, "test", "test@example.com", "test", []string{"."})
+	assert.NoError(t, err)
+	err = StartCommit(rootPath, "test", "test@example.com", "symlink", &buf)
+	assert.NoError(t, err)
+
+	err = StartCheckout(rootPath, []string{"master^"}, &buf)
+	assert.NoError(t, err)
+
+	stat, err := os.Lstat(helloPath)
+	assert.NoError(t, err)
+	assert.True(t, stat.Mode().IsRegular())
+	_, err = os.Lstat(linkPath)
+	assert.True(t, os.IsNotExist(err))
+
+	statusBuf := new(bytes.Buffer)
+	err = StartStatus(statusBuf, rootPath, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "", statusBuf.String())
+
+	//戻すと本物のsymlinkができる
+	err = StartCheckout(rootPath, []string{"master"}, &buf)
+	assert.NoError(t, err)
+
+	for path, target := range map[string]string{helloPath: "xxx/dummy.txt", linkPath: "xxx"} {
+		stat, err := os.Lstat(path)
+		assert.NoError(t, err)
+		assert.True(t, stat.Mode()&os.ModeSymlink != 0)
+		actual, err := os.Readlink(path)
+		assert.NoError(t, err)
+		assert.Equal(t, target, actual)
+	}
+
+	statusBuf = new(bytes.Buffer)
+	err = StartStatus(statusBuf, rootPath, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "", statusBuf.String())
+}
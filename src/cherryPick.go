@@ -6,7 +6,6 @@ import (
 	"io"
 	con "mygit/src/database/content"
 	ers "mygit/src/errors"
-	"path/filepath"
 	"strings"
 )
 
@@ -107,10 +106,9 @@ func RunPick(c *con.CommitFromMem, sd *SequenceData) error {
 		return HandleConflict(c.Message, PEDING_CHERRY_PICK_TYPE, c, m, sd)
 	}
 
-	pickedCommit, err := CreateCommit(
+	pickedCommit, err := CreateCommitWithAuthor(
 		[]string{m.leftObjId},
-		c.Author.Name,
-		c.Author.Email,
+		c.Author,
 		c.Message,
 		sd.repo,
 	)
@@ -180,7 +178,7 @@ func (ch *CherryPick) ContinueWriteCommit(sd *SequenceData) error {
 
 	parents := []string{headObjId}
 
-	pickedCommit, err := CreateCommit(parents, c.Author.Name, c.Author.Email, CHERRY_PICK_MESSAGE, sd.repo)
+	pickedCommit, err := CreateCommitWithAuthor(parents, c.Author, CHERRY_PICK_MESSAGE, sd.repo)
 	if err != nil {
 		return err
 	}
@@ -199,9 +197,10 @@ func (ch *CherryPick) ContinueWriteCommit(sd *SequenceData) error {
 }
 
 func StartCherryPick(rootPath string, args []string, option *SequenceOption, w io.Writer) error {
-	gitPath := filepath.Join(rootPath, ".git")
-	dbPath := filepath.Join(gitPath, "objects")
-	repo := GenerateRepository(rootPath, gitPath, dbPath)
+	repo, err := DiscoverWorkTree(rootPath)
+	if err != nil {
+		return err
+	}
 
 	seq := GenerateSequencer(repo)
 	pc := GeneratePendingCommit(repo.r.Path)
@@ -36,7 +36,7 @@ func PrepareCherryPick(t *testing.T) string {
 
 	//A
 	var buf bytes.Buffer
-	err = StartInit(is, &buf)
+	err = StartInit(is, &InitOption{}, &buf)
 	assert.NoError(t, err)
 	ss := []string{"."}
 	err = StartAdd(tempPath, "test", "test@example.com", "test", ss)
@@ -169,7 +169,7 @@ func PrepareCherryPickConflict(t *testing.T) string {
 
 	//A
 	var buf bytes.Buffer
-	err = StartInit(is, &buf)
+	err = StartInit(is, &InitOption{}, &buf)
 	assert.NoError(t, err)
 	ss := []string{"."}
 	err = StartAdd(tempPath, "test", "test@example.com", "test", ss)
@@ -302,7 +302,7 @@ func PrepareAfterCherryPickConflict(t *testing.T) string {
 
 	//A
 	var buf bytes.Buffer
-	err = StartInit(is, &buf)
+	err = StartInit(is, &InitOption{}, &buf)
 	assert.NoError(t, err)
 	ss := []string{"."}
 	err = StartAdd(tempPath, "test", "test@example.com", "test", ss)
@@ -469,7 +469,7 @@ func PrepareRangeCherryPickConflict(t *testing.T) string {
 
 	//A
 	var buf bytes.Buffer
-	err = StartInit(is, &buf)
+	err = StartInit(is, &InitOption{}, &buf)
 	assert.NoError(t, err)
 	ss := []string{"."}
 	err = StartAdd(tempPath, "test", "test@example.com", "test", ss)
@@ -655,7 +655,7 @@ func PrepareAfterRangeCherryPickConflict(t *testing.T) string {
 
 	//A
 	var buf bytes.Buffer
-	err = StartInit(is, &buf)
+	err = StartInit(is, &InitOption{}, &buf)
 	assert.NoError(t, err)
 	ss := []string{"."}
 	err = StartAdd(tempPath, "test", "test@example.com", "test", ss)
@@ -801,7 +801,7 @@ func TestRangeCherryPickQuit(t *testing.T) {
 	//Conflictしたままの状態なこと
 	fContent, err := ioutil.ReadFile(filepath.Join(tempPath, "f.txt"))
 	assert.NoError(t, err)
-	expected := fmt.Sprintf("<<<<<<< HEAD\n3\n\n=======\n5\n\n>>>>>>> %s... commitE\n", shortObjIdcommitE)
+	expected := fmt.Sprintf("<<<<<<< HEAD\n3\n=======\n5\n>>>>>>> %s... commitE\n", shortObjIdcommitE)
 	if diff := cmp.Diff(expected, string(fContent)); diff != "" {
 		t.Errorf("diff is %s\n", diff)
 	}
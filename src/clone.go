@@ -0,0 +1,242 @@
+package src
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	data "mygit/src/database"
+	"mygit/src/database/lock"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//initしてoriginを登録し、fetchしてからremoteのHEADが指すbranchをcheckoutする
+
+var ErrorCloneDestinationExists = errors.New("destination path already exists and is not an empty directory")
+
+var EmptyCloneMessage = "warning: You appear to have cloned an empty repository.\n"
+
+func StartClone(args []string, w io.Writer) error {
+	if len(args) == 0 {
+		return ErrorRemoteUrlRequired
+	}
+	url := args[0]
+
+	dir := ""
+	if len(args) > 1 {
+		dir = args[1]
+	} else {
+		dir = cloneDirName(url)
+	}
+
+	rootPath, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+
+	//localのpathは作業ディレクトリが変わっても辿れるように絶対pathで登録する
+	if _, isSSH := ParseSSHURL(url); !isSSH && !strings.Contains(url, "://") {
+		url, err = filepath.Abs(url)
+		if err != nil {
+			return err
+		}
+	}
+
+	return RunClone(url, rootPath, w)
+}
+
+var ErrorRemoteUrlRequired = errors.New("You must specify a repository to clone.")
+
+//本家と同じく/path/to/repo.gitならrepoにする
+func cloneDirName(url string) string {
+	if remote, ok := ParseSSHURL(url); ok {
+		url = remote.Path
+	}
+	name := filepath.Base(strings.TrimRight(strings.TrimPrefix(url, FILE_URL_PREFIX), "/"))
+	name = strings.TrimSuffix(name, ".git")
+	if name == "" || name == "." || name == "/" {
+		return "repo"
+	}
+
+	return name
+}
+
+func RunClone(url, rootPath string, w io.Writer) error {
+	return RunCloneWithGitPath(url, rootPath, filepath.Join(rootPath, ".git"), w)
+}
+
+//submoduleのように.gitを作業ディレクトリの外に置くときは、作業ディレクトリの.gitをgitfileにする
+func RunCloneWithGitPath(url, rootPath, gitPath string, w io.Writer) error {
+	if files, err := ioutil.ReadDir(rootPath); err == nil && len(files) != 0 {
+		return fmt.Errorf("'%s' %w", rootPath, ErrorCloneDestinationExists)
+	}
+
+	err := os.MkdirAll(rootPath, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	w.Write([]byte(fmt.Sprintf("Cloning into '%s'...\n", filepath.Base(rootPath))))
+
+	err = gitInit(gitPath, ioutil.Discard)
+	if err != nil {
+		return err
+	}
+	if dotGit := filepath.Join(rootPath, ".git"); gitPath != dotGit {
+		err = writeGitFile(dotGit, gitPath, rootPath)
+		if err != nil {
+			return err
+		}
+	}
+	repo := GenerateRepository(rootPath, gitPath, filepath.Join(gitPath, "objects"))
+
+	err = AddRemote(DEFAULT_REMOTE, url, repo)
+	if err != nil {
+		return err
+	}
+	remote, err := LoadRemote(DEFAULT_REMOTE, repo)
+	if err != nil {
+		return err
+	}
+
+	err = adoptRemoteObjectFormat(remote, repo)
+	if err != nil {
+		return err
+	}
+
+	refs, err := RunFetch(remote, repo, ioutil.Discard)
+	if err != nil {
+		return err
+	}
+
+	var head *RemoteRef
+	for _, ref := range refs {
+		if ref.Name == "HEAD" {
+			head = ref
+		}
+	}
+
+	if head == nil {
+		w.Write([]byte(EmptyCloneMessage))
+		return nil
+	}
+
+	return checkoutClonedHead(remote, head, repo)
+}
+
+//本家と同じく相対pathで書き、gitPathの方にはcore.worktreeで作業ディレクトリを書く
+func writeGitFile(dotGit, gitPath, rootPath string) error {
+	rel, err := filepath.Rel(rootPath, gitPath)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(dotGit, []byte(GITFILE_PREFIX+filepath.ToSlash(rel)+"\n"), 0644)
+	if err != nil {
+		return err
+	}
+
+	c := data.GenerateConfig(filepath.Join(gitPath, "config"))
+	err = c.Load()
+	if err != nil {
+		return err
+	}
+	workTree, err := filepath.Rel(gitPath, rootPath)
+	if err != nil {
+		return err
+	}
+	c.Set("core", "", "worktree", filepath.ToSlash(workTree))
+
+	return c.Save()
+}
+
+//本家と同じくcloneしたrepositoryはremoteと同じobjectFormatにする
+func adoptRemoteObjectFormat(remote *Remote, repo *Repository) error {
+	t, err := OpenTransport(remote.URL, repo)
+	if err != nil {
+		return err
+	}
+	if _, err := t.ListRefs(); err != nil {
+		return err
+	}
+
+	h := t.ObjectFormat()
+	if h == repo.Hash() {
+		return nil
+	}
+	if err := writeObjectFormat(repo.r.Path, h); err != nil {
+		return err
+	}
+	repo.SetHash(h)
+
+	return nil
+}
+
+func checkoutClonedHead(remote *Remote, head *RemoteRef, repo *Repository) error {
+	refs := repo.r.WithReason(fmt.Sprintf("clone: from %s", remote.URL))
+
+	if head.Target == "" {
+		//remoteのHEADがdetachedならそのcommitにdetachする
+		err := refs.SetHead(head.ObjId, head.ObjId)
+		if err != nil {
+			return err
+		}
+	} else {
+		branch := strings.TrimPrefix(head.Target, "refs/heads/")
+
+		//initで作ったmasterと違うbranchならbranchを作ってからHEADを付け替える
+		if branch != DEFAULT_BRANCH {
+			os.Remove(filepath.Join(repo.r.HeadsPath(), DEFAULT_BRANCH))
+			err := refs.UpdateRef(head.Target, head.ObjId)
+			if err != nil {
+				return err
+			}
+			err = refs.SetHead(branch, head.ObjId)
+			if err != nil {
+				return err
+			}
+		} else {
+			_, err := refs.UpdateHead(head.ObjId)
+			if err != nil {
+				return err
+			}
+		}
+
+		if tracking, ok := remote.TrackingRef(head.Target); ok {
+			err := refs.SetSymRef(remote.TrackingHeadName(), tracking)
+			if err != nil {
+				return err
+			}
+		}
+
+		c, err := LoadConfig(repo)
+		if err != nil {
+			return err
+		}
+		c.Set(BRANCH_SECTION, branch, "remote", remote.Name)
+		c.Set(BRANCH_SECTION, branch, "merge", head.Target)
+		err = c.Save()
+		if err != nil {
+			return err
+		}
+	}
+
+	l := lock.NewFileLock(repo.i.Path)
+	l.Lock()
+	defer l.Unlock()
+
+	//空のworkspaceからのcheckoutと同じ
+	trDiff := GenerateTreeDiff(repo)
+	err := trDiff.CompareObjId("", head.ObjId)
+	if err != nil {
+		return err
+	}
+
+	err = GenerateMigration(trDiff, repo).ApplyChanges()
+	if err != nil {
+		return err
+	}
+
+	return repo.i.Write(repo.i.Path)
+}
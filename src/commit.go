@@ -5,10 +5,28 @@ import (
 	"io"
 	con "mygit/src/database/content"
 	ers "mygit/src/errors"
-	"path/filepath"
+	"strings"
 )
 
-func RunCommit(uName, uEmail, message string, pc *PendingCommit, repo *Repository, w io.Writer) error {
+type CommitOption struct {
+	//-S、指定がなくてもcommit.gpgSignがtrueなら署名する
+	Sign bool
+}
+
+func (o *CommitOption) shouldSign(repo *Repository) (bool, error) {
+	if o.Sign {
+		return true, nil
+	}
+
+	cs, err := repo.Config()
+	if err != nil {
+		return false, err
+	}
+
+	return cs.CommitGpgSign()
+}
+
+func RunCommit(uName, uEmail, message string, option *CommitOption, pc *PendingCommit, repo *Repository, w io.Writer) error {
 	if pc.InProgress() {
 		return ResumeMerge(uName, uEmail, PENDING_MERGE_TYPE, pc, repo)
 
@@ -19,7 +37,7 @@ func RunCommit(uName, uEmail, message string, pc *PendingCommit, repo *Repositor
 		return err
 	}
 
-	err = ProcessCommit([]string{parent}, uName, uEmail, message, repo)
+	err = ProcessCommit([]string{parent}, uName, uEmail, message, option, repo)
 	if err != nil {
 		return err
 	}
@@ -28,20 +46,34 @@ func RunCommit(uName, uEmail, message string, pc *PendingCommit, repo *Repositor
 }
 
 func StartCommit(rootPath, uName, uEmail, message string, w io.Writer) error {
-	gitPath := filepath.Join(rootPath, ".git")
-	dbPath := filepath.Join(gitPath, "objects")
+	return StartCommitWithOption(rootPath, uName, uEmail, message, &CommitOption{}, w)
+}
 
-	repo := GenerateRepository(rootPath, gitPath, dbPath)
+func StartCommitWithOption(rootPath, uName, uEmail, message string, option *CommitOption, w io.Writer) error {
+	repo, err := DiscoverWorkTree(rootPath)
+	if err != nil {
+		return err
+	}
+	uName, uEmail, err = repo.Identity(uName, uEmail)
+	if err != nil {
+		return err
+	}
 
-	err := repo.i.Load()
+	err = repo.i.Load()
 	if err != nil {
 		return err
 	}
 
 	//conflictのあとはadd . -> merge --c or commitで解消する、commitの時はこっち
-	pc := GeneratePendingCommit(gitPath)
+	pc := GeneratePendingCommit(repo.r.Path)
 
-	return ers.HandleWillWriteError(RunCommit(uName, uEmail, message, pc, repo, w), w)
+	err = RunCommit(uName, uEmail, message, option, pc, repo, w)
+	if err != nil {
+		return ers.HandleWillWriteError(err, w)
+	}
+
+	//commitの時に作ったcache treeを次のcommitで使えるようにindexに残す
+	return repo.i.Write(repo.i.Path)
 }
 
 var CONFLICT_MESSAGE = `hint: Fix them up in the work tree, and then use 'mygit add/rm <file>'
@@ -132,7 +164,7 @@ func WriteMergeCommit(name, email string, pc *PendingCommit, repo *Repository) e
 		return err
 	}
 
-	err = ProcessCommit([]string{head, mergeObjId}, name, email, mergeMessage, repo)
+	err = ProcessCommit([]string{head, mergeObjId}, name, email, mergeMessage, &CommitOption{}, repo)
 	if err != nil {
 		return err
 	}
@@ -207,20 +239,49 @@ func ResumeMerge(name, email string, pendingType PendingType, pc *PendingCommit,
 }
 
 func CreateCommit(parents []string, name, email, message string, repo *Repository) (*con.Commit, error) {
+	author, err := AuthorSignature(name, email)
+	if err != nil {
+		return nil, err
+	}
+	committer, err := repo.CommitterSignature(name, email)
+	if err != nil {
+		return nil, err
+	}
+
+	return createCommit(parents, author, committer, message, repo)
+}
+
+//rebaseやcherry-pickでは元のcommitのauthorを日時ごと引き継ぎ、committerだけ新しくする
+func CreateCommitWithAuthor(parents []string, author *con.Author, message string, repo *Repository) (*con.Commit, error) {
+	committer, err := repo.CommitterSignature(author.Name, author.Email)
+	if err != nil {
+		return nil, err
+	}
 
+	return createCommit(parents, author, committer, message, repo)
+}
+
+func createCommit(parents []string, author, committer *con.Author, message string, repo *Repository) (*con.Commit, error) {
 	t, err := CreateTree(repo)
 	if err != nil {
 		return nil, err
 	}
 
-	author := con.GenerateAuthor(name, email)
+	//root commitの時は""が渡されるので除く
+	var nonEmptyParents []string
+	for _, p := range parents {
+		if p != "" {
+			nonEmptyParents = append(nonEmptyParents, p)
+		}
+	}
 
 	commit := &con.Commit{
-		ObjId:   t.GetObjId(),
-		Parents: parents,
-		Tree:    t,
-		Author:  author,
-		Message: message,
+		ObjId:     t.GetObjId(),
+		Parents:   nonEmptyParents,
+		Tree:      t,
+		Author:    author,
+		Committer: committer,
+		Message:   message,
 	}
 
 	return commit, nil
@@ -244,18 +305,43 @@ func WriteCommit(c *con.Commit, repo *Repository) error {
 
 	repo.d.Store(c)
 
-	_, err := repo.r.UpdateHead(c.ObjId)
+	_, err := repo.r.WithIdentity(c.Author.Name, c.Author.Email).WithReason(CommitReflogMessage(c)).UpdateHead(c.ObjId)
 
 	return err
 
 }
 
+//本家と同じくroot commitとmerge commitは区別して書く
+//ParentsはCreateCommitで""を除いてあるのでそのまま数える
+func CommitReflogMessage(c *con.Commit) string {
+	subject := strings.Split(c.Message, "\n")[0]
+
+	switch len(c.Parents) {
+	case 0:
+		return fmt.Sprintf("commit (initial): %s", subject)
+	case 1:
+		return fmt.Sprintf("commit: %s", subject)
+	default:
+		return fmt.Sprintf("commit (merge): %s", subject)
+	}
+}
+
 //ProccessCommitはCreateCommit,WriteCommit,PrintCommitをまとめたもの
-func ProcessCommit(parents []string, name, email, message string, repo *Repository) error {
+func ProcessCommit(parents []string, name, email, message string, option *CommitOption, repo *Repository) error {
 	c, err := CreateCommit(parents, name, email, message, repo)
 	if err != nil {
 		return err
 	}
+
+	sign, err := option.shouldSign(repo)
+	if err != nil {
+		return err
+	}
+	if sign {
+		if err := repo.SignCommit(c); err != nil {
+			return err
+		}
+	}
 	err = WriteCommit(c, repo)
 	if err != nil {
 		return err
@@ -274,14 +360,63 @@ func CreateTree(repo *Repository) (*con.Tree, error) {
 		return nil, err
 	}
 
-	t.Build(es)
+	//indexのcache treeで変わっていないとわかるdirectoryはentryから作り直さずにobjIdをそのまま使う
+	cached := repo.i.CachedSubtrees()
+	for dir, objId := range cached {
+		if !repo.d.HasObject(objId) {
+			delete(cached, dir)
+		}
+	}
+
+	//add -Nしただけのものはcommitしない
+	var committed []*con.Entry
+	reused := make(map[string]struct{})
+	for _, e := range es {
+		if e.IsIntentToAdd() {
+			continue
+		}
+
+		if dir, ok := cachedParent(e, cached); ok {
+			if _, ok := reused[dir]; !ok {
+				reused[dir] = struct{}{}
+				committed = append(committed, &con.Entry{
+					ObjId: cached[dir],
+					Mode:  con.ModeToInt(con.DIRECTORY_MODE),
+					Path:  dir,
+				})
+			}
+			continue
+		}
+		committed = append(committed, e)
+	}
+
+	t.Build(committed)
 
 	return t, nil
 }
 
-func WriteTree(t *con.Tree, repo *Repository) {
+func cachedParent(e *con.Entry, cached map[string]string) (string, bool) {
+	if len(cached) == 0 {
+		return "", false
+	}
+	//浅いdirectoryから見る
+	for _, dir := range e.ParentDirs(e.Path) {
+		if _, ok := cached[dir]; ok {
+			return dir, true
+		}
+	}
+	return "", false
+}
+
+//作り直したtreeだけをstoreし、そのobjIdでindexのcache treeを更新する
+func StoreTree(t *con.Tree, repo *Repository) {
 	t.Traverse(func(t *con.Tree) {
 		repo.d.Store(t)
 	})
+	repo.i.UpdateCacheTree(t)
+}
+
+func WriteTree(t *con.Tree, repo *Repository) {
+	StoreTree(t, repo)
 	fmt.Printf("tree: %s\n", t.GetObjId())
 }
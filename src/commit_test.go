@@ -1,6 +1,8 @@
 package src
 
 import (
+	"bytes"
+	con "mygit/src/database/content"
 	"os"
 	"path/filepath"
 	"testing"
@@ -104,3 +106,130 @@ func CreateFiles(t *testing.T, dir string, name string, content string) string {
 // 	assert.NoError(t, err)
 
 // }
+
+func TestCommitSignatureFromEnv(t *testing.T) {
+	SetConfigHomeForTest(t)
+	tempPath, repo := PrepareRebaseRepo(t)
+	var buf bytes.Buffer
+
+	err := StartConfig(tempPath, []string{"user.name", "Config User"}, &ConfigOption{Global: true}, &buf)
+	assert.NoError(t, err)
+	t.Setenv("GIT_AUTHOR_DATE", "1700000000 +0900")
+	t.Setenv("GIT_COMMITTER_EMAIL", "committer@example.com")
+	t.Setenv("GIT_COMMITTER_DATE", "@1700000100 -0500")
+
+	CommitFileForTest(t, tempPath, "hello.txt", "hello\n", "first")
+	head := ReadCommitForTest(t, "HEAD", repo)
+
+	//--nameの指定がconfigより優先、環境変数はさらに優先
+	assert.Equal(t, 0, len(head.Parents))
+	assert.Equal(t, "test", head.Author.Name)
+	assert.Equal(t, "test@example.com", head.Author.Email)
+	assert.Equal(t, "1700000000 +0900", head.Author.CreatedAt)
+	assert.Equal(t, "test", head.Committer.Name)
+	assert.Equal(t, "committer@example.com", head.Committer.Email)
+	assert.Equal(t, "1700000100 -0500", head.Committer.CreatedAt)
+	assert.Contains(t, head.ToString(), "\ncommitter test <committer@example.com> 1700000100 -0500\n")
+
+	//--nameがなければconfigを使う
+	CreateFiles(t, tempPath, "hello.txt", "config\n")
+	err = StartAdd(tempPath, "test", "test@example.com", "", []string{"hello.txt"})
+	assert.NoError(t, err)
+	err = StartCommit(tempPath, "", "test@example.com", "config", &buf)
+	assert.NoError(t, err)
+	head = ReadCommitForTest(t, "HEAD", repo)
+	assert.Equal(t, "Config User", head.Author.Name)
+	assert.Equal(t, "Config User", head.Committer.Name)
+
+	t.Setenv("GIT_AUTHOR_DATE", "someday")
+	CreateFiles(t, tempPath, "hello.txt", "again\n")
+	err = StartAdd(tempPath, "test", "test@example.com", "", []string{"hello.txt"})
+	assert.NoError(t, err)
+	err = StartCommit(tempPath, "test", "test@example.com", "second", &buf)
+	assert.ErrorIs(t, err, con.ErrorInvalidDate)
+}
+
+func TestCommitCacheTree(t *testing.T) {
+	SetConfigHomeForTest(t)
+	tempPath, repo := PrepareRebaseRepo(t)
+	var buf bytes.Buffer
+
+	err := os.MkdirAll(filepath.Join(tempPath, "a", "b"), os.ModePerm)
+	assert.NoError(t, err)
+	err = os.MkdirAll(filepath.Join(tempPath, "x"), os.ModePerm)
+	assert.NoError(t, err)
+	CreateFiles(t, filepath.Join(tempPath, "a", "b"), "c.txt", "c\n")
+	CreateFiles(t, filepath.Join(tempPath, "a"), "e.txt", "e\n")
+	CreateFiles(t, filepath.Join(tempPath, "x"), "y.txt", "y\n")
+	CreateFiles(t, tempPath, "f.txt", "f\n")
+	err = StartAdd(tempPath, "test", "test@example.com", "", []string{"."})
+	assert.NoError(t, err)
+	err = StartCommit(tempPath, "test", "test@example.com", "first", &buf)
+	assert.NoError(t, err)
+
+	//commitしたtreeがindexに残る
+	err = repo.i.Load()
+	assert.NoError(t, err)
+	head := ReadCommitForTest(t, "HEAD", repo)
+	assert.True(t, repo.i.CacheTree.IsValid())
+	assert.Equal(t, head.Tree, repo.i.CacheTree.ObjId)
+	assert.Equal(t, 4, repo.i.CacheTree.EntryCount)
+	assert.Equal(t, 1, repo.i.CacheTree.Find("a/b").EntryCount)
+
+	//変えたxだけが作り直され、aはcacheのobjIdを使う
+	CreateFiles(t, filepath.Join(tempPath, "x"), "y.txt", "changed\n")
+	err = StartAdd(tempPath, "test", "test@example.com", "", []string{"."})
+	assert.NoError(t, err)
+	repo.i = repo.i.Clear()
+	err = repo.i.Load()
+	assert.NoError(t, err)
+	assert.False(t, repo.i.CacheTree.IsValid())
+	assert.False(t, repo.i.CacheTree.Find("x").IsValid())
+	assert.True(t, repo.i.CacheTree.Find("a").IsValid())
+
+	tree, err := CreateTree(repo)
+	assert.NoError(t, err)
+	_, reused := tree.Entries["a"].(*con.Entry)
+	assert.True(t, reused)
+	_, rebuilt := tree.Entries["x"].(*con.Tree)
+	assert.True(t, rebuilt)
+
+	err = StartCommit(tempPath, "test", "test@example.com", "second", &buf)
+	assert.NoError(t, err)
+
+	//cacheを使わずに作ったtreeと同じになる
+	repo.i = repo.i.Clear()
+	err = repo.i.Load()
+	assert.NoError(t, err)
+	head = ReadCommitForTest(t, "HEAD", repo)
+	assert.Equal(t, head.Tree, repo.i.CacheTree.ObjId)
+	repo.i.CacheTree = nil
+	full, err := CreateTree(repo)
+	assert.NoError(t, err)
+	full.Traverse(func(t *con.Tree) {
+		repo.d.Store(t)
+	})
+	assert.Equal(t, head.Tree, full.GetObjId())
+
+	//add -Nしたものがあるdirectoryは無効のまま
+	CreateFiles(t, filepath.Join(tempPath, "a"), "new.txt", "new\n")
+	err = StartAddWithOption(tempPath, "test", "test@example.com", "", []string{"a/new.txt"}, &AddOption{IntentToAdd: true})
+	assert.NoError(t, err)
+	CreateFiles(t, tempPath, "f.txt", "changed\n")
+	err = StartAdd(tempPath, "test", "test@example.com", "", []string{"f.txt"})
+	assert.NoError(t, err)
+	err = StartCommit(tempPath, "test", "test@example.com", "third", &buf)
+	assert.NoError(t, err)
+
+	repo.i = repo.i.Clear()
+	err = repo.i.Load()
+	assert.NoError(t, err)
+	assert.False(t, repo.i.CacheTree.IsValid())
+	assert.False(t, repo.i.CacheTree.Find("a").IsValid())
+	assert.True(t, repo.i.CacheTree.Find("a/b").IsValid())
+	assert.True(t, repo.i.CacheTree.Find("x").IsValid())
+	list, err := repo.d.LoadTreeList(ResolveForTest(t, "HEAD", repo))
+	assert.NoError(t, err)
+	_, ok := list["a/new.txt"]
+	assert.False(t, ok)
+}
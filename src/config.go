@@ -0,0 +1,279 @@
+package src
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	data "mygit/src/database"
+	con "mygit/src/database/content"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+//mgit config --get/--set/--unset/--listでsystem,global,localのconfigを読み書きする
+//scopeの指定がなければ読む時は全部を重ねたもの、書く時は.git/configを使う
+
+type ConfigOption struct {
+	Get    bool
+	Set    bool
+	Unset  bool
+	List   bool
+	Global bool
+	System bool
+	Local  bool
+}
+
+var (
+	ErrorConfigKeyNotFound = errors.New("config key not found")
+	ErrorUnknownConfigCmd  = errors.New("unknown config usage")
+	ErrorAliasLoop         = errors.New("alias loop detected")
+)
+
+//aliasの展開を何回まで続けるか
+const MAX_ALIAS_DEPTH = 16
+
+//system,global,.git/configを重ねたもの
+func (repo *Repository) Config() (*data.ConfigStack, error) {
+	return data.LoadConfigStack(repo.r.Path)
+}
+
+//--nameや--emailで指定がなければuser.name,user.emailを使う
+func (repo *Repository) Identity(name, email string) (string, string, error) {
+	if name != "" && email != "" {
+		return name, email, nil
+	}
+
+	cs, err := repo.Config()
+	if err != nil {
+		return "", "", err
+	}
+	if name == "" {
+		name = cs.UserName()
+	}
+	if email == "" {
+		email = cs.UserEmail()
+	}
+
+	return name, email, nil
+}
+
+//GIT_AUTHOR_NAME,GIT_AUTHOR_EMAIL,GIT_AUTHOR_DATEがあればそちらを優先する
+func AuthorSignature(name, email string) (*con.Author, error) {
+	return signatureFromEnv("AUTHOR", name, email)
+}
+
+//本家と同じくcommitterはGIT_COMMITTER_*,--name/--email,user.name/user.emailの順に決める
+func (repo *Repository) CommitterSignature(name, email string) (*con.Author, error) {
+	name, email, err := repo.Identity(name, email)
+	if err != nil {
+		return nil, err
+	}
+
+	return signatureFromEnv("COMMITTER", name, email)
+}
+
+func signatureFromEnv(role, name, email string) (*con.Author, error) {
+	if v := os.Getenv(fmt.Sprintf("GIT_%s_NAME", role)); v != "" {
+		name = v
+	}
+	if v := os.Getenv(fmt.Sprintf("GIT_%s_EMAIL", role)); v != "" {
+		email = v
+	}
+
+	date := os.Getenv(fmt.Sprintf("GIT_%s_DATE", role))
+	if date == "" {
+		return con.GenerateAuthor(name, email), nil
+	}
+
+	createdAt, err := con.ParseGitDate(date)
+	if err != nil {
+		return nil, err
+	}
+
+	return con.GenerateAuthorAt(name, email, createdAt), nil
+}
+
+func (o *ConfigOption) scope() (data.ConfigScope, bool) {
+	switch {
+	case o.System:
+		return data.SCOPE_SYSTEM, true
+	case o.Global:
+		return data.SCOPE_GLOBAL, true
+	case o.Local:
+		return data.SCOPE_LOCAL, true
+	default:
+		return "", false
+	}
+}
+
+//書き込む先のファイル
+func configPathForScope(scope data.ConfigScope, repo *Repository) (string, error) {
+	switch scope {
+	case data.SCOPE_SYSTEM:
+		return data.SystemConfigPath(), nil
+	case data.SCOPE_GLOBAL:
+		return data.GlobalConfigPath(), nil
+	default:
+		if repo == nil {
+			return "", ErrorNotAGitRepository
+		}
+		return ConfigPath(repo), nil
+	}
+}
+
+func StartConfig(rootPath string, args []string, option *ConfigOption, w io.Writer) error {
+	//global,systemだけを見るならrepositoryの外でもよい
+	repo, err := DiscoverRepository(rootPath)
+	if err != nil && !errors.Is(err, ErrorNotAGitRepository) {
+		return err
+	}
+
+	scope, hasScope := option.scope()
+
+	switch {
+	case option.List:
+		cs, err := readConfigStack(scope, hasScope, repo)
+		if err != nil {
+			return err
+		}
+		for _, v := range cs.Values {
+			w.Write([]byte(fmt.Sprintf("%s=%s\n", v.Name(), v.Value)))
+		}
+		return nil
+	case option.Unset:
+		if len(args) != 1 {
+			return ErrorUnknownConfigCmd
+		}
+		return writeConfig(args[0], scope, repo, func(c *data.Config, section, sub, key string) error {
+			if _, ok := c.Get(section, sub, key); !ok {
+				return fmt.Errorf("%s: %w", args[0], ErrorConfigKeyNotFound)
+			}
+			c.Unset(section, sub, key)
+			return nil
+		})
+	case option.Set || (!option.Get && len(args) == 2):
+		if len(args) != 2 {
+			return ErrorUnknownConfigCmd
+		}
+		return writeConfig(args[0], scope, repo, func(c *data.Config, section, sub, key string) error {
+			c.Set(section, sub, key, args[1])
+			return nil
+		})
+	case option.Get || len(args) == 1:
+		if len(args) != 1 {
+			return ErrorUnknownConfigCmd
+		}
+		section, sub, key, err := data.SplitConfigKey(args[0])
+		if err != nil {
+			return err
+		}
+		cs, err := readConfigStack(scope, hasScope, repo)
+		if err != nil {
+			return err
+		}
+		value, ok := cs.Get(section, sub, key)
+		if !ok {
+			return fmt.Errorf("%s: %w", args[0], ErrorConfigKeyNotFound)
+		}
+		w.Write([]byte(value + "\n"))
+		return nil
+	default:
+		return ErrorUnknownConfigCmd
+	}
+}
+
+func readConfigStack(scope data.ConfigScope, hasScope bool, repo *Repository) (*data.ConfigStack, error) {
+	if !hasScope {
+		gitPath := ""
+		if repo != nil {
+			gitPath = repo.r.Path
+		}
+		return data.LoadConfigStack(gitPath)
+	}
+
+	path, err := configPathForScope(scope, repo)
+	if err != nil {
+		return nil, err
+	}
+	return data.LoadConfigFile(path, scope)
+}
+
+//includeで読み込んだ先ではなく、そのscopeのファイルそのものを書き換える
+func writeConfig(name string, scope data.ConfigScope, repo *Repository, update func(c *data.Config, section, sub, key string) error) error {
+	section, sub, key, err := data.SplitConfigKey(name)
+	if err != nil {
+		return err
+	}
+
+	path, err := configPathForScope(scope, repo)
+	if err != nil {
+		return err
+	}
+
+	c := data.GenerateConfig(path)
+	if err := c.Load(); err != nil {
+		return err
+	}
+	if err := update(c, section, sub, key); err != nil {
+		return err
+	}
+
+	return c.Save()
+}
+
+//aliasを展開した結果、Shellが空でなければ"!"で始まるaliasなのでshellで動かす
+type Alias struct {
+	Args  []string
+	Shell string
+}
+
+//先頭のargがcommandでなくalias.xxxにあれば置き換える、置き換えた先がまたaliasならさらに展開する
+func ExpandAlias(rootPath string, args []string, isCommand func(name string) bool) (*Alias, error) {
+	alias := &Alias{Args: args}
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") || isCommand(args[0]) {
+		return alias, nil
+	}
+
+	gitPath := ""
+	if repo, err := DiscoverRepository(rootPath); err == nil {
+		gitPath = repo.r.Path
+	}
+	cs, err := data.LoadConfigStack(gitPath)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	for len(alias.Args) > 0 && !isCommand(alias.Args[0]) {
+		name := alias.Args[0]
+		value, ok := cs.Alias(name)
+		if !ok {
+			break
+		}
+		if seen[name] || len(seen) >= MAX_ALIAS_DEPTH {
+			return nil, fmt.Errorf("%s: %w", name, ErrorAliasLoop)
+		}
+		seen[name] = true
+
+		if strings.HasPrefix(value, "!") {
+			alias.Shell = strings.TrimPrefix(value, "!")
+			alias.Args = alias.Args[1:]
+			return alias, nil
+		}
+
+		alias.Args = append(strings.Fields(value), alias.Args[1:]...)
+	}
+
+	return alias, nil
+}
+
+//本家と同じく残りの引数は"$@"として渡す
+func RunShellAlias(shell string, args []string) error {
+	cmd := exec.Command("sh", append([]string{"-c", shell + ` "$@"`, shell}, args...)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	return cmd.Run()
+}
@@ -0,0 +1,181 @@
+package src
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//HOMEとXDG_CONFIG_HOMEを一時directoryに向け、手元のconfigを読まないようにする
+func SetConfigHomeForTest(t *testing.T) string {
+	home, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(home)
+	})
+
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_CONFIG_GLOBAL", "")
+
+	return home
+}
+
+func TestConfigLayersAndInclude(t *testing.T) {
+	home := SetConfigHomeForTest(t)
+	tempPath, repo := PrepareRebaseRepo(t)
+	var buf bytes.Buffer
+
+	global := "[user]\n\tname = Global\n[include]\n\tpath = extra.inc\n[alias]\n\tst = status\n"
+	err := ioutil.WriteFile(filepath.Join(home, ".gitconfig"), []byte(global), 0644)
+	assert.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(home, "extra.inc"), []byte("[user]\n\temail = global@example.com\n"), 0644)
+	assert.NoError(t, err)
+
+	err = StartConfig(tempPath, []string{"user.name", "Local"}, &ConfigOption{}, &buf)
+	assert.NoError(t, err)
+
+	cs, err := repo.Config()
+	assert.NoError(t, err)
+	assert.Equal(t, "Local", cs.UserName())
+	assert.Equal(t, "global@example.com", cs.UserEmail())
+
+	//scopeを指定すればそのファイルだけ見る
+	err = StartConfig(tempPath, []string{"user.name"}, &ConfigOption{Get: true, Global: true}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "Global\n", buf.String())
+
+	buf.Reset()
+	err = StartConfig(tempPath, nil, &ConfigOption{List: true}, &buf)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "user.name=Global\ninclude.path=extra.inc\nuser.email=global@example.com\nalias.st=status\n")
+	assert.Contains(t, buf.String(), "user.name=Local\n")
+
+	//--globalで書いたものは~/.gitconfigに入る
+	err = StartConfig(tempPath, []string{"core.editor", "nano -w"}, &ConfigOption{Set: true, Global: true}, &buf)
+	assert.NoError(t, err)
+	content, err := ioutil.ReadFile(filepath.Join(home, ".gitconfig"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "[core]\n\teditor = nano -w\n")
+	t.Setenv("GIT_EDITOR", "")
+	assert.Equal(t, "nano -w", CommitEditor(repo))
+}
+
+func TestConfigSetUnset(t *testing.T) {
+	SetConfigHomeForTest(t)
+	tempPath, repo := PrepareRebaseRepo(t)
+	var buf bytes.Buffer
+
+	//subsectionは大文字小文字と.を保つ
+	err := StartConfig(tempPath, []string{"branch.Feature.x.remote", "origin"}, &ConfigOption{Set: true}, &buf)
+	assert.NoError(t, err)
+	c, err := LoadConfig(repo)
+	assert.NoError(t, err)
+	v, ok := c.Get("branch", "Feature.x", "remote")
+	assert.True(t, ok)
+	assert.Equal(t, "origin", v)
+
+	err = StartConfig(tempPath, []string{"branch.Feature.x.remote"}, &ConfigOption{Unset: true}, &buf)
+	assert.NoError(t, err)
+	err = StartConfig(tempPath, []string{"branch.Feature.x.remote"}, &ConfigOption{Get: true}, &buf)
+	assert.ErrorIs(t, err, ErrorConfigKeyNotFound)
+	err = StartConfig(tempPath, []string{"branch.Feature.x.remote"}, &ConfigOption{Unset: true}, &buf)
+	assert.ErrorIs(t, err, ErrorConfigKeyNotFound)
+
+	err = StartConfig(tempPath, []string{"nosection"}, &ConfigOption{Get: true}, &buf)
+	assert.Error(t, err)
+}
+
+func TestIdentityFromConfig(t *testing.T) {
+	SetConfigHomeForTest(t)
+	tempPath, repo := PrepareRebaseRepo(t)
+	var buf bytes.Buffer
+
+	err := StartConfig(tempPath, []string{"user.name", "Config User"}, &ConfigOption{Global: true}, &buf)
+	assert.NoError(t, err)
+	err = StartConfig(tempPath, []string{"user.email", "config@example.com"}, &ConfigOption{}, &buf)
+	assert.NoError(t, err)
+
+	CreateFiles(t, tempPath, "hello.txt", "hello\n")
+	err = StartAdd(tempPath, "", "", "", []string{"hello.txt"})
+	assert.NoError(t, err)
+	err = StartCommit(tempPath, "", "", "first", &buf)
+	assert.NoError(t, err)
+
+	head := ReadCommitForTest(t, "HEAD", repo)
+	assert.Equal(t, "Config User", head.Author.Name)
+	assert.Equal(t, "config@example.com", head.Author.Email)
+
+	//--nameの指定はconfigより優先する
+	name, email, err := repo.Identity("Flag User", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "Flag User", name)
+	assert.Equal(t, "config@example.com", email)
+}
+
+func TestExpandAlias(t *testing.T) {
+	SetConfigHomeForTest(t)
+	tempPath, _ := PrepareRebaseRepo(t)
+	var buf bytes.Buffer
+
+	for _, kv := range [][]string{
+		{"alias.co", "checkout -b"},
+		{"alias.nb", "co"},
+		{"alias.hi", "!echo hi"},
+		{"alias.loop1", "loop2"},
+		{"alias.loop2", "loop1"},
+	} {
+		err := StartConfig(tempPath, kv, &ConfigOption{}, &buf)
+		assert.NoError(t, err)
+	}
+
+	isCommand := func(name string) bool {
+		return name == "checkout" || name == "status"
+	}
+
+	alias, err := ExpandAlias(tempPath, []string{"nb", "topic"}, isCommand)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"checkout", "-b", "topic"}, alias.Args)
+	assert.Equal(t, "", alias.Shell)
+
+	alias, err = ExpandAlias(tempPath, []string{"hi", "there"}, isCommand)
+	assert.NoError(t, err)
+	assert.Equal(t, "echo hi", alias.Shell)
+	assert.Equal(t, []string{"there"}, alias.Args)
+
+	//commandと同じ名前のaliasは使わない
+	alias, err = ExpandAlias(tempPath, []string{"status"}, isCommand)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"status"}, alias.Args)
+
+	_, err = ExpandAlias(tempPath, []string{"loop1"}, isCommand)
+	assert.ErrorIs(t, err, ErrorAliasLoop)
+}
+
+func TestMergeFFOnly(t *testing.T) {
+	SetConfigHomeForTest(t)
+	tempPath := PrepareMerge(t)
+	t.Cleanup(func() {
+		os.RemoveAll(tempPath)
+	})
+	var buf bytes.Buffer
+
+	err := StartConfig(tempPath, []string{"merge.ff", "only"}, &ConfigOption{}, &buf)
+	assert.NoError(t, err)
+	repo := OpenRepoForTest(tempPath)
+	head := ResolveForTest(t, "HEAD", repo)
+
+	mc := MergeCommand{RootPath: tempPath, Name: "test", Email: "test@email.com", Message: "merged", Args: []string{"test1"}}
+	err = StartMerge(mc, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, NotPossibleFastForwardMessage, buf.String())
+	assert.Equal(t, head, ResolveForTest(t, "HEAD", repo))
+
+	_, err = os.Stat(filepath.Join(tempPath, ".git", "MERGE_HEAD"))
+	assert.True(t, os.IsNotExist(err))
+}
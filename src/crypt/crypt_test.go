@@ -3,6 +3,8 @@ package crypt
 import (
 	"fmt"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func Test_SHA(t *testing.T) {
@@ -11,3 +13,18 @@ func Test_SHA(t *testing.T) {
 
 	fmt.Println(s)
 }
+
+func TestObjectFormat(t *testing.T) {
+	//git hash-objectと同じ
+	content := "blob 6\x00hello\n"
+	assert.Equal(t, "ce013625030ba8dba906f756967f9e9ca394464a", SHA1.HexDigest(content))
+	assert.Equal(t, "2cf8d83d9ee29543b34a87727421fdecb7e3f3a183d337639025de576db9ebb4", SHA256.HexDigest(content))
+	assert.Equal(t, HexDigestBySha1(content), SHA1.HexDigest(content))
+	assert.Equal(t, 64, len(SHA256.ZeroObjId()))
+
+	h, err := HashByName("SHA256")
+	assert.NoError(t, err)
+	assert.Equal(t, SHA256, h)
+	_, err = HashByName("md5")
+	assert.ErrorIs(t, err, ErrorUnknownObjectFormat)
+}
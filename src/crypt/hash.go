@@ -0,0 +1,81 @@
+package crypt
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+)
+
+//objIdを計算するhash、本家のextensions.objectFormatのsha1かsha256
+//objId,tree,index,pack,refのobjIdの長さはすべてここから決める
+type Hash interface {
+	//extensions.objectFormatに書く名前
+	Name() string
+	//binaryのbyte数、hexの文字数はその倍
+	Size() int
+	HexSize() int
+	New() hash.Hash
+	HexDigest(str string) string
+	Digest(str string) string
+	//すべて0のobjId、refの作成や削除を表す
+	ZeroObjId() string
+}
+
+type objectFormat struct {
+	name string
+	size int
+	new  func() hash.Hash
+}
+
+var (
+	SHA1   Hash = &objectFormat{name: "sha1", size: sha1.Size, new: sha1.New}
+	SHA256 Hash = &objectFormat{name: "sha256", size: sha256.Size, new: sha256.New}
+)
+
+var ErrorUnknownObjectFormat = errors.New("unknown object format")
+
+func HashByName(name string) (Hash, error) {
+	switch strings.ToLower(name) {
+	case "", SHA1.Name():
+		return SHA1, nil
+	case SHA256.Name():
+		return SHA256, nil
+	default:
+		return nil, fmt.Errorf("%s: %w", name, ErrorUnknownObjectFormat)
+	}
+}
+
+func (f *objectFormat) Name() string {
+	return f.name
+}
+
+func (f *objectFormat) Size() int {
+	return f.size
+}
+
+func (f *objectFormat) HexSize() int {
+	return 2 * f.size
+}
+
+func (f *objectFormat) New() hash.Hash {
+	return f.new()
+}
+
+func (f *objectFormat) HexDigest(str string) string {
+	return hex.EncodeToString([]byte(f.Digest(str)))
+}
+
+func (f *objectFormat) Digest(str string) string {
+	h := f.new()
+	io.WriteString(h, str)
+	return string(h.Sum(nil))
+}
+
+func (f *objectFormat) ZeroObjId() string {
+	return strings.Repeat("0", f.HexSize())
+}
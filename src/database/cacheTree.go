@@ -0,0 +1,247 @@
+package database
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mygit/src/crypt"
+	con "mygit/src/database/content"
+	dcrypt "mygit/src/database/crypt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var CACHE_TREE_SIGNATURE = "TREE"
+
+var ErrorInvalidCacheTree = errors.New("invalid cache tree")
+
+//indexのTREE拡張、directoryごとにその下のentry数とtreeのobjIdを覚えておく
+//entryが変わるとそのpathに沿ってrootまで無効になる
+type CacheTree struct {
+	Name string
+	//このdirectory以下のindexのentry数、-1なら無効でObjIdは使えない
+	EntryCount int
+	ObjId      string
+	Subtrees   []*CacheTree
+}
+
+func (c *CacheTree) IsValid() bool {
+	return 0 <= c.EntryCount
+}
+
+func (c *CacheTree) subtree(name string) *CacheTree {
+	for _, s := range c.Subtrees {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+//dirは"a/b"のようなdirectoryのpath、""ならroot
+func (c *CacheTree) Find(dir string) *CacheTree {
+	if dir == "" {
+		return c
+	}
+
+	node := c
+	for _, name := range strings.Split(dir, "/") {
+		node = node.subtree(name)
+		if node == nil {
+			return nil
+		}
+	}
+	return node
+}
+
+//fileのpathを受け取り、rootからそのfileのあるdirectoryまでを無効にする
+func (c *CacheTree) Invalidate(filePath string) {
+	c.EntryCount = -1
+
+	names := strings.Split(filePath, "/")
+	node := c
+	for _, name := range names[:len(names)-1] {
+		node = node.subtree(name)
+		if node == nil {
+			return
+		}
+		node.EntryCount = -1
+	}
+}
+
+//有効なsubtreeのうち一番浅いものをdirectoryのpath -> objIdで返す、rootは含めない
+func (c *CacheTree) ValidSubtrees() map[string]string {
+	m := make(map[string]string)
+	c.collectValidSubtrees("", m)
+	return m
+}
+
+func (c *CacheTree) collectValidSubtrees(prefix string, m map[string]string) {
+	for _, s := range c.Subtrees {
+		dir := path.Join(prefix, s.Name)
+		if s.IsValid() {
+			m[dir] = s.ObjId
+		} else {
+			s.collectValidSubtrees(dir, m)
+		}
+	}
+}
+
+//本家と同じくsubtreeは名前の長さ、名前の順に並べる
+func (c *CacheTree) sortSubtrees() {
+	sort.Slice(c.Subtrees, func(i, j int) bool {
+		a, b := c.Subtrees[i].Name, c.Subtrees[j].Name
+		if len(a) != len(b) {
+			return len(a) < len(b)
+		}
+		return a < b
+	})
+}
+
+//name NUL entry数 SP subtree数 LF objId(有効な時だけ) のあとにsubtreeを続ける
+func (c *CacheTree) Encode(buf *bytes.Buffer) {
+	buf.WriteString(c.Name)
+	buf.WriteByte(0)
+	buf.WriteString(fmt.Sprintf("%d %d\n", c.EntryCount, len(c.Subtrees)))
+	if c.IsValid() {
+		raw, _ := dcrypt.CreateH40(c.ObjId)
+		buf.WriteString(raw)
+	}
+	for _, s := range c.Subtrees {
+		s.Encode(buf)
+	}
+}
+
+func ReadCacheTree(bs []byte, h crypt.Hash) (*CacheTree, error) {
+	buf := bytes.NewBuffer(bs)
+	c, err := readCacheTreeNode(buf, h)
+	if err != nil {
+		return nil, err
+	}
+	if buf.Len() != 0 {
+		return nil, ErrorInvalidCacheTree
+	}
+	return c, nil
+}
+
+func readCacheTreeNode(buf *bytes.Buffer, h crypt.Hash) (*CacheTree, error) {
+	name, err := buf.ReadString(0)
+	if err != nil {
+		return nil, ErrorInvalidCacheTree
+	}
+	line, err := buf.ReadString('\n')
+	if err != nil {
+		return nil, ErrorInvalidCacheTree
+	}
+	countStr, subStr, ok := strings.Cut(strings.TrimSuffix(line, "\n"), " ")
+	if !ok {
+		return nil, ErrorInvalidCacheTree
+	}
+	count, err := strconv.Atoi(countStr)
+	if err != nil {
+		return nil, ErrorInvalidCacheTree
+	}
+	subCount, err := strconv.Atoi(subStr)
+	if err != nil || subCount < 0 {
+		return nil, ErrorInvalidCacheTree
+	}
+
+	c := &CacheTree{
+		Name:       name[:len(name)-1],
+		EntryCount: count,
+	}
+	if c.IsValid() {
+		if buf.Len() < h.Size() {
+			return nil, ErrorInvalidCacheTree
+		}
+		c.ObjId = hex.EncodeToString(buf.Next(h.Size()))
+	}
+
+	for n := 0; n < subCount; n++ {
+		s, err := readCacheTreeNode(buf, h)
+		if err != nil {
+			return nil, err
+		}
+		c.Subtrees = append(c.Subtrees, s)
+	}
+	c.sortSubtrees()
+
+	return c, nil
+}
+
+//storeしてobjIdの決まったtreeからcache treeを作り直す
+//entry数はtreeに入らないadd -Nのものも含めたindexのentry数で、add -Nのものがあるdirectoryは無効にする
+func (i *Index) UpdateCacheTree(t *con.Tree) {
+	counts := make(map[string]int)
+	invalid := make(map[string]bool)
+	for _, o := range i.Entries {
+		e, ok := o.(*con.Entry)
+		if !ok {
+			continue
+		}
+		dirs := append([]string{""}, e.ParentDirs(e.Path)...)
+		for _, dir := range dirs {
+			counts[dir]++
+			if e.IsIntentToAdd() || e.GetStage() != 0 {
+				invalid[dir] = true
+			}
+		}
+	}
+
+	c := i.cacheTreeFromTree("", "", t, counts, invalid)
+
+	var before, after bytes.Buffer
+	if i.CacheTree != nil {
+		i.CacheTree.Encode(&before)
+	}
+	c.Encode(&after)
+	if before.String() != after.String() {
+		i.CacheTree = c
+		i.Changed = true
+	}
+}
+
+func (i *Index) cacheTreeFromTree(name, dir string, t *con.Tree, counts map[string]int, invalid map[string]bool) *CacheTree {
+	c := &CacheTree{
+		Name:       name,
+		EntryCount: counts[dir],
+		ObjId:      t.GetObjId(),
+	}
+	if invalid[dir] {
+		c.EntryCount = -1
+	}
+
+	for k, v := range t.Entries {
+		switch o := v.(type) {
+		case *con.Tree:
+			c.Subtrees = append(c.Subtrees, i.cacheTreeFromTree(path.Base(k), k, o, counts, invalid))
+		case *con.Entry:
+			//作り直さなかったsubtreeは前のcache treeをそのまま使う
+			if !o.IsTree() || i.CacheTree == nil {
+				continue
+			}
+			if old := i.CacheTree.Find(k); old != nil {
+				c.Subtrees = append(c.Subtrees, old)
+			}
+		}
+	}
+	c.sortSubtrees()
+
+	return c
+}
+
+func (i *Index) CachedSubtrees() map[string]string {
+	if i.CacheTree == nil {
+		return map[string]string{}
+	}
+	return i.CacheTree.ValidSubtrees()
+}
+
+func (i *Index) invalidateCacheTree(filePath string) {
+	if i.CacheTree != nil {
+		i.CacheTree.Invalidate(filePath)
+	}
+}
@@ -0,0 +1,127 @@
+package database
+
+import (
+	con "mygit/src/database/content"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//testData/index_cache_treeはgitでa,x以下をaddしてwrite-treeしたあとにx/z.txtをaddしたもの
+//rootとxは無効で、aとa/bだけが使える
+func Test_ReadCacheTreeFromGit(t *testing.T) {
+	cur, err := os.Getwd()
+	assert.NoError(t, err)
+	fixture := filepath.Join(cur, "testData/index_cache_tree")
+
+	i := GenerateIndex(fixture)
+	err = i.Load()
+	assert.NoError(t, err)
+
+	c := i.CacheTree
+	assert.NotNil(t, c)
+	assert.False(t, c.IsValid())
+	assert.Equal(t, 2, len(c.Subtrees))
+
+	a := c.Find("a")
+	assert.Equal(t, 3, a.EntryCount)
+	assert.Equal(t, "770c53cc8bb7326a1725bd8e3d60bf5c7b504be4", a.ObjId)
+	ab := c.Find("a/b")
+	assert.Equal(t, 2, ab.EntryCount)
+	assert.Equal(t, "192b546c826d803e88f748b6e370b8885aa346fe", ab.ObjId)
+	assert.False(t, c.Find("x").IsValid())
+	assert.Nil(t, c.Find("a/c"))
+
+	//一番浅い有効なものだけ
+	assert.Equal(t, map[string]string{"a": "770c53cc8bb7326a1725bd8e3d60bf5c7b504be4"}, i.CachedSubtrees())
+
+	//書き戻すとgitの書いたものと同じになる
+	tempPath, err := os.MkdirTemp(cur, "")
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(tempPath)
+	})
+	i.Changed = true
+	err = i.Write(filepath.Join(tempPath, "index"))
+	assert.NoError(t, err)
+	want, err := os.ReadFile(fixture)
+	assert.NoError(t, err)
+	got, err := os.ReadFile(filepath.Join(tempPath, "index"))
+	assert.NoError(t, err)
+	assert.Equal(t, want, got)
+}
+
+func Test_InvalidateCacheTree(t *testing.T) {
+	cur, err := os.Getwd()
+	assert.NoError(t, err)
+
+	i := GenerateIndex(filepath.Join(cur, "testData/index_cache_tree"))
+	err = i.Load()
+	assert.NoError(t, err)
+
+	//同じ中身を入れ直しただけでは無効にならない
+	e, ok := i.EntryForPath("a/b/c.txt")
+	assert.True(t, ok)
+	same := *e
+	i.StoreEntry(&same)
+	assert.True(t, i.CacheTree.Find("a/b").IsValid())
+
+	changed := *e
+	changed.ObjId = "0000000000000000000000000000000000000001"
+	i.StoreEntry(&changed)
+	assert.False(t, i.CacheTree.Find("a").IsValid())
+	assert.False(t, i.CacheTree.Find("a/b").IsValid())
+	assert.Equal(t, map[string]string{}, i.CachedSubtrees())
+
+	i = GenerateIndex(filepath.Join(cur, "testData/index_cache_tree"))
+	err = i.Load()
+	assert.NoError(t, err)
+	i.Remove("a/e.txt")
+	assert.False(t, i.CacheTree.Find("a").IsValid())
+	assert.True(t, i.CacheTree.Find("a/b").IsValid())
+	assert.Equal(t, map[string]string{"a/b": "192b546c826d803e88f748b6e370b8885aa346fe"}, i.CachedSubtrees())
+}
+
+func Test_UnknownIndexExtension(t *testing.T) {
+	cur, err := os.Getwd()
+	assert.NoError(t, err)
+	tempPath, err := os.MkdirTemp(cur, "")
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(tempPath)
+	})
+
+	for _, tc := range []struct {
+		sig string
+		err error
+	}{
+		{sig: "UNTR", err: nil},
+		{sig: "link", err: ErrorUnknownIndexExtension},
+	} {
+		i := GenerateIndex(filepath.Join(tempPath, "index"))
+		i.StoreEntry(&con.Entry{Path: "hello.txt", ObjId: "ce013625030ba8dba906f756967f9e9ca394464a", Mode: REGULAR_MODE, Flags: 9})
+		i.Changed = true
+		err = i.Write(i.Path)
+		assert.NoError(t, err)
+
+		//checksumの前に拡張を差し込んで書き直す
+		bs, err := os.ReadFile(i.Path)
+		assert.NoError(t, err)
+		content := string(bs[:len(bs)-20]) + tc.sig + "\x00\x00\x00\x03abc"
+		content += i.GetHash().Digest(content)
+		err = os.WriteFile(i.Path, []byte(content), os.ModePerm)
+		assert.NoError(t, err)
+
+		loaded := GenerateIndex(i.Path)
+		err = loaded.Load()
+		if tc.err == nil {
+			assert.NoError(t, err)
+			_, ok := loaded.EntryForPath("hello.txt")
+			assert.True(t, ok)
+		} else {
+			assert.ErrorIs(t, err, tc.err)
+		}
+	}
+}
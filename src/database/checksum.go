@@ -9,6 +9,8 @@ import (
 type CheckSum struct {
 	reader  io.Reader
 	Content string
+	//nilならsha1
+	hash crypt.Hash
 }
 
 func (c *CheckSum) Read(r io.Reader, size int) ([]byte, error) {
@@ -26,6 +28,19 @@ func (c *CheckSum) Read(r io.Reader, size int) ([]byte, error) {
 
 }
 
+//index v4の可変長の数やNULまでのpathを1byteずつ読む
+func (c *CheckSum) ReadByte() (byte, error) {
+	bs, err := c.Read(c.reader, 1)
+	if err != nil {
+		return 0, err
+	}
+
+	return bs[0], nil
+}
+
 func (c *CheckSum) GenerateHash() string {
-	return crypt.DigestBySha1(c.Content)
+	if c.hash == nil {
+		return crypt.SHA1.Digest(c.Content)
+	}
+	return c.hash.Digest(c.Content)
 }
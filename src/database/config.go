@@ -0,0 +1,291 @@
+package database
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mygit/src/database/lock"
+	"os"
+	"strings"
+)
+
+//.git/configを本家と同じINIの形で読み書きする
+//[remote "origin"]
+//	url = /path/to/repo
+//	fetch = +refs/heads/*:refs/remotes/origin/*
+//section名とkeyは大文字小文字を区別しない、subsectionは区別する
+
+var ErrorInvalidConfig = errors.New("invalid config file")
+
+type ConfigEntry struct {
+	Key   string
+	Value string
+}
+
+type ConfigSection struct {
+	Name       string
+	Subsection string
+	Entries    []*ConfigEntry
+}
+
+type Config struct {
+	Path     string
+	Sections []*ConfigSection
+}
+
+func GenerateConfig(path string) *Config {
+	return &Config{
+		Path: path,
+	}
+}
+
+//ファイルがなければ空のconfigとして扱う
+func (c *Config) Load() error {
+	c.Sections = nil
+
+	f, err := os.Open(c.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	var current *ConfigSection
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		if line[0] == '[' {
+			section, err := parseSectionHeader(line)
+			if err != nil {
+				return err
+			}
+			current = section
+			c.Sections = append(c.Sections, current)
+			continue
+		}
+
+		if current == nil {
+			return ErrorInvalidConfig
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		if key == "" {
+			return ErrorInvalidConfig
+		}
+
+		//"key"だけの行は本家と同じくtrueとみなす
+		if !found {
+			current.Entries = append(current.Entries, &ConfigEntry{Key: key, Value: "true"})
+			continue
+		}
+
+		current.Entries = append(current.Entries, &ConfigEntry{Key: key, Value: parseConfigValue(value)})
+	}
+
+	return s.Err()
+}
+
+//[core]か[remote "origin"]の形
+func parseSectionHeader(line string) (*ConfigSection, error) {
+	end := strings.LastIndex(line, "]")
+	if end < 0 {
+		return nil, ErrorInvalidConfig
+	}
+
+	header := strings.TrimSpace(line[1:end])
+	name, sub, found := strings.Cut(header, " ")
+	if !found {
+		return &ConfigSection{Name: strings.ToLower(header)}, nil
+	}
+
+	sub = strings.TrimSpace(sub)
+	if len(sub) < 2 || sub[0] != '"' || sub[len(sub)-1] != '"' {
+		return nil, ErrorInvalidConfig
+	}
+
+	return &ConfigSection{
+		Name:       strings.ToLower(name),
+		Subsection: strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(sub[1 : len(sub)-1]),
+	}, nil
+}
+
+//"で囲まれた部分以外の#,;以降はコメント
+func parseConfigValue(raw string) string {
+	var b strings.Builder
+	inQuote := false
+
+	raw = strings.TrimSpace(raw)
+	for i := 0; i < len(raw); i++ {
+		ch := raw[i]
+		switch {
+		case ch == '"':
+			inQuote = !inQuote
+		case ch == '\\' && i+1 < len(raw):
+			i++
+			switch raw[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			default:
+				b.WriteByte(raw[i])
+			}
+		case (ch == '#' || ch == ';') && !inQuote:
+			return strings.TrimSpace(b.String())
+		default:
+			b.WriteByte(ch)
+		}
+	}
+
+	return b.String()
+}
+
+func formatConfigValue(value string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`).Replace(value)
+	if escaped != value || strings.ContainsAny(value, "#;") || strings.TrimSpace(value) != value {
+		return fmt.Sprintf(`"%s"`, escaped)
+	}
+
+	return value
+}
+
+func (c *Config) Save() error {
+	var str string
+	for _, section := range c.Sections {
+		if section.Subsection == "" {
+			str += fmt.Sprintf("[%s]\n", section.Name)
+		} else {
+			str += fmt.Sprintf("[%s \"%s\"]\n", section.Name, strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(section.Subsection))
+		}
+
+		for _, e := range section.Entries {
+			str += fmt.Sprintf("\t%s = %s\n", e.Key, formatConfigValue(e.Value))
+		}
+	}
+
+	l := lock.NewFileLock(c.Path)
+	l.Lock()
+	defer l.Unlock()
+
+	return ioutil.WriteFile(c.Path, []byte(str), 0644)
+}
+
+func (c *Config) findSection(name, sub string) *ConfigSection {
+	for _, section := range c.Sections {
+		if section.Name == strings.ToLower(name) && section.Subsection == sub {
+			return section
+		}
+	}
+
+	return nil
+}
+
+//同じkeyが何度も出てきたら本家と同じく最後のものを使う
+func (c *Config) Get(name, sub, key string) (string, bool) {
+	values := c.GetAll(name, sub, key)
+	if len(values) == 0 {
+		return "", false
+	}
+
+	return values[len(values)-1], true
+}
+
+//remote.origin.fetchのように複数持てるもの
+func (c *Config) GetAll(name, sub, key string) []string {
+	var values []string
+	key = strings.ToLower(key)
+
+	for _, section := range c.Sections {
+		if section.Name != strings.ToLower(name) || section.Subsection != sub {
+			continue
+		}
+		for _, e := range section.Entries {
+			if e.Key == key {
+				values = append(values, e.Value)
+			}
+		}
+	}
+
+	return values
+}
+
+//すでにあるkeyは消してから一つだけ書く
+func (c *Config) Set(name, sub, key, value string) {
+	c.Unset(name, sub, key)
+	c.Add(name, sub, key, value)
+}
+
+func (c *Config) Add(name, sub, key, value string) {
+	section := c.findSection(name, sub)
+	if section == nil {
+		section = &ConfigSection{
+			Name:       strings.ToLower(name),
+			Subsection: sub,
+		}
+		c.Sections = append(c.Sections, section)
+	}
+
+	section.Entries = append(section.Entries, &ConfigEntry{
+		Key:   strings.ToLower(key),
+		Value: value,
+	})
+}
+
+func (c *Config) Unset(name, sub, key string) {
+	key = strings.ToLower(key)
+
+	for _, section := range c.Sections {
+		if section.Name != strings.ToLower(name) || section.Subsection != sub {
+			continue
+		}
+
+		var entries []*ConfigEntry
+		for _, e := range section.Entries {
+			if e.Key != key {
+				entries = append(entries, e)
+			}
+		}
+		section.Entries = entries
+	}
+}
+
+//消せたらtrue
+func (c *Config) RemoveSection(name, sub string) bool {
+	var sections []*ConfigSection
+	removed := false
+
+	for _, section := range c.Sections {
+		if section.Name == strings.ToLower(name) && section.Subsection == sub {
+			removed = true
+			continue
+		}
+		sections = append(sections, section)
+	}
+	c.Sections = sections
+
+	return removed
+}
+
+//remoteの一覧のように、あるsectionのsubsectionを出てきた順に返す
+func (c *Config) Subsections(name string) []string {
+	var subs []string
+	seen := make(map[string]bool)
+
+	for _, section := range c.Sections {
+		if section.Name != strings.ToLower(name) || section.Subsection == "" || seen[section.Subsection] {
+			continue
+		}
+		seen[section.Subsection] = true
+		subs = append(subs, section.Subsection)
+	}
+
+	return subs
+}
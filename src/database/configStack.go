@@ -0,0 +1,401 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+//本家と同じくsystem,global,localの順にconfigを重ねて読む、後から読んだ値が優先される
+//system  : $GIT_CONFIG_SYSTEMか/etc/gitconfig、GIT_CONFIG_NOSYSTEMがあれば読まない
+//global  : $GIT_CONFIG_GLOBAL、なければ$XDG_CONFIG_HOME/git/config,~/.gitconfigの順
+//local   : .git/config
+//[include] path = xxxは書かれた位置にそのファイルの中身を差し込む
+
+type ConfigScope string
+
+const (
+	SCOPE_SYSTEM ConfigScope = "system"
+	SCOPE_GLOBAL ConfigScope = "global"
+	SCOPE_LOCAL  ConfigScope = "local"
+
+	DEFAULT_SYSTEM_CONFIG = "/etc/gitconfig"
+	//includeが循環しても止まるように
+	MAX_INCLUDE_DEPTH = 10
+)
+
+var (
+	ErrorInvalidConfigKey   = errors.New("invalid config key")
+	ErrorInvalidConfigValue = errors.New("invalid config value")
+	ErrorIncludeDepth       = errors.New("exceeded maximum include depth")
+)
+
+//includeを展開した後の1つの値
+type ConfigValue struct {
+	Section    string
+	Subsection string
+	Key        string
+	Value      string
+	Scope      ConfigScope
+	//値が書かれていたファイル
+	Origin string
+}
+
+//core.bareやremote.origin.urlの形
+func (v *ConfigValue) Name() string {
+	return JoinConfigKey(v.Section, v.Subsection, v.Key)
+}
+
+type ConfigStack struct {
+	Values []*ConfigValue
+}
+
+//gitPathが空ならlocalは読まない
+func LoadConfigStack(gitPath string) (*ConfigStack, error) {
+	cs := &ConfigStack{}
+
+	if os.Getenv("GIT_CONFIG_NOSYSTEM") == "" {
+		if err := cs.load(SystemConfigPath(), SCOPE_SYSTEM, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, path := range globalConfigPaths() {
+		if err := cs.load(path, SCOPE_GLOBAL, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	if gitPath != "" {
+		if err := cs.load(filepath.Join(gitPath, "config"), SCOPE_LOCAL, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	return cs, nil
+}
+
+//--globalのように1つのファイルだけ見る時、includeは展開する
+func LoadConfigFile(path string, scope ConfigScope) (*ConfigStack, error) {
+	cs := &ConfigStack{}
+	if err := cs.load(path, scope, 0); err != nil {
+		return nil, err
+	}
+
+	return cs, nil
+}
+
+func (cs *ConfigStack) load(path string, scope ConfigScope, depth int) error {
+	if depth > MAX_INCLUDE_DEPTH {
+		return fmt.Errorf("%s: %w", path, ErrorIncludeDepth)
+	}
+
+	c := GenerateConfig(path)
+	if err := c.Load(); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	for _, section := range c.Sections {
+		for _, e := range section.Entries {
+			cs.Values = append(cs.Values, &ConfigValue{
+				Section:    section.Name,
+				Subsection: section.Subsection,
+				Key:        e.Key,
+				Value:      e.Value,
+				Scope:      scope,
+				Origin:     path,
+			})
+
+			if section.Name == "include" && section.Subsection == "" && e.Key == "path" {
+				if err := cs.load(includePath(path, e.Value), scope, depth+1); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+//相対パスはincludeを書いたファイルのdirectoryから、~/はhomeから
+func includePath(from, path string) string {
+	if strings.HasPrefix(path, "~/") {
+		home, _ := os.UserHomeDir()
+		return filepath.Join(home, path[2:])
+	}
+	if filepath.IsAbs(path) {
+		return path
+	}
+
+	return filepath.Join(filepath.Dir(from), path)
+}
+
+func SystemConfigPath() string {
+	if path := os.Getenv("GIT_CONFIG_SYSTEM"); path != "" {
+		return path
+	}
+	return DEFAULT_SYSTEM_CONFIG
+}
+
+func xdgConfigPath() string {
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		return filepath.Join(xdg, "git", "config")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "git", "config")
+}
+
+func globalConfigPaths() []string {
+	if path := os.Getenv("GIT_CONFIG_GLOBAL"); path != "" {
+		return []string{path}
+	}
+
+	var paths []string
+	if xdg := xdgConfigPath(); xdg != "" {
+		paths = append(paths, xdg)
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, filepath.Join(home, ".gitconfig"))
+	}
+
+	return paths
+}
+
+//--globalで書き込む先、本家と同じく~/.gitconfigがなくXDGの方だけあればそちらに書く
+func GlobalConfigPath() string {
+	if path := os.Getenv("GIT_CONFIG_GLOBAL"); path != "" {
+		return path
+	}
+
+	home, _ := os.UserHomeDir()
+	path := filepath.Join(home, ".gitconfig")
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if xdg := xdgConfigPath(); xdg != "" {
+			if _, err := os.Stat(xdg); err == nil {
+				return xdg
+			}
+		}
+	}
+
+	return path
+}
+
+//"remote.origin.url"をsection,subsection,keyに分ける、subsectionには.が入ってもよい
+func SplitConfigKey(name string) (string, string, string, error) {
+	first := strings.Index(name, ".")
+	last := strings.LastIndex(name, ".")
+	if first <= 0 || last == len(name)-1 {
+		return "", "", "", fmt.Errorf("%s: %w", name, ErrorInvalidConfigKey)
+	}
+
+	section := strings.ToLower(name[:first])
+	key := strings.ToLower(name[last+1:])
+	sub := ""
+	if first != last {
+		sub = name[first+1 : last]
+	}
+
+	return section, sub, key, nil
+}
+
+func JoinConfigKey(section, sub, key string) string {
+	if sub == "" {
+		return fmt.Sprintf("%s.%s", section, key)
+	}
+	return fmt.Sprintf("%s.%s.%s", section, sub, key)
+}
+
+func (cs *ConfigStack) Get(name, sub, key string) (string, bool) {
+	values := cs.GetAll(name, sub, key)
+	if len(values) == 0 {
+		return "", false
+	}
+
+	return values[len(values)-1], true
+}
+
+func (cs *ConfigStack) GetAll(name, sub, key string) []string {
+	var values []string
+	name = strings.ToLower(name)
+	key = strings.ToLower(key)
+
+	for _, v := range cs.Values {
+		if v.Section == name && v.Subsection == sub && v.Key == key {
+			values = append(values, v.Value)
+		}
+	}
+
+	return values
+}
+
+//本家のtrue/yes/on/1とfalse/no/off/0/空文字、なければdefaultValue
+func (cs *ConfigStack) GetBool(name, sub, key string, defaultValue bool) (bool, error) {
+	value, ok := cs.Get(name, sub, key)
+	if !ok {
+		return defaultValue, nil
+	}
+
+	switch strings.ToLower(value) {
+	case "true", "yes", "on", "1":
+		return true, nil
+	case "false", "no", "off", "0", "":
+		return false, nil
+	default:
+		return false, fmt.Errorf("%s=%s: %w", JoinConfigKey(name, sub, key), value, ErrorInvalidConfigValue)
+	}
+}
+
+//10k,1m,1gのような単位もつけられる
+func (cs *ConfigStack) GetInt(name, sub, key string, defaultValue int) (int, error) {
+	value, ok := cs.Get(name, sub, key)
+	if !ok {
+		return defaultValue, nil
+	}
+
+	unit := 1
+	number := strings.ToLower(value)
+	switch {
+	case strings.HasSuffix(number, "k"):
+		unit = 1024
+	case strings.HasSuffix(number, "m"):
+		unit = 1024 * 1024
+	case strings.HasSuffix(number, "g"):
+		unit = 1024 * 1024 * 1024
+	}
+	if unit != 1 {
+		number = number[:len(number)-1]
+	}
+
+	n, err := strconv.Atoi(number)
+	if err != nil {
+		return 0, fmt.Errorf("%s=%s: %w", JoinConfigKey(name, sub, key), value, ErrorInvalidConfigValue)
+	}
+
+	return n * unit, nil
+}
+
+func (cs *ConfigStack) UserName() string {
+	name, _ := cs.Get("user", "", "name")
+	return name
+}
+
+func (cs *ConfigStack) UserEmail() string {
+	email, _ := cs.Get("user", "", "email")
+	return email
+}
+
+//core.editor、なければ空
+func (cs *ConfigStack) CoreEditor() string {
+	editor, _ := cs.Get("core", "", "editor")
+	return editor
+}
+
+func (cs *ConfigStack) CoreBare() (bool, error) {
+	return cs.GetBool("core", "", "bare", false)
+}
+
+//merge.ff、true,false,onlyのどれか
+func (cs *ConfigStack) MergeFF() string {
+	ff, ok := cs.Get("merge", "", "ff")
+	if !ok {
+		return "true"
+	}
+	return strings.ToLower(ff)
+}
+
+//alias.xxxの値、"!"で始まるものはshellで動かす
+func (cs *ConfigStack) Alias(command string) (string, bool) {
+	return cs.Get("alias", "", command)
+}
+
+//~/で始まればhomeからのpathにする
+func (cs *ConfigStack) GetPath(name, sub, key string) (string, bool) {
+	value, ok := cs.Get(name, sub, key)
+	if !ok || value == "" {
+		return "", false
+	}
+	if strings.HasPrefix(value, "~/") {
+		home, _ := os.UserHomeDir()
+		return filepath.Join(home, value[2:]), true
+	}
+
+	return value, true
+}
+
+//gpg.format、なければ本家と同じくopenpgp
+func (cs *ConfigStack) GpgFormat() string {
+	format, ok := cs.Get("gpg", "", "format")
+	if !ok {
+		return "openpgp"
+	}
+	return strings.ToLower(format)
+}
+
+//user.signingKey、sshなら秘密鍵か公開鍵のファイル
+func (cs *ConfigStack) SigningKey() (string, bool) {
+	return cs.GetPath("user", "", "signingkey")
+}
+
+func (cs *ConfigStack) AllowedSignersFile() (string, bool) {
+	return cs.GetPath("gpg", "ssh", "allowedsignersfile")
+}
+
+//commit.gpgSign,tag.gpgSignがtrueなら-S,-sがなくても署名する
+func (cs *ConfigStack) CommitGpgSign() (bool, error) {
+	return cs.GetBool("commit", "", "gpgsign", false)
+}
+
+func (cs *ConfigStack) TagGpgSign() (bool, error) {
+	return cs.GetBool("tag", "", "gpgsign", false)
+}
+
+//index.version、なければ0(今のindexのversionのまま)
+func (cs *ConfigStack) IndexVersion() (int, error) {
+	return cs.GetInt("index", "", "version", 0)
+}
+
+//trueならmgit fsmonitorのdaemonに変更を聞く、本家のhookのpathは使えないのでfalseと同じ
+func (cs *ConfigStack) CoreFsmonitor() (bool, error) {
+	return cs.GetBool("core", "", "fsmonitor", false)
+}
+
+//trueなら.git/info/sparse-checkoutの外のentryを作業ディレクトリに置かない
+func (cs *ConfigStack) CoreSparseCheckout() (bool, error) {
+	return cs.GetBool("core", "", "sparseCheckout", false)
+}
+
+//gcで消すunreachableなobjectの古さ、2.weeks.agoやnowの形
+func (cs *ConfigStack) GcPruneExpire() (string, bool) {
+	return cs.Get("gc", "", "pruneExpire")
+}
+
+//http-backendでpushを受け付けるか、認証がないので既定では受け付けない
+func (cs *ConfigStack) HTTPReceivePack() (bool, error) {
+	return cs.GetBool("http", "", "receivepack", false)
+}
+
+//本家と同じく0かtrueなら自動(GOMAXPROCS)、1かfalseなら並列にしない
+func (cs *ConfigStack) IndexThreads() (int, error) {
+	n, err := cs.GetInt("index", "", "threads", 0)
+	if err == nil {
+		if n < 0 {
+			return 0, fmt.Errorf("index.threads=%d: %w", n, ErrorInvalidConfigValue)
+		}
+		return n, nil
+	}
+
+	b, berr := cs.GetBool("index", "", "threads", true)
+	if berr != nil {
+		return 0, err
+	}
+	if b {
+		return 0, nil
+	}
+	return 1, nil
+}
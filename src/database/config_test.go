@@ -0,0 +1,157 @@
+package database
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigLoadAndSave(t *testing.T) {
+	cur, err := os.Getwd()
+	assert.NoError(t, err)
+	tempPath, err := ioutil.TempDir(cur, "")
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(tempPath)
+	})
+
+	path := filepath.Join(tempPath, "config")
+	content := `# comment
+[Core]
+	Bare = false
+	editor = "vim -n" ; inline comment
+	filemode
+[remote "origin"]
+	url = /srv/repo.git
+	fetch = +refs/heads/*:refs/remotes/origin/*
+	fetch = +refs/tags/*:refs/tags/*
+`
+	err = ioutil.WriteFile(path, []byte(content), 0644)
+	assert.NoError(t, err)
+
+	c := GenerateConfig(path)
+	assert.NoError(t, c.Load())
+
+	v, ok := c.Get("core", "", "bare")
+	assert.True(t, ok)
+	assert.Equal(t, "false", v)
+	v, _ = c.Get("CORE", "", "editor")
+	assert.Equal(t, "vim -n", v)
+	v, _ = c.Get("core", "", "filemode")
+	assert.Equal(t, "true", v)
+	assert.Equal(t, []string{"+refs/heads/*:refs/remotes/origin/*", "+refs/tags/*:refs/tags/*"}, c.GetAll("remote", "origin", "fetch"))
+	_, ok = c.Get("remote", "Origin", "url")
+	assert.False(t, ok)
+
+	c.Set("remote", "origin", "url", "/new path;x")
+	c.Add("branch", "master", "remote", "origin")
+	assert.Equal(t, []string{"origin"}, c.Subsections("remote"))
+	assert.NoError(t, c.Save())
+
+	reloaded := GenerateConfig(path)
+	assert.NoError(t, reloaded.Load())
+	v, _ = reloaded.Get("remote", "origin", "url")
+	assert.Equal(t, "/new path;x", v)
+	v, _ = reloaded.Get("branch", "master", "remote")
+	assert.Equal(t, "origin", v)
+
+	assert.True(t, reloaded.RemoveSection("remote", "origin"))
+	assert.False(t, reloaded.RemoveSection("remote", "origin"))
+	assert.Empty(t, reloaded.Subsections("remote"))
+
+	//ファイルがなければ空
+	empty := GenerateConfig(filepath.Join(tempPath, "none"))
+	assert.NoError(t, empty.Load())
+	assert.Empty(t, empty.Sections)
+}
+
+func TestConfigStackTypedValues(t *testing.T) {
+	cur, err := os.Getwd()
+	assert.NoError(t, err)
+	tempPath, err := ioutil.TempDir(cur, "")
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(tempPath)
+	})
+
+	system := filepath.Join(tempPath, "system")
+	global := filepath.Join(tempPath, "global")
+	t.Setenv("GIT_CONFIG_SYSTEM", system)
+	t.Setenv("GIT_CONFIG_GLOBAL", global)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "")
+
+	err = ioutil.WriteFile(system, []byte("[core]\n\tbare = yes\n\tbigFileThreshold = 512k\n[merge]\n\tff = only\n"), 0644)
+	assert.NoError(t, err)
+	err = ioutil.WriteFile(global, []byte("[core]\n\tbare = off\n[include]\n\tpath = loop\n"), 0644)
+	assert.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(tempPath, "loop"), []byte("[include]\n\tpath = loop\n"), 0644)
+	assert.NoError(t, err)
+
+	//自分自身をincludeし続けると止める
+	_, err = LoadConfigStack("")
+	assert.ErrorIs(t, err, ErrorIncludeDepth)
+
+	err = ioutil.WriteFile(global, []byte("[core]\n\tbare = off\n\tfilemode = maybe\n"), 0644)
+	assert.NoError(t, err)
+	cs, err := LoadConfigStack("")
+	assert.NoError(t, err)
+
+	bare, err := cs.CoreBare()
+	assert.NoError(t, err)
+	assert.False(t, bare)
+	n, err := cs.GetInt("core", "", "bigfilethreshold", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 512*1024, n)
+	_, err = cs.GetBool("core", "", "filemode", true)
+	assert.ErrorIs(t, err, ErrorInvalidConfigValue)
+	assert.Equal(t, "only", cs.MergeFF())
+	assert.Equal(t, SCOPE_SYSTEM, cs.Values[0].Scope)
+
+	section, sub, key, err := SplitConfigKey("remote.my.origin.URL")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"remote", "my.origin", "url"}, []string{section, sub, key})
+	_, _, _, err = SplitConfigKey("core.")
+	assert.ErrorIs(t, err, ErrorInvalidConfigKey)
+}
+
+func Test_IndexThreads(t *testing.T) {
+	cur, err := os.Getwd()
+	assert.NoError(t, err)
+	tempPath, err := ioutil.TempDir(cur, "")
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(tempPath)
+	})
+	path := filepath.Join(tempPath, "config")
+
+	for _, tc := range []struct {
+		value   string
+		threads int
+		err     error
+	}{
+		{value: "", threads: 0},
+		{value: "\tthreads = 0\n", threads: 0},
+		{value: "\tthreads = true\n", threads: 0},
+		{value: "\tthreads = 1\n", threads: 1},
+		{value: "\tthreads = false\n", threads: 1},
+		{value: "\tthreads = 8\n", threads: 8},
+		{value: "\tthreads = -2\n", err: ErrorInvalidConfigValue},
+		{value: "\tthreads = many\n", err: ErrorInvalidConfigValue},
+	} {
+		err = ioutil.WriteFile(path, []byte("[index]\n"+tc.value), 0644)
+		assert.NoError(t, err)
+		cs, err := LoadConfigFile(path, SCOPE_LOCAL)
+		assert.NoError(t, err)
+
+		threads, err := cs.IndexThreads()
+		if tc.err != nil {
+			assert.ErrorIs(t, err, tc.err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, tc.threads, threads, tc.value)
+	}
+}
@@ -2,6 +2,7 @@ package content
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"strconv"
@@ -20,12 +21,7 @@ func (a *Author) ToString() string {
 }
 
 func generateTime(t time.Time) string {
-	s := t.String()
-
-	words := strings.Fields(s)
-	unixTime := t.Unix()
-
-	return fmt.Sprintf("%d %s", unixTime, words[2])
+	return fmt.Sprintf("%d %s", t.Unix(), t.Format("-0700"))
 }
 
 func (a *Author) GetUnixTime() time.Time {
@@ -49,12 +45,57 @@ func (a *Author) ReadableTime() string {
 }
 
 func GenerateAuthor(name, email string) *Author {
-	timeString := generateTime(time.Now())
+	return GenerateAuthorAt(name, email, generateTime(time.Now()))
+}
 
+//createdAtは"unixtime timezone"の形
+func GenerateAuthorAt(name, email, createdAt string) *Author {
 	return &Author{
 		Name:      name,
 		Email:     email,
-		CreatedAt: timeString,
+		CreatedAt: createdAt,
+	}
+}
+
+var ErrorInvalidDate = errors.New("invalid date format")
+
+//GIT_AUTHOR_DATE,GIT_COMMITTER_DATEに書ける形を"unixtime timezone"にする
+//本家と同じく"1700000000 +0900","@1700000000 +0900",RFC2822,ISO8601を受け付ける
+func ParseGitDate(date string) (string, error) {
+	date = strings.TrimSpace(date)
+
+	unix, zone, found := strings.Cut(strings.TrimPrefix(date, "@"), " ")
+	if _, err := strconv.ParseInt(unix, 10, 64); err == nil {
+		if !found {
+			zone = "+0000"
+		}
+		if _, err := time.Parse("-0700", zone); err != nil {
+			return "", fmt.Errorf("%s: %w", date, ErrorInvalidDate)
+		}
+		return fmt.Sprintf("%s %s", unix, zone), nil
+	}
+
+	for _, layout := range []string{time.RFC1123Z, "Mon, 2 Jan 2006 15:04:05 -0700", time.RFC3339, "2006-01-02 15:04:05 -0700", "2006-01-02T15:04:05 -0700"} {
+		if t, err := time.Parse(layout, date); err == nil {
+			return generateTime(t), nil
+		}
+	}
+
+	return "", fmt.Errorf("%s: %w", date, ErrorInvalidDate)
+}
+
+//"name <email> unixtime timezone"の形からAuthorを作る、nameには空白が入ることもある
+func ParseAuthorLine(line string) *Author {
+	start := strings.Index(line, "<")
+	end := strings.Index(line, ">")
+	if start == -1 || end == -1 || end < start {
+		return &Author{Name: strings.TrimSpace(line)}
+	}
+
+	return &Author{
+		Name:      strings.TrimSpace(line[:start]),
+		Email:     line[start+1 : end],
+		CreatedAt: strings.TrimSpace(line[end+1:]),
 	}
 }
 
@@ -1,9 +1,10 @@
 package content
 
 import (
-	"bufio"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"mygit/src/crypt"
 	"strings"
 )
 
@@ -11,29 +12,68 @@ type Commit struct {
 	ObjId   string
 	Tree    *Tree
 	Author  *Author
-	Message string
-	Parents []string
+	//nilならAuthorと同じ
+	Committer *Author
+	Message   string
+	Parents   []string
+	//gpgsigやencodingのようにtree,parent,author,committer以外のheader
+	Headers []*CommitHeader
+}
+
+//本家と同じく署名はgpgsig、sha256のrepositoryの署名はgpgsig-sha256に入れる
+const (
+	SIGNATURE_HEADER        = "gpgsig"
+	SIGNATURE_HEADER_SHA256 = "gpgsig-sha256"
+)
+
+func SignatureHeader(h crypt.Hash) string {
+	if h == crypt.SHA256 {
+		return SIGNATURE_HEADER_SHA256
+	}
+	return SIGNATURE_HEADER
+}
+
+//"key value"の1行、valueが複数行ならつづきの行は先頭に空白を1つつけて書く
+type CommitHeader struct {
+	Key   string
+	Value string
+}
+
+func (h *CommitHeader) ToString() string {
+	return fmt.Sprintf("%s %s\n", h.Key, strings.ReplaceAll(h.Value, "\n", "\n "))
 }
 
 func (c *Commit) Type() string {
 	return "commit"
 }
 
-func (c *Commit) ToString() string {
+func (c *Commit) GetCommitter() *Author {
+	if c.Committer == nil {
+		return c.Author
+	}
+	return c.Committer
+}
 
+//本家と同じくtree,parent,author,committer,その他のheader,空行,messageの順
+func (c *Commit) ToString() string {
 	var str string
-	str = str + fmt.Sprintf("tree %s\n", c.Tree.GetObjId())
+	str += fmt.Sprintf("tree %s\n", c.Tree.GetObjId())
 
-	if len(c.Parents) != 0 {
-		for _, p := range c.Parents {
-			str = str + fmt.Sprintf("parent %s\n", p)
+	for _, p := range c.Parents {
+		//root commitのparentは書かない
+		if p == "" {
+			continue
 		}
+		str += fmt.Sprintf("parent %s\n", p)
 	}
 
-	str = str + fmt.Sprintf("author %s\n", c.Author.ToString())
-	str = str + fmt.Sprintf("commiter %s\n", c.Author.ToString())
+	str += fmt.Sprintf("author %s\n", c.Author.ToString())
+	str += fmt.Sprintf("committer %s\n", c.GetCommitter().ToString())
+	for _, h := range c.Headers {
+		str += h.ToString()
+	}
 	str += "\n"
-	str = str + c.Message + "\n"
+	str += c.Message + "\n"
 
 	return str
 }
@@ -55,11 +95,15 @@ func (c *Commit) getMode() string {
 }
 
 type CommitFromMem struct {
-	ObjId   string
-	Tree    string
-	Author  *Author
-	Message string
-	Parents []string
+	ObjId     string
+	Tree      string
+	Author    *Author
+	Committer *Author
+	Message   string
+	Parents   []string
+	//読んだheaderを出てきた順にすべて持つ、ToStringで同じbyte列に戻すため
+	Headers []*CommitHeader
+	body    string
 }
 
 func (c *CommitFromMem) SetObjId(objId string) {
@@ -87,46 +131,95 @@ func (c *CommitFromMem) FirstParent() string {
 	return c.Parents[0]
 }
 
+//headerは空行まで、そのあとはmessage
+//空白で始まる行は前のheaderのつづき(gpgsigやmergetag)
 func (c *CommitFromMem) Parse(r io.Reader) error {
-	s := bufio.NewScanner(r)
-
-	var messages []string
-	for s.Scan() {
-		text := s.Text()
-		words := strings.Fields(text)
-
-		if c.Tree != "" && c.Author != nil {
-			messages = append(messages, text)
-		} else if len(words) == 2 {
-			//tree,parentの時
-
-			if words[0] == "parent" {
-				c.Parents = append(c.Parents, words[1])
-			} else {
-				//treeの時
-				c.Tree = words[1]
-			}
-		} else if len(words) == 5 {
-			//authorとcommiter
-			emailLen := len(words[2])
-			createdAt := words[3] + " " + words[4]
-
-			if words[0] == "author" {
-				a := &Author{
-					Name:      words[1],
-					Email:     words[2][1 : emailLen-1],
-					CreatedAt: createdAt,
-				}
-				c.Author = a
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	header, body, _ := strings.Cut(string(content), "\n\n")
+	for _, line := range strings.Split(header, "\n") {
+		if strings.HasPrefix(line, " ") && len(c.Headers) > 0 {
+			last := c.Headers[len(c.Headers)-1]
+			last.Value += "\n" + line[1:]
+			continue
+		}
+
+		key, value, _ := strings.Cut(line, " ")
+		c.Headers = append(c.Headers, &CommitHeader{Key: key, Value: value})
+	}
+
+	for _, h := range c.Headers {
+		switch h.Key {
+		case "tree":
+			c.Tree = h.Value
+		case "parent":
+			//以前のmygitはroot commitに空のparentを書いていた
+			if h.Value != "" {
+				c.Parents = append(c.Parents, h.Value)
 			}
+		case "author":
+			c.Author = ParseAuthorLine(h.Value)
+		//以前のmygitはcommiterと書いていた
+		case "committer", "commiter":
+			c.Committer = ParseAuthorLine(h.Value)
+		}
+	}
+	if c.Committer == nil {
+		c.Committer = c.Author
+	}
 
-			s.Scan() //authorの情報だけでいいのでcommiterのparseはskip
-			s.Scan() //commiterとmessageの間に改行があるのでそれもskip
+	c.body = body
+	c.Message = strings.TrimSuffix(body, "\n")
 
+	return nil
+}
+
+//tree,parent,author,committer以外のheader
+func (c *CommitFromMem) ExtraHeaders() []*CommitHeader {
+	var headers []*CommitHeader
+	for _, h := range c.Headers {
+		switch h.Key {
+		case "tree", "parent", "author", "committer", "commiter":
+			continue
 		}
+		headers = append(headers, h)
+	}
+	return headers
+}
 
+//repositoryのhashに合ったgpgsigかgpgsig-sha256の値、署名がなければfalse
+func (c *CommitFromMem) Signature(hash crypt.Hash) (string, bool) {
+	key := SignatureHeader(hash)
+	for _, h := range c.Headers {
+		if h.Key == key {
+			return h.Value, true
+		}
 	}
-	c.Message = strings.Join(messages, "\n")
+	return "", false
+}
 
-	return nil
+//署名の対象になるbyte列、gpgsigを除いたもの
+func (c *CommitFromMem) Payload() string {
+	var str string
+	for _, h := range c.Headers {
+		if h.Key == SIGNATURE_HEADER || h.Key == SIGNATURE_HEADER_SHA256 {
+			continue
+		}
+		str += h.ToString()
+	}
+
+	return str + "\n" + c.body
+}
+
+//読んだ時と同じbyte列、objIdの計算に使える
+func (c *CommitFromMem) ToString() string {
+	var str string
+	for _, h := range c.Headers {
+		str += h.ToString()
+	}
+
+	return str + "\n" + c.body
 }
@@ -0,0 +1,150 @@
+package content
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//以下のobjIdはgit 2.39で同じ内容をcommitして得たもの
+//GIT_AUTHOR_DATE="1700000000 +0900" GIT_COMMITTER_DATE="1700000100 -0500"
+const (
+	gitFirstCommit  = "012a31c4538e6ac14f62806a10bc6b8cdb6d2d01"
+	gitFirstTree    = "1a18675bc2c8ef600997947576271eb9c397e1eb"
+	gitSecondCommit = "90f16936435d54eaf8296459c6a6c1edf99f2738"
+	gitSecondTree   = "41475fa08babe7bde0c19d4f35c92b24f0e9d855"
+	gitSignedCommit = "211ff2cb218fc72f71bf1b4982f156dc4a775480"
+)
+
+func objIdForTest(o interface {
+	ToString() string
+	Type() string
+}) string {
+	content := o.ToString()
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s %d\x00%s", o.Type(), len(content), content)))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestCommitMatchesGit(t *testing.T) {
+	author := GenerateAuthorAt("Jane Doe", "jane@example.com", "1700000000 +0900")
+	committer := GenerateAuthorAt("John Roe", "john@example.com", "1700000100 -0500")
+
+	first := &Commit{
+		Tree:      &Tree{ObjId: gitFirstTree},
+		Parents:   []string{""},
+		Author:    author,
+		Committer: committer,
+		Message:   "first commit",
+	}
+	assert.Equal(t, gitFirstCommit, objIdForTest(first))
+
+	second := &Commit{
+		Tree:      &Tree{ObjId: gitSecondTree},
+		Parents:   []string{gitFirstCommit},
+		Author:    GenerateAuthorAt("Jane Doe", "jane@example.com", "1700000200 +0900"),
+		Committer: GenerateAuthorAt("John Roe", "john@example.com", "1700000300 -0500"),
+		Message:   "second\n\nbody line",
+	}
+	assert.Equal(t, gitSecondCommit, objIdForTest(second))
+
+	//読み直しても同じbyte列になる
+	c := &CommitFromMem{}
+	assert.NoError(t, c.Parse(bytes.NewBufferString(second.ToString())))
+	assert.Equal(t, second.ToString(), c.ToString())
+	assert.Equal(t, []string{gitFirstCommit}, c.Parents)
+	assert.Equal(t, "Jane Doe", c.Author.Name)
+	assert.Equal(t, "John Roe", c.Committer.Name)
+	assert.Equal(t, "1700000300 -0500", c.Committer.CreatedAt)
+	assert.Equal(t, "second\n\nbody line", c.Message)
+}
+
+func TestTreeMatchesGit(t *testing.T) {
+	//dir-a,dir.txt,dir/の順に並ぶ
+	tree := GenerateTree()
+	tree.Build([]*Entry{
+		{Path: "a.txt", Mode: 0100644, ObjId: "78981922613b2afb6025042ff6bd878ac1994e85"},
+		{Path: "dir-a", Mode: 0100644, ObjId: "4bcfe98e640c8284511312660fb8709b0afa888e"},
+		{Path: "dir.txt", Mode: 0100644, ObjId: "f2ad6c76f0115a6ba5b00456a849810e7ec0af20"},
+		{Path: "dir/sub/b.txt", Mode: 0100644, ObjId: "61780798228d17af2d34fce4cfbdf35556832472"},
+		{Path: "run.sh", Mode: 0100755, ObjId: "1a2485251c33a70432394c93fb89330ef214bfc9"},
+	})
+	tree.Traverse(func(t *Tree) {
+		t.SetObjId(objIdForTest(t))
+	})
+
+	assert.Equal(t, gitFirstTree, tree.GetObjId())
+	assert.Equal(t, []string{"a.txt", "dir-a", "dir.txt", "dir", "run.sh"}, tree.SortedNames())
+
+	//読むとbasenameで引ける
+	parsed := GenerateTree()
+	assert.NoError(t, parsed.Parse(bytes.NewBufferString(tree.ToString())))
+	dir, ok := parsed.Entries["dir"].(*Entry)
+	assert.True(t, ok)
+	assert.True(t, dir.IsTree())
+	assert.Equal(t, "709c8f9d6353e162c529fc30e14a481632837699", dir.ObjId)
+	parsed.SetObjId(objIdForTest(parsed))
+	assert.Equal(t, gitFirstTree, parsed.GetObjId())
+}
+
+func TestParseSignedCommit(t *testing.T) {
+	raw := "tree " + gitFirstTree + "\n" +
+		"parent " + gitFirstCommit + "\n" +
+		"author Jane Doe <jane@example.com> 1700000000 +0900\n" +
+		"committer John Roe <john@example.com> 1700000100 -0500\n" +
+		"encoding ISO-8859-1\n" +
+		"gpgsig -----BEGIN SSH SIGNATURE-----\n" +
+		" U1NIU0lHAAAAAQ==\n" +
+		" -----END SSH SIGNATURE-----\n" +
+		"\n" +
+		"signed\n"
+
+	c := &CommitFromMem{}
+	assert.NoError(t, c.Parse(bytes.NewBufferString(raw)))
+	assert.Equal(t, raw, c.ToString())
+	assert.Equal(t, gitSignedCommit, objIdForTest(c))
+	assert.Equal(t, "signed", c.Message)
+
+	extra := c.ExtraHeaders()
+	assert.Equal(t, 2, len(extra))
+	assert.Equal(t, &CommitHeader{Key: "encoding", Value: "ISO-8859-1"}, extra[0])
+	assert.Equal(t, "-----BEGIN SSH SIGNATURE-----\nU1NIU0lHAAAAAQ==\n-----END SSH SIGNATURE-----", extra[1].Value)
+
+	//以前のmygitのcommiterと空のparentも読める
+	legacy := "tree " + gitFirstTree + "\nparent \nauthor a b <a@example.com> 1 +0000\ncommiter a b <a@example.com> 2 +0000\n\nold\n"
+	c = &CommitFromMem{}
+	assert.NoError(t, c.Parse(bytes.NewBufferString(legacy)))
+	assert.Equal(t, 0, len(c.Parents))
+	assert.Equal(t, "2 +0000", c.Committer.CreatedAt)
+	assert.Equal(t, legacy, c.ToString())
+}
+
+func TestParseGitDate(t *testing.T) {
+	tests := []struct {
+		date     string
+		expected string
+	}{
+		{date: "1700000000 +0900", expected: "1700000000 +0900"},
+		{date: "@1700000000 -0500", expected: "1700000000 -0500"},
+		{date: "1700000000", expected: "1700000000 +0000"},
+		{date: "Wed, 15 Nov 2023 07:13:20 +0900", expected: "1700000000 +0900"},
+		{date: "2023-11-15T07:13:20+09:00", expected: "1700000000 +0900"},
+		{date: "2023-11-14 17:13:20 -0500", expected: "1700000000 -0500"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.date, func(t *testing.T) {
+			ret, err := ParseGitDate(tt.date)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, ret)
+		})
+	}
+
+	_, err := ParseGitDate("yesterday")
+	assert.ErrorIs(t, err, ErrorInvalidDate)
+	_, err = ParseGitDate("1700000000 JST")
+	assert.ErrorIs(t, err, ErrorInvalidDate)
+}
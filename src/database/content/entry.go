@@ -17,9 +17,20 @@ import (
 var (
 	REGULAR_MODE    = "100644"
 	EXECUTABLE_MODE = "100755"
+	SYMLINK_MODE    = "120000"
+	GITLINK_MODE    = "160000"
 	ENTRY_BLOCK     = 8
 )
 
+//flagsの0x4000が立っていればflagsのあとに拡張flags(2byte)が続く(index v3以上)
+const (
+	FLAG_EXTENDED = 0x4000
+	//拡張flags、sparse checkoutで作業ディレクトリに置かないもの
+	EXTENDED_SKIP_WORKTREE = 0x4000
+	//拡張flags、add -Nで中身はまだaddしていないもの
+	EXTENDED_INTENT_TO_ADD = 0x2000
+)
+
 type FileState = os.FileInfo
 
 type Entry struct {
@@ -39,7 +50,9 @@ type Entry struct {
 	Size       int64
 	ObjId      string
 	Flags      int
-	Path       string
+	//EXTENDED_SKIP_WORKTREEとEXTENDED_INTENT_TO_ADD、0でなければv3以上で書く
+	ExtendedFlags int
+	Path          string
 }
 
 type EntryStateBin struct {
@@ -59,38 +72,56 @@ type EntryFlagsBin struct {
 	Flags uint16
 }
 
+func (e *Entry) IsIntentToAdd() bool {
+	return e.ExtendedFlags&EXTENDED_INTENT_TO_ADD != 0
+}
+
+func (e *Entry) IsSkipWorktree() bool {
+	return e.ExtendedFlags&EXTENDED_SKIP_WORKTREE != 0
+}
+
+func (e *Entry) SetIntentToAdd(on bool) {
+	e.setExtendedFlag(EXTENDED_INTENT_TO_ADD, on)
+}
+
+func (e *Entry) SetSkipWorktree(on bool) {
+	e.setExtendedFlag(EXTENDED_SKIP_WORKTREE, on)
+}
+
+func (e *Entry) setExtendedFlag(flag int, on bool) {
+	if on {
+		e.ExtendedFlags |= flag
+	} else {
+		e.ExtendedFlags &^= flag
+	}
+}
+
+//objIdの長さはhashで変わるのでstatとflagsの間に別に読む
 type EntryFromMem struct {
-	CTime      uint32
-	CTime_nsec uint32
-	MTime      uint32
-	MTime_nsec uint32
-	Dev        uint32
-	Ino        uint32
-	Mode       uint32
-	UId        uint32
-	GId        uint32
-	Size       uint32
-	ObjId      [20]byte
-	Flags      uint16
+	EntryStateBin
+	ObjId         []byte
+	Flags         uint16
+	ExtendedFlags uint16
 }
 
 func (em *EntryFromMem) ConvertToEntity(path string) *Entry {
-	hexString := hex.EncodeToString(em.ObjId[:])
+	hexString := hex.EncodeToString(em.ObjId)
 
 	return &Entry{
-		CTime:      int64(em.CTime),
-		CTime_nsec: int64(em.CTime_nsec),
-		MTime:      int64(em.MTime),
-		MTime_nsec: int64(em.MTime_nsec),
-		Dev:        uint64(em.Dev),
-		Ino:        uint64(em.Ino),
-		Mode:       int(em.Mode),
-		UId:        em.UId,
-		GId:        em.GId,
-		Size:       int64(em.Size),
-		ObjId:      hexString,
-		Flags:      int(em.Flags),
-		Path:       path,
+		CTime:         int64(em.CTime),
+		CTime_nsec:    int64(em.CTime_nsec),
+		MTime:         int64(em.MTime),
+		MTime_nsec:    int64(em.MTime_nsec),
+		Dev:           uint64(em.Dev),
+		Ino:           uint64(em.Ino),
+		Mode:          int(em.Mode),
+		UId:           em.UId,
+		GId:           em.GId,
+		Size:          int64(em.Size),
+		ObjId:         hexString,
+		Flags:         int(em.Flags) &^ FLAG_EXTENDED,
+		ExtendedFlags: int(em.ExtendedFlags),
+		Path:          path,
 	}
 }
 
@@ -98,8 +129,32 @@ func IsExec(mode uint32) bool {
 	return mode&0111 != 0
 }
 
+//modeの上位bitがファイルの種類、symlinkのblobの中身はlinkの先のpath
+func IsSymlink(mode uint32) bool {
+	return mode&0170000 == 0120000
+}
+
+//submoduleのcommitを指すentry、objIdはこのrepositoryにはないcommit
+func IsGitlink(mode uint32) bool {
+	return mode&0170000 == 0160000
+}
+
+//100644と100755は同じファイルで、ファイルとsymlinkの入れ替わりはtypechangeになる
+func IsTypeChange(a, b int) bool {
+	return a&0170000 != b&0170000
+}
+
 //これはtree,entryとかの書き込みで使う 040000 tree 100644 hello.txtで使うのでstring
 func (e *Entry) getMode() string {
+	if e.IsTree() {
+		return DIRECTORY_MODE
+	}
+	if e.IsSymlink() {
+		return SYMLINK_MODE
+	}
+	if e.IsGitlink() {
+		return GITLINK_MODE
+	}
 	if IsExec(uint32(e.Mode)) {
 		return EXECUTABLE_MODE
 	} else {
@@ -112,6 +167,14 @@ func (e *Entry) IsTree() bool {
 	return e.Mode == int(i)
 }
 
+func (e *Entry) IsSymlink() bool {
+	return IsSymlink(uint32(e.Mode))
+}
+
+func (e *Entry) IsGitlink() bool {
+	return IsGitlink(uint32(e.Mode))
+}
+
 func ModeToInt(mode string) int {
 	i, _ := strconv.ParseInt(mode, 8, 64)
 	return int(i)
@@ -128,7 +191,16 @@ func (e *Entry) SetObjId(objId string) {
 	e.ObjId = objId
 }
 
+//index v2,v3の形、pathはNULのあと8byteにそろえる
 func (e *Entry) ToString() string {
+	tempStr := e.EncodeHeader()
+	tempStr += fmt.Sprintf("%s\x00", e.Path)
+
+	return PaddingAlign8(tempStr)
+}
+
+//statからflags(拡張flagsがあればそれも)まで、pathの書き方はindexのversionで変わる
+func (e *Entry) EncodeHeader() string {
 	var tempStr string
 	buf := new(bytes.Buffer)
 
@@ -154,18 +226,22 @@ func (e *Entry) ToString() string {
 
 	tempStr += ret
 
+	flags := e.Flags &^ FLAG_EXTENDED
+	if e.ExtendedFlags != 0 {
+		flags |= FLAG_EXTENDED
+	}
 	fb := &EntryFlagsBin{
-		Flags: uint16(e.Flags),
+		Flags: uint16(flags),
 	}
 	binary.Write(buf, binary.BigEndian, fb)
+	if e.ExtendedFlags != 0 {
+		binary.Write(buf, binary.BigEndian, uint16(e.ExtendedFlags))
+	}
 
 	tempStr += buf.String()
 	buf.Reset()
 
-	tempStr += fmt.Sprintf("%s\x00", e.Path)
-
-	return PaddingAlign8(tempStr)
-
+	return tempStr
 }
 
 func PaddingAlign8(str string) string {
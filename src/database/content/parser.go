@@ -3,12 +3,14 @@ package content
 import (
 	"errors"
 	"io"
+	"mygit/src/crypt"
 )
 
 const (
 	BLOB   = "blob"
 	TREE   = "tree"
 	COMMIT = "commit"
+	TAG    = "tag"
 )
 
 var ErrorUndefinedGitObjectType = errors.New("undefinedGitObjectType")
@@ -21,14 +23,21 @@ type ParsedObj interface {
 }
 
 func Parse(objType string, r io.Reader) (ParsedObj, error) {
+	return ParseWithHash(objType, crypt.SHA1, r)
+}
+
+//treeのentryのobjIdはbinaryなので、長さをhashから決める
+func ParseWithHash(objType string, h crypt.Hash, r io.Reader) (ParsedObj, error) {
 
 	switch objType {
 	case BLOB:
 		return ParseBlob(r)
 	case TREE:
-		return ParseTree(r)
+		return ParseTree(r, h)
 	case COMMIT:
 		return ParseCommit(r)
+	case TAG:
+		return ParseTag(r)
 	default:
 		return nil, ErrorUndefinedGitObjectType
 	}
@@ -40,8 +49,9 @@ func ParseBlob(r io.Reader) (ParsedObj, error) {
 	return b, nil
 }
 
-func ParseTree(r io.Reader) (ParsedObj, error) {
+func ParseTree(r io.Reader, h crypt.Hash) (ParsedObj, error) {
 	t := GenerateTree()
+	t.Hash = h
 	t.Parse(r)
 	return t, nil
 }
@@ -51,3 +61,9 @@ func ParseCommit(r io.Reader) (ParsedObj, error) {
 	c.Parse(r)
 	return c, nil
 }
+
+func ParseTag(r io.Reader) (ParsedObj, error) {
+	t := &Tag{}
+	t.Parse(r)
+	return t, nil
+}
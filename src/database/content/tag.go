@@ -0,0 +1,146 @@
+package content
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+//annotated tagのobject
+//object <objId>
+//type commit
+//tag <tagName>
+//tagger name <email> time timezone
+//
+//message
+//-----BEGIN SSH SIGNATURE-----
+//...
+//-----END SSH SIGNATURE-----
+//署名されたtagはmessageのあとに署名がつく
+type Tag struct {
+	ObjId   string
+	Object  string
+	ObjType string
+	TagName string
+	Tagger  *Author
+	Message string
+	//改行で終わるarmor済みの署名、なければ空
+	Signature string
+}
+
+//本家がmessageの中で署名の始まりとみなす行
+var signatureBegins = []string{
+	"-----BEGIN PGP SIGNATURE-----",
+	"-----BEGIN PGP MESSAGE-----",
+	"-----BEGIN SIGNED MESSAGE-----",
+	"-----BEGIN SSH SIGNATURE-----",
+}
+
+func isSignatureBegin(line string) bool {
+	for _, begin := range signatureBegins {
+		if line == begin {
+			return true
+		}
+	}
+	return false
+}
+
+func GenerateTag(object, objType, tagName string, tagger *Author, message string) *Tag {
+	return &Tag{
+		Object:  object,
+		ObjType: objType,
+		TagName: tagName,
+		Tagger:  tagger,
+		Message: message,
+	}
+}
+
+func (t *Tag) Type() string {
+	return TAG
+}
+
+func (t *Tag) ToString() string {
+	return t.Payload() + t.Signature
+}
+
+//署名の対象になるbyte列、署名を除いたもの
+func (t *Tag) Payload() string {
+	var str string
+	str += fmt.Sprintf("object %s\n", t.Object)
+	str += fmt.Sprintf("type %s\n", t.ObjType)
+	str += fmt.Sprintf("tag %s\n", t.TagName)
+	if t.Tagger != nil {
+		str += fmt.Sprintf("tagger %s\n", t.Tagger.ToString())
+	}
+	str += "\n"
+	str += t.Message + "\n"
+
+	return str
+}
+
+func (t *Tag) GetObjId() string {
+	return t.ObjId
+}
+
+func (t *Tag) SetObjId(objId string) {
+	t.ObjId = objId
+}
+
+func (t *Tag) Basename() string {
+	return ""
+}
+
+func (t *Tag) getMode() string {
+	return ""
+}
+
+func (t *Tag) GetFirstLineMessage() string {
+	s := strings.Split(t.Message, "\n")
+	return s[0]
+}
+
+func (t *Tag) Parse(r io.Reader) error {
+	s := bufio.NewScanner(r)
+
+	//headerは空行まで
+	for s.Scan() {
+		text := s.Text()
+		if text == "" {
+			break
+		}
+
+		key, value, found := strings.Cut(text, " ")
+		if !found {
+			continue
+		}
+
+		switch key {
+		case "object":
+			t.Object = value
+		case "type":
+			t.ObjType = value
+		case "tag":
+			t.TagName = value
+		case "tagger":
+			t.Tagger = ParseAuthorLine(value)
+		}
+	}
+
+	var messages []string
+	var signature []string
+	for s.Scan() {
+		text := s.Text()
+		if len(signature) > 0 || isSignatureBegin(text) {
+			signature = append(signature, text)
+			continue
+		}
+		messages = append(messages, text)
+	}
+	t.Message = strings.Join(messages, "\n")
+	if len(signature) > 0 {
+		t.Signature = strings.Join(signature, "\n") + "\n"
+	}
+
+	return nil
+}
@@ -0,0 +1,31 @@
+package content
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTagToStringAndParse(t *testing.T) {
+	tagger := &Author{
+		Name:      "tag user",
+		Email:     "tag@example.com",
+		CreatedAt: "1620000000 +0900",
+	}
+	tag := GenerateTag("03fb89c2c5c6ad1c0d21c4ac77595175eeba6b27", COMMIT, "v1.0", tagger, "release v1.0\n\nfirst release")
+
+	expected := "object 03fb89c2c5c6ad1c0d21c4ac77595175eeba6b27\ntype commit\ntag v1.0\ntagger tag user <tag@example.com> 1620000000 +0900\n\nrelease v1.0\n\nfirst release\n"
+	assert.Equal(t, expected, tag.ToString())
+
+	o, err := Parse(TAG, bytes.NewBufferString(tag.ToString()))
+	assert.NoError(t, err)
+
+	parsed, ok := o.(*Tag)
+	assert.True(t, ok)
+	if diff := cmp.Diff(tag, parsed); diff != "" {
+		t.Errorf("diff is %s\n", diff)
+	}
+	assert.Equal(t, "release v1.0", parsed.GetFirstLineMessage())
+}
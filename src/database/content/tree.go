@@ -6,7 +6,11 @@ import (
 	"encoding/hex"
 	"fmt"
 	"io"
+	hashing "mygit/src/crypt"
 	"mygit/src/database/crypt"
+	"path"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -15,19 +19,21 @@ type Tree struct {
 	Entries map[string]Object
 	ObjId   string
 	Content string
+	//Parseの時にentryのobjIdを何byte読むか、nilならsha1
+	Hash hashing.Hash
 }
 
 func (t *Tree) Type() string {
 	return "tree"
 }
 
+//本家と同じくentryはbasenameで書き、名前順に並べる
 func (t *Tree) ToString() string {
-	// sort.Slice(t.Entries, func(i, j int) bool { return t.Entries[i].Name < t.Entries[j].Name })
 	str := ""
 
-	for k, v := range t.Entries {
-
-		str += fmt.Sprintf("%s %s\x00", v.getMode(), k)
+	for _, k := range t.SortedNames() {
+		v := t.Entries[k]
+		str += fmt.Sprintf("%s %s\x00", v.getMode(), path.Base(filepath.ToSlash(k)))
 		ret, _ := crypt.CreateH40(v.GetObjId())
 
 		str += ret
@@ -37,6 +43,38 @@ func (t *Tree) ToString() string {
 
 }
 
+//本家の並び順ではdirectoryは名前の後ろに/がついているものとして比べる
+//dir-a,dir.txt,dir/の順になる
+func (t *Tree) SortedNames() []string {
+	var names []string
+	sortKeys := make(map[string]string)
+	for k, v := range t.Entries {
+		key := path.Base(filepath.ToSlash(k))
+		if isTreeObject(v) {
+			key += "/"
+		}
+		sortKeys[k] = key
+		names = append(names, k)
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		return sortKeys[names[i]] < sortKeys[names[j]]
+	})
+
+	return names
+}
+
+func isTreeObject(o Object) bool {
+	switch v := o.(type) {
+	case *Tree:
+		return true
+	case *Entry:
+		return v.IsTree()
+	default:
+		return false
+	}
+}
+
 func (t *Tree) Traverse(fn func(t *Tree)) {
 	for _, v := range t.Entries {
 		t, ok := v.(*Tree)
@@ -124,10 +162,12 @@ func GenerateTree() *Tree {
 	}
 }
 
-var ENTRY_SIZE = 20
-
 func (t *Tree) Parse(r io.Reader) error {
 	b := bufio.NewReader(r)
+	h := t.Hash
+	if h == nil {
+		h = hashing.SHA1
+	}
 
 	for {
 		//eofまで下三つを繰り返す
@@ -151,8 +191,8 @@ func (t *Tree) Parse(r io.Reader) error {
 		}
 		path := pathWithNullTerm[:len(pathWithNullTerm)-1]
 
-		//20bytes読むとき
-		sum := make([]byte, ENTRY_SIZE)
+		//sha1なら20byte、sha256なら32byte
+		sum := make([]byte, h.Size())
 		err = binary.Read(b, binary.BigEndian, &sum)
 		if err == io.EOF {
 			break
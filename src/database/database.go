@@ -20,6 +20,22 @@ import (
 type Database struct {
 	Path string
 	Objs map[string]c.Object
+	//objIdを計算するhash、nilならsha1
+	Hash crypt.Hash
+	//objects/pack以下のpack、Packs()で読み込む
+	packs []*Pack
+}
+
+func (d *Database) GetHash() crypt.Hash {
+	if d.Hash == nil {
+		return crypt.SHA1
+	}
+	return d.Hash
+}
+
+//"type size\x00content"のobjId、書き込みはしない(hash-object)
+func (d *Database) HashObject(content string) string {
+	return d.GetHash().HexDigest(content)
 }
 
 func (d *Database) CreateContent(o c.Object) string {
@@ -28,7 +44,7 @@ func (d *Database) CreateContent(o c.Object) string {
 	return content
 }
 func (d *Database) SetObjId(o c.Object, content string) {
-	o.SetObjId(crypt.HexDigestBySha1(content))
+	o.SetObjId(d.HashObject(content))
 }
 
 func GetStoreHeaderContent(o c.Object) string {
@@ -40,7 +56,7 @@ func GetStoreHeaderContent(o c.Object) string {
 
 func (d *Database) Store(o c.Object) {
 	content := GetStoreHeaderContent(o)
-	o.SetObjId(crypt.HexDigestBySha1(content))
+	o.SetObjId(d.HashObject(content))
 	d.WriteObject(o.GetObjId(), content)
 }
 
@@ -49,6 +65,16 @@ func (d *Database) ObjPath(objId string) string {
 	return filepath.Join(d.Path, objId[0:2], objId[2:])
 }
 
+//looseかpackのどちらかにあればtrue
+func (d *Database) HasObject(objId string) bool {
+	if _, err := os.Stat(d.ObjPath(objId)); err == nil {
+		return true
+	}
+
+	packed, err := d.HasPackedObject(objId)
+	return err == nil && packed
+}
+
 func (d *Database) WriteObject(objId, content string) error {
 	// objPath := filepath.Join(d.Path, objId[0:2], objId[2:])
 	// dirName := filepath.Dir(filepath.Clean(objPath))
@@ -60,6 +86,10 @@ func (d *Database) WriteObject(objId, content string) error {
 		return nil
 	}
 
+	if packed, err := d.HasPackedObject(objId); err == nil && packed {
+		return nil
+	}
+
 	var in bytes.Buffer
 	err := CompressWithDeflate(&in, content)
 
@@ -101,28 +131,56 @@ func Inflate(w io.Writer, r io.Reader) error {
 
 var ErrorUnexpectedObjType = errors.New("unexpectedObjType")
 
-func (d *Database) GenerateTree(objId string) (string, error) {
-	var retContent string
-
+//treeにはbasenameしか書かれていないので、prefixをつけたpathをkeyとEntry.Pathにして返す
+func (d *Database) ReadTree(objId, prefix string) (*c.Tree, error) {
 	o, err := d.ReadObject(objId)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	//まず一番初めにCommitをParseしてTreeを入手しそのEntriesを使うので、、ここにはEntryであるTreeかBlobしか来ない想定
 	t, ok := o.(*c.Tree)
 	if !ok {
-		return "", ErrorUnexpectedObjType
+		return nil, ErrorUnexpectedObjType
+	}
+	if prefix == "" {
+		return t, nil
 	}
 
-	for _, v := range t.Entries {
+	entries := make(map[string]c.Object)
+	for name, v := range t.Entries {
 		e, ok := v.(*c.Entry)
+		if !ok {
+			return nil, ErrorUnexpectedObjType
+		}
+		e.Path = filepath.Join(prefix, name)
+		entries[e.Path] = e
+	}
+	t.Entries = entries
+
+	return t, nil
+}
+
+func (d *Database) GenerateTree(objId string) (string, error) {
+	return d.generateTree(objId, "")
+}
+
+func (d *Database) generateTree(objId, prefix string) (string, error) {
+	var retContent string
+
+	//まず一番初めにCommitをParseしてTreeを入手しそのEntriesを使うので、、ここにはEntryであるTreeかBlobしか来ない想定
+	t, err := d.ReadTree(objId, prefix)
+	if err != nil {
+		return "", err
+	}
+
+	for _, k := range t.SortedNames() {
+		e, ok := t.Entries[k].(*c.Entry)
 		if !ok {
 			return "", ErrorUnexpectedObjType
 		}
 
 		if e.IsTree() {
-			ret, err := d.GenerateTree(e.ObjId)
+			ret, err := d.generateTree(e.ObjId, e.Path)
 			if err != nil {
 				return "", err
 			}
@@ -164,7 +222,7 @@ func (d *Database) ReadObject(objId string) (c.ParsedObj, error) {
 	if err != nil {
 		return nil, err
 	}
-	o, err := ParseObjectContent(hAndR.ObjType, hAndR.Reader)
+	o, err := ParseObjectContent(hAndR.ObjType, d.GetHash(), hAndR.Reader)
 	if err != nil {
 		return nil, err
 	}
@@ -175,8 +233,8 @@ func (d *Database) ReadObject(objId string) (c.ParsedObj, error) {
 
 }
 
-func ParseObjectContent(objType string, r io.Reader) (c.ParsedObj, error) {
-	obj, err := c.Parse(objType, r)
+func ParseObjectContent(objType string, h crypt.Hash, r io.Reader) (c.ParsedObj, error) {
+	obj, err := c.ParseWithHash(objType, h, r)
 	if err != nil {
 		return nil, err
 	}
@@ -184,10 +242,20 @@ func ParseObjectContent(objType string, r io.Reader) (c.ParsedObj, error) {
 	return obj, err
 }
 
+//looseになければpackから探す、どちらでも"type size\x00content"の形で返す
 func (d *Database) GetContent(objId string) (io.Reader, error) {
 	objPath := d.ObjPath(objId)
 	if _, err := os.Stat(objPath); err != nil {
-		return nil, err
+		o, packErr := d.ReadPackedObject(objId)
+		if packErr == ErrorPackObjNotFound {
+			//どちらにもないときはlooseのerrorをそのまま返す
+			return nil, err
+		}
+		if packErr != nil {
+			return nil, packErr
+		}
+
+		return bytes.NewBufferString(o.HeaderContent()), nil
 	}
 
 	data, err := ioutil.ReadFile(objPath)
@@ -262,14 +330,10 @@ func (d *Database) BuildList(path string, m map[string]*con.Entry, e *con.Entry)
 	}
 
 	//Treeの時
-	o, err := d.ReadObject(e.GetObjId())
+	t, err := d.ReadTree(e.GetObjId(), path)
 	if err != nil {
 		return nil, err
 	}
-	t, ok := o.(*con.Tree)
-	if !ok {
-		return nil, ErrorObjeToEntryConvError
-	}
 
 	for _, o := range t.Entries {
 		e, ok := o.(*con.Entry)
@@ -349,24 +413,25 @@ func (d *Database) RunLoadTreeEntry(objId, path string) (*con.Entry, error) {
 	var currentEntry con.Object //基本的にTree,最後の1ループでcurrentEntryにBlobがセットされる
 	currentEntry = rootTreeEntry
 	//DescendをrelativePathで使う想定
+	prefix := ""
 	for _, p := range util.Descend(path) {
 		if currentEntry == nil {
 			break
 		}
-		o, err := d.ReadObject(currentEntry.GetObjId())
+		// 最後の1ループでcurrentEntryにBlobがセットされる、それまでは全部TreeなのでここでTreeConversionをしてよい
+		t, err := d.ReadTree(currentEntry.GetObjId(), prefix)
 		if err != nil {
 			return nil, err
 		}
-		// 最後の1ループでcurrentEntryにBlobがセットされる、それまでは全部TreeなのでここでTreeConversionをしてよい
-		t, ok := o.(*con.Tree)
+
+		newEntry, ok := t.Entries[p]
 		if !ok {
-			return nil, ErrorObjeToEntryConvError
+			currentEntry = nil
+			break
 		}
 
-		newEntry := t.Entries[p]
-
 		currentEntry = newEntry
-
+		prefix = p
 	}
 
 	//blobだろうが、treeだろうがEntryの形であることには変わりない
@@ -0,0 +1,89 @@
+package database
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+var ErrorInvalidEWAH = errors.New("invalid ewah bitmap")
+
+//本家のewah/ewah_io.cと同じ形のEWAH圧縮bitmap
+//bit数(4byte)、word数(4byte)、word(8byteずつ)、最後のrunning length wordの位置(4byte)
+//running length wordは最下位bitが連続するbitの値、次の32bitが連続するword数、残り31bitが後に続くliteral word数
+
+//立っているbitの位置を小さい順に返す、読んだbyte数も返す
+func ReadEWAH(bs []byte) ([]int, int, error) {
+	if len(bs) < 8 {
+		return nil, 0, ErrorInvalidEWAH
+	}
+	bitSize := int(binary.BigEndian.Uint32(bs[0:4]))
+	wordCount := int(binary.BigEndian.Uint32(bs[4:8]))
+	size := 8 + wordCount*8 + 4
+	if wordCount < 0 || len(bs) < size {
+		return nil, 0, ErrorInvalidEWAH
+	}
+
+	words := make([]uint64, wordCount)
+	for n := range words {
+		words[n] = binary.BigEndian.Uint64(bs[8+n*8:])
+	}
+
+	var positions []int
+	pos := 0
+	for n := 0; n < len(words); {
+		rlw := words[n]
+		n++
+		running := int((rlw >> 1) & 0xffffffff)
+		literals := int(rlw >> 33)
+
+		if rlw&1 == 1 {
+			for b := 0; b < running*64; b++ {
+				positions = append(positions, pos+b)
+			}
+		}
+		pos += running * 64
+
+		if len(words) < n+literals {
+			return nil, 0, ErrorInvalidEWAH
+		}
+		for _, word := range words[n : n+literals] {
+			for b := 0; b < 64; b++ {
+				if word&(1<<uint(b)) != 0 {
+					positions = append(positions, pos+b)
+				}
+			}
+			pos += 64
+		}
+		n += literals
+	}
+
+	//bit数より後ろは使わない
+	for len(positions) > 0 && positions[len(positions)-1] >= bitSize {
+		positions = positions[:len(positions)-1]
+	}
+
+	return positions, size, nil
+}
+
+//positionsは小さい順、圧縮はせずliteral wordだけで書く
+func EncodeEWAH(positions []int) []byte {
+	bitSize := 0
+	if len(positions) > 0 {
+		bitSize = positions[len(positions)-1] + 1
+	}
+
+	literals := make([]uint64, (bitSize+63)/64)
+	for _, p := range positions {
+		literals[p/64] |= 1 << uint(p%64)
+	}
+	words := append([]uint64{uint64(len(literals)) << 33}, literals...)
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, uint32(bitSize))
+	binary.Write(&buf, binary.BigEndian, uint32(len(words)))
+	binary.Write(&buf, binary.BigEndian, words)
+	binary.Write(&buf, binary.BigEndian, uint32(0))
+
+	return buf.Bytes()
+}
@@ -0,0 +1,143 @@
+package database
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"sort"
+)
+
+var FSMONITOR_SIGNATURE = "FSMN"
+
+//本家のversion2と同じくtokenは文字列で持つ、version1のtimestampは読めるが使わない
+var FSMONITOR_VERSION = uint32(2)
+
+var ErrorInvalidFsmonitor = errors.New("invalid fsmonitor extension")
+
+//version、NUL終端のtoken、EWAHの長さ、前回調べたときに作業ディレクトリと一致していなかったentryの位置
+func (i *Index) readFsmonitorExtension(bs []byte) error {
+	if len(bs) < 4 {
+		return ErrorInvalidFsmonitor
+	}
+
+	var token string
+	rest := bs[4:]
+	switch binary.BigEndian.Uint32(bs[:4]) {
+	case 1:
+		if len(rest) < 8 {
+			return ErrorInvalidFsmonitor
+		}
+		rest = rest[8:]
+	case 2:
+		end := bytes.IndexByte(rest, 0)
+		if end < 0 {
+			return ErrorInvalidFsmonitor
+		}
+		token = string(rest[:end])
+		rest = rest[end+1:]
+	default:
+		return ErrorInvalidFsmonitor
+	}
+
+	if len(rest) < 4 {
+		return ErrorInvalidFsmonitor
+	}
+	size := int(binary.BigEndian.Uint32(rest[:4]))
+	positions, read, err := ReadEWAH(rest[4:])
+	if err != nil {
+		return err
+	}
+	if read != size {
+		return ErrorInvalidFsmonitor
+	}
+
+	keys := i.Entries.GetSortedkey()
+	dirty := make(map[string]struct{})
+	for _, p := range positions {
+		if len(keys) <= p {
+			return ErrorInvalidFsmonitor
+		}
+		dirty[keys[p].Path] = struct{}{}
+	}
+
+	//timestampのtokenはこちらのdaemonでは使えないので、次は全体を調べる
+	i.FsmonitorToken = token
+	i.FsmonitorDirty = dirty
+
+	return nil
+}
+
+func (i *Index) encodeFsmonitorExtension() []byte {
+	var positions []int
+	for n, k := range i.Entries.GetSortedkey() {
+		if _, ok := i.FsmonitorDirty[k.Path]; ok {
+			positions = append(positions, n)
+		}
+	}
+	ewah := EncodeEWAH(positions)
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, FSMONITOR_VERSION)
+	buf.WriteString(i.FsmonitorToken)
+	buf.WriteByte(0)
+	binary.Write(&buf, binary.BigEndian, uint32(len(ewah)))
+	buf.Write(ewah)
+
+	return buf.Bytes()
+}
+
+//tokenより後の変更はfsmonitorに聞けばわかるので、dirtyでもなければstatしなくていい
+func (i *Index) IsFsmonitorValid(path string) bool {
+	if i.FsmonitorToken == "" {
+		return false
+	}
+	_, dirty := i.FsmonitorDirty[path]
+	return !dirty
+}
+
+//statusで作業ディレクトリを調べた後に、そのときのtokenと一致しなかったentryを残す
+func (i *Index) UpdateFsmonitor(token string, dirty []string) {
+	m := make(map[string]struct{})
+	for _, p := range dirty {
+		m[p] = struct{}{}
+	}
+
+	if token == i.FsmonitorToken && sameDirty(i.FsmonitorDirty, m) {
+		return
+	}
+	i.FsmonitorToken = token
+	i.FsmonitorDirty = m
+	i.Changed = true
+}
+
+func sameDirty(a, b map[string]struct{}) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k := range a {
+		if _, ok := b[k]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (i *Index) FsmonitorDirtyPaths() []string {
+	var paths []string
+	for p := range i.FsmonitorDirty {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+//entryを入れ替えた時はstatが作業ディレクトリと合っているかわからないので調べ直す
+func (i *Index) markFsmonitorDirty(path string) {
+	if i.FsmonitorToken == "" {
+		return
+	}
+	if i.FsmonitorDirty == nil {
+		i.FsmonitorDirty = make(map[string]struct{})
+	}
+	i.FsmonitorDirty[path] = struct{}{}
+}
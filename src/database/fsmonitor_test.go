@@ -0,0 +1,87 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_EWAHRoundTrip(t *testing.T) {
+	for _, positions := range [][]int{
+		nil,
+		{0},
+		{2},
+		{1, 63, 64, 200},
+	} {
+		bs := EncodeEWAH(positions)
+		got, size, err := ReadEWAH(bs)
+		assert.NoError(t, err)
+		assert.Equal(t, len(bs), size)
+		assert.Equal(t, positions, got)
+	}
+
+	//runを使った圧縮されたもの、0が1word続いたあと1が2word続き、literalが1word
+	bs := []byte{
+		0, 0, 0, 200,
+		0, 0, 0, 3,
+		0, 0, 0, 0, 0, 0, 0, 2,
+		0, 0, 0, 2, 0, 0, 0, 5,
+		0, 0, 0, 0, 0, 0, 0, 1,
+		0, 0, 0, 1,
+	}
+	got, _, err := ReadEWAH(bs)
+	assert.NoError(t, err)
+	assert.Equal(t, 129, len(got))
+	assert.Equal(t, 64, got[0])
+	assert.Equal(t, 191, got[127])
+	assert.Equal(t, 192, got[128])
+
+	_, _, err = ReadEWAH(bs[:20])
+	assert.ErrorIs(t, err, ErrorInvalidEWAH)
+}
+
+//testData/index_fsmonitorはgitでcore.fsmonitorにtok123とc.txtを返すhookを設定してstatusしたもの
+func Test_ReadFsmonitorFromGit(t *testing.T) {
+	cur, err := os.Getwd()
+	assert.NoError(t, err)
+	fixture := filepath.Join(cur, "testData/index_fsmonitor")
+
+	i := GenerateIndex(fixture)
+	err = i.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, "tok123", i.FsmonitorToken)
+	assert.Equal(t, []string{"c.txt"}, i.FsmonitorDirtyPaths())
+	assert.True(t, i.IsFsmonitorValid("a.txt"))
+	assert.False(t, i.IsFsmonitorValid("c.txt"))
+
+	//書き戻すとgitの書いたものと同じになる
+	tempPath, err := os.MkdirTemp(cur, "")
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(tempPath)
+	})
+	i.Changed = true
+	err = i.Write(filepath.Join(tempPath, "index"))
+	assert.NoError(t, err)
+	want, err := os.ReadFile(fixture)
+	assert.NoError(t, err)
+	got, err := os.ReadFile(filepath.Join(tempPath, "index"))
+	assert.NoError(t, err)
+	assert.Equal(t, want, got)
+
+	//entryを入れ替えたら調べ直す
+	e, ok := i.EntryForPath("a.txt")
+	assert.True(t, ok)
+	replaced := *e
+	i.StoreEntry(&replaced)
+	assert.False(t, i.IsFsmonitorValid("a.txt"))
+
+	i.Changed = false
+	i.UpdateFsmonitor("tok123", []string{"a.txt", "c.txt"})
+	assert.False(t, i.Changed)
+	i.UpdateFsmonitor("tok124", nil)
+	assert.True(t, i.Changed)
+	assert.True(t, i.IsFsmonitorValid("c.txt"))
+}
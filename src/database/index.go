@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"mygit/src/crypt"
@@ -15,10 +16,16 @@ import (
 var (
 	REGULAR_MODE    = 0100644
 	EXECUTABLE_MODE = 0100755
+	SYMLINK_MODE    = 0120000
+	GITLINK_MODE    = 0160000
 	MAX_PATH_SIZE   = 0xfff
 	SIGNATURE       = "DIRC"
-	VERSION         = uint32(2)
-	HeaderBinLen    = 8
+	//新しく作るindexのversion、index.versionで変えられる
+	VERSION = uint32(2)
+	//v3は拡張flags、v4はpathを前のentryとの差分で書く
+	MIN_VERSION  = uint32(2)
+	MAX_VERSION  = uint32(4)
+	HeaderBinLen = 8
 )
 
 type HeaderBin struct {
@@ -34,6 +41,25 @@ type Index struct {
 	Keys    KeysSlice
 	Changed bool
 	Parents map[string][]string
+	//entryのobjIdと末尾のchecksumのhash、nilならsha1
+	Hash crypt.Hash
+	//読み込んだindexのversion、まだ読んでいなければ0
+	Version uint32
+	//index.versionの設定、設定がなければ0を返す
+	ConfiguredVersion func() (uint32, error)
+	//TREE拡張、なければnil
+	CacheTree *CacheTree
+	//FSMN拡張、fsmonitorに前回聞いたときのtoken、""ならfsmonitorを使っていない
+	FsmonitorToken string
+	//そのときに作業ディレクトリと一致していなかったentryのpath
+	FsmonitorDirty map[string]struct{}
+}
+
+func (i *Index) GetHash() crypt.Hash {
+	if i.Hash == nil {
+		return crypt.SHA1
+	}
+	return i.Hash
 }
 
 func (i *Index) IsConflicted() bool {
@@ -172,6 +198,7 @@ func (i *Index) RemoveEntryWithStage(path string, stage int) {
 	}
 
 	i.Keys = i.Keys.Delete(ek)
+	i.invalidateCacheTree(path)
 
 	delete(i.Entries, EntryKey{
 		Path:  path,
@@ -218,7 +245,11 @@ func (i *Index) AddFromDB(path string, e *con.Entry) {
 }
 
 func (i *Index) Clear() *Index {
-	return GenerateIndex(i.Path)
+	newi := GenerateIndex(i.Path)
+	newi.Hash = i.Hash
+	newi.Version = i.Version
+	newi.ConfiguredVersion = i.ConfiguredVersion
+	return newi
 }
 
 func (i *Index) Reset() *Index {
@@ -309,19 +340,39 @@ func (i *Index) StoreEntry(e *con.Entry) {
 		Stage: e.GetStage(),
 	}
 	if i.Keys.Contains(key) {
+		//中身の変わらないentryを入れ直しただけならcache treeはそのまま使える
+		if old, ok := i.Entries[key].(*con.Entry); !ok || !sameTreeEntry(old, e) {
+			i.invalidateCacheTree(e.Path)
+		}
 		i.Entries[key] = e
 	} else {
+		i.invalidateCacheTree(e.Path)
 		i.Keys = append(i.Keys, key)
 		i.Entries[key] = e
 	}
 
 	i.StoreParent(e)
+	i.markFsmonitorDirty(e.Path)
 
 	// i.Keys = append(i.Keys, path)
 	// i.Entries[path] = e
 
 }
 
+//sparse-checkoutで作業ディレクトリに置くかどうかが変わったentry、treeは変わらないのでcache treeはそのまま
+func (i *Index) SetSkipWorktree(e *con.Entry, on bool) {
+	if e.IsSkipWorktree() == on {
+		return
+	}
+	e.SetSkipWorktree(on)
+	i.markFsmonitorDirty(e.Path)
+	i.Changed = true
+}
+
+func sameTreeEntry(a, b *con.Entry) bool {
+	return a.ObjId == b.ObjId && a.Mode == b.Mode && a.IsIntentToAdd() == b.IsIntentToAdd()
+}
+
 func IsExec(mode uint32) bool {
 	return mode&0111 != 0
 }
@@ -338,7 +389,17 @@ func (i *Index) Remove(path string) {
 }
 
 func (i *Index) Write(path string) error {
-	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, os.ModePerm)
+	if !i.Changed {
+		return nil
+	}
+
+	//versionの設定が正しくなければ、今のindexを切り詰める前に止める
+	if _, err := i.WriteVersion(); err != nil {
+		return err
+	}
+
+	//v4では前より短くなることがあるので切り詰める
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, os.ModePerm)
 	if err != nil {
 		return err
 	}
@@ -360,11 +421,16 @@ func (i *Index) WriteContent(f *os.File, path string) error {
 		return nil
 	}
 
+	version, err := i.WriteVersion()
+	if err != nil {
+		return err
+	}
+
 	var tempStr string
 	tempStr += SIGNATURE
 
 	hb := &HeaderBin{
-		Version:       uint32(VERSION),
+		Version:       version,
 		EntriesNumber: uint32(len(i.Entries)),
 	}
 
@@ -383,26 +449,105 @@ func (i *Index) WriteContent(f *os.File, path string) error {
 	// 	tempStr += i.Entries[k].ToString()
 	// }
 
+	var prevPath string
 	for _, k := range i.Entries.GetSortedkey() {
 
 		o, ok := i.Entries.GetValue(k.Path, k.Stage)
 		if !ok {
 			return ErrorEntriesNotExists
 		}
-		tempStr += o.ToString()
+		e, ok := o.(*con.Entry)
+		if !ok {
+			return ErrorObjeToEntryConvError
+		}
+		tempStr += encodeEntry(e, version, prevPath)
+		prevPath = e.Path
+	}
+
+	if i.CacheTree != nil {
+		var data bytes.Buffer
+		i.CacheTree.Encode(&data)
+		tempStr += encodeExtension(CACHE_TREE_SIGNATURE, data.Bytes())
+	}
+	if i.FsmonitorToken != "" {
+		tempStr += encodeExtension(FSMONITOR_SIGNATURE, i.encodeFsmonitorExtension())
 	}
 
-	content := crypt.DigestBySha1(tempStr)
+	content := i.GetHash().Digest(tempStr)
 
 	tempStr += content
 
 	f.Write([]byte(tempStr))
 
+	i.Version = version
 	i.Changed = false
 
 	return nil
 }
 
+//設定があればそのversion、なければ読み込んだversionで書く
+//本家と同じく2と3は拡張flagsを持つentryがあるかどうかで決める
+func (i *Index) WriteVersion() (uint32, error) {
+	version := i.Version
+	if i.ConfiguredVersion != nil {
+		configured, err := i.ConfiguredVersion()
+		if err != nil {
+			return 0, err
+		}
+		if configured != 0 {
+			version = configured
+		}
+	}
+	if version == 0 {
+		version = VERSION
+	}
+	if version < MIN_VERSION || MAX_VERSION < version {
+		return 0, fmt.Errorf("index version %d: %w", version, ErrorInvalidVersion)
+	}
+
+	if version < 4 {
+		version = 2
+		for _, o := range i.Entries {
+			if e, ok := o.(*con.Entry); ok && e.ExtendedFlags != 0 {
+				version = 3
+				break
+			}
+		}
+	}
+
+	return version, nil
+}
+
+//signature 4byte、長さ4byteのあとに中身
+func encodeExtension(sig string, data []byte) string {
+	var buf bytes.Buffer
+	buf.WriteString(sig)
+	binary.Write(&buf, binary.BigEndian, uint32(len(data)))
+	buf.Write(data)
+
+	return buf.String()
+}
+
+//v4はpadせず、前のentryのpathの末尾から削る長さと残りのpathを書く
+func encodeEntry(e *con.Entry, version uint32, prevPath string) string {
+	if version < 4 {
+		return e.ToString()
+	}
+
+	common := 0
+	for common < len(prevPath) && common < len(e.Path) && prevPath[common] == e.Path[common] {
+		common++
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(e.EncodeHeader())
+	WriteOfsDeltaOffset(&buf, int64(len(prevPath)-common))
+	buf.WriteString(e.Path[common:])
+	buf.WriteByte(0)
+
+	return buf.String()
+}
+
 func (i *Index) Load() error {
 	_, err := os.Stat(i.Path)
 	if err != nil {
@@ -423,6 +568,7 @@ func (i *Index) Load() error {
 
 	checkSum := &CheckSum{
 		reader: buf,
+		hash:   i.GetHash(),
 	}
 
 	count, err := i.ReadHeader(buf, checkSum)
@@ -437,6 +583,11 @@ func (i *Index) Load() error {
 		return err
 	}
 
+	err = i.ReadExtensions(buf, checkSum)
+	if err != nil {
+		return err
+	}
+
 	err = i.ReadCheckSum(buf, checkSum)
 	if err != nil {
 		return err
@@ -450,12 +601,56 @@ var ErrorInvalidSig = errors.New("invalid signature")
 var ErrorInvalidVersion = errors.New("invalid version")
 var ErrorInvalidCheckSum = errors.New("invalid checksum")
 
-var ENTRY_MIN_SIZE = 64
+//ctimeからsizeまでの40byte
+var ENTRY_STAT_SIZE = 40
+
+var ErrorInvalidIndexEntry = errors.New("invalid index entry")
+var ErrorUnknownIndexExtension = errors.New("unknown index extension")
+
+//entryのあとchecksumまでは拡張が続く
+//知らない拡張のうち大文字で始まるものは読み飛ばしてよく、それ以外は読めないindexとして扱う
+func (i *Index) ReadExtensions(r *bytes.Buffer, cs *CheckSum) error {
+	i.CacheTree = nil
+	i.FsmonitorToken = ""
+	i.FsmonitorDirty = nil
+	for r.Len() > i.GetHash().Size() {
+		bs, err := cs.Read(r, 8)
+		if err != nil {
+			return err
+		}
+		sig := string(bs[:4])
+		size := binary.BigEndian.Uint32(bs[4:])
+		if uint32(r.Len()) < size {
+			return ErrorInvalidIndexEntry
+		}
+		data, err := cs.Read(r, int(size))
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case sig == CACHE_TREE_SIGNATURE:
+			c, err := ReadCacheTree(data, i.GetHash())
+			if err != nil {
+				return err
+			}
+			i.CacheTree = c
+		case sig == FSMONITOR_SIGNATURE:
+			if err := i.readFsmonitorExtension(data); err != nil {
+				return err
+			}
+		case 'A' <= sig[0] && sig[0] <= 'Z':
+			continue
+		default:
+			return fmt.Errorf("%q: %w", sig, ErrorUnknownIndexExtension)
+		}
+	}
 
-var CHECKSUM_SIZE = 20
+	return nil
+}
 
 func (i *Index) ReadCheckSum(r io.Reader, cs *CheckSum) error {
-	sum := make([]byte, CHECKSUM_SIZE)
+	sum := make([]byte, i.GetHash().Size())
 	err := binary.Read(r, binary.BigEndian, &sum)
 	if err != nil {
 		return err
@@ -468,60 +663,96 @@ func (i *Index) ReadCheckSum(r io.Reader, cs *CheckSum) error {
 }
 
 func (i *Index) ReadEntries(r io.Reader, cs *CheckSum, count int) error {
-
+	var prevPath string
 	for ind := 0; ind < count; ind++ {
-
-		bs, err := cs.Read(r, ENTRY_MIN_SIZE)
-		if err != nil {
-			return err
-		}
-		//64byteまで読んで最後が0じゃなければ8byteずつ読んで０かどうか確かめる
-		for {
-			if bs[len(bs)-1] != byte(0) {
-				eightbs, err := cs.Read(r, 8)
-				if err != nil {
-					return err
-				}
-				bs = append(bs, eightbs...)
-			} else {
-				break
-			}
-		}
-
-		e, _, err := i.ParseEntry(bs)
+		e, err := i.ReadEntry(r, cs, prevPath)
 		if err != nil {
 			return err
 		}
 
 		i.StoreEntry(e)
-
+		prevPath = e.Path
 	}
 
 	return nil
 }
 
-func (i *Index) ParseEntry(bs []byte) (*con.Entry, string, error) {
+//stat,objId,flags(拡張flags)のあとのpathはversionで読み方が変わる
+//v2,v3はNULのあと8byteにそろえてあり、v4は前のentryのpathとの差分でpadはない
+func (i *Index) ReadEntry(r io.Reader, cs *CheckSum, prevPath string) (*con.Entry, error) {
+	size := ENTRY_STAT_SIZE + i.GetHash().Size() + 2
+	bs, err := cs.Read(r, size)
+	if err != nil {
+		return nil, err
+	}
 
 	em := &con.EntryFromMem{}
-	buf := bytes.NewBuffer(bs[:62]) //flagsまでを読み取る、pathからは自分で何とかする
-	err := binary.Read(buf, binary.BigEndian, em)
-
+	buf := bytes.NewBuffer(bs)
+	err = binary.Read(buf, binary.BigEndian, &em.EntryStateBin)
 	if err != nil {
-		return nil, "", err
+		return nil, err
+	}
+	em.ObjId = buf.Next(i.GetHash().Size())
+	err = binary.Read(buf, binary.BigEndian, &em.Flags)
+	if err != nil {
+		return nil, err
 	}
 
-	pathbytes := bs[62:]
-	for {
-		if pathbytes[len(pathbytes)-1] != byte(0) {
-			break
-		} else {
-			pathbytes = pathbytes[:len(pathbytes)-1]
+	if em.Flags&con.FLAG_EXTENDED != 0 {
+		if i.Version < 3 {
+			return nil, ErrorInvalidIndexEntry
+		}
+		bs, err := cs.Read(r, 2)
+		if err != nil {
+			return nil, err
+		}
+		em.ExtendedFlags = binary.BigEndian.Uint16(bs)
+		size += 2
+	}
+
+	if i.Version >= 4 {
+		strip, err := ReadOfsDeltaOffset(cs)
+		if err != nil {
+			return nil, err
+		}
+		if int(strip) > len(prevPath) {
+			return nil, ErrorInvalidIndexEntry
+		}
+		suffix, err := readNulTerminated(cs)
+		if err != nil {
+			return nil, err
+		}
+
+		return em.ConvertToEntity(prevPath[:len(prevPath)-int(strip)] + suffix), nil
+	}
+
+	path, err := readNulTerminated(cs)
+	if err != nil {
+		return nil, err
+	}
+	//NULのあとを8byteにそろえる分を読み飛ばす
+	size += len(path) + 1
+	if pad := (con.ENTRY_BLOCK - size%con.ENTRY_BLOCK) % con.ENTRY_BLOCK; pad > 0 {
+		if _, err := cs.Read(r, pad); err != nil {
+			return nil, err
 		}
 	}
 
-	e := em.ConvertToEntity(string(pathbytes))
+	return em.ConvertToEntity(path), nil
+}
 
-	return e, string(pathbytes), nil
+func readNulTerminated(cs *CheckSum) (string, error) {
+	var bs []byte
+	for {
+		b, err := cs.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		if b == 0 {
+			return string(bs), nil
+		}
+		bs = append(bs, b)
+	}
 }
 
 func (i *Index) ReadHeader(r io.Reader, cs *CheckSum) (uint32, error) {
@@ -547,9 +778,10 @@ func (i *Index) ReadHeader(r io.Reader, cs *CheckSum) (uint32, error) {
 		return 0, err
 	}
 
-	if bin.Version != VERSION {
-		return 0, ErrorInvalidVersion
+	if bin.Version < MIN_VERSION || MAX_VERSION < bin.Version {
+		return 0, fmt.Errorf("index version %d: %w", bin.Version, ErrorInvalidVersion)
 	}
+	i.Version = bin.Version
 
 	return bin.EntriesNumber, nil
 
@@ -559,9 +791,15 @@ func (i *Index) StatMatch(e *con.Entry, stat con.FileState) bool {
 	return e.Size == stat.Size() && e.Mode == ModeForStat(stat)
 }
 
+//statはLstatでとったもの、symlinkはlinkの先ではなくlinkそのものとして扱う
 func ModeForStat(stat con.FileState) int {
 	var mode int
-	if IsExec(uint32(stat.Mode())) {
+	if stat.Mode()&os.ModeSymlink != 0 {
+		mode = SYMLINK_MODE
+	} else if stat.IsDir() {
+		//entryになるdirectoryはsubmoduleだけ
+		mode = GITLINK_MODE
+	} else if IsExec(uint32(stat.Mode())) {
 		mode = EXECUTABLE_MODE
 	} else {
 		mode = REGULAR_MODE
@@ -124,3 +124,98 @@ func Test_ReadFromFile(t *testing.T) {
 }
 
 //indexのclearをテスト
+
+//git 2.39でadd、add -N g.txtのあとupdate-index --index-version 4で作ったもの
+func Test_ReadIndexV4FromGit(t *testing.T) {
+	cur, err := os.Getwd()
+	assert.NoError(t, err)
+
+	i := GenerateIndex(filepath.Join(cur, "testData/index_v4"))
+	err = i.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(4), i.Version)
+
+	es, err := i.GetEntries()
+	assert.NoError(t, err)
+	var paths []string
+	for _, e := range es {
+		paths = append(paths, e.Path)
+	}
+	assert.Equal(t, []string{"a/b/c.txt", "a/b/d.txt", "a/e.txt", "f.txt", "g.txt"}, paths)
+
+	assert.False(t, es[0].IsIntentToAdd())
+	assert.Equal(t, "f2ad6c76f0115a6ba5b00456a849810e7ec0af20", es[0].ObjId)
+	assert.True(t, es[4].IsIntentToAdd())
+	assert.Equal(t, "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391", es[4].ObjId)
+	assert.Equal(t, 5, es[4].Flags)
+}
+
+func Test_IndexVersionRoundTrip(t *testing.T) {
+	cur, err := os.Getwd()
+	assert.NoError(t, err)
+	tempPath, err := os.MkdirTemp(cur, "")
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(tempPath)
+	})
+
+	paths := []string{"a/b/c.txt", "a/b/d.txt", "a/e.txt", "f.txt", "very/deep/nested/path/to/g.txt"}
+
+	for _, tc := range []struct {
+		configured uint32
+		extended   bool
+		written    uint32
+	}{
+		{configured: 0, extended: false, written: 2},
+		{configured: 2, extended: true, written: 3},
+		{configured: 3, extended: false, written: 2},
+		{configured: 4, extended: false, written: 4},
+		{configured: 4, extended: true, written: 4},
+	} {
+		indexPath := filepath.Join(tempPath, "index")
+		i := GenerateIndex(indexPath)
+		configured := tc.configured
+		i.ConfiguredVersion = func() (uint32, error) { return configured, nil }
+
+		for n, p := range paths {
+			e := &con.Entry{
+				CTime: int64(n),
+				Mode:  REGULAR_MODE,
+				Size:  int64(n),
+				ObjId: "f2ad6c76f0115a6ba5b00456a849810e7ec0af20",
+				Flags: con.CreateFlags(0, p),
+				Path:  p,
+			}
+			if tc.extended && n == 1 {
+				e.SetSkipWorktree(true)
+			}
+			if tc.extended && n == 4 {
+				e.SetIntentToAdd(true)
+			}
+			i.StoreEntry(e)
+		}
+		i.Changed = true
+		err := i.Write(indexPath)
+		assert.NoError(t, err)
+
+		loaded := GenerateIndex(indexPath)
+		err = loaded.Load()
+		assert.NoError(t, err)
+		assert.Equal(t, tc.written, loaded.Version)
+
+		for _, p := range paths {
+			want, _ := i.Entries.GetValue(p, 0)
+			got, ok := loaded.Entries.GetValue(p, 0)
+			assert.True(t, ok)
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("v%d diff is %s\n", tc.written, diff)
+			}
+		}
+	}
+
+	i := GenerateIndex(filepath.Join(tempPath, "index"))
+	i.ConfiguredVersion = func() (uint32, error) { return 5, nil }
+	i.Changed = true
+	err = i.Write(i.Path)
+	assert.ErrorIs(t, err, ErrorInvalidVersion)
+}
@@ -0,0 +1,892 @@
+package database
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"mygit/src/crypt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+//objects/pack/pack-xxx.packとpack-xxx.idx(version2)を扱う
+//packの中身は ヘッダ(PACK,version,object数) + object(type,sizeのヘッダとzlibで圧縮したデータ)の列 + checksum
+//objIdとchecksumの長さはrepositoryのhash(sha1なら20byte、sha256なら32byte)
+//idxは objIdでソートされていて、fanout(先頭1byteごとの累積数)から二分探索してpack内のoffsetを引く
+
+const (
+	PACK_SIGNATURE = "PACK"
+	PACK_VERSION   = 2
+
+	IDX_SIGNATURE = "\377tOc"
+	IDX_VERSION   = 2
+
+	PACK_COMMIT    = 1
+	PACK_TREE      = 2
+	PACK_BLOB      = 3
+	PACK_TAG       = 4
+	PACK_OFS_DELTA = 6
+	PACK_REF_DELTA = 7
+
+	//offsetが31bitに収まらない時は64bitのtableの方を見る
+	IDX_LARGE_OFFSET = 0x80000000
+
+	//可変長のsize,offsetは9byteまで(7bit*9=63bitでint64に収まる)
+	MAX_VARINT_BYTES = 9
+	//headerのsizeは信用できないので、先に確保するのはこの大きさまで
+	MAX_PREALLOC_SIZE = 1 << 20
+)
+
+var packTypeNames = map[int]string{
+	PACK_COMMIT: "commit",
+	PACK_TREE:   "tree",
+	PACK_BLOB:   "blob",
+	PACK_TAG:    "tag",
+}
+
+var (
+	ErrorInvalidPack       = errors.New("invalid pack file")
+	ErrorInvalidPackIndex  = errors.New("invalid pack index file")
+	ErrorInvalidDelta      = errors.New("invalid delta data")
+	ErrorPackObjNotFound   = errors.New("object not found in pack")
+	ErrorPackChecksumError = errors.New("pack checksum mismatch")
+	ErrorInvalidVarint     = errors.New("invalid variable length integer in pack")
+)
+
+type PackIndex struct {
+	ObjIds  []string //hex、ソート済み
+	Crcs    []uint32
+	Offsets []int64
+	//packの末尾のchecksum
+	PackHash []byte
+	//nilならsha1
+	Hash crypt.Hash
+}
+
+func (i *PackIndex) GetHash() crypt.Hash {
+	if i.Hash == nil {
+		return crypt.SHA1
+	}
+	return i.Hash
+}
+
+type Pack struct {
+	PackPath string
+	IdxPath  string
+	Index    *PackIndex
+}
+
+//packのobjectを生のまま(deltaを解決済み)持つ
+type PackedObj struct {
+	Type string
+	Data []byte
+}
+
+func (p *PackedObj) HeaderContent() string {
+	return fmt.Sprintf("%s %d\x00%s", p.Type, len(p.Data), p.Data)
+}
+
+func (d *Database) PackDir() string {
+	return filepath.Join(d.Path, "pack")
+}
+
+//packは毎回読み込むと重いのでDatabaseに持っておく、packを書き込んだ後はResetPacksで読み直す
+func (d *Database) Packs() ([]*Pack, error) {
+	if d.packs != nil {
+		return d.packs, nil
+	}
+
+	idxPaths, err := filepath.Glob(filepath.Join(d.PackDir(), "pack-*.idx"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(idxPaths)
+
+	packs := make([]*Pack, 0, len(idxPaths))
+	for _, idxPath := range idxPaths {
+		packPath := strings.TrimSuffix(idxPath, ".idx") + ".pack"
+		if _, err := os.Stat(packPath); err != nil {
+			//idxだけ残っているものは無視
+			continue
+		}
+
+		index, err := ReadPackIndex(idxPath, d.GetHash())
+		if err != nil {
+			return nil, err
+		}
+
+		packs = append(packs, &Pack{
+			PackPath: packPath,
+			IdxPath:  idxPath,
+			Index:    index,
+		})
+	}
+
+	d.packs = packs
+
+	return packs, nil
+}
+
+func (d *Database) ResetPacks() {
+	d.packs = nil
+}
+
+func (d *Database) HasPackedObject(objId string) (bool, error) {
+	packs, err := d.Packs()
+	if err != nil {
+		return false, err
+	}
+
+	for _, p := range packs {
+		if _, ok := p.Index.Find(objId); ok {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (d *Database) ReadPackedObject(objId string) (*PackedObj, error) {
+	packs, err := d.Packs()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range packs {
+		offset, ok := p.Index.Find(objId)
+		if !ok {
+			continue
+		}
+
+		return p.ReadAt(offset, d.readRawObject)
+	}
+
+	return nil, ErrorPackObjNotFound
+}
+
+//REF_DELTAのbaseは別のpackやlooseにあることもあるので、Database全体から探す
+func (d *Database) readRawObject(objId string) (*PackedObj, error) {
+	r, err := d.GetContent(objId)
+	if err != nil {
+		return nil, err
+	}
+
+	hAndR, err := d.ScanObjectHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(hAndR.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PackedObj{
+		Type: hAndR.ObjType,
+		Data: data,
+	}, nil
+}
+
+//prefixから始まるpack内のobjIdをすべて返す
+func (d *Database) PackedPrefixMatch(prefix string) ([]string, error) {
+	packs, err := d.Packs()
+	if err != nil {
+		return nil, err
+	}
+
+	var objIds []string
+	seen := make(map[string]bool)
+
+	for _, p := range packs {
+		for _, objId := range p.Index.PrefixMatch(prefix) {
+			if !seen[objId] {
+				seen[objId] = true
+				objIds = append(objIds, objId)
+			}
+		}
+	}
+
+	return objIds, nil
+}
+
+func (i *PackIndex) Find(objId string) (int64, bool) {
+	n := sort.SearchStrings(i.ObjIds, objId)
+	if n < len(i.ObjIds) && i.ObjIds[n] == objId {
+		return i.Offsets[n], true
+	}
+
+	return 0, false
+}
+
+func (i *PackIndex) PrefixMatch(prefix string) []string {
+	var objIds []string
+
+	for n := sort.SearchStrings(i.ObjIds, prefix); n < len(i.ObjIds); n++ {
+		if !strings.HasPrefix(i.ObjIds[n], prefix) {
+			break
+		}
+		objIds = append(objIds, i.ObjIds[n])
+	}
+
+	return objIds
+}
+
+func ReadPackIndex(path string, h crypt.Hash) (*PackIndex, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	hashSize := h.Size()
+
+	//header(8) + fanout(256*4) + packのchecksum + idxのchecksum
+	if len(data) < 8+256*4+2*hashSize {
+		return nil, ErrorInvalidPackIndex
+	}
+
+	if string(data[0:4]) != IDX_SIGNATURE || binary.BigEndian.Uint32(data[4:8]) != IDX_VERSION {
+		return nil, ErrorInvalidPackIndex
+	}
+
+	body := data[:len(data)-hashSize]
+	if h.Digest(string(body)) != string(data[len(data)-hashSize:]) {
+		return nil, ErrorPackChecksumError
+	}
+
+	pos := 8 + 255*4
+	count := int(binary.BigEndian.Uint32(data[pos : pos+4]))
+	pos += 4
+
+	if len(data) < pos+count*(hashSize+4+4)+2*hashSize {
+		return nil, ErrorInvalidPackIndex
+	}
+
+	index := &PackIndex{
+		ObjIds:  make([]string, count),
+		Crcs:    make([]uint32, count),
+		Offsets: make([]int64, count),
+		Hash:    h,
+	}
+
+	for n := 0; n < count; n++ {
+		index.ObjIds[n] = hex.EncodeToString(data[pos : pos+hashSize])
+		pos += hashSize
+	}
+
+	for n := 0; n < count; n++ {
+		index.Crcs[n] = binary.BigEndian.Uint32(data[pos : pos+4])
+		pos += 4
+	}
+
+	smallOffsets := data[pos : pos+count*4]
+	pos += count * 4
+
+	for n := 0; n < count; n++ {
+		offset := binary.BigEndian.Uint32(smallOffsets[n*4 : n*4+4])
+		if offset&IDX_LARGE_OFFSET == 0 {
+			index.Offsets[n] = int64(offset)
+			continue
+		}
+
+		largePos := pos + int(offset&^IDX_LARGE_OFFSET)*8
+		if largePos+8 > len(data)-2*hashSize {
+			return nil, ErrorInvalidPackIndex
+		}
+		index.Offsets[n] = int64(binary.BigEndian.Uint64(data[largePos : largePos+8]))
+	}
+
+	index.PackHash = data[len(data)-2*hashSize : len(data)-hashSize]
+
+	return index, nil
+}
+
+func (p *Pack) ReadAt(offset int64, readBase func(objId string) (*PackedObj, error)) (*PackedObj, error) {
+	f, err := os.Open(p.PackPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return p.readEntry(f, offset, readBase)
+}
+
+func (p *Pack) readEntry(f *os.File, offset int64, readBase func(objId string) (*PackedObj, error)) (*PackedObj, error) {
+	r := bufio.NewReader(io.NewSectionReader(f, offset, 1<<62))
+
+	objType, size, err := ReadPackEntryHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	switch objType {
+	case PACK_COMMIT, PACK_TREE, PACK_BLOB, PACK_TAG:
+		data, err := inflateN(r, size)
+		if err != nil {
+			return nil, err
+		}
+
+		return &PackedObj{
+			Type: packTypeNames[objType],
+			Data: data,
+		}, nil
+
+	case PACK_OFS_DELTA:
+		rel, err := ReadOfsDeltaOffset(r)
+		if err != nil {
+			return nil, err
+		}
+
+		if rel <= 0 || rel > offset {
+			return nil, ErrorInvalidPack
+		}
+
+		delta, err := inflateN(r, size)
+		if err != nil {
+			return nil, err
+		}
+
+		base, err := p.readEntry(f, offset-rel, readBase)
+		if err != nil {
+			return nil, err
+		}
+
+		return applyDeltaToObj(base, delta)
+
+	case PACK_REF_DELTA:
+		baseId := make([]byte, p.Index.GetHash().Size())
+		if _, err := io.ReadFull(r, baseId); err != nil {
+			return nil, err
+		}
+
+		delta, err := inflateN(r, size)
+		if err != nil {
+			return nil, err
+		}
+
+		var base *PackedObj
+		if baseOffset, ok := p.Index.Find(hex.EncodeToString(baseId)); ok {
+			base, err = p.readEntry(f, baseOffset, readBase)
+		} else {
+			base, err = readBase(hex.EncodeToString(baseId))
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return applyDeltaToObj(base, delta)
+
+	default:
+		return nil, ErrorInvalidPack
+	}
+}
+
+func applyDeltaToObj(base *PackedObj, delta []byte) (*PackedObj, error) {
+	data, err := ApplyDelta(base.Data, delta)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PackedObj{
+		Type: base.Type,
+		Data: data,
+	}, nil
+}
+
+func inflateN(r io.Reader, size int64) ([]byte, error) {
+	zr, err := zlib.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	//sizeの分を先に確保せず、読めた分だけ伸ばす
+	data, err := io.ReadAll(io.LimitReader(zr, size))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != size {
+		return nil, ErrorInvalidPack
+	}
+
+	return data, nil
+}
+
+//1byte目: MSBが続きがあるかのflag,次の3bitがtype,下位4bitがsize
+//2byte目以降: MSBがflag,下位7bitがsizeの続き(little endian)
+func ReadPackEntryHeader(r io.ByteReader) (int, int64, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	objType := int(c>>4) & 0x7
+	size := int64(c & 0x0f)
+	shift := uint(4)
+
+	for n := 1; c&0x80 != 0; n++ {
+		if n >= MAX_VARINT_BYTES {
+			return 0, 0, ErrorInvalidVarint
+		}
+		c, err = r.ReadByte()
+		if err != nil {
+			return 0, 0, err
+		}
+		size |= int64(c&0x7f) << shift
+		shift += 7
+	}
+	if size < 0 {
+		return 0, 0, ErrorInvalidVarint
+	}
+
+	return objType, size, nil
+}
+
+func WritePackEntryHeader(w io.Writer, objType int, size int64) error {
+	c := byte(objType<<4) | byte(size&0x0f)
+	size >>= 4
+
+	var buf []byte
+	for size != 0 {
+		buf = append(buf, c|0x80)
+		c = byte(size & 0x7f)
+		size >>= 7
+	}
+	buf = append(buf, c)
+
+	_, err := w.Write(buf)
+	return err
+}
+
+//ReadOfsDeltaOffsetの逆、index v4の削るpathの長さも同じ形
+func WriteOfsDeltaOffset(w io.Writer, offset int64) error {
+	buf := []byte{byte(offset & 0x7f)}
+	for offset >>= 7; offset != 0; offset >>= 7 {
+		offset--
+		buf = append([]byte{byte(offset&0x7f) | 0x80}, buf...)
+	}
+
+	_, err := w.Write(buf)
+	return err
+}
+
+//OFS_DELTAのbaseまでの距離、sizeとは違いbig endianで続くごとに+1されている
+func ReadOfsDeltaOffset(r io.ByteReader) (int64, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+
+	offset := int64(c & 0x7f)
+	for n := 1; c&0x80 != 0; n++ {
+		if n >= MAX_VARINT_BYTES {
+			return 0, ErrorInvalidVarint
+		}
+		c, err = r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		offset = ((offset + 1) << 7) | int64(c&0x7f)
+	}
+	if offset < 0 {
+		return 0, ErrorInvalidVarint
+	}
+
+	return offset, nil
+}
+
+//delta: baseのsize,結果のsize(どちらもlittle endianの可変長) + 命令の列
+//命令のMSBが1ならbaseからのcopy(下位4bitがoffset,次の3bitがsizeのどのbyteがあるか)、0ならその数だけdeltaからinsert
+func ApplyDelta(base, delta []byte) ([]byte, error) {
+	r := bytes.NewReader(delta)
+
+	baseSize, err := readDeltaSize(r)
+	if err != nil {
+		return nil, err
+	}
+	if baseSize != int64(len(base)) {
+		return nil, ErrorInvalidDelta
+	}
+
+	targetSize, err := readDeltaSize(r)
+	if err != nil {
+		return nil, err
+	}
+
+	//targetSizeはdeltaに書かれた値なので、そのまま確保はしない
+	capacity := targetSize
+	if capacity > MAX_PREALLOC_SIZE {
+		capacity = MAX_PREALLOC_SIZE
+	}
+	out := make([]byte, 0, capacity)
+
+	for r.Len() > 0 {
+		cmd, _ := r.ReadByte()
+
+		if cmd&0x80 != 0 {
+			var offset, size int64
+			for i := uint(0); i < 4; i++ {
+				if cmd&(1<<i) != 0 {
+					b, err := r.ReadByte()
+					if err != nil {
+						return nil, ErrorInvalidDelta
+					}
+					offset |= int64(b) << (8 * i)
+				}
+			}
+			for i := uint(0); i < 3; i++ {
+				if cmd&(1<<(4+i)) != 0 {
+					b, err := r.ReadByte()
+					if err != nil {
+						return nil, ErrorInvalidDelta
+					}
+					size |= int64(b) << (8 * i)
+				}
+			}
+			if size == 0 {
+				size = 0x10000
+			}
+			if offset+size > int64(len(base)) || int64(len(out))+size > targetSize {
+				return nil, ErrorInvalidDelta
+			}
+			out = append(out, base[offset:offset+size]...)
+		} else if cmd != 0 {
+			if int64(len(out))+int64(cmd) > targetSize {
+				return nil, ErrorInvalidDelta
+			}
+			insert := make([]byte, cmd)
+			if _, err := io.ReadFull(r, insert); err != nil {
+				return nil, ErrorInvalidDelta
+			}
+			out = append(out, insert...)
+		} else {
+			//0は予約されている
+			return nil, ErrorInvalidDelta
+		}
+	}
+
+	if int64(len(out)) != targetSize {
+		return nil, ErrorInvalidDelta
+	}
+
+	return out, nil
+}
+
+func readDeltaSize(r io.ByteReader) (int64, error) {
+	var size int64
+	var shift uint
+
+	for n := 0; n < MAX_VARINT_BYTES; n++ {
+		c, err := r.ReadByte()
+		if err != nil {
+			return 0, ErrorInvalidDelta
+		}
+		size |= int64(c&0x7f) << shift
+		shift += 7
+		if c&0x80 == 0 {
+			if size < 0 {
+				return 0, ErrorInvalidDelta
+			}
+			return size, nil
+		}
+	}
+
+	return 0, ErrorInvalidDelta
+}
+
+//looseのobjectのうちwantedにあるもの(到達できるもの)を一つのpackにまとめる(deltaは作らない)
+//すでにpackにあるものは入れない、deleteLooseならpackに入っているlooseのobjectを消す
+func (d *Database) PackLooseObjects(wanted map[string]bool, deleteLoose bool) (string, []string, error) {
+	looseObjIds, err := d.LooseObjIds()
+	if err != nil {
+		return "", nil, err
+	}
+
+	var objIds, packedObjIds []string
+	for _, objId := range looseObjIds {
+		packed, err := d.HasPackedObject(objId)
+		if err != nil {
+			return "", nil, err
+		}
+		if packed {
+			packedObjIds = append(packedObjIds, objId)
+			continue
+		}
+		if wanted[objId] {
+			objIds = append(objIds, objId)
+		}
+	}
+
+	var name string
+	if len(objIds) != 0 {
+		objs := make(map[string]*PackedObj, len(objIds))
+		for _, objId := range objIds {
+			o, err := d.readRawObject(objId)
+			if err != nil {
+				return "", nil, err
+			}
+			objs[objId] = o
+		}
+
+		name, err = d.WritePack(objIds, objs)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	if deleteLoose {
+		for _, objId := range append(objIds, packedObjIds...) {
+			objPath := d.ObjPath(objId)
+			if err := os.Remove(objPath); err != nil {
+				return "", nil, err
+			}
+			//空になったobjects/xxは消す
+			os.Remove(filepath.Dir(objPath))
+		}
+	}
+
+	return name, objIds, nil
+}
+
+//objects/xx/yyyyをすべて集める
+func (d *Database) LooseObjIds() ([]string, error) {
+	dirs, err := os.ReadDir(d.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var objIds []string
+	for _, dir := range dirs {
+		if !dir.IsDir() || len(dir.Name()) != 2 || !isHex(dir.Name()) {
+			continue
+		}
+
+		files, err := os.ReadDir(filepath.Join(d.Path, dir.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range files {
+			objId := dir.Name() + f.Name()
+			if f.IsDir() || len(objId) != d.GetHash().HexSize() || !isHex(f.Name()) {
+				continue
+			}
+			objIds = append(objIds, objId)
+		}
+	}
+
+	sort.Strings(objIds)
+
+	return objIds, nil
+}
+
+func isHex(s string) bool {
+	_, err := hex.DecodeString(strings.Repeat("0", len(s)%2) + s)
+	return err == nil
+}
+
+//objIdsの順にpackを書き、idxも作る、名前はpackのchecksum(本家と同じ)
+func (d *Database) WritePack(objIds []string, objs map[string]*PackedObj) (string, error) {
+	packDir := d.PackDir()
+	if err := os.MkdirAll(packDir, os.ModePerm); err != nil {
+		return "", err
+	}
+
+	tmp, err := os.CreateTemp(packDir, "tmp_pack_")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	pw := newHashWriter(tmp, d.GetHash())
+
+	header := make([]byte, 12)
+	copy(header, PACK_SIGNATURE)
+	binary.BigEndian.PutUint32(header[4:8], PACK_VERSION)
+	binary.BigEndian.PutUint32(header[8:12], uint32(len(objIds)))
+	if _, err := pw.Write(header); err != nil {
+		tmp.Close()
+		return "", err
+	}
+
+	index := &PackIndex{Hash: d.GetHash()}
+
+	for _, objId := range objIds {
+		o := objs[objId]
+
+		objType, ok := packTypeCode(o.Type)
+		if !ok {
+			tmp.Close()
+			return "", ErrorInvalidPack
+		}
+
+		var entry bytes.Buffer
+		if err := WritePackEntryHeader(&entry, objType, int64(len(o.Data))); err != nil {
+			tmp.Close()
+			return "", err
+		}
+		zw := zlib.NewWriter(&entry)
+		zw.Write(o.Data)
+		if err := zw.Close(); err != nil {
+			tmp.Close()
+			return "", err
+		}
+
+		index.ObjIds = append(index.ObjIds, objId)
+		index.Offsets = append(index.Offsets, pw.n)
+		index.Crcs = append(index.Crcs, crc32.ChecksumIEEE(entry.Bytes()))
+
+		if _, err := pw.Write(entry.Bytes()); err != nil {
+			tmp.Close()
+			return "", err
+		}
+	}
+
+	packHash := pw.h.Sum(nil)
+	if _, err := tmp.Write(packHash); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+
+	index.PackHash = packHash
+	name := hex.EncodeToString(packHash)
+	base := filepath.Join(packDir, "pack-"+name)
+
+	//-dなしでrepackし直した時のように、同じobjectを詰めたpackはすでにある
+	if _, err := os.Stat(base + ".pack"); err == nil {
+		if _, err := os.Stat(base + ".idx"); err == nil {
+			return name, nil
+		}
+	}
+
+	if err := WritePackIndex(base+".idx", index); err != nil {
+		return "", err
+	}
+
+	if err := os.Rename(tmp.Name(), base+".pack"); err != nil {
+		return "", err
+	}
+
+	d.ResetPacks()
+
+	return name, nil
+}
+
+func WritePackIndex(path string, index *PackIndex) error {
+	//idxはobjIdの順に並べる
+	order := make([]int, len(index.ObjIds))
+	for n := range order {
+		order[n] = n
+	}
+	sort.Slice(order, func(a, b int) bool {
+		return index.ObjIds[order[a]] < index.ObjIds[order[b]]
+	})
+
+	var buf bytes.Buffer
+	buf.WriteString(IDX_SIGNATURE)
+	binary.Write(&buf, binary.BigEndian, uint32(IDX_VERSION))
+
+	var fanout [256]uint32
+	for _, objId := range index.ObjIds {
+		b, err := hex.DecodeString(objId[0:2])
+		if err != nil {
+			return err
+		}
+		for n := int(b[0]); n < 256; n++ {
+			fanout[n]++
+		}
+	}
+	binary.Write(&buf, binary.BigEndian, fanout)
+
+	for _, n := range order {
+		b, err := hex.DecodeString(index.ObjIds[n])
+		if err != nil {
+			return err
+		}
+		buf.Write(b)
+	}
+
+	for _, n := range order {
+		binary.Write(&buf, binary.BigEndian, index.Crcs[n])
+	}
+
+	var largeOffsets []int64
+	for _, n := range order {
+		offset := index.Offsets[n]
+		if offset < IDX_LARGE_OFFSET {
+			binary.Write(&buf, binary.BigEndian, uint32(offset))
+		} else {
+			binary.Write(&buf, binary.BigEndian, uint32(IDX_LARGE_OFFSET|len(largeOffsets)))
+			largeOffsets = append(largeOffsets, offset)
+		}
+	}
+	for _, offset := range largeOffsets {
+		binary.Write(&buf, binary.BigEndian, uint64(offset))
+	}
+
+	buf.Write(index.PackHash)
+	buf.WriteString(index.GetHash().Digest(buf.String()))
+
+	//idxは読み取り専用にするので、すでにあっても上書きできるように別のファイルに書いてからrenameする
+	tmp, err := os.CreateTemp(filepath.Dir(path), "tmp_idx_")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0444); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func packTypeCode(objType string) (int, bool) {
+	for code, name := range packTypeNames {
+		if name == objType {
+			return code, true
+		}
+	}
+	return 0, false
+}
+
+//書いたbyte数(=次のobjectのoffset)とchecksumを同時にとる
+type hashWriter struct {
+	w io.Writer
+	h hash.Hash
+	n int64
+}
+
+func newHashWriter(w io.Writer, h crypt.Hash) *hashWriter {
+	return &hashWriter{
+		w: w,
+		h: h.New(),
+	}
+}
+
+func (hw *hashWriter) Write(p []byte) (int, error) {
+	n, err := hw.w.Write(p)
+	hw.h.Write(p[:n])
+	hw.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,263 @@
+package database
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"hash"
+	"io"
+	"os"
+)
+
+//fetch,pushでやりとりするpackはファイルにせず、そのままstreamで読み書きする
+//送る側はdeltaを作らない、受ける側はOFS_DELTAとREF_DELTAも解決してlooseのobjectとして書く
+
+func (d *Database) WritePackStream(w io.Writer, objIds []string) error {
+	pw := newHashWriter(w, d.GetHash())
+
+	header := make([]byte, 12)
+	copy(header, PACK_SIGNATURE)
+	binary.BigEndian.PutUint32(header[4:8], PACK_VERSION)
+	binary.BigEndian.PutUint32(header[8:12], uint32(len(objIds)))
+	if _, err := pw.Write(header); err != nil {
+		return err
+	}
+
+	for _, objId := range objIds {
+		o, err := d.readRawObject(objId)
+		if err != nil {
+			return err
+		}
+
+		objType, ok := packTypeCode(o.Type)
+		if !ok {
+			return ErrorInvalidPack
+		}
+
+		if err := WritePackEntryHeader(pw, objType, int64(len(o.Data))); err != nil {
+			return err
+		}
+		zw := zlib.NewWriter(pw)
+		zw.Write(o.Data)
+		if err := zw.Close(); err != nil {
+			return err
+		}
+	}
+
+	_, err := w.Write(pw.h.Sum(nil))
+	return err
+}
+
+//読んだbyte数とsha1をとりながら1byteずつ読めるreader
+//zlibはio.ByteReaderを実装していれば余分に読まないので、次のentryのoffsetがずれない
+type packStreamReader struct {
+	r *bufio.Reader
+	h hash.Hash
+	n int64
+}
+
+func (pr *packStreamReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	pr.h.Write(p[:n])
+	pr.n += int64(n)
+	return n, err
+}
+
+func (pr *packStreamReader) ReadByte() (byte, error) {
+	c, err := pr.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	pr.h.Write([]byte{c})
+	pr.n++
+	return c, nil
+}
+
+//inflateNと違いzlibの末尾のchecksumまで読み切る、読み残すと次のentryの位置がずれる
+//中身は持たずに長さだけ確かめる
+func skipInflateStream(r io.Reader, size int64) error {
+	zr, err := zlib.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	//sizeより多く展開されるものは途中で打ち切る
+	n, err := io.Copy(io.Discard, io.LimitReader(zr, size+1))
+	if err != nil {
+		return err
+	}
+	if n != size {
+		return ErrorInvalidPack
+	}
+
+	return nil
+}
+
+//packを読んでobjectをすべて書き、書いたobjIdを返す
+//一度pack/tmp_pack_xxxに書いて末尾のchecksumを確かめてから、offsetを頼りに読み直してobjectを書く
+func (d *Database) ReadPackStream(r io.Reader) ([]string, error) {
+	packDir := d.PackDir()
+	if err := os.MkdirAll(packDir, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.CreateTemp(packDir, "tmp_pack_")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	offsets, err := d.copyPackStream(tmp, r)
+	if err != nil {
+		return nil, err
+	}
+
+	//OFS_DELTAのbaseはoffsetで指されるので、offsetごとのobjIdを覚えておく
+	byOffset := make(map[int64]string, len(offsets))
+	var objIds []string
+
+	for _, offset := range offsets {
+		o, err := d.readStreamEntry(tmp, offset, byOffset)
+		if err != nil {
+			return nil, err
+		}
+
+		content := o.HeaderContent()
+		objId := d.GetHash().HexDigest(content)
+		if err := d.WriteObject(objId, content); err != nil {
+			return nil, err
+		}
+
+		byOffset[offset] = objId
+		objIds = append(objIds, objId)
+	}
+
+	return objIds, nil
+}
+
+//streamをwに写しながらentryの境目を読み、各entryのoffsetを返す
+//末尾のchecksumが合わなければerror
+func (d *Database) copyPackStream(w io.Writer, r io.Reader) ([]int64, error) {
+	pr := &packStreamReader{
+		r: bufio.NewReader(io.TeeReader(r, w)),
+		h: d.GetHash().New(),
+	}
+
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(pr, header); err != nil {
+		return nil, err
+	}
+	if string(header[0:4]) != PACK_SIGNATURE || binary.BigEndian.Uint32(header[4:8]) != PACK_VERSION {
+		return nil, ErrorInvalidPack
+	}
+	count := binary.BigEndian.Uint32(header[8:12])
+
+	var offsets []int64
+
+	for n := uint32(0); n < count; n++ {
+		offset := pr.n
+
+		objType, size, err := ReadPackEntryHeader(pr)
+		if err != nil {
+			return nil, err
+		}
+
+		switch objType {
+		case PACK_COMMIT, PACK_TREE, PACK_BLOB, PACK_TAG:
+		case PACK_OFS_DELTA:
+			rel, err := ReadOfsDeltaOffset(pr)
+			if err != nil {
+				return nil, err
+			}
+			if rel <= 0 || rel > offset {
+				return nil, ErrorInvalidPack
+			}
+		case PACK_REF_DELTA:
+			baseId := make([]byte, d.GetHash().Size())
+			if _, err := io.ReadFull(pr, baseId); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, ErrorInvalidPack
+		}
+
+		if err := skipInflateStream(pr, size); err != nil {
+			return nil, err
+		}
+
+		offsets = append(offsets, offset)
+	}
+
+	sum := pr.h.Sum(nil)
+	trailer := make([]byte, d.GetHash().Size())
+	if _, err := io.ReadFull(pr.r, trailer); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(sum, trailer) {
+		return nil, ErrorPackChecksumError
+	}
+
+	return offsets, nil
+}
+
+//checksumを確かめたpackのoffsetのentryを読む
+//deltaのbaseは先に書いたobjectか、thin packなら相手が持っているobjectを読む
+func (d *Database) readStreamEntry(f *os.File, offset int64, byOffset map[int64]string) (*PackedObj, error) {
+	r := bufio.NewReader(io.NewSectionReader(f, offset, 1<<62))
+
+	objType, size, err := ReadPackEntryHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var baseId string
+	switch objType {
+	case PACK_COMMIT, PACK_TREE, PACK_BLOB, PACK_TAG:
+		data, err := inflateN(r, size)
+		if err != nil {
+			return nil, err
+		}
+
+		return &PackedObj{
+			Type: packTypeNames[objType],
+			Data: data,
+		}, nil
+
+	case PACK_OFS_DELTA:
+		rel, err := ReadOfsDeltaOffset(r)
+		if err != nil {
+			return nil, err
+		}
+		id, ok := byOffset[offset-rel]
+		if !ok {
+			return nil, ErrorInvalidPack
+		}
+		baseId = id
+
+	case PACK_REF_DELTA:
+		id := make([]byte, d.GetHash().Size())
+		if _, err := io.ReadFull(r, id); err != nil {
+			return nil, err
+		}
+		baseId = hex.EncodeToString(id)
+
+	default:
+		return nil, ErrorInvalidPack
+	}
+
+	delta, err := inflateN(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := d.readRawObject(baseId)
+	if err != nil {
+		return nil, err
+	}
+
+	return applyDeltaToObj(base, delta)
+}
@@ -0,0 +1,364 @@
+package database
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"mygit/src/crypt"
+	c "mygit/src/database/content"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ApplyDelta(t *testing.T) {
+	base := []byte("hello world\n")
+
+	for _, d := range []struct {
+		title    string
+		delta    []byte
+		expected string
+		err      error
+	}{
+		{
+			"copy and insert",
+			//base12,target18, copy(offset0,size6) insert "there " copy(offset6,size6)
+			[]byte{12, 18, 0x90, 6, 6, 't', 'h', 'e', 'r', 'e', ' ', 0x91, 6, 6},
+			"hello there world\n",
+			nil,
+		},
+		{
+			"insert only",
+			[]byte{12, 3, 3, 'a', 'b', 'c'},
+			"abc",
+			nil,
+		},
+		{
+			"base size mismatch",
+			[]byte{11, 3, 3, 'a', 'b', 'c'},
+			"",
+			ErrorInvalidDelta,
+		},
+		{
+			"copy out of range",
+			[]byte{12, 20, 0x91, 6, 20},
+			"",
+			ErrorInvalidDelta,
+		},
+		{
+			"target size too long",
+			[]byte{12, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01},
+			"",
+			ErrorInvalidDelta,
+		},
+		{
+			"negative target size",
+			[]byte{12, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f},
+			"",
+			ErrorInvalidDelta,
+		},
+		{
+			"output longer than target size",
+			[]byte{12, 2, 3, 'a', 'b', 'c'},
+			"",
+			ErrorInvalidDelta,
+		},
+	} {
+		t.Run(d.title, func(t *testing.T) {
+			out, err := ApplyDelta(base, d.delta)
+			assert.Equal(t, d.err, err)
+			if err == nil {
+				assert.Equal(t, d.expected, string(out))
+			}
+		})
+	}
+}
+
+func Test_PackEntryHeader(t *testing.T) {
+	for _, size := range []int64{0, 15, 16, 2047, 1 << 20} {
+		var buf bytes.Buffer
+		err := WritePackEntryHeader(&buf, PACK_BLOB, size)
+		assert.NoError(t, err)
+
+		objType, readSize, err := ReadPackEntryHeader(&buf)
+		assert.NoError(t, err)
+		assert.Equal(t, PACK_BLOB, objType)
+		assert.Equal(t, size, readSize)
+	}
+
+	//9byteを超えるものは読まない
+	_, _, err := ReadPackEntryHeader(bytes.NewReader([]byte{0xbf, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}))
+	assert.Equal(t, ErrorInvalidVarint, err)
+
+	_, err = ReadOfsDeltaOffset(bytes.NewReader([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}))
+	assert.Equal(t, ErrorInvalidVarint, err)
+}
+
+func Test_InflateNLargeHeaderSize(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write([]byte("short"))
+	zw.Close()
+
+	//headerのsizeが大きくてもdataが足りなければ確保せずにerrorにする
+	_, err := inflateN(&buf, 1<<40)
+	assert.Equal(t, ErrorInvalidPack, err)
+}
+
+func Test_PackLooseObjects(t *testing.T) {
+	cur, err := os.Getwd()
+	assert.NoError(t, err)
+	tempPath, err := ioutil.TempDir(cur, "")
+	assert.NoError(t, err)
+
+	t.Cleanup(func() {
+		os.RemoveAll(tempPath)
+	})
+
+	d := &Database{
+		Path: filepath.Join(tempPath, "objects"),
+	}
+
+	var objIds []string
+	wanted := make(map[string]bool)
+	for _, content := range []string{"first\n", "second\n", "third\n"} {
+		b := &c.Blob{Content: content}
+		d.Store(b)
+		objIds = append(objIds, b.GetObjId())
+		wanted[b.GetObjId()] = true
+	}
+
+	//wantedにないものはlooseのまま残る
+	unreachable := &c.Blob{Content: "unreachable\n"}
+	d.Store(unreachable)
+
+	name, packed, err := d.PackLooseObjects(wanted, true)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(packed))
+
+	_, err = os.Stat(filepath.Join(d.PackDir(), "pack-"+name+".pack"))
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(d.PackDir(), "pack-"+name+".idx"))
+	assert.NoError(t, err)
+
+	//looseは消えていて、packから読める
+	loose, err := d.LooseObjIds()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{unreachable.GetObjId()}, loose)
+
+	for i, content := range []string{"first\n", "second\n", "third\n"} {
+		o, err := d.ReadObject(objIds[i])
+		assert.NoError(t, err)
+		b, ok := o.(*c.Blob)
+		assert.True(t, ok)
+		assert.Equal(t, content, b.Content)
+
+		matched, err := d.PackedPrefixMatch(objIds[i][0:6])
+		assert.NoError(t, err)
+		assert.Equal(t, []string{objIds[i]}, matched)
+	}
+
+	//idxはすでにあっても書き直せる
+	idxPath := filepath.Join(d.PackDir(), "pack-"+name+".idx")
+	index, err := ReadPackIndex(idxPath, d.GetHash())
+	assert.NoError(t, err)
+	err = WritePackIndex(idxPath, index)
+	assert.NoError(t, err)
+	stat, err := os.Stat(idxPath)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0444), stat.Mode().Perm())
+
+	//packにあるものは再度looseに書かない
+	d.Store(&c.Blob{Content: "first\n"})
+	loose, err = d.LooseObjIds()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{unreachable.GetObjId()}, loose)
+
+	name, _, err = d.PackLooseObjects(wanted, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "", name)
+}
+
+//-dなしで2回repackしても、packにあるものは新しいpackに入れない
+func Test_PackLooseObjectsKeepingLoose(t *testing.T) {
+	cur, err := os.Getwd()
+	assert.NoError(t, err)
+	tempPath, err := ioutil.TempDir(cur, "")
+	assert.NoError(t, err)
+
+	t.Cleanup(func() {
+		os.RemoveAll(tempPath)
+	})
+
+	d := &Database{
+		Path: filepath.Join(tempPath, "objects"),
+	}
+	b := &c.Blob{Content: "first\n"}
+	d.Store(b)
+	wanted := map[string]bool{b.GetObjId(): true}
+
+	name, _, err := d.PackLooseObjects(wanted, false)
+	assert.NoError(t, err)
+	assert.NotEqual(t, "", name)
+	again, packed, err := d.PackLooseObjects(wanted, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "", again)
+	assert.Equal(t, 0, len(packed))
+
+	loose, err := d.LooseObjIds()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(loose))
+
+	//-dではpackにあるlooseのobjectも消す
+	_, _, err = d.PackLooseObjects(wanted, true)
+	assert.NoError(t, err)
+	loose, err = d.LooseObjIds()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(loose))
+}
+
+func Test_ReadDeltaObjects(t *testing.T) {
+	cur, err := os.Getwd()
+	assert.NoError(t, err)
+	tempPath, err := ioutil.TempDir(cur, "")
+	assert.NoError(t, err)
+
+	t.Cleanup(func() {
+		os.RemoveAll(tempPath)
+	})
+
+	d := &Database{
+		Path: filepath.Join(tempPath, "objects"),
+	}
+
+	pack, index := deltaPackForTest(t)
+
+	err = os.MkdirAll(d.PackDir(), os.ModePerm)
+	assert.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(d.PackDir(), "pack-test.pack"), pack, 0444)
+	assert.NoError(t, err)
+	err = WritePackIndex(filepath.Join(d.PackDir(), "pack-test.idx"), index)
+	assert.NoError(t, err)
+
+	for i, expected := range []string{"hello world\n", "hello there world\n", "abc"} {
+		o, err := d.ReadObject(index.ObjIds[i])
+		assert.NoError(t, err)
+		b, ok := o.(*c.Blob)
+		assert.True(t, ok)
+		assert.Equal(t, expected, b.Content)
+	}
+}
+
+//base(blob) -> OFS_DELTA(baseからの距離) -> REF_DELTA(baseのobjId)の順に並べたpackとそのidx
+func deltaPackForTest(t *testing.T) ([]byte, *PackIndex) {
+	base := "hello world\n"
+	ofsTarget := "hello there world\n"
+	refTarget := "abc"
+
+	var pack bytes.Buffer
+	header := make([]byte, 12)
+	copy(header, PACK_SIGNATURE)
+	binary.BigEndian.PutUint32(header[4:8], PACK_VERSION)
+	binary.BigEndian.PutUint32(header[8:12], 3)
+	pack.Write(header)
+
+	index := &PackIndex{}
+	addEntry := func(objId string, entry []byte) {
+		index.ObjIds = append(index.ObjIds, objId)
+		index.Offsets = append(index.Offsets, int64(pack.Len()))
+		index.Crcs = append(index.Crcs, crc32.ChecksumIEEE(entry))
+		pack.Write(entry)
+	}
+
+	baseId := crypt.HexDigestBySha1("blob 12\x00" + base)
+	baseOffset := int64(pack.Len())
+	var entry bytes.Buffer
+	WritePackEntryHeader(&entry, PACK_BLOB, int64(len(base)))
+	entry.Write(deflateForTest(t, []byte(base)))
+	addEntry(baseId, entry.Bytes())
+
+	ofsDelta := []byte{12, 18, 0x90, 6, 6, 't', 'h', 'e', 'r', 'e', ' ', 0x91, 6, 6}
+	entry.Reset()
+	WritePackEntryHeader(&entry, PACK_OFS_DELTA, int64(len(ofsDelta)))
+	//距離は1byteに収まる
+	entry.WriteByte(byte(int64(pack.Len()) - baseOffset))
+	entry.Write(deflateForTest(t, ofsDelta))
+	addEntry(crypt.HexDigestBySha1("blob 18\x00"+ofsTarget), entry.Bytes())
+
+	refDelta := []byte{12, 3, 3, 'a', 'b', 'c'}
+	entry.Reset()
+	WritePackEntryHeader(&entry, PACK_REF_DELTA, int64(len(refDelta)))
+	rawBaseId, err := hex.DecodeString(baseId)
+	assert.NoError(t, err)
+	entry.Write(rawBaseId)
+	entry.Write(deflateForTest(t, refDelta))
+	addEntry(crypt.HexDigestBySha1("blob 3\x00"+refTarget), entry.Bytes())
+
+	sum := sha1.Sum(pack.Bytes())
+	pack.Write(sum[:])
+	index.PackHash = sum[:]
+
+	return pack.Bytes(), index
+}
+
+func Test_ReadPackStream(t *testing.T) {
+	pack, index := deltaPackForTest(t)
+
+	for _, d := range []struct {
+		title string
+		pack  []byte
+		err   error
+	}{
+		{"valid", pack, nil},
+		{"checksum mismatch", append(append([]byte{}, pack[:len(pack)-1]...), pack[len(pack)-1]^0xff), ErrorPackChecksumError},
+		{"truncated", pack[:len(pack)-4], io.ErrUnexpectedEOF},
+	} {
+		t.Run(d.title, func(t *testing.T) {
+			cur, err := os.Getwd()
+			assert.NoError(t, err)
+			tempPath, err := ioutil.TempDir(cur, "")
+			assert.NoError(t, err)
+
+			t.Cleanup(func() {
+				os.RemoveAll(tempPath)
+			})
+
+			db := &Database{
+				Path: filepath.Join(tempPath, "objects"),
+			}
+
+			objIds, err := db.ReadPackStream(bytes.NewReader(d.pack))
+			assert.Equal(t, d.err, err)
+
+			//checksumが合わないものは何も書かない、一時ファイルも残さない
+			loose, err := db.LooseObjIds()
+			assert.NoError(t, err)
+			tmps, err := filepath.Glob(filepath.Join(db.PackDir(), "tmp_*"))
+			assert.NoError(t, err)
+			assert.Equal(t, 0, len(tmps))
+			if d.err != nil {
+				assert.Equal(t, 0, len(loose))
+				return
+			}
+
+			assert.Equal(t, index.ObjIds, objIds)
+			assert.Equal(t, 3, len(loose))
+		})
+	}
+}
+
+func deflateForTest(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	_, err := w.Write(data)
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	return buf.Bytes()
+}
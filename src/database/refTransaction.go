@@ -0,0 +1,163 @@
+package database
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+//refの変更はすべてtransactionを通す
+//本家と同じく.git/hooks/reference-transactionをprepared,committed,abortedの3つの状態で呼び、
+//stdinには"<old> <new> <ref>"を1行ずつ渡す、preparedで0以外を返したら変更せずにabortedを呼ぶ
+//hookの前にconfigの[branch "xxx"] protected = trueを見て、保護されたbranchの削除とfast-forwardでない移動を拒否する
+
+const (
+	REFERENCE_TRANSACTION_HOOK = "reference-transaction"
+	TRANSACTION_PREPARED       = "prepared"
+	TRANSACTION_COMMITTED      = "committed"
+	TRANSACTION_ABORTED        = "aborted"
+)
+
+var (
+	ErrorProtectedBranch       = errors.New("protected branch")
+	ErrorRefTransactionAborted = errors.New("ref updates aborted by reference-transaction hook")
+)
+
+type RefTransactionUpdate struct {
+	//.gitからの相対、HEADやrefs/heads/master
+	Name     string
+	OldObjId string
+	//空なら削除
+	NewObjId string
+}
+
+type RefTransaction struct {
+	refs    *Refs
+	Updates []*RefTransactionUpdate
+}
+
+func (r *Refs) Transaction() *RefTransaction {
+	return &RefTransaction{
+		refs: r,
+	}
+}
+
+func (tx *RefTransaction) Add(name, oldObjId, newObjId string) *RefTransaction {
+	tx.Updates = append(tx.Updates, &RefTransactionUpdate{
+		Name:     filepath.ToSlash(name),
+		OldObjId: oldObjId,
+		NewObjId: newObjId,
+	})
+	return tx
+}
+
+//policyとhookのpreparedを通ったらapplyでrefを書き換え、committedを呼ぶ
+func (tx *RefTransaction) Run(apply func() error) error {
+	for _, u := range tx.Updates {
+		if err := tx.refs.checkRefPolicy(u); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.runHook(TRANSACTION_PREPARED); err != nil {
+		tx.runHook(TRANSACTION_ABORTED)
+		return fmt.Errorf("%s: %w", tx.names(), ErrorRefTransactionAborted)
+	}
+
+	if err := apply(); err != nil {
+		tx.runHook(TRANSACTION_ABORTED)
+		return err
+	}
+
+	//committedの結果では取り消せないので無視する
+	tx.runHook(TRANSACTION_COMMITTED)
+	return nil
+}
+
+func (tx *RefTransaction) names() string {
+	var names []string
+	for _, u := range tx.Updates {
+		names = append(names, u.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+func (r *Refs) HooksPath() string {
+	return filepath.Join(r.Path, "hooks")
+}
+
+//hookがない、または実行できなければ何もしない
+func (tx *RefTransaction) runHook(state string) error {
+	path := filepath.Join(tx.refs.HooksPath(), REFERENCE_TRANSACTION_HOOK)
+	stat, err := os.Stat(path)
+	if err != nil || stat.IsDir() || stat.Mode()&0111 == 0 {
+		return nil
+	}
+
+	var stdin bytes.Buffer
+	for _, u := range tx.Updates {
+		stdin.WriteString(fmt.Sprintf("%s %s %s\n", tx.refs.zeroIfEmpty(u.OldObjId), tx.refs.zeroIfEmpty(u.NewObjId), u.Name))
+	}
+
+	cmd := exec.Command(path, state)
+	cmd.Stdin = &stdin
+	//本家と同じくhookの出力はstderrに出す
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	cmd.Dir = tx.refs.hookDir()
+
+	return cmd.Run()
+}
+
+//作業ディレクトリがあればそこ、bareなら.gitにあたるdirectoryでhookを動かす
+func (r *Refs) hookDir() string {
+	if filepath.Base(r.Path) == ".git" {
+		return filepath.Dir(r.Path)
+	}
+	return r.Path
+}
+
+func (r *Refs) zeroIfEmpty(objId string) string {
+	if objId == "" {
+		return r.ZeroObjId()
+	}
+	return objId
+}
+
+func (r *Refs) checkRefPolicy(u *RefTransactionUpdate) error {
+	if !strings.HasPrefix(u.Name, "refs/heads/") || u.OldObjId == "" || u.OldObjId == u.NewObjId {
+		return nil
+	}
+	branch := strings.TrimPrefix(u.Name, "refs/heads/")
+
+	c := GenerateConfig(filepath.Join(r.Path, "config"))
+	if err := c.Load(); err != nil {
+		return err
+	}
+	if v, _ := c.Get("branch", branch, "protected"); v != "true" {
+		return nil
+	}
+
+	if u.NewObjId == "" {
+		return fmt.Errorf("cannot delete '%s': %w", branch, ErrorProtectedBranch)
+	}
+
+	//履歴を辿れない時は安全側に倒して拒否する
+	ff := false
+	if r.FastForward != nil {
+		var err error
+		ff, err = r.FastForward(u.OldObjId, u.NewObjId)
+		if err != nil {
+			return err
+		}
+	}
+	if !ff {
+		return fmt.Errorf("cannot force-move '%s': %w", branch, ErrorProtectedBranch)
+	}
+
+	return nil
+}
@@ -0,0 +1,141 @@
+package database
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	txOldObjId = "1111111111111111111111111111111111111111"
+	txNewObjId = "2222222222222222222222222222222222222222"
+)
+
+func prepareRefsForTxTest(t *testing.T) *Refs {
+	cur, err := os.Getwd()
+	assert.NoError(t, err)
+	tempPath, err := ioutil.TempDir(cur, "")
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(tempPath)
+	})
+
+	gitPath := filepath.Join(tempPath, ".git")
+	assert.NoError(t, os.MkdirAll(filepath.Join(gitPath, "refs", "heads"), os.ModePerm))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(gitPath, "HEAD"), []byte("ref: refs/heads/main\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(gitPath, "refs", "heads", "main"), []byte(txOldObjId+"\n"), 0644))
+
+	return &Refs{Path: gitPath}
+}
+
+//呼ばれた状態とstdinをhook.logに追記し、REJECTがあればpreparedで拒否するhook
+func writeTxHook(t *testing.T, r *Refs) string {
+	logPath := filepath.Join(r.Path, "hook.log")
+	script := `#!/bin/sh
+echo "$1" >> .git/hook.log
+cat >> .git/hook.log
+if [ "$1" = prepared ] && [ -f .git/REJECT ]; then
+	exit 1
+fi
+`
+	assert.NoError(t, os.MkdirAll(r.HooksPath(), os.ModePerm))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(r.HooksPath(), REFERENCE_TRANSACTION_HOOK), []byte(script), 0755))
+
+	return logPath
+}
+
+func TestRefTransactionHook(t *testing.T) {
+	r := prepareRefsForTxTest(t)
+	logPath := writeTxHook(t, r)
+
+	_, err := r.UpdateHead(txNewObjId)
+	assert.NoError(t, err)
+
+	log, err := ioutil.ReadFile(logPath)
+	assert.NoError(t, err)
+	lines := txOldObjId + " " + txNewObjId + " HEAD\n" + txOldObjId + " " + txNewObjId + " refs/heads/main\n"
+	assert.Equal(t, "prepared\n"+lines+"committed\n"+lines, string(log))
+
+	//preparedで拒否されたらrefは変わらない
+	assert.NoError(t, os.Remove(logPath))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(r.Path, "REJECT"), nil, 0644))
+
+	err = r.CreateBranch("topic", txNewObjId)
+	assert.ErrorIs(t, err, ErrorRefTransactionAborted)
+	_, err = os.Stat(filepath.Join(r.HeadsPath(), "topic"))
+	assert.True(t, os.IsNotExist(err))
+
+	log, err = ioutil.ReadFile(logPath)
+	assert.NoError(t, err)
+	line := ZERO_OBJID + " " + txNewObjId + " refs/heads/topic\n"
+	assert.Equal(t, "prepared\n"+line+"aborted\n"+line, string(log))
+
+	_, err = r.DeleteBranch("main")
+	assert.ErrorIs(t, err, ErrorRefTransactionAborted)
+	objId, err := ReadRefFile(filepath.Join(r.HeadsPath(), "main"))
+	assert.NoError(t, err)
+	assert.Equal(t, txNewObjId, objId)
+}
+
+func TestRefTransactionHookSymRefAndStash(t *testing.T) {
+	r := prepareRefsForTxTest(t)
+	logPath := writeTxHook(t, r)
+
+	//symrefはtargetの指すobjIdとして渡し、reflogにも書く
+	err := r.SetSymRef("refs/remotes/origin/HEAD", "refs/heads/main")
+	assert.NoError(t, err)
+	content, err := ReadRefFile(filepath.Join(r.Path, "refs", "remotes", "origin", "HEAD"))
+	assert.NoError(t, err)
+	assert.Equal(t, "ref: refs/heads/main", content)
+	entries, err := r.ReadReflog("refs/remotes/origin/HEAD")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, txOldObjId, entries[0].NewObjId)
+
+	//stash dropで使う、reflogには足さない
+	err = r.UpdateRefWithoutReflog(STASH_REF, txNewObjId)
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(r.LogsPath(), STASH_REF))
+	assert.True(t, os.IsNotExist(err))
+
+	log, err := ioutil.ReadFile(logPath)
+	assert.NoError(t, err)
+	symLine := ZERO_OBJID + " " + txOldObjId + " refs/remotes/origin/HEAD\n"
+	stashLine := ZERO_OBJID + " " + txNewObjId + " " + STASH_REF + "\n"
+	assert.Equal(t, "prepared\n"+symLine+"committed\n"+symLine+"prepared\n"+stashLine+"committed\n"+stashLine, string(log))
+}
+
+func TestProtectedBranch(t *testing.T) {
+	r := prepareRefsForTxTest(t)
+	c := GenerateConfig(filepath.Join(r.Path, "config"))
+	c.Set("branch", "main", "protected", "true")
+	assert.NoError(t, c.Save())
+
+	r.FastForward = func(oldObjId, newObjId string) (bool, error) {
+		return !strings.HasPrefix(newObjId, "3"), nil
+	}
+
+	//fast-forwardなら動かせる
+	err := r.UpdateRef("refs/heads/main", txNewObjId)
+	assert.NoError(t, err)
+
+	err = r.UpdateRef("refs/heads/main", "3333333333333333333333333333333333333333")
+	assert.ErrorIs(t, err, ErrorProtectedBranch)
+	assert.Contains(t, err.Error(), "cannot force-move 'main'")
+
+	_, err = r.DeleteBranch("main")
+	assert.ErrorIs(t, err, ErrorProtectedBranch)
+	objId, err := ReadRefFile(filepath.Join(r.HeadsPath(), "main"))
+	assert.NoError(t, err)
+	assert.Equal(t, txNewObjId, objId)
+
+	//保護されていないbranchは自由に動かせる
+	assert.NoError(t, r.CreateBranch("topic", txNewObjId))
+	assert.NoError(t, r.UpdateRef("refs/heads/topic", "3333333333333333333333333333333333333333"))
+	_, err = r.DeleteBranch("topic")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,276 @@
+package database
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	c "mygit/src/database/content"
+	"mygit/src/database/util"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//.git/logs/<ref>に1行ずつ追記していく
+//<old objId> <new objId> name <email> unixtime timezone\tmessage
+//sha1のrepositoryのすべて0のobjId、sha256ではRefs.ZeroObjIdを使う
+var ZERO_OBJID = strings.Repeat("0", 40)
+
+var ErrorInvalidReflog = errors.New("invalid reflog entry")
+
+type ReflogEntry struct {
+	OldObjId string
+	NewObjId string
+	Identity *c.Author
+	Message  string
+}
+
+func (e *ReflogEntry) ToString() string {
+	return fmt.Sprintf("%s %s %s\t%s\n", e.OldObjId, e.NewObjId, e.Identity.ToString(), e.Message)
+}
+
+func ParseReflogEntry(line string) (*ReflogEntry, error) {
+	header, message, _ := strings.Cut(line, "\t")
+
+	words := strings.SplitN(header, " ", 3)
+	if len(words) != 3 {
+		return nil, ErrorInvalidReflog
+	}
+
+	return &ReflogEntry{
+		OldObjId: words[0],
+		NewObjId: words[1],
+		Identity: c.ParseAuthorLine(words[2]),
+		Message:  message,
+	}, nil
+}
+
+//reflogに書く理由(commit,checkoutなど)を持たせたRefsを返す、元のRefsは変えない
+func (r *Refs) WithReason(reason string) *Refs {
+	cp := *r
+	cp.reason = reason
+	return &cp
+}
+
+//reflogに書くidentity、指定がなければconfigのuser.name,user.emailを使う
+func (r *Refs) WithIdentity(name, email string) *Refs {
+	cp := *r
+	cp.Name = name
+	cp.Email = email
+	return &cp
+}
+
+func (r *Refs) identity() *c.Author {
+	name := r.Name
+	email := r.Email
+	if name == "" || email == "" {
+		//configが読めなくてもreflogは書く
+		if cs, err := LoadConfigStack(r.Path); err == nil {
+			if name == "" {
+				name = cs.UserName()
+			}
+			if email == "" {
+				email = cs.UserEmail()
+			}
+		}
+	}
+
+	return c.GenerateAuthor(name, email)
+}
+
+func (r *Refs) LogsPath() string {
+	return filepath.Join(r.Path, "logs")
+}
+
+//本家のcore.logAllRefUpdatesと同じくHEADとbranch,remote-tracking branchだけ記録する
+//refs/stashはstashの一覧をreflogで持つので記録する
+func (r *Refs) shouldLog(relPath string) bool {
+	relPath = filepath.ToSlash(relPath)
+	return relPath == "HEAD" || relPath == STASH_REF || strings.HasPrefix(relPath, "refs/heads/") || strings.HasPrefix(relPath, "refs/remotes/")
+}
+
+//pathは.git/HEADや.git/refs/heads/masterのような絶対パス
+func (r *Refs) appendReflog(path, oldObjId, newObjId string) error {
+	relPath, err := filepath.Rel(r.Path, path)
+	if err != nil {
+		return err
+	}
+
+	if !r.shouldLog(relPath) || strings.HasPrefix(newObjId, "ref: ") {
+		return nil
+	}
+
+	if oldObjId == "" {
+		oldObjId = r.ZeroObjId()
+	}
+	if newObjId == "" {
+		newObjId = r.ZeroObjId()
+	}
+
+	logPath := filepath.Join(r.LogsPath(), relPath)
+	err = os.MkdirAll(filepath.Dir(logPath), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	entry := &ReflogEntry{
+		OldObjId: oldObjId,
+		NewObjId: newObjId,
+		Identity: r.identity(),
+		Message:  r.reason,
+	}
+
+	_, err = f.Write([]byte(entry.ToString()))
+
+	return err
+}
+
+//HEAD,master,refs/heads/masterのどれでも読めるようにPathForNameで解決してからlogsのパスにする
+func (r *Refs) ReflogPath(name string) (string, bool) {
+	path, ok := r.PathForName(name)
+	if !ok {
+		return "", false
+	}
+
+	relPath, err := filepath.Rel(r.Path, path)
+	if err != nil {
+		return "", false
+	}
+
+	logPath := filepath.Join(r.LogsPath(), relPath)
+	if _, err := os.Stat(logPath); err != nil {
+		return "", false
+	}
+
+	return logPath, true
+}
+
+func (r *Refs) ReadReflog(name string) ([]*ReflogEntry, error) {
+	logPath, ok := r.ReflogPath(name)
+	if !ok {
+		return nil, ErrorPathNotExists
+	}
+
+	return ReadReflogFile(logPath)
+}
+
+//ファイルには古い順に並んでいるが、HEAD@{0}が最新なので新しい順にして返す
+func ReadReflogFile(logPath string) ([]*ReflogEntry, error) {
+	f, err := os.Open(logPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []*ReflogEntry
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if s.Text() == "" {
+			continue
+		}
+
+		e, err := ParseReflogEntry(s.Text())
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+
+	return entries, nil
+}
+
+//entriesは新しい順、ファイルには古い順に書く
+func WriteReflogFile(logPath string, entries []*ReflogEntry) error {
+	var b strings.Builder
+	for i := len(entries) - 1; i >= 0; i-- {
+		b.WriteString(entries[i].ToString())
+	}
+
+	return ioutil.WriteFile(logPath, []byte(b.String()), 0644)
+}
+
+//stash dropのようにreflogのn番目だけ消す、消したentryを返す
+func (r *Refs) DropReflogEntry(name string, n int) (*ReflogEntry, error) {
+	logPath, ok := r.ReflogPath(name)
+	if !ok {
+		return nil, ErrorPathNotExists
+	}
+
+	entries, err := ReadReflogFile(logPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if n < 0 || n >= len(entries) {
+		return nil, ErrorPathNotExists
+	}
+
+	dropped := entries[n]
+	entries = append(entries[:n], entries[n+1:]...)
+
+	err = WriteReflogFile(logPath, entries)
+	if err != nil {
+		return nil, err
+	}
+
+	return dropped, nil
+}
+
+//gcでreflogから辿れるobjectを残すために全部のlogファイルを返す
+func (r *Refs) ListReflogs() ([]string, error) {
+	if _, err := os.Stat(r.LogsPath()); err != nil {
+		return nil, nil
+	}
+
+	files, err := util.FilePathWalkDir(r.LogsPath(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, f := range files {
+		paths = append(paths, filepath.Join(r.LogsPath(), f))
+	}
+
+	return paths, nil
+}
+
+//branchを消した時はlogも消す
+func (r *Refs) deleteReflog(path string) error {
+	relPath, err := filepath.Rel(r.Path, path)
+	if err != nil {
+		return err
+	}
+
+	logPath := filepath.Join(r.LogsPath(), relPath)
+	if _, err := os.Stat(logPath); err != nil {
+		return nil
+	}
+
+	err = os.Remove(logPath)
+	if err != nil {
+		return err
+	}
+
+	logHeadsPath := filepath.Join(r.LogsPath(), "refs", "heads")
+	rel, err := filepath.Rel(logHeadsPath, logPath)
+	if err != nil {
+		return err
+	}
+
+	return util.DeleteParentDir(rel, logHeadsPath)
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"mygit/src/crypt"
 	"mygit/src/database/lock"
 	"mygit/src/database/util"
 	"os"
@@ -12,9 +13,26 @@ import (
 )
 
 var ORIG_HEAD = "ORIG_HEAD"
+var STASH_REF = "refs/stash"
 
 type Refs struct {
 	Path string
+	//reflogに書くidentity
+	Name  string
+	Email string
+	//reflogに書く理由、WithReasonで指定する
+	reason string
+	//oldから辿ってnewに行けるか、保護されたbranchの確認に使う
+	FastForward func(oldObjId, newObjId string) (bool, error)
+	//作成や削除を表すobjIdの長さに使う、nilならsha1
+	Hash crypt.Hash
+}
+
+func (r *Refs) ZeroObjId() string {
+	if r.Hash == nil {
+		return ZERO_OBJID
+	}
+	return r.Hash.ZeroObjId()
 }
 
 type RefObj interface {
@@ -141,13 +159,20 @@ func (r *Refs) DeleteBranch(path string) (string, error) {
 		return "", err
 	}
 
-	err = os.RemoveAll(p)
-	if err != nil {
-		return "", err
-	}
-	//refs/heads/features/xxxがあったとして、今xxxを削除してfeaturesが空になったとする
-	//そうするとfeaturesを削除したい(headsまでは削除しない)
-	err = util.DeleteParentDir(path, r.HeadsPath())
+	err = r.Transaction().Add(filepath.Join("refs", "heads", path), objId, "").Run(func() error {
+		err := os.RemoveAll(p)
+		if err != nil {
+			return err
+		}
+
+		err = r.deleteReflog(p)
+		if err != nil {
+			return err
+		}
+		//refs/heads/features/xxxがあったとして、今xxxを削除してfeaturesが空になったとする
+		//そうするとfeaturesを削除したい(headsまでは削除しない)
+		return util.DeleteParentDir(path, r.HeadsPath())
+	})
 	if err != nil {
 		return "", err
 	}
@@ -183,6 +208,30 @@ func (r *Refs) DeleteBranch(path string) (string, error) {
 // 	return nil
 // }
 
+//refs/stashのようにbranch,tag以外のrefを消す、reflogも一緒に消す
+func (r *Refs) DeleteRef(name string) error {
+	path := filepath.Join(r.Path, name)
+
+	if _, err := os.Stat(path); err != nil {
+		return ErrorPathNotExists
+	}
+	oldObjId, _ := ReadRefFile(path)
+
+	return r.Transaction().Add(name, oldObjId, "").Run(func() error {
+		err := os.Remove(path)
+		if err != nil {
+			return err
+		}
+
+		logPath := filepath.Join(r.LogsPath(), name)
+		if _, err := os.Stat(logPath); err == nil {
+			return os.Remove(logPath)
+		}
+
+		return nil
+	})
+}
+
 func (r *Refs) ListBranches() ([]*SymRef, error) {
 	return r.ListRefs(r.HeadsPath())
 }
@@ -196,8 +245,8 @@ func (r *Refs) ListRefs(headsPath string) ([]*SymRef, error) {
 	var temp []*SymRef
 	//WalkDirを使うことでnestedDirの下にあるファイルも一気に取れる
 	for _, l := range lists {
-		//refs/heads/~の相対パスとなる
-		relPath, err := filepath.Rel(r.Path, filepath.Join(r.HeadsPath(), l))
+		//refs/heads/~(refs/tags/~)の相対パスとなる
+		relPath, err := filepath.Rel(r.Path, filepath.Join(headsPath, l))
 
 		if err != nil {
 			return nil, err
@@ -231,6 +280,7 @@ var (
 	ErrorExtIsLock              = errors.New("extIsLockError")
 	ErrorRevisionContained      = errors.New("revisionComponentContained")
 	ErrorBranchAlreadyExists    = errors.New("branchAlreadyExists")
+	ErrorTagAlreadyExists       = errors.New("tagAlreadyExists")
 )
 
 func (r *Refs) CreateBranch(branchName string, startObjId string) error {
@@ -251,12 +301,78 @@ func (r *Refs) CreateBranch(branchName string, startObjId string) error {
 	// if err != nil {
 	// 	return err
 	// }
-	err = r.UpdateRefFile(path, startObjId)
+	return r.Transaction().Add(filepath.Join("refs", "heads", branchName), "", startObjId).Run(func() error {
+		err := r.UpdateRefFile(path, startObjId)
+		if err != nil {
+			return err
+		}
+
+		return r.appendReflog(path, "", startObjId)
+	})
+}
+
+//forceなら既存のtagを上書きする
+func (r *Refs) CreateTag(tagName, objId string, force bool) error {
+	err := CheckValidRef(tagName)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	path := filepath.Join(r.TagsPath(), tagName)
+
+	if _, err := os.Stat(path); err == nil && !force {
+		return ErrorTagAlreadyExists
+	}
+	oldObjId, _ := ReadRefFile(path)
+
+	return r.Transaction().Add(filepath.Join("refs", "tags", tagName), oldObjId, objId).Run(func() error {
+		return r.UpdateRefFile(path, objId)
+	})
+}
+
+func (r *Refs) DeleteTag(tagName string) (string, error) {
+	//../heads/masterのようにrefs/tagsの外を消せないようにする
+	err := CheckValidRef(tagName)
+	if err != nil {
+		return "", err
+	}
+
+	p := filepath.Join(r.TagsPath(), tagName)
+
+	stat, _ := os.Stat(p)
+
+	if stat == nil || stat.IsDir() {
+		return "", ErrorPathNotExists
+	}
+
+	objId, err := ReadRefFile(p)
+	if err != nil {
+		return "", err
+	}
+
+	err = r.Transaction().Add(filepath.Join("refs", "tags", tagName), objId, "").Run(func() error {
+		err := os.RemoveAll(p)
+		if err != nil {
+			return err
+		}
+
+		//branchと同じくrefs/tags/release/v1のreleaseが空になったら消す
+		return util.DeleteParentDir(tagName, r.TagsPath())
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return objId, nil
+}
+
+func (r *Refs) ListTags() ([]*SymRef, error) {
+	if _, err := os.Stat(r.TagsPath()); err != nil {
+		//まだtagを一つも作っていない
+		return nil, nil
+	}
+
+	return r.ListRefs(r.TagsPath())
 }
 
 func CheckValidRef(branchName string) error {
@@ -331,7 +447,27 @@ func (r *Refs) CreateHeadPath(path string) error {
 func (r *Refs) UpdateRef(path, objId string) error {
 	//.git/pathにobjIdを書き込む
 	//例としてpath=ORIG_HEAD
-	return r.UpdateRefFile(filepath.Join(r.Path, path), objId)
+	absPath := filepath.Join(r.Path, path)
+	oldObjId, _ := ReadRefFile(absPath)
+
+	return r.Transaction().Add(path, oldObjId, objId).Run(func() error {
+		err := r.UpdateRefFile(absPath, objId)
+		if err != nil {
+			return err
+		}
+
+		return r.appendReflog(absPath, oldObjId, objId)
+	})
+}
+
+//stash dropのようにreflogを書き換えてからrefを合わせる時は、本家のreflog delete --updaterefと同じくreflogに足さない
+func (r *Refs) UpdateRefWithoutReflog(path, objId string) error {
+	absPath := filepath.Join(r.Path, path)
+	oldObjId, _ := ReadRefFile(absPath)
+
+	return r.Transaction().Add(path, oldObjId, objId).Run(func() error {
+		return r.UpdateRefFile(absPath, objId)
+	})
 }
 
 func (r *Refs) UpdateRefFile(path, objId string) error {
@@ -375,7 +511,60 @@ func (r *Refs) UpdateHead(objId string) (string, error) {
 
 }
 
+//HEAD->masterならHEADとrefs/heads/masterを1つのtransactionで更新する
 func (r *Refs) UpdateSymRef(path, objId string) (string, error) {
+	names, oldObjId, err := r.resolveSymRefChain(path)
+	if err != nil {
+		return "", err
+	}
+
+	tx := r.Transaction()
+	for _, name := range names {
+		tx.Add(name, oldObjId, objId)
+	}
+
+	var origObjId string
+	err = tx.Run(func() error {
+		var err error
+		origObjId, err = r.updateSymRef(path, objId)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return origObjId, nil
+}
+
+//pathから辿ったrefの名前と、最後に指しているobjId
+func (r *Refs) resolveSymRefChain(path string) ([]string, string, error) {
+	var names []string
+
+	for {
+		name, err := filepath.Rel(r.Path, path)
+		if err != nil {
+			return nil, "", err
+		}
+		names = append(names, name)
+
+		ref, err := r.ReadObjIdOrSymRef(path)
+		if os.IsNotExist(err) {
+			//initで最初にHEADを書く時はまだファイルがない
+			return names, "", nil
+		}
+		if err != nil {
+			return nil, "", err
+		}
+
+		symRef, ok := ref.(*SymRef)
+		if !ok {
+			return names, ref.GetObjIdOrPath(), nil
+		}
+		path = filepath.Join(r.Path, symRef.GetObjIdOrPath())
+	}
+}
+
+func (r *Refs) updateSymRef(path, objId string) (string, error) {
 	l := lock.NewFileLock(path)
 	l.Lock()
 	defer l.Unlock()
@@ -401,40 +590,72 @@ func (r *Refs) UpdateSymRef(path, objId string) (string, error) {
 			}
 		}()
 		f.Write([]byte(fmt.Sprintf("%s\n", objId)))
+
+		err = r.appendReflog(path, ref.GetObjIdOrPath(), objId)
+		if err != nil {
+			return "", err
+		}
 		//refなのでobjIdが返る,ここでUpdateする前の元々のobjIdを返すのはORIG_HEADに書き込むため
 		return ref.GetObjIdOrPath(), nil
 	}
 
 	//SymRefの場合,(最終的にRefにたどり着き、ここまでobjIdが返ってくる)
-	objId, err = r.UpdateSymRef(filepath.Join(r.Path, symRef.GetObjIdOrPath()), objId)
+	origObjId, err := r.updateSymRef(filepath.Join(r.Path, symRef.GetObjIdOrPath()), objId)
 	if err != nil {
 		return "", err
 	}
 
-	return objId, nil
+	//HEAD->masterならmasterだけでなくHEADのlogにも書く
+	err = r.appendReflog(path, origObjId, objId)
+	if err != nil {
+		return "", err
+	}
+
+	return origObjId, nil
 
 }
 
 func (r *Refs) SetHead(revPath, objId string) error {
 	path := filepath.Join(r.HeadsPath(), revPath)
 
-	stat, _ := os.Stat(path)
+	//まだcommitがないbranchのこともあるのでerrorは無視
+	oldObjId, _ := r.ReadHead()
 
-	if stat != nil && !stat.IsDir() {
+	return r.Transaction().Add("HEAD", oldObjId, objId).Run(func() error {
+		stat, _ := os.Stat(path)
 
-		relPath, _ := filepath.Rel(r.Path, path) //refs/heads/~以下だけ書きたい
-		err := r.UpdateRefFile(r.HeadPath(), fmt.Sprintf("ref: %s", relPath))
-		if err != nil {
-			return err
+		if stat != nil && !stat.IsDir() {
+
+			relPath, _ := filepath.Rel(r.Path, path) //refs/heads/~以下だけ書きたい
+			err := r.UpdateRefFile(r.HeadPath(), fmt.Sprintf("ref: %s", relPath))
+			if err != nil {
+				return err
+			}
+		} else {
+			err := r.UpdateRefFile(r.HeadPath(), objId)
+			if err != nil {
+				return err
+			}
 		}
-	} else {
-		err := r.UpdateRefFile(r.HeadPath(), objId)
+
+		return r.appendReflog(r.HeadPath(), oldObjId, objId)
+	})
+}
+
+//refs/remotes/origin/HEADのようなHEAD以外のsymrefを書く、transactionとreflogにはtargetの指すobjIdを渡す
+func (r *Refs) SetSymRef(name, target string) error {
+	path := filepath.Join(r.Path, name)
+	oldObjId, _ := r.ReadSymRef(path)
+	objId, _ := r.ReadSymRef(filepath.Join(r.Path, target))
+
+	return r.Transaction().Add(name, oldObjId, objId).Run(func() error {
+		err := r.UpdateRefFile(path, fmt.Sprintf("ref: %s", target))
 		if err != nil {
 			return err
 		}
-	}
 
-	return nil
+		return r.appendReflog(path, oldObjId, objId)
+	})
 }
 
 var ErrorPathNotExists = errors.New("PathNotExists")
@@ -460,8 +681,9 @@ func ReadRefFile(name string) (string, error) {
 	return strings.TrimSpace(string(bytes)), nil
 }
 
+//本家と同じくtagの方をbranchより先に見る、origin/masterはrefs/remotesから探す
 func (r *Refs) PathForName(name string) (string, bool) {
-	pref := []string{r.Path, r.RefsPath(), r.HeadsPath()}
+	pref := []string{r.Path, r.RefsPath(), r.TagsPath(), r.HeadsPath(), r.RemotesPath()}
 
 	for _, r := range pref {
 		target := filepath.Join(r, name)
@@ -511,6 +733,14 @@ func (r *Refs) HeadsPath() string {
 	return filepath.Join(r.RefsPath(), "heads")
 }
 
+func (r *Refs) TagsPath() string {
+	return filepath.Join(r.RefsPath(), "tags")
+}
+
+func (r *Refs) RemotesPath() string {
+	return filepath.Join(r.RefsPath(), "remotes")
+}
+
 func (r *Refs) HeadPath() string {
 	return filepath.Join(r.Path, "HEAD")
 }
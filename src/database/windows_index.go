@@ -11,12 +11,7 @@ import (
 
 func CreateIndex(path, objId string, state con.FileState) *con.Entry {
 
-	var mode int
-	if IsExec(uint32(state.Mode())) {
-		mode = EXECUTABLE_MODE
-	} else {
-		mode = REGULAR_MODE
-	}
+	mode := ModeForStat(state)
 
 	flags := int(math.Min(float64(len([]byte(path))), float64(MAX_PATH_SIZE)))
 
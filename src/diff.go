@@ -3,12 +3,10 @@ package src
 import (
 	"fmt"
 	"io"
-	"mygit/src/crypt"
 	data "mygit/src/database"
 	con "mygit/src/database/content"
 	"mygit/util"
 	"path/filepath"
-	"strings"
 
 	"github.com/hexops/gotextdiff"
 	"github.com/hexops/gotextdiff/myers"
@@ -21,11 +19,12 @@ type DiffOption struct {
 }
 
 func StartDiff(w io.Writer, rootPath string, option *DiffOption) error {
-	gitPath := filepath.Join(rootPath, ".git")
-	dbPath := filepath.Join(gitPath, "objects")
-	repo := GenerateRepository(rootPath, gitPath, dbPath)
+	repo, err := DiscoverWorkTree(rootPath)
+	if err != nil {
+		return err
+	}
 
-	err := repo.i.Load()
+	err = repo.i.Load()
 
 	if err != nil {
 		return err
@@ -54,10 +53,7 @@ func StartDiff(w io.Writer, rootPath string, option *DiffOption) error {
 	return nil
 }
 
-var (
-	NULLObjId = strings.Repeat("0", 40)
-	NULLPath  = "/dev/null"
-)
+var NULLPath = "/dev/null"
 
 type DiffTarget struct {
 	Mode    string
@@ -109,7 +105,12 @@ func RunCreateTargetFromIndex(stage int, path string, repo *Repository) (*DiffTa
 func CreateTargetFromEntry(path string, repo *Repository, e *con.Entry) (*DiffTarget, error) {
 
 	if e == nil {
-		return CreateTargetFromNothing(path)
+		return CreateTargetFromNothing(path, repo)
+	}
+
+	if e.IsGitlink() {
+		//submoduleのcommitはこのrepositoryにはないので、本家と同じくcommitのobjIdを中身にする
+		return createGitlinkTarget(path, e.ObjId, e.Mode), nil
 	}
 
 	o, err := repo.d.ReadObject(e.ObjId)
@@ -132,6 +133,10 @@ func CreateTargetFromEntry(path string, repo *Repository, e *con.Entry) (*DiffTa
 }
 
 func CreateTargetFromFile(path string, s *Status, repo *Repository) (*DiffTarget, error) {
+	if stat, ok := s.Stats[path]; ok && stat.IsDir() {
+		return createSubmoduleTarget(path, repo)
+	}
+
 	content, err := repo.w.ReadFile(path)
 
 	if err != nil {
@@ -147,7 +152,7 @@ func CreateTargetFromFile(path string, s *Status, repo *Repository) (*DiffTarget
 		Content: content,
 	}
 	headerCon := data.GetStoreHeaderContent(blob)
-	objId := crypt.HexDigestBySha1(headerCon)
+	objId := repo.Hash().HexDigest(headerCon)
 	mode := con.ModeToString(data.ModeForStat(stat))
 
 	return &DiffTarget{
@@ -158,10 +163,41 @@ func CreateTargetFromFile(path string, s *Status, repo *Repository) (*DiffTarget
 	}, nil
 }
 
-func CreateTargetFromNothing(path string) (*DiffTarget, error) {
+func createGitlinkTarget(path, objId string, mode int) *DiffTarget {
+	return &DiffTarget{
+		Path:    path,
+		ObjId:   objId,
+		Mode:    con.ModeToString(mode),
+		Content: fmt.Sprintf("Subproject commit %s\n", objId),
+	}
+}
+
+//作業ディレクトリのsubmoduleはHEADのcommit、cloneしていなければindexに記録したcommitのまま
+func createSubmoduleTarget(path string, repo *Repository) (*DiffTarget, error) {
+	e, ok := repo.i.EntryForPath(path)
+	if !ok {
+		return nil, data.ErrorEntriesNotExists
+	}
+	if !repo.w.IsNestedRepository(path) {
+		return createGitlinkTarget(path, e.ObjId, e.Mode), nil
+	}
+
+	sub, err := openSubmodule(repo.w, path)
+	if err != nil {
+		return nil, err
+	}
+	head, err := sub.r.ReadHead()
+	if err != nil {
+		return nil, err
+	}
+
+	return createGitlinkTarget(path, head, data.GITLINK_MODE), nil
+}
+
+func CreateTargetFromNothing(path string, repo *Repository) (*DiffTarget, error) {
 	return &DiffTarget{
 		Path:  path,
-		ObjId: NULLObjId,
+		ObjId: repo.Hash().ZeroObjId(),
 	}, nil
 }
 
@@ -203,7 +239,7 @@ func DiffIndexWorkSpace(stage int, s *Status, repo *Repository, w io.Writer) err
 		}
 
 		switch status {
-		case WORKSPACE_MODIFIED:
+		case WORKSPACE_MODIFIED, WORKSPACE_TYPECHANGE:
 			{
 				a, err := CreateTargetFromIndex(path, repo)
 				if err != nil {
@@ -224,13 +260,34 @@ func DiffIndexWorkSpace(stage int, s *Status, repo *Repository, w io.Writer) err
 				}
 
 			}
+		case WORKSPACE_ADDED:
+			{
+				//add -Nしたものは空ではなく存在しないファイルとの差分にする
+				a, err := CreateTargetFromNothing(path, repo)
+				if err != nil {
+					return err
+				}
+				b, err := CreateTargetFromFile(path, s, repo)
+				if err != nil {
+					return err
+				}
+				err = PrintDiff(
+					a,
+					b,
+					repo,
+					w,
+				)
+				if err != nil {
+					return err
+				}
+			}
 		case WORKSPACE_DELETE:
 			{
 				a, err := CreateTargetFromIndex(path, repo)
 				if err != nil {
 					return err
 				}
-				b, err := CreateTargetFromNothing(path)
+				b, err := CreateTargetFromNothing(path, repo)
 				if err != nil {
 					return err
 				}
@@ -263,7 +320,7 @@ func DiffHeadIndex(s *Status, repo *Repository, w io.Writer) error {
 		switch status {
 		case INDEX_ADDED:
 			{
-				a, err := CreateTargetFromNothing(path)
+				a, err := CreateTargetFromNothing(path, repo)
 				if err != nil {
 					return err
 				}
@@ -282,7 +339,7 @@ func DiffHeadIndex(s *Status, repo *Repository, w io.Writer) error {
 				}
 
 			}
-		case INDEX_MODIFIED:
+		case INDEX_MODIFIED, INDEX_TYPECHANGE:
 			{
 				a, err := CreateTargetFromHead(path, repo, s)
 				if err != nil {
@@ -309,7 +366,7 @@ func DiffHeadIndex(s *Status, repo *Repository, w io.Writer) error {
 				if err != nil {
 					return err
 				}
-				b, err := CreateTargetFromNothing(path)
+				b, err := CreateTargetFromNothing(path, repo)
 				if err != nil {
 					return err
 				}
@@ -366,6 +423,11 @@ func PrintDiff(a, b *DiffTarget, repo *Repository, w io.Writer) error {
 		return nil
 	}
 
+	if a.Mode != "" && b.Mode != "" && con.IsTypeChange(con.ModeToInt(a.Mode), con.ModeToInt(b.Mode)) {
+		//本家と同じくファイルとsymlinkの入れ替わりは削除と追加の2つに分けて出す
+		return PrintTypeChangeDiff(a, b, repo, w)
+	}
+
 	a.Path = filepath.Join("a", a.Path)
 	b.Path = filepath.Join("b", b.Path)
 
@@ -385,6 +447,24 @@ func PrintDiff(a, b *DiffTarget, repo *Repository, w io.Writer) error {
 
 }
 
+func PrintTypeChangeDiff(a, b *DiffTarget, repo *Repository, w io.Writer) error {
+	deleted, err := CreateTargetFromNothing(b.Path, repo)
+	if err != nil {
+		return err
+	}
+	added, err := CreateTargetFromNothing(a.Path, repo)
+	if err != nil {
+		return err
+	}
+
+	err = PrintDiff(a, deleted, repo, w)
+	if err != nil {
+		return err
+	}
+
+	return PrintDiff(added, b, repo, w)
+}
+
 func PrintDiffMode(a, b *DiffTarget, w io.Writer) error {
 	if a.Mode == "" {
 		w.Write([]byte(fmt.Sprintf("new file mode %s\n", b.Mode)))
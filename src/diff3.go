@@ -1,22 +1,245 @@
 package src
 
-//diff3はいったんdiffアルゴリズムを自分で実装してから
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+//diff3はbase->a,base->bそれぞれの行単位のdiffをとって、
+//baseの行がa,b両方で変化していない(一致している)ところを区切りにchunkを作っていく
+//区切りと区切りの間のchunkでa,bの片方しか変わっていなければclean,両方変わっていればconflict
 type Diff3 struct {
-	origin    string
-	a         string
-	b         string
-	chunks    []string
-	matchA    []string
-	matchB    []string
+	origin    []string
+	a         []string
+	b         []string
+	chunks    []Diff3Chunk
+	matchA    map[int]int //baseの行番号 -> aの行番号
+	matchB    map[int]int //baseの行番号 -> bの行番号
 	lineOrign int
 	lineA     int
 	lineB     int
 }
 
-func (d *Diff3) Merge() {
+type Diff3Chunk interface {
+	ToString(aName, bName string) string
+	IsConflict() bool
+}
+
+type CleanChunk struct {
+	Lines []string
+}
+
+func (c *CleanChunk) ToString(aName, bName string) string {
+	return strings.Join(c.Lines, "")
+}
+
+func (c *CleanChunk) IsConflict() bool {
+	return false
+}
+
+type ConflictChunk struct {
+	OriginLines []string
+	ALines      []string
+	BLines      []string
+}
+
+func (c *ConflictChunk) ToString(aName, bName string) string {
+	var str string
+	str += conflictSeparator("<", aName)
+	str += joinWithTrailingNewLine(c.ALines)
+	str += conflictSeparator("=", "")
+	str += joinWithTrailingNewLine(c.BLines)
+	str += conflictSeparator(">", bName)
+
+	return str
+}
+
+func (c *ConflictChunk) IsConflict() bool {
+	return true
+}
+
+func conflictSeparator(char, name string) string {
+	str := strings.Repeat(char, 7)
+	if name != "" {
+		str += fmt.Sprintf(" %s", name)
+	}
+	return str + "\n"
+}
+
+//ファイル末尾の改行なしの行がconflictに入るとseparatorとくっついてしまうので改行を補う
+func joinWithTrailingNewLine(lines []string) string {
+	str := strings.Join(lines, "")
+	if str != "" && !strings.HasSuffix(str, "\n") {
+		str += "\n"
+	}
+	return str
+}
+
+type Diff3Result struct {
+	Chunks []Diff3Chunk
+}
+
+func (r *Diff3Result) IsClean() bool {
+	for _, c := range r.Chunks {
+		if c.IsConflict() {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Diff3Result) ToString(aName, bName string) string {
+	var str string
+	for _, c := range r.Chunks {
+		str += c.ToString(aName, bName)
+	}
+	return str
+}
+
+func Diff3Merge(origin, a, b string) *Diff3Result {
+	d := &Diff3{
+		origin: SplitLines(origin),
+		a:      SplitLines(a),
+		b:      SplitLines(b),
+	}
+
+	return d.Merge()
+}
+
+func (d *Diff3) Merge() *Diff3Result {
+	d.SetUp()
+	d.GenerateChunks()
 
+	return &Diff3Result{
+		Chunks: d.chunks,
+	}
 }
 
-func SetUp() {
+func (d *Diff3) SetUp() {
+	d.chunks = make([]Diff3Chunk, 0)
+	d.lineOrign = 0
+	d.lineA = 0
+	d.lineB = 0
+	d.matchA = d.MatchSet(d.a)
+	d.matchB = d.MatchSet(d.b)
+}
+
+func (d *Diff3) MatchSet(file []string) map[int]int {
+	matches := make(map[int]int)
+
+	for _, edit := range MyersDiff(d.origin, file) {
+		if edit.Type != EDIT_EQL {
+			continue
+		}
+		matches[edit.ALine.Number] = edit.BLine.Number
+	}
+
+	return matches
+}
+
+func (d *Diff3) GenerateChunks() {
+	for {
+		i, found := d.FindNextMismatch()
+
+		if !found {
+			d.EmitFinalChunk()
+			return
+		}
+
+		if i == 1 {
+			//今の位置からすぐにずれている->次に3つが一致する場所を探す
+			o, a, b, ok := d.FindNextMatch()
+			if !ok {
+				d.EmitFinalChunk()
+				return
+			}
+			d.EmitChunk(o, a, b)
+		} else {
+			//i-1行分は3つとも一致しているのでそこまでcleanとして出す
+			d.EmitChunk(d.lineOrign+i, d.lineA+i, d.lineB+i)
+		}
+	}
+}
+
+func (d *Diff3) FindNextMismatch() (int, bool) {
+	i := 1
+	for d.InBounds(i) && d.IsMatch(d.matchA, d.lineA, i) && d.IsMatch(d.matchB, d.lineB, i) {
+		i++
+	}
+
+	return i, d.InBounds(i)
+}
+
+func (d *Diff3) InBounds(i int) bool {
+	return d.lineOrign+i <= len(d.origin) ||
+		d.lineA+i <= len(d.a) ||
+		d.lineB+i <= len(d.b)
+}
+
+func (d *Diff3) IsMatch(matches map[int]int, offset, i int) bool {
+	n, ok := matches[d.lineOrign+i]
+	return ok && n == offset+i
+}
+
+func (d *Diff3) FindNextMatch() (int, int, int, bool) {
+	o := d.lineOrign + 1
+
+	for o <= len(d.origin) {
+		_, aOk := d.matchA[o]
+		_, bOk := d.matchB[o]
+		if aOk && bOk {
+			return o, d.matchA[o], d.matchB[o], true
+		}
+		o++
+	}
+
+	return 0, 0, 0, false
+}
+
+//o,a,bはそれぞれ次に一致する行(1始まり)、その手前までをchunkとして出す
+func (d *Diff3) EmitChunk(o, a, b int) {
+	d.WriteChunk(
+		d.origin[d.lineOrign:o-1],
+		d.a[d.lineA:a-1],
+		d.b[d.lineB:b-1],
+	)
+
+	d.lineOrign = o - 1
+	d.lineA = a - 1
+	d.lineB = b - 1
+}
+
+func (d *Diff3) EmitFinalChunk() {
+	d.WriteChunk(
+		d.origin[d.lineOrign:],
+		d.a[d.lineA:],
+		d.b[d.lineB:],
+	)
+}
+
+func (d *Diff3) WriteChunk(o, a, b []string) {
+	if len(o) == 0 && len(a) == 0 && len(b) == 0 {
+		return
+	}
+
+	if equalLines(a, o) || equalLines(a, b) {
+		d.chunks = append(d.chunks, &CleanChunk{Lines: b})
+	} else if equalLines(b, o) {
+		d.chunks = append(d.chunks, &CleanChunk{Lines: a})
+	} else {
+		d.chunks = append(d.chunks, &ConflictChunk{
+			OriginLines: o,
+			ALines:      a,
+			BLines:      b,
+		})
+	}
+}
 
+//nilと空sliceを同じとみなしたいのでDeepEqualの前に長さで判定
+func equalLines(x, y []string) bool {
+	if len(x) == 0 && len(y) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(x, y)
 }
@@ -1,20 +1,138 @@
 package src
 
-// func Test_Diff3(t *testing.T) {
-// 	cur, err := os.Getwd()
-// 	assert.NoError(t, err)
-// 	testDataPath := filepath.Join(cur, "testdata/diff3")
-// 	originPath := filepath.Join(testDataPath, "origin.txt")
-// 	aPath := filepath.Join(testDataPath, "a.txt")
-// 	bPath := filepath.Join(testDataPath, "b.txt")
-// 	originContent, err := ioutil.ReadFile(originPath)
-// 	assert.NoError(t, err)
-// 	aContent, err := ioutil.ReadFile(aPath)
-// 	assert.NoError(t, err)
-// 	bContent, err := ioutil.ReadFile(bPath)
-// 	assert.NoError(t, err)
-// 	originAEdits := myers.ComputeEdits(span.URIFromPath("a.txt"), string(aContent), string(originContent))
-// 	originBEdits := myers.ComputeEdits(span.URIFromPath("b.txt"), string(bContent), string(originContent))
-
-// 	fmt.Println(originAEdits, originBEdits)
-// }
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_MyersDiff(t *testing.T) {
+	edits := MyersDiff(
+		[]string{"A", "B", "C", "A", "B", "B", "A"},
+		[]string{"C", "B", "A", "B", "A", "C"},
+	)
+
+	var a, b []string
+	var str string
+	for _, e := range edits {
+		str += string(e.Type)
+		if e.ALine != nil {
+			a = append(a, e.ALine.Text)
+		}
+		if e.BLine != nil {
+			b = append(b, e.BLine.Text)
+		}
+	}
+
+	//Myersの最短編集距離は5
+	assert.Equal(t, 5, len(edits)-len(MatchedLines(edits)))
+	assert.Equal(t, []string{"A", "B", "C", "A", "B", "B", "A"}, a)
+	assert.Equal(t, []string{"C", "B", "A", "B", "A", "C"}, b)
+	assert.Equal(t, "--=+==-=+", str)
+}
+
+func MatchedLines(edits []*Edit) []*Edit {
+	var ret []*Edit
+	for _, e := range edits {
+		if e.Type == EDIT_EQL {
+			ret = append(ret, e)
+		}
+	}
+	return ret
+}
+
+func Test_Diff3(t *testing.T) {
+	for _, d := range []struct {
+		title    string
+		origin   string
+		a        string
+		b        string
+		expected string
+		clean    bool
+	}{
+		{
+			"changes in different places are merged",
+			"func a\n1\nend\n\nfunc b\n2\nend\n",
+			"func a\nleft\nend\n\nfunc b\n2\nend\n",
+			"func a\n1\nend\n\nfunc b\nright\nend\n",
+			"func a\nleft\nend\n\nfunc b\nright\nend\n",
+			true,
+		},
+		{
+			"one side only changed",
+			"a\nb\nc\n",
+			"a\nb\nc\n",
+			"a\nB\nc\n",
+			"a\nB\nc\n",
+			true,
+		},
+		{
+			"both sides changed same lines",
+			"a\nb\nc\n",
+			"a\nleft\nc\n",
+			"a\nright\nc\n",
+			"a\n<<<<<<< left\nleft\n=======\nright\n>>>>>>> right\nc\n",
+			false,
+		},
+		{
+			"both sides made same change",
+			"a\nb\nc\n",
+			"a\nB\nc\n",
+			"a\nB\nc\n",
+			"a\nB\nc\n",
+			true,
+		},
+		{
+			"add/add without base and without trailing newline",
+			"",
+			"master",
+			"test1",
+			"<<<<<<< left\nmaster\n=======\ntest1\n>>>>>>> right\n",
+			false,
+		},
+		{
+			"conflict only around overlapping region",
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			"1\nA\n3\n4\n5\n6\n7\nX\n9\n",
+			"1\n2\n3\n4\n5\n6\n7\nY\n9\n",
+			"1\nA\n3\n4\n5\n6\n7\n<<<<<<< left\nX\n=======\nY\n>>>>>>> right\n9\n",
+			false,
+		},
+	} {
+		t.Run(d.title, func(t *testing.T) {
+			result := Diff3Merge(d.origin, d.a, d.b)
+
+			if diff := cmp.Diff(d.expected, result.ToString("left", "right")); diff != "" {
+				t.Errorf("diff is %s\n", diff)
+			}
+			assert.Equal(t, d.clean, result.IsClean())
+		})
+	}
+}
+
+func Test_Diff3FromFile(t *testing.T) {
+	cur, err := os.Getwd()
+	assert.NoError(t, err)
+	testDataPath := filepath.Join(cur, "testData", "diff3")
+
+	originContent, err := ioutil.ReadFile(filepath.Join(testDataPath, "origin.txt"))
+	assert.NoError(t, err)
+	aContent, err := ioutil.ReadFile(filepath.Join(testDataPath, "a.txt"))
+	assert.NoError(t, err)
+	bContent, err := ioutil.ReadFile(filepath.Join(testDataPath, "b.txt"))
+	assert.NoError(t, err)
+
+	result := Diff3Merge(string(originContent), string(aContent), string(bContent))
+
+	//a,bどちらもsalmonの位置を変えているところだけがconflictになり、tomatoes以降はbの変更がそのまま入る
+	expected := "celery\n<<<<<<< a.txt\nsalmon\n=======\nsalmon\ngarlic\nonions\n>>>>>>> b.txt\ntomatoes\ngarlic\nonions\nwine"
+
+	assert.False(t, result.IsClean())
+	if diff := cmp.Diff(expected, result.ToString("a.txt", "b.txt")); diff != "" {
+		t.Errorf("diff is %s\n", diff)
+	}
+}
@@ -305,7 +305,7 @@ func PrepareConflictMerge(t *testing.T) string {
 	is := []string{tempPath}
 
 	var buf bytes.Buffer
-	err = StartInit(is, &buf)
+	err = StartInit(is, &InitOption{}, &buf)
 	assert.NoError(t, err)
 	ss := []string{"."}
 	err = StartAdd(tempPath, "test", "test@example.com", "test", ss)
@@ -390,14 +390,12 @@ diff --git a/hello.txt b/hello.txt
 index %s..%s 100644
 --- a/hello.txt
 +++ b/hello.txt
-@@ -1 +1,7 @@
+@@ -1 +1,5 @@
 -initial
 +<<<<<<< HEAD
 +masterChanged
-+
 +=======
 +test1Changed
-+
 +>>>>>>> test1
 `, repo.d.ShortObjId(initialObjId), repo.d.ShortObjId(curWorkSpaceObjId)),
 		},
@@ -410,13 +408,11 @@ diff --git a/hello.txt b/hello.txt
 index %s..%s 100644
 --- a/hello.txt
 +++ b/hello.txt
-@@ -1 +1,7 @@
+@@ -1 +1,5 @@
 +<<<<<<< HEAD
  masterChanged
-+
 +=======
 +test1Changed
-+
 +>>>>>>> test1
 `, repo.d.ShortObjId(masterObjId), repo.d.ShortObjId(curWorkSpaceObjId)),
 		},
@@ -429,13 +425,11 @@ diff --git a/hello.txt b/hello.txt
 index %s..%s 100644
 --- a/hello.txt
 +++ b/hello.txt
-@@ -1 +1,7 @@
+@@ -1 +1,5 @@
 +<<<<<<< HEAD
 +masterChanged
-+
 +=======
  test1Changed
-+
 +>>>>>>> test1
 `, repo.d.ShortObjId(test1ObjId), repo.d.ShortObjId(curWorkSpaceObjId)),
 		},
@@ -454,3 +448,59 @@ index %s..%s 100644
 	}
 
 }
+
+func TestDiffSymlink(t *testing.T) {
+	fn := Prepare(t)
+
+	t.Cleanup(fn)
+
+	linkPath := filepath.Join(tempPath, "link")
+	err := os.Symlink("hello.txt", linkPath)
+	assert.NoError(t, err)
+
+	err = StartAdd(tempPath, "test", "test@example.com", "test", []string{"link"})
+	assert.NoError(t, err)
+
+	//blobはlinkの先の中身ではなくlinkの先のpath
+	linkBlob, err := CreateObjIdFromContent("hello.txt")
+	assert.NoError(t, err)
+
+	buf := new(bytes.Buffer)
+	err = StartDiff(buf, tempPath, &DiffOption{Cached: true})
+	assert.NoError(t, err)
+
+	expected := fmt.Sprintf("diff --git a/link b/link\nnew file mode 120000\nindex 000000..%s\n--- a/link\n+++ b/link\n@@ -1 +1 @@\n+hello.txt\n\\ No newline at end of file\n", ShortOid(linkBlob, repo.d))
+
+	if diff := cmp.Diff(expected, buf.String()); diff != "" {
+		t.Errorf("diff is %s\n", diff)
+	}
+}
+
+func TestDiffTypeChange_Index_And_WorkSpace(t *testing.T) {
+	fn := Prepare(t)
+
+	t.Cleanup(fn)
+
+	helloPath := filepath.Join(tempPath, "hello.txt")
+	beforeBlob, err := CreateObjIdFromPath(helloPath)
+	assert.NoError(t, err)
+
+	err = os.Remove(helloPath)
+	assert.NoError(t, err)
+	err = os.Symlink("xxx/dummy.txt", helloPath)
+	assert.NoError(t, err)
+	linkBlob, err := CreateObjIdFromContent("xxx/dummy.txt")
+	assert.NoError(t, err)
+
+	buf := new(bytes.Buffer)
+	err = StartDiff(buf, tempPath, &DiffOption{})
+	assert.NoError(t, err)
+
+	//本家と同じく削除と追加に分かれる
+	expected := fmt.Sprintf("diff --git a/hello.txt b/hello.txt\ndeleted file mode 100644\nindex %s..000000\n--- a/hello.txt\n+++ b/hello.txt\n@@ -1 +1 @@\n-test\n", ShortOid(beforeBlob, repo.d)) +
+		fmt.Sprintf("diff --git a/hello.txt b/hello.txt\nnew file mode 120000\nindex 000000..%s\n--- a/hello.txt\n+++ b/hello.txt\n@@ -1 +1 @@\n+xxx/dummy.txt\n\\ No newline at end of file\n", ShortOid(linkBlob, repo.d))
+
+	if diff := cmp.Diff(expected, buf.String()); diff != "" {
+		t.Errorf("diff is %s\n", diff)
+	}
+}
@@ -0,0 +1,97 @@
+package src
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+var DEFAULT_EDITOR = "vi"
+
+var ErrorEmptyCommitMessage = errors.New("Aborting commit due to empty commit message.")
+
+//本家と同じくGIT_EDITOR,core.editor,VISUAL,EDITORの順に見る
+func CommitEditor(repo *Repository) string {
+	if editor := os.Getenv("GIT_EDITOR"); editor != "" {
+		return editor
+	}
+
+	if cs, err := repo.Config(); err == nil {
+		if editor := cs.CoreEditor(); editor != "" {
+			return editor
+		}
+	}
+
+	for _, key := range []string{"VISUAL", "EDITOR"} {
+		if editor := os.Getenv(key); editor != "" {
+			return editor
+		}
+	}
+
+	return DEFAULT_EDITOR
+}
+
+//todoの編集はGIT_SEQUENCE_EDITOR,sequence.editorを優先する
+func SequenceEditor(repo *Repository) string {
+	if editor := os.Getenv("GIT_SEQUENCE_EDITOR"); editor != "" {
+		return editor
+	}
+
+	if cs, err := repo.Config(); err == nil {
+		if editor, ok := cs.Get("sequence", "", "editor"); ok && editor != "" {
+			return editor
+		}
+	}
+
+	return CommitEditor(repo)
+}
+
+//editorには"code --wait"のように引数がつくこともあるのでshell経由で起動する
+func LaunchEditor(editor, path string) error {
+	cmd := exec.Command("sh", "-c", editor+` "$@"`, editor, path)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	return cmd.Run()
+}
+
+//messageをファイルに書いてeditorで編集させ、#で始まる行を除いて返す
+//本家のstripspaceと同じく続く空行は一つにまとめる、残ったものが空ならerror
+func EditMessage(path, message string, repo *Repository) (string, error) {
+	err := ioutil.WriteFile(path, []byte(message), 0644)
+	if err != nil {
+		return "", err
+	}
+
+	err = LaunchEditor(CommitEditor(repo), path)
+	if err != nil {
+		return "", err
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	var lines []string
+	for _, line := range strings.Split(string(content), "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimRight(line, " \t")
+		if line == "" && len(lines) > 0 && lines[len(lines)-1] == "" {
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	edited := strings.TrimSpace(strings.Join(lines, "\n"))
+	if edited == "" {
+		return "", ErrorEmptyCommitMessage
+	}
+
+	return edited, nil
+}
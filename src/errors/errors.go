@@ -147,6 +147,75 @@ func (s *SequenceAbortError) GetContent() string {
 	return s.Message
 }
 
+type IgnoredPathOnAddError struct {
+	Message string
+}
+
+func (i *IgnoredPathOnAddError) UserCause() string {
+	return i.Message
+}
+
+func (i *IgnoredPathOnAddError) Error() string {
+	return "IgnoredPathOnAddError"
+}
+
+func (i *IgnoredPathOnAddError) GetContent() string {
+	return i.Message
+}
+
+//sparse-checkoutの外にあってaddやrmできないpath
+type SparsePathError struct {
+	Message string
+}
+
+func (s *SparsePathError) UserCause() string {
+	return s.Message
+}
+
+func (s *SparsePathError) Error() string {
+	return "SparsePathError"
+}
+
+func (s *SparsePathError) GetContent() string {
+	return s.Message
+}
+
+//todoの何行目が不正かを示す
+type InvalidToDoLineError struct {
+	Line    int
+	Content string
+	Reason  string
+}
+
+func (i *InvalidToDoLineError) UserCause() string {
+	return i.GetContent()
+}
+
+func (i *InvalidToDoLineError) Error() string {
+	return "InvalidToDoLineError"
+}
+
+func (i *InvalidToDoLineError) GetContent() string {
+	return fmt.Sprintf("error: invalid line %d: %s\nerror: %s\n", i.Line, i.Content, i.Reason)
+}
+
+//rebase -iのeditやexecの失敗で途中で止まった時
+type SequenceStoppedError struct {
+	Message string
+}
+
+func (s *SequenceStoppedError) UserCause() string {
+	return s.Message
+}
+
+func (s *SequenceStoppedError) Error() string {
+	return "SequenceStoppedError"
+}
+
+func (s *SequenceStoppedError) GetContent() string {
+	return s.Message
+}
+
 type InternalError interface {
 	Cause() string
 }
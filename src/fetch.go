@@ -0,0 +1,183 @@
+package src
+
+import (
+	"fmt"
+	"io"
+	data "mygit/src/database"
+	"path/filepath"
+	"strings"
+)
+
+//remoteのrefをrefspecでremote-tracking branchに写し、必要なobjectを持ってくる
+//tagはrefs/tags/*をそのまま持ってくるが、本家と同じくすでにあるtagは上書きしない
+
+var TAG_REFSPEC = &Refspec{
+	Src: "refs/tags/*",
+	Dst: "refs/tags/*",
+}
+
+func StartFetch(rootPath string, args []string, w io.Writer) error {
+	repo, err := DiscoverRepository(rootPath)
+	if err != nil {
+		return err
+	}
+
+	name := DEFAULT_REMOTE
+	if len(args) > 0 {
+		name = args[0]
+	}
+
+	remote, err := LoadRemote(name, repo)
+	if err != nil {
+		return err
+	}
+
+	_, err = RunFetch(remote, repo, w)
+	return err
+}
+
+//取ってきたremoteのrefの一覧を返す、cloneでHEADを決めるのに使う
+func RunFetch(remote *Remote, repo *Repository, w io.Writer) ([]*RemoteRef, error) {
+	t, err := OpenTransport(remote.URL, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	refs, err := t.ListRefs()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkObjectFormat(t, repo); err != nil {
+		return nil, err
+	}
+
+	updates, wants, err := planFetch(remote, refs, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	err = t.Fetch(wants, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	printed := false
+	for _, u := range updates {
+		line, err := applyFetchUpdate(u, repo)
+		if err != nil {
+			return nil, err
+		}
+		if line == "" {
+			continue
+		}
+
+		if !printed {
+			w.Write([]byte(fmt.Sprintf("From %s\n", remote.URL)))
+			printed = true
+		}
+		w.Write([]byte(line))
+	}
+
+	return refs, nil
+}
+
+type fetchUpdate struct {
+	src      string
+	dst      string
+	oldObjId string
+	newObjId string
+	force    bool
+	isTag    bool
+}
+
+func planFetch(remote *Remote, refs []*RemoteRef, repo *Repository) ([]*fetchUpdate, []string, error) {
+	var updates []*fetchUpdate
+	var wants []string
+
+	for _, ref := range refs {
+		specs := remote.Fetch
+		isTag := strings.HasPrefix(ref.Name, "refs/tags/")
+		if isTag {
+			specs = []*Refspec{TAG_REFSPEC}
+		}
+
+		for _, spec := range specs {
+			dst, ok := spec.Match(ref.Name)
+			if !ok {
+				continue
+			}
+
+			oldObjId, _ := data.ReadRefFile(filepath.Join(repo.r.Path, dst))
+			if oldObjId == ref.ObjId {
+				break
+			}
+
+			updates = append(updates, &fetchUpdate{
+				src:      ref.Name,
+				dst:      dst,
+				oldObjId: oldObjId,
+				newObjId: ref.ObjId,
+				force:    spec.Force,
+				isTag:    isTag,
+			})
+			wants = append(wants, ref.ObjId)
+			break
+		}
+	}
+
+	return updates, wants, nil
+}
+
+//本家のfetchと同じ形式の1行を返す、何もしなければ空
+func applyFetchUpdate(u *fetchUpdate, repo *Repository) (string, error) {
+	src := ShortRefName(u.src)
+	dst := ShortRefName(u.dst)
+
+	if u.oldObjId == "" {
+		kind := "[new branch]"
+		reason := "storing head"
+		if u.isTag {
+			kind = "[new tag]"
+			reason = "storing tag"
+		}
+
+		err := repo.r.WithReason(fmt.Sprintf("fetch: %s", reason)).UpdateRef(u.dst, u.newObjId)
+		if err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf(" * %-17s %-10s -> %s\n", kind, src, dst), nil
+	}
+
+	//tagは動かさない
+	if u.isTag {
+		return fmt.Sprintf(" ! %-17s %-10s -> %s  (would clobber existing tag)\n", "[rejected]", src, dst), nil
+	}
+
+	ff, err := IsFastForward(u.oldObjId, u.newObjId, repo.d)
+	if err != nil {
+		return "", err
+	}
+
+	if ff {
+		err := repo.r.WithReason("fetch: fast-forward").UpdateRef(u.dst, u.newObjId)
+		if err != nil {
+			return "", err
+		}
+
+		rangeStr := fmt.Sprintf("%s..%s", ShortOid(u.oldObjId, repo.d), ShortOid(u.newObjId, repo.d))
+		return fmt.Sprintf("   %-17s %-10s -> %s\n", rangeStr, src, dst), nil
+	}
+
+	if !u.force {
+		return fmt.Sprintf(" ! %-17s %-10s -> %s  (non-fast-forward)\n", "[rejected]", src, dst), nil
+	}
+
+	err = repo.r.WithReason("fetch: forced-update").UpdateRef(u.dst, u.newObjId)
+	if err != nil {
+		return "", err
+	}
+
+	rangeStr := fmt.Sprintf("%s...%s", ShortOid(u.oldObjId, repo.d), ShortOid(u.newObjId, repo.d))
+	return fmt.Sprintf(" + %-17s %-10s -> %s  (forced update)\n", rangeStr, src, dst), nil
+}
@@ -0,0 +1,181 @@
+package src
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	data "mygit/src/database"
+	con "mygit/src/database/content"
+	"mygit/src/fsmonitor"
+	"os"
+	"path/filepath"
+)
+
+var ErrorFsmonitorUsage = errors.New("usage: mygit fsmonitor (run|stop|status)")
+
+//runは止められるまで作業ディレクトリを見続ける
+func StartFsmonitor(rootPath string, args []string, w io.Writer) error {
+	repo, err := DiscoverWorkTree(rootPath)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return ErrorFsmonitorUsage
+	}
+
+	switch args[0] {
+	case "run":
+		fmt.Fprintf(w, "fsmonitor-daemon is watching '%s'\n", repo.w.Path)
+		return fsmonitor.Run(repo.w.Path, repo.r.Path)
+	case "stop":
+		return fsmonitor.Stop(repo.r.Path)
+	case "status":
+		if fsmonitor.IsRunning(repo.r.Path) {
+			fmt.Fprintf(w, "fsmonitor-daemon is watching '%s'\n", repo.w.Path)
+		} else {
+			fmt.Fprintf(w, "fsmonitor-daemon is not watching '%s'\n", repo.w.Path)
+		}
+		return nil
+	default:
+		return ErrorFsmonitorUsage
+	}
+}
+
+//core.fsmonitorがtrueでdaemonが動いていれば、indexのtokenより後の変更を聞く
+//使えないときはnilで、statusは今まで通り全体を調べる
+func (repo *Repository) queryFsmonitor() *fsmonitor.Response {
+	cs, err := repo.Config()
+	if err != nil {
+		return nil
+	}
+	enabled, err := cs.CoreFsmonitor()
+	if err != nil || !enabled {
+		return nil
+	}
+
+	res, err := fsmonitor.Query(repo.r.Path, repo.i.FsmonitorToken)
+	if err != nil {
+		return nil
+	}
+	return res
+}
+
+//前回一致していて、そのあとfsmonitorから変更を知らされていないentryはstatしなくていい
+//変わったpathがdirectoryの時はその中すべてを調べ直す
+func fsmonitorValidPaths(i *data.Index, changed []string) map[string]struct{} {
+	changedSet := make(map[string]struct{})
+	for _, p := range changed {
+		changedSet[filepath.FromSlash(p)] = struct{}{}
+	}
+
+	valid := make(map[string]struct{})
+	for k, v := range i.Entries {
+		if k.Stage != 0 || !i.IsFsmonitorValid(k.Path) {
+			continue
+		}
+		e, _ := v.(*con.Entry)
+		//submoduleのHEADや中の変更はfsmonitorではわからない
+		if e == nil || e.IsIntentToAdd() || e.IsGitlink() {
+			continue
+		}
+		if _, ok := changedSet[k.Path]; ok {
+			continue
+		}
+		if anyParentIn(e, changedSet) {
+			continue
+		}
+		valid[k.Path] = struct{}{}
+	}
+
+	return valid
+}
+
+func anyParentIn(e *con.Entry, set map[string]struct{}) bool {
+	for _, dir := range e.ParentDirs(e.Path) {
+		if _, ok := set[dir]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+//statしなかったentryは変わっていないものとして、indexにstatを合わせられなかったものだけを次回も調べる
+func (s *Status) fsmonitorDirty(i *data.Index) []string {
+	var dirty []string
+	for k, v := range i.Entries {
+		e, _ := v.(*con.Entry)
+		if _, changed := s.WorkSpaceChanges[k.Path]; changed || k.Stage != 0 || (e != nil && e.IsIntentToAdd()) {
+			dirty = append(dirty, k.Path)
+		}
+	}
+	return dirty
+}
+
+//fsmonitorで変わっていないとわかるentryはstatしない、untrackedの候補は今まで通り調べる
+func ScanWorkSpaceWithFsmonitor(w *WorkSpace, dir string, i *data.Index, s *Status) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	ig := w.ignoreFor(dir)
+	for _, d := range entries {
+		abs := filepath.Join(dir, d.Name())
+		k, err := filepath.Rel(w.Path, abs)
+		if err != nil {
+			return err
+		}
+
+		//ScanWorkSpaceと同じくsymlinkはlinkの先がdirectoryでもファイルとして扱う
+		isDir := d.IsDir()
+		if ig != nil && w.isExcluded(ig, k, isDir) {
+			continue
+		}
+
+		if isDir {
+			stat, err := os.Lstat(abs)
+			if err != nil {
+				return err
+			}
+			if isSubmoduleDir(w, i, k, stat) {
+				if i.IsIndexed(k) {
+					s.Stats[k] = stat
+				} else {
+					s.Untracked = append(s.Untracked, k+"/")
+				}
+				continue
+			}
+		}
+
+		if i.IsIndexed(k) {
+			if isDir {
+				if err := ScanWorkSpaceWithFsmonitor(w, abs, i, s); err != nil {
+					return err
+				}
+				continue
+			}
+			if _, ok := s.FsmonitorValid[k]; ok {
+				continue
+			}
+			stat, err := os.Lstat(abs)
+			if err != nil {
+				return err
+			}
+			s.Stats[k] = stat
+			continue
+		}
+
+		trackable, err := IsTrackableFile(i, k, isDir, w)
+		if err != nil {
+			return err
+		}
+		if trackable {
+			if isDir {
+				k += "/"
+			}
+			s.Untracked = append(s.Untracked, k)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,232 @@
+package fsmonitor
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrorUnsupported    = errors.New("fsmonitor is not supported on this platform")
+	ErrorNotRunning     = errors.New("fsmonitor daemon is not running")
+	ErrorAlreadyRunning = errors.New("fsmonitor daemon is already running")
+	ErrorInvalidRequest = errors.New("invalid fsmonitor request")
+)
+
+//.gitの中に置くunix socket、本家のdaemonと同じ名前
+var SOCKET_NAME = "fsmonitor--daemon.ipc"
+
+//tokenが古くて何が変わったかわからないときは、本家と同じく"/"だけを返して全体を調べさせる
+var TRIVIAL_PATH = "/"
+
+var DIAL_TIMEOUT = 1 * time.Second
+
+//1つの接続でrequestを読んで返事を書き終えるまでの時間、止まったclientを切る
+var REQUEST_TIMEOUT = 5 * time.Second
+
+//queryの前に起きた変更を確実に読み終えるために.gitに作るファイル
+var COOKIE_PREFIX = "fsmonitor--cookie-"
+
+type Response struct {
+	Token string
+	//tokenより後に変わった作業ディレクトリからの相対path、directoryならその中すべて
+	Paths []string
+	//trueならPathsは使えず、作業ディレクトリ全体を調べ直す
+	Trivial bool
+}
+
+type Monitor interface {
+	Query(token string) *Response
+	Close() error
+}
+
+func SocketPath(gitPath string) string {
+	return filepath.Join(gitPath, SOCKET_NAME)
+}
+
+//daemonを起動してstopされるまで待つ
+func Run(worktree, gitPath string) error {
+	socket := SocketPath(gitPath)
+	if IsRunning(gitPath) {
+		return ErrorAlreadyRunning
+	}
+	//前のdaemonが落ちて残ったsocketは消してよい
+	os.Remove(socket)
+
+	m, err := StartWatcher(worktree, gitPath)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(socket)
+
+	return Serve(l, m)
+}
+
+//1接続で1つのrequestを受ける、"query <token>"か"stop"
+//接続ごとにgoroutineで受けるので、止まったclientがいても他のqueryは待たない
+func Serve(l net.Listener, m Monitor) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	var stopOnce sync.Once
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer conn.Close()
+
+			conn.SetDeadline(time.Now().Add(REQUEST_TIMEOUT))
+			stop, err := handle(conn, m)
+			if err == nil && stop {
+				stopOnce.Do(func() {
+					l.Close()
+				})
+			}
+		}()
+	}
+}
+
+func handle(conn net.Conn, m Monitor) (bool, error) {
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return false, err
+	}
+	line = strings.TrimSuffix(line, "\n")
+
+	switch {
+	case line == "stop":
+		_, err := io.WriteString(conn, "ok\n")
+		return true, err
+	case strings.HasPrefix(line, "query "):
+		return false, writeResponse(conn, m.Query(strings.TrimPrefix(line, "query ")))
+	default:
+		return false, ErrorInvalidRequest
+	}
+}
+
+//token NUL path NUL path NUL ...
+func writeResponse(w io.Writer, res *Response) error {
+	var b strings.Builder
+	b.WriteString(res.Token)
+	b.WriteByte(0)
+	if res.Trivial {
+		b.WriteString(TRIVIAL_PATH)
+		b.WriteByte(0)
+	} else {
+		for _, p := range res.Paths {
+			b.WriteString(p)
+			b.WriteByte(0)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func readResponse(r io.Reader) (*Response, error) {
+	bs, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := strings.Split(string(bs), "\x00")
+	if len(fields) < 2 || fields[len(fields)-1] != "" {
+		return nil, ErrorInvalidRequest
+	}
+	fields = fields[:len(fields)-1]
+
+	res := &Response{Token: fields[0]}
+	for _, p := range fields[1:] {
+		if p == TRIVIAL_PATH {
+			res.Trivial = true
+			res.Paths = nil
+			break
+		}
+		res.Paths = append(res.Paths, p)
+	}
+
+	return res, nil
+}
+
+func request(gitPath, line string) (net.Conn, error) {
+	conn, err := net.DialTimeout("unix", SocketPath(gitPath), DIAL_TIMEOUT)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err, ErrorNotRunning)
+	}
+	if _, err := io.WriteString(conn, line+"\n"); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+//tokenより後の変更を聞く、tokenが""なら今のtokenだけを受け取る(Trivial)
+func Query(gitPath, token string) (*Response, error) {
+	conn, err := request(gitPath, "query "+token)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return readResponse(conn)
+}
+
+func Stop(gitPath string) error {
+	conn, err := request(gitPath, "stop")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = io.ReadAll(conn)
+	return err
+}
+
+func IsRunning(gitPath string) bool {
+	conn, err := net.DialTimeout("unix", SocketPath(gitPath), DIAL_TIMEOUT)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+//token比較で使う、prefix:世代:通し番号
+var TOKEN_PREFIX = "mgit"
+
+func formatToken(generation string, seq uint64) string {
+	return fmt.Sprintf("%s:%s:%d", TOKEN_PREFIX, generation, seq)
+}
+
+func parseToken(token string) (string, uint64, bool) {
+	parts := strings.Split(token, ":")
+	if len(parts) != 3 || parts[0] != TOKEN_PREFIX {
+		return "", 0, false
+	}
+	var seq uint64
+	if _, err := fmt.Sscanf(parts[2], "%d", &seq); err != nil {
+		return "", 0, false
+	}
+	return parts[1], seq, true
+}
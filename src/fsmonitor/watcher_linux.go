@@ -0,0 +1,272 @@
+// +build linux
+
+package fsmonitor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+var ErrorCookieTimeout = errors.New("fsmonitor cookie was not observed")
+
+var COOKIE_TIMEOUT = 2 * time.Second
+
+//changedに覚えておくpathの数、超えたらtokenを新しくして忘れる
+//古いtokenで聞かれても作業ディレクトリ全体を調べさせればよい
+var MAX_CHANGED_PATHS = 100000
+
+var WATCH_MASK uint32 = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MODIFY | syscall.IN_ATTRIB |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_CLOSE_WRITE |
+	syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF | syscall.IN_ONLYDIR | syscall.IN_DONT_FOLLOW
+
+//inotifyは再帰的に見てくれないので、作業ディレクトリのdirectoryごとにwatchを置く
+//.gitの中の変更は見ないが、cookieのために.gitのdirectoryだけは見る
+type Watcher struct {
+	worktree string
+	gitPath  string
+	file     *os.File
+	done     chan struct{}
+
+	mu sync.Mutex
+	//watch descriptor -> 作業ディレクトリからの相対path、rootは""
+	dirs  map[int32]string
+	gitWd int32
+	//overflowなどで変更を取りこぼしたら変わり、それより前のtokenは使えなくなる
+	generation string
+	seq        uint64
+	//path -> 最後に変わったときのseq
+	changed   map[string]uint64
+	cookies   map[string]chan struct{}
+	cookieSeq int
+	err       error
+}
+
+func StartWatcher(worktree, gitPath string) (Monitor, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Watcher{
+		worktree:   worktree,
+		gitPath:    gitPath,
+		file:       os.NewFile(uintptr(fd), "inotify"),
+		done:       make(chan struct{}),
+		dirs:       make(map[int32]string),
+		generation: newGeneration(),
+		changed:    make(map[string]uint64),
+		cookies:    make(map[string]chan struct{}),
+	}
+
+	if err := w.addTree("", false); err != nil {
+		w.file.Close()
+		return nil, err
+	}
+	gitWd, err := syscall.InotifyAddWatch(fd, gitPath, syscall.IN_CREATE|syscall.IN_MOVED_TO)
+	if err != nil {
+		w.file.Close()
+		return nil, err
+	}
+	w.gitWd = int32(gitWd)
+
+	go w.loop()
+
+	return w, nil
+}
+
+func newGeneration() string {
+	return fmt.Sprintf("%d-%d", os.Getpid(), time.Now().UnixNano())
+}
+
+//watchを置く前にできたものは取りこぼすので、新しくできたdirectoryは中身もすべて変更として記録する
+func (w *Watcher) addTree(rel string, record bool) error {
+	abs := filepath.Join(w.worktree, filepath.FromSlash(rel))
+	wd, err := syscall.InotifyAddWatch(int(w.file.Fd()), abs, WATCH_MASK)
+	if err != nil {
+		//watchする前に消えたものや読めないdirectoryは飛ばす
+		if errors.Is(err, syscall.ENOENT) || errors.Is(err, syscall.ENOTDIR) || errors.Is(err, syscall.EACCES) {
+			return nil
+		}
+		return err
+	}
+	w.dirs[int32(wd)] = rel
+
+	entries, err := os.ReadDir(abs)
+	if err != nil {
+		return nil
+	}
+	for _, e := range entries {
+		child := path.Join(rel, e.Name())
+		if child == ".git" {
+			continue
+		}
+		if record {
+			w.record(child)
+		}
+		if e.IsDir() {
+			if err := w.addTree(child, record); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (w *Watcher) record(rel string) {
+	if _, ok := w.changed[rel]; !ok && len(w.changed) >= MAX_CHANGED_PATHS {
+		w.reset()
+	}
+	w.seq++
+	w.changed[rel] = w.seq
+}
+
+//変更を取りこぼしたので、今までのtokenをすべて古いものにする
+func (w *Watcher) reset() {
+	w.generation = newGeneration()
+	w.changed = make(map[string]uint64)
+}
+
+func (w *Watcher) loop() {
+	defer close(w.done)
+
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			w.mu.Lock()
+			w.err = err
+			w.mu.Unlock()
+			return
+		}
+
+		w.mu.Lock()
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			start := offset + syscall.SizeofInotifyEvent
+			end := start + int(ev.Len)
+			if n < end {
+				break
+			}
+			name := strings.TrimRight(string(buf[start:end]), "\x00")
+			w.handle(ev.Wd, ev.Mask, name)
+			offset = end
+		}
+		w.mu.Unlock()
+	}
+}
+
+func (w *Watcher) handle(wd int32, mask uint32, name string) {
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		w.reset()
+		return
+	}
+
+	if wd == w.gitWd {
+		if ch, ok := w.cookies[name]; ok {
+			close(ch)
+			delete(w.cookies, name)
+		}
+		return
+	}
+
+	dir, ok := w.dirs[wd]
+	if !ok {
+		return
+	}
+	if mask&syscall.IN_IGNORED != 0 {
+		delete(w.dirs, wd)
+		return
+	}
+
+	rel := path.Join(dir, name)
+	if rel == "." {
+		//作業ディレクトリそのものが消えたり移動した
+		w.reset()
+		return
+	}
+	if rel == ".git" || strings.HasPrefix(rel, ".git/") {
+		return
+	}
+
+	w.record(rel)
+	if mask&syscall.IN_ISDIR != 0 && mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+		if err := w.addTree(rel, true); err != nil {
+			//watchの上限などで見られないところができた
+			w.reset()
+		}
+	}
+}
+
+//.gitにcookieを作り、そのeventが届くまで待つ
+//inotifyのeventは順番に届くので、それより前の変更はすべて読み終えている
+func (w *Watcher) sync() error {
+	w.mu.Lock()
+	if w.err != nil {
+		w.mu.Unlock()
+		return w.err
+	}
+	w.cookieSeq++
+	name := fmt.Sprintf("%s%d-%d", COOKIE_PREFIX, os.Getpid(), w.cookieSeq)
+	ch := make(chan struct{})
+	w.cookies[name] = ch
+	w.mu.Unlock()
+
+	cookie := filepath.Join(w.gitPath, name)
+	f, err := os.Create(cookie)
+	if err != nil {
+		return err
+	}
+	f.Close()
+	defer os.Remove(cookie)
+
+	select {
+	case <-ch:
+		return nil
+	case <-w.done:
+		return w.err
+	case <-time.After(COOKIE_TIMEOUT):
+		w.mu.Lock()
+		delete(w.cookies, name)
+		w.mu.Unlock()
+		return ErrorCookieTimeout
+	}
+}
+
+func (w *Watcher) Query(token string) *Response {
+	err := w.sync()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	current := formatToken(w.generation, w.seq)
+	generation, seq, ok := parseToken(token)
+	if err != nil || !ok || generation != w.generation || w.seq < seq {
+		return &Response{Token: current, Trivial: true}
+	}
+
+	paths := []string{}
+	for p, s := range w.changed {
+		if seq < s {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+
+	return &Response{Token: current, Paths: paths}
+}
+
+func (w *Watcher) Close() error {
+	err := w.file.Close()
+	<-w.done
+	return err
+}
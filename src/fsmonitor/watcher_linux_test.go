@@ -0,0 +1,164 @@
+// +build linux
+
+package fsmonitor
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func prepareWorkTree(t *testing.T) (string, string) {
+	cur, err := os.Getwd()
+	assert.NoError(t, err)
+	worktree, err := os.MkdirTemp(cur, "")
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(worktree)
+	})
+
+	gitPath := filepath.Join(worktree, ".git")
+	err = os.MkdirAll(filepath.Join(worktree, "dir"), os.ModePerm)
+	assert.NoError(t, err)
+	err = os.MkdirAll(gitPath, os.ModePerm)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(worktree, "dir", "a.txt"), []byte("a\n"), os.ModePerm)
+	assert.NoError(t, err)
+
+	return worktree, gitPath
+}
+
+func TestWatcherQuery(t *testing.T) {
+	worktree, gitPath := prepareWorkTree(t)
+
+	m, err := StartWatcher(worktree, gitPath)
+	assert.NoError(t, err)
+	defer m.Close()
+
+	//最初はtokenがないので全体を調べさせる
+	res := m.Query("")
+	assert.True(t, res.Trivial)
+	token := res.Token
+
+	res = m.Query(token)
+	assert.False(t, res.Trivial)
+	assert.Equal(t, []string{}, res.Paths)
+	assert.Equal(t, token, res.Token)
+
+	//書き込み、.gitの中は見ない
+	err = os.WriteFile(filepath.Join(worktree, "dir", "a.txt"), []byte("changed\n"), os.ModePerm)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(gitPath, "index"), []byte("index\n"), os.ModePerm)
+	assert.NoError(t, err)
+	res = m.Query(token)
+	assert.Equal(t, []string{"dir/a.txt"}, res.Paths)
+	token = res.Token
+
+	//新しいdirectoryの中もwatchされる
+	err = os.MkdirAll(filepath.Join(worktree, "new", "deep"), os.ModePerm)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(worktree, "new", "deep", "b.txt"), []byte("b\n"), os.ModePerm)
+	assert.NoError(t, err)
+	res = m.Query(token)
+	assert.Contains(t, res.Paths, "new")
+	assert.Contains(t, res.Paths, "new/deep/b.txt")
+	token = res.Token
+
+	err = os.WriteFile(filepath.Join(worktree, "new", "deep", "b.txt"), []byte("again\n"), os.ModePerm)
+	assert.NoError(t, err)
+	err = os.RemoveAll(filepath.Join(worktree, "dir"))
+	assert.NoError(t, err)
+	res = m.Query(token)
+	assert.Contains(t, res.Paths, "new/deep/b.txt")
+	assert.Contains(t, res.Paths, "dir")
+	assert.NotContains(t, res.Paths, "new")
+
+	//別のwatcherが出したtokenは使えない
+	res = m.Query("mgit:other:1")
+	assert.True(t, res.Trivial)
+	res = m.Query("something")
+	assert.True(t, res.Trivial)
+}
+
+//覚えるpathが多すぎたら忘れて、前のtokenには全体を調べさせる
+func TestWatcherTrimChanged(t *testing.T) {
+	worktree, gitPath := prepareWorkTree(t)
+
+	max := MAX_CHANGED_PATHS
+	MAX_CHANGED_PATHS = 2
+	t.Cleanup(func() {
+		MAX_CHANGED_PATHS = max
+	})
+
+	m, err := StartWatcher(worktree, gitPath)
+	assert.NoError(t, err)
+	defer m.Close()
+
+	token := m.Query("").Token
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		err := os.WriteFile(filepath.Join(worktree, name), []byte(name), os.ModePerm)
+		assert.NoError(t, err)
+	}
+
+	res := m.Query(token)
+	assert.True(t, res.Trivial)
+	assert.NotEqual(t, token, res.Token)
+
+	w := m.(*Watcher)
+	w.mu.Lock()
+	assert.LessOrEqual(t, len(w.changed), MAX_CHANGED_PATHS)
+	w.mu.Unlock()
+
+	//新しいtokenからは続けて使える
+	token = res.Token
+	err = os.WriteFile(filepath.Join(worktree, "a.txt"), []byte("again"), os.ModePerm)
+	assert.NoError(t, err)
+	res = m.Query(token)
+	assert.False(t, res.Trivial)
+	assert.Equal(t, []string{"a.txt"}, res.Paths)
+}
+
+func TestDaemon(t *testing.T) {
+	worktree, gitPath := prepareWorkTree(t)
+
+	_, err := Query(gitPath, "")
+	assert.ErrorIs(t, err, ErrorNotRunning)
+
+	done := make(chan error)
+	go func() {
+		done <- Run(worktree, gitPath)
+	}()
+	for n := 0; n < 100 && !IsRunning(gitPath); n++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.True(t, IsRunning(gitPath))
+	assert.ErrorIs(t, Run(worktree, gitPath), ErrorAlreadyRunning)
+
+	//何も送らないclientがいても他のqueryは返る
+	stalled, err := net.Dial("unix", SocketPath(gitPath))
+	assert.NoError(t, err)
+
+	res, err := Query(gitPath, "")
+	assert.NoError(t, err)
+	assert.True(t, res.Trivial)
+
+	err = os.WriteFile(filepath.Join(worktree, "c.txt"), []byte("c\n"), os.ModePerm)
+	assert.NoError(t, err)
+	res, err = Query(gitPath, res.Token)
+	assert.NoError(t, err)
+	assert.False(t, res.Trivial)
+	assert.Equal(t, []string{"c.txt"}, res.Paths)
+
+	//stopは受けている接続が終わるのを待つ
+	stalled.Close()
+	err = Stop(gitPath)
+	assert.NoError(t, err)
+	assert.NoError(t, <-done)
+	assert.False(t, IsRunning(gitPath))
+	_, err = os.Stat(SocketPath(gitPath))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,8 @@
+// +build !linux
+
+package fsmonitor
+
+//inotifyがないのでdaemonは起動できず、statusはいつも全体を調べる
+func StartWatcher(worktree, gitPath string) (Monitor, error) {
+	return nil, ErrorUnsupported
+}
@@ -0,0 +1,115 @@
+// +build linux
+
+package src
+
+import (
+	"bytes"
+	"mygit/src/fsmonitor"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func StartFsmonitorForTest(t *testing.T, tempPath string, repo *Repository) {
+	var buf bytes.Buffer
+	done := make(chan error)
+	go func() {
+		done <- StartFsmonitor(tempPath, []string{"run"}, &buf)
+	}()
+	for n := 0; n < 100 && !fsmonitor.IsRunning(repo.r.Path); n++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.True(t, fsmonitor.IsRunning(repo.r.Path))
+
+	t.Cleanup(func() {
+		if fsmonitor.IsRunning(repo.r.Path) {
+			fsmonitor.Stop(repo.r.Path)
+			<-done
+		}
+	})
+}
+
+func TestStatusWithFsmonitor(t *testing.T) {
+	SetConfigHomeForTest(t)
+	tempPath, repo := PrepareRebaseRepo(t)
+	var buf bytes.Buffer
+
+	err := os.MkdirAll(filepath.Join(tempPath, "dir"), os.ModePerm)
+	assert.NoError(t, err)
+	CreateFiles(t, filepath.Join(tempPath, "dir"), "a.txt", "a\n")
+	CreateFiles(t, filepath.Join(tempPath, "dir"), "b.txt", "b\n")
+	CreateFiles(t, tempPath, "hello.txt", "hello\n")
+	err = StartAdd(tempPath, "test", "test@example.com", "", []string{"."})
+	assert.NoError(t, err)
+	err = StartCommit(tempPath, "test", "test@example.com", "first", &buf)
+	assert.NoError(t, err)
+	err = StartConfig(tempPath, []string{"core.fsmonitor", "true"}, &ConfigOption{}, &buf)
+	assert.NoError(t, err)
+
+	status := func() string {
+		var out bytes.Buffer
+		err := StartStatus(&out, tempPath, false)
+		assert.NoError(t, err)
+		return out.String()
+	}
+	load := func() {
+		repo.i = repo.i.Clear()
+		err := repo.i.Load()
+		assert.NoError(t, err)
+	}
+
+	//daemonが動いていなければ今まで通り全体を調べる
+	assert.Equal(t, "", status())
+	load()
+	assert.Equal(t, "", repo.i.FsmonitorToken)
+
+	//最初は全体を調べてtokenを残す
+	StartFsmonitorForTest(t, tempPath, repo)
+	assert.Equal(t, "", status())
+	load()
+	assert.NotEqual(t, "", repo.i.FsmonitorToken)
+	assert.Equal(t, 0, len(repo.i.FsmonitorDirty))
+
+	//知らされた変更とuntrackedの候補だけstatする
+	CreateFiles(t, filepath.Join(tempPath, "dir"), "a.txt", "changed\n")
+	CreateFiles(t, tempPath, "new.txt", "new\n")
+	s := GenerateStatus()
+	err = s.IntitializeStatus(repo)
+	assert.NoError(t, err)
+	assert.Contains(t, s.FsmonitorValid, "hello.txt")
+	assert.Contains(t, s.FsmonitorValid, "dir/b.txt")
+	assert.NotContains(t, s.FsmonitorValid, "dir/a.txt")
+	_, statted := s.Stats["hello.txt"]
+	assert.False(t, statted)
+
+	assert.Equal(t, " M dir/a.txt\n?? new.txt\n", status())
+	//作業ディレクトリと違うままのものは変更がなくても次も調べる
+	assert.Equal(t, " M dir/a.txt\n?? new.txt\n", status())
+	load()
+	assert.Equal(t, []string{"dir/a.txt"}, repo.i.FsmonitorDirtyPaths())
+
+	err = os.Remove(filepath.Join(tempPath, "dir", "b.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, " M dir/a.txt\n D dir/b.txt\n?? new.txt\n", status())
+
+	//addで入れ替えたentryはadd中のstatusで調べ直して一致したので次はstatしない
+	err = StartAdd(tempPath, "test", "test@example.com", "", []string{"dir/a.txt", "new.txt"})
+	assert.NoError(t, err)
+	load()
+	assert.Equal(t, 0, len(repo.i.FsmonitorDirty))
+	assert.Equal(t, "A  new.txt\nM  dir/a.txt\nD  dir/b.txt\n", status())
+
+	//止めた後は全体を調べる
+	err = StartFsmonitor(tempPath, []string{"stop"}, &buf)
+	assert.NoError(t, err)
+	CreateFiles(t, tempPath, "hello.txt", "changed\n")
+	assert.Equal(t, "A  new.txt\nM  dir/a.txt\nD  dir/b.txt\n M hello.txt\n", status())
+
+	buf.Reset()
+	err = StartFsmonitor(tempPath, []string{"status"}, &buf)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "is not watching")
+}
@@ -0,0 +1,460 @@
+package src
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	data "mygit/src/database"
+	con "mygit/src/database/content"
+	"mygit/src/database/util"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//refs,reflog,HEAD,ORIG_HEAD,MERGE_HEADなど,indexから辿れないlooseのobjectを消す
+//消してすぐの書き込み途中のobjectを消さないように、mtimeがExpireより前のものだけ消す(本家のgc.pruneExpire)
+
+//本家のgcのdefaultは2週間
+const (
+	DEFAULT_GC_PRUNE  = "2.weeks.ago"
+	DEFAULT_GC_EXPIRE = 14 * 24 * time.Hour
+)
+
+type GcOption struct {
+	DryRun bool
+	//--pruneや--expireの値、空ならgc.pruneExpire、それもなければDEFAULT_GC_PRUNE
+	Prune string
+	//StartGcでPruneから決める、-1ならどれも消さない(never)
+	Expire time.Duration
+	//testでは時間を固定したいのでNowを渡せるようにしておく
+	Now time.Time
+}
+
+type GcResult struct {
+	Objects   []string
+	TempFiles []string
+}
+
+var ErrorInvalidExpire = errors.New("invalid expire")
+
+var expireAgoExp = `^(\d+)\.(second|minute|hour|day|week)s?\.ago$`
+
+//now,never,Goのduration(336h),本家の2.weeks.agoの形を受け付ける
+func ParseExpire(s string) (time.Duration, error) {
+	switch s {
+	case "now":
+		return 0, nil
+	case "never":
+		return -1, nil
+	}
+
+	if d, err := time.ParseDuration(s); err == nil {
+		return d, nil
+	}
+
+	m := regexp.MustCompile(expireAgoExp).FindStringSubmatch(s)
+	if m == nil {
+		return 0, ErrorInvalidExpire
+	}
+
+	n, err := strconv.Atoi(m[1])
+	if err != nil {
+		return 0, ErrorInvalidExpire
+	}
+
+	unit := map[string]time.Duration{
+		"second": time.Second,
+		"minute": time.Minute,
+		"hour":   time.Hour,
+		"day":    24 * time.Hour,
+		"week":   7 * 24 * time.Hour,
+	}[m[2]]
+
+	return time.Duration(n) * unit, nil
+}
+
+//--prune,gc.pruneExpire,DEFAULT_GC_PRUNEの順に見る
+func GcExpire(prune string, repo *Repository) (time.Duration, error) {
+	if prune == "" {
+		cs, err := repo.Config()
+		if err != nil {
+			return 0, err
+		}
+		prune = DEFAULT_GC_PRUNE
+		if v, ok := cs.GcPruneExpire(); ok {
+			prune = v
+		}
+	}
+
+	return ParseExpire(prune)
+}
+
+func StartGc(rootPath string, option *GcOption, w io.Writer) error {
+	repo, err := DiscoverRepository(rootPath)
+	if err != nil {
+		return err
+	}
+
+	option.Expire, err = GcExpire(option.Prune, repo)
+	if err != nil {
+		return err
+	}
+
+	if option.Now.IsZero() {
+		option.Now = time.Now()
+	}
+
+	result, err := RunGc(repo, option)
+	if err != nil {
+		return err
+	}
+
+	if option.DryRun {
+		for _, objId := range result.Objects {
+			objType, err := ReadObjType(objId, repo)
+			if err != nil {
+				return err
+			}
+			w.Write([]byte(fmt.Sprintf("%s %s\n", objId, objType)))
+		}
+		w.Write([]byte(fmt.Sprintf("Would remove %d unreachable objects and %d temporary files\n", len(result.Objects), len(result.TempFiles))))
+		return nil
+	}
+
+	w.Write([]byte(fmt.Sprintf("Removed %d unreachable objects and %d temporary files\n", len(result.Objects), len(result.TempFiles))))
+
+	return nil
+}
+
+func RunGc(repo *Repository, option *GcOption) (*GcResult, error) {
+	reachable, err := ReachableObjects(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	looseObjIds, err := repo.d.LooseObjIds()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &GcResult{}
+
+	for _, objId := range looseObjIds {
+		if reachable[objId] {
+			continue
+		}
+
+		expired, err := isExpired(repo.d.ObjPath(objId), option)
+		if err != nil {
+			return nil, err
+		}
+		if expired {
+			result.Objects = append(result.Objects, objId)
+		}
+	}
+
+	tempFiles, err := staleTempFiles(repo, option)
+	if err != nil {
+		return nil, err
+	}
+	result.TempFiles = tempFiles
+
+	if option.DryRun {
+		return result, nil
+	}
+
+	for _, objId := range result.Objects {
+		objPath := repo.d.ObjPath(objId)
+		if err := os.Remove(objPath); err != nil {
+			return nil, err
+		}
+		//空になったobjects/xxは消す、空でなければerrorになるので無視
+		os.Remove(filepath.Dir(objPath))
+	}
+
+	for _, p := range result.TempFiles {
+		if err := os.Remove(p); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+func isExpired(path string, option *GcOption) (bool, error) {
+	if option.Expire < 0 {
+		return false, nil
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+
+	return !stat.ModTime().After(option.Now.Add(-option.Expire)), nil
+}
+
+//util.WriteFileが途中で失敗した時のobjects/xx/yyyy123456のようなファイルと、packを書く途中のtmp_pack_xxx
+func staleTempFiles(repo *Repository, option *GcOption) ([]string, error) {
+	var candidates []string
+
+	dirs, err := ioutil.ReadDir(repo.d.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+
+		if dir.Name() == "pack" {
+			files, err := filepath.Glob(filepath.Join(repo.d.PackDir(), "tmp_*"))
+			if err != nil {
+				return nil, err
+			}
+			candidates = append(candidates, files...)
+			continue
+		}
+
+		if len(dir.Name()) != 2 {
+			continue
+		}
+
+		files, err := ioutil.ReadDir(filepath.Join(repo.d.Path, dir.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			//objIdからdirの2文字を除いた長さでなければ書きかけのtmp
+			if !f.IsDir() && len(f.Name()) != repo.Hash().HexSize()-2 {
+				candidates = append(candidates, filepath.Join(repo.d.Path, dir.Name(), f.Name()))
+			}
+		}
+	}
+
+	var stale []string
+	for _, p := range candidates {
+		expired, err := isExpired(p, option)
+		if err != nil {
+			return nil, err
+		}
+		if expired {
+			stale = append(stale, p)
+		}
+	}
+
+	sort.Strings(stale)
+
+	return stale, nil
+}
+
+func ReadObjType(objId string, repo *Repository) (string, error) {
+	r, err := repo.d.GetContent(objId)
+	if err != nil {
+		return "", err
+	}
+
+	hAndR, err := repo.d.ScanObjectHeader(r)
+	if err != nil {
+		return "", err
+	}
+
+	return hAndR.ObjType, nil
+}
+
+//gcで消してはいけないobjectの起点となるobjId
+func ReachableRoots(repo *Repository) ([]string, error) {
+	var roots []string
+
+	//refs/heads以外(これから増えるtagなど)も対象にするのでrefs以下をすべて見る
+	if _, err := os.Stat(repo.r.RefsPath()); err == nil {
+		refs, err := util.FilePathWalkDir(repo.r.RefsPath(), nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, ref := range refs {
+			objId, err := repo.r.ReadSymRef(filepath.Join(repo.r.RefsPath(), ref))
+			if err != nil {
+				return nil, err
+			}
+			roots = append(roots, objId)
+		}
+	}
+
+	//reflogに残っている位置はHEAD@{n}で戻れるようにする
+	logs, err := repo.r.ListReflogs()
+	if err != nil {
+		return nil, err
+	}
+	for _, logPath := range logs {
+		entries, err := data.ReadReflogFile(logPath)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			for _, objId := range []string{e.OldObjId, e.NewObjId} {
+				if objId != repo.Hash().ZeroObjId() {
+					roots = append(roots, objId)
+				}
+			}
+		}
+	}
+
+	//HEADはdetachedのこともあるので別に読む
+	headFiles := []string{"HEAD", data.ORIG_HEAD}
+	for _, name := range typesMap {
+		headFiles = append(headFiles, name)
+	}
+	seq := GenerateSequencer(repo)
+	headFiles = append(headFiles, seq.GetHeadPath(), seq.GetAbortPath())
+
+	for _, name := range headFiles {
+		path := name
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(repo.r.Path, name)
+		}
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+
+		objId, err := repo.r.ReadSymRef(path)
+		if err != nil {
+			//まだcommitのない状態のHEADはrefs/heads/masterがないのでとばす
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		if objId != "" {
+			roots = append(roots, objId)
+		}
+	}
+
+	//cherry-pickなどの途中でtodoに残っているcommit
+	if seq.IsExists(seq.Path) && seq.IsDir(seq.Path) {
+		if err := seq.Load(); err == nil {
+			for _, c := range seq.Command {
+				//execの行はcommitを持たない
+				if c.c == nil {
+					continue
+				}
+				roots = append(roots, c.c.ObjId)
+			}
+		}
+	}
+
+	return roots, nil
+}
+
+//commitからparentとtreeを辿ってすべてのobjIdを集める、indexのblobも入れる
+func ReachableObjects(repo *Repository) (map[string]bool, error) {
+	reachable := make(map[string]bool)
+
+	roots, err := ReachableRoots(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	queue := append([]string{}, roots...)
+	for len(queue) > 0 {
+		objId := queue[0]
+		queue = queue[1:]
+
+		if reachable[objId] {
+			continue
+		}
+		reachable[objId] = true
+
+		o, err := repo.d.ReadObject(objId)
+		if err != nil {
+			return nil, err
+		}
+
+		switch v := o.(type) {
+		case *con.CommitFromMem:
+			queue = append(queue, v.Parents...)
+
+			err = markTree(v.Tree, repo, reachable)
+			if err != nil {
+				return nil, err
+			}
+		case *con.Tag:
+			//annotated tagは指しているobjectも残す
+			queue = append(queue, v.Object)
+		case *con.Tree:
+			delete(reachable, objId)
+			err = markTree(objId, repo, reachable)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	_, indexNonExist := os.Stat(repo.i.Path)
+	if indexNonExist == nil {
+		if err := repo.i.Load(); err != nil {
+			return nil, err
+		}
+		entries, err := repo.i.GetEntries()
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if e.IsGitlink() {
+				continue
+			}
+			reachable[e.ObjId] = true
+		}
+	}
+
+	return reachable, nil
+}
+
+//LoadTreeListはblobしか返さないので、tree自体のobjIdもとるために自分で辿る
+func markTree(objId string, repo *Repository, reachable map[string]bool) error {
+	if reachable[objId] {
+		return nil
+	}
+	reachable[objId] = true
+
+	o, err := repo.d.ReadObject(objId)
+	if err != nil {
+		return err
+	}
+
+	t, ok := o.(*con.Tree)
+	if !ok {
+		return ErrorObjeToEntryConvError
+	}
+
+	for _, v := range t.Entries {
+		e, ok := v.(*con.Entry)
+		if !ok {
+			return ErrorObjeToEntryConvError
+		}
+
+		if e.IsTree() {
+			if err := markTree(e.ObjId, repo, reachable); err != nil {
+				return err
+			}
+			continue
+		}
+		//submoduleのcommitはこのrepositoryにはない
+		if e.IsGitlink() {
+			continue
+		}
+
+		reachable[e.ObjId] = true
+	}
+
+	return nil
+}
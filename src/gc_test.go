@@ -0,0 +1,189 @@
+package src
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	con "mygit/src/database/content"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseExpire(t *testing.T) {
+	for _, d := range []struct {
+		input    string
+		expected time.Duration
+		err      error
+	}{
+		{"now", 0, nil},
+		{"never", -1, nil},
+		{"336h", 336 * time.Hour, nil},
+		{"2.weeks.ago", 14 * 24 * time.Hour, nil},
+		{"1.day.ago", 24 * time.Hour, nil},
+		{"yesterday", 0, ErrorInvalidExpire},
+	} {
+		t.Run(d.input, func(t *testing.T) {
+			expire, err := ParseExpire(d.input)
+			assert.Equal(t, d.err, err)
+			assert.Equal(t, d.expected, expire)
+		})
+	}
+}
+
+func Test_GcExpire(t *testing.T) {
+	SetConfigHomeForTest(t)
+	_, repo := PrepareRebaseRepo(t)
+
+	expire, err := GcExpire("", repo)
+	assert.NoError(t, err)
+	assert.Equal(t, DEFAULT_GC_EXPIRE, expire)
+
+	c, err := LoadConfig(repo)
+	assert.NoError(t, err)
+	c.Set("gc", "", "pruneExpire", "1.day.ago")
+	assert.NoError(t, c.Save())
+
+	expire, err = GcExpire("", repo)
+	assert.NoError(t, err)
+	assert.Equal(t, 24*time.Hour, expire)
+
+	//--pruneがconfigより優先
+	expire, err = GcExpire("now", repo)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), expire)
+}
+
+func Test_Gc(t *testing.T) {
+	cur, err := os.Getwd()
+	assert.NoError(t, err)
+	tempPath, err := ioutil.TempDir(cur, "")
+	assert.NoError(t, err)
+
+	t.Cleanup(func() {
+		os.RemoveAll(tempPath)
+	})
+
+	var buf bytes.Buffer
+	err = StartInit([]string{tempPath}, &InitOption{}, &buf)
+	assert.NoError(t, err)
+
+	xxxPath := filepath.Join(tempPath, "xxx")
+	err = os.MkdirAll(xxxPath, os.ModePerm)
+	assert.NoError(t, err)
+	CreateFiles(t, tempPath, "hello.txt", "hello\n")
+	CreateFiles(t, xxxPath, "dummy.txt", "dummy\n")
+	err = StartAdd(tempPath, "test", "test@example.com", "test", []string{"."})
+	assert.NoError(t, err)
+	err = StartCommit(tempPath, "test", "test@example.com", "first", &buf)
+	assert.NoError(t, err)
+
+	//indexにだけあるblobは消してはいけない
+	CreateFiles(t, tempPath, "staged.txt", "staged\n")
+	err = StartAdd(tempPath, "test", "test@example.com", "test", []string{"staged.txt"})
+	assert.NoError(t, err)
+
+	gitPath := filepath.Join(tempPath, ".git")
+	repo := GenerateRepository(tempPath, gitPath, filepath.Join(gitPath, "objects"))
+
+	now := time.Now()
+	old := now.Add(-30 * 24 * time.Hour)
+
+	oldBlob := &con.Blob{Content: "old garbage\n"}
+	repo.d.Store(oldBlob)
+	err = os.Chtimes(repo.d.ObjPath(oldBlob.ObjId), old, old)
+	assert.NoError(t, err)
+
+	//grace periodの中のものは消さない
+	newBlob := &con.Blob{Content: "new garbage\n"}
+	repo.d.Store(newBlob)
+
+	tempFile := repo.d.ObjPath(oldBlob.ObjId) + "123456"
+	err = ioutil.WriteFile(tempFile, []byte("broken"), os.ModePerm)
+	assert.NoError(t, err)
+	err = os.Chtimes(tempFile, old, old)
+	assert.NoError(t, err)
+
+	before, err := repo.d.LooseObjIds()
+	assert.NoError(t, err)
+
+	//dry-runでは数だけ出して何も消さない
+	buf.Reset()
+	err = StartGc(tempPath, &GcOption{DryRun: true, Now: now}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("%s blob\nWould remove 1 unreachable objects and 1 temporary files\n", oldBlob.ObjId), buf.String())
+
+	after, err := repo.d.LooseObjIds()
+	assert.NoError(t, err)
+	assert.Equal(t, before, after)
+
+	buf.Reset()
+	err = StartGc(tempPath, &GcOption{Now: now}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "Removed 1 unreachable objects and 1 temporary files\n", buf.String())
+
+	_, err = os.Stat(repo.d.ObjPath(oldBlob.ObjId))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(tempFile)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(repo.d.ObjPath(newBlob.ObjId))
+	assert.NoError(t, err)
+
+	//expire=nowならgrace periodなしで消える、reachableなものは残る
+	buf.Reset()
+	err = StartGc(tempPath, &GcOption{Prune: "now", Now: now.Add(time.Second)}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "Removed 1 unreachable objects and 0 temporary files\n", buf.String())
+
+	reachable, err := ReachableObjects(GenerateRepository(tempPath, gitPath, filepath.Join(gitPath, "objects")))
+	assert.NoError(t, err)
+	remain, err := repo.d.LooseObjIds()
+	assert.NoError(t, err)
+	//commit,root tree,xxx tree,hello,dummy,staged
+	assert.Equal(t, 6, len(remain))
+	for _, objId := range remain {
+		assert.True(t, reachable[objId])
+	}
+
+	buf.Reset()
+	err = StartStatus(&buf, tempPath, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "A  staged.txt\n", buf.String())
+}
+
+//repackは到達できないobjectをpackに入れないので、gcで消せる
+func Test_GcAfterRepack(t *testing.T) {
+	SetConfigHomeForTest(t)
+	tempPath, repo := PrepareRebaseRepo(t)
+	var buf bytes.Buffer
+
+	CommitFileForTest(t, tempPath, "hello.txt", "hello\n", "first")
+
+	unreachable := &con.Blob{Content: "unreachable\n"}
+	repo.d.Store(unreachable)
+
+	err := StartRepack(tempPath, &RepackOption{DeleteLoose: true}, &buf)
+	assert.NoError(t, err)
+	repo.d.ResetPacks()
+
+	packed, err := repo.d.HasPackedObject(unreachable.GetObjId())
+	assert.NoError(t, err)
+	assert.False(t, packed)
+
+	result, err := RunGc(repo, &GcOption{Now: time.Now()})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{unreachable.GetObjId()}, result.Objects)
+
+	loose, err := repo.d.LooseObjIds()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(loose))
+
+	//2回目は新しいpackを作らない
+	buf.Reset()
+	err = StartRepack(tempPath, &RepackOption{}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "Nothing new to pack.\n", buf.String())
+}
@@ -0,0 +1,132 @@
+package src
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+//本家のgit http-backendと同じsmart HTTPのserver
+//GET  <repo>/info/refs?service=git-upload-pack|git-receive-pack
+//POST <repo>/git-upload-pack
+//POST <repo>/git-receive-pack
+//1つのrepositoryだけを扱うので<repo>の部分は何でもよい
+//認証はしないので、本家と同じくhttp.receivepackをtrueにしない限りpushは受け付けない
+
+var ErrorReceivePackDisabled = errors.New("receive-pack is disabled; set http.receivepack to enable it")
+
+type HTTPBackend struct {
+	repo *Repository
+	bare bool
+}
+
+func GenerateHTTPBackend(path string) (*HTTPBackend, error) {
+	repo, bare, err := OpenRepositoryAt(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &HTTPBackend{
+		repo: repo,
+		bare: bare,
+	}, nil
+}
+
+func StartHTTPBackend(rootPath, addr string, w io.Writer) error {
+	backend, err := GenerateHTTPBackend(rootPath)
+	if err != nil {
+		return err
+	}
+
+	w.Write([]byte(fmt.Sprintf("Serving %s on %s\n", rootPath, addr)))
+
+	return http.ListenAndServe(addr, backend)
+}
+
+func (b *HTTPBackend) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	path := req.URL.Path
+
+	if (strings.HasSuffix(path, "/info/refs") && req.URL.Query().Get("service") == RECEIVE_PACK) || strings.HasSuffix(path, "/"+RECEIVE_PACK) {
+		if !b.receivePackEnabled() {
+			http.Error(w, ErrorReceivePackDisabled.Error(), http.StatusForbidden)
+			return
+		}
+	}
+
+	switch {
+	case req.Method == http.MethodGet && strings.HasSuffix(path, "/info/refs"):
+		b.serveInfoRefs(w, req)
+	case req.Method == http.MethodPost && strings.HasSuffix(path, "/"+UPLOAD_PACK):
+		b.serveRPC(w, req, UPLOAD_PACK)
+	case req.Method == http.MethodPost && strings.HasSuffix(path, "/"+RECEIVE_PACK):
+		b.serveRPC(w, req, RECEIVE_PACK)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+//設定を変えたらserverを起動し直さなくても効くように毎回読む
+func (b *HTTPBackend) receivePackEnabled() bool {
+	cs, err := b.repo.Config()
+	if err != nil {
+		return false
+	}
+	enabled, err := cs.HTTPReceivePack()
+	return err == nil && enabled
+}
+
+func (b *HTTPBackend) serveInfoRefs(w http.ResponseWriter, req *http.Request) {
+	service := req.URL.Query().Get("service")
+	if service != UPLOAD_PACK && service != RECEIVE_PACK {
+		//dumb HTTPには対応しない
+		http.Error(w, ErrorUnknownService.Error(), http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Content-Type", fmt.Sprintf("application/x-%s-advertisement", service))
+	w.Header().Set("Cache-Control", "no-cache")
+
+	WritePktLine(w, fmt.Sprintf("# service=%s\n", service))
+	WritePktFlush(w)
+
+	var err error
+	if service == UPLOAD_PACK {
+		err = AdvertiseUploadPack(w, b.repo)
+	} else {
+		err = AdvertiseReceivePack(w, b.repo)
+	}
+	if err != nil {
+		WritePktLine(w, fmt.Sprintf("ERR %s\n", err.Error()))
+	}
+}
+
+func (b *HTTPBackend) serveRPC(w http.ResponseWriter, req *http.Request, service string) {
+	if req.Header.Get("Content-Type") != fmt.Sprintf("application/x-%s-request", service) {
+		http.Error(w, ErrorUnknownService.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var body io.Reader = req.Body
+	if req.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	w.Header().Set("Content-Type", fmt.Sprintf("application/x-%s-result", service))
+	w.Header().Set("Cache-Control", "no-cache")
+
+	//途中で失敗した時はERRかreport-statusで相手に伝わっているので、ここではstatusを変えない
+	if service == UPLOAD_PACK {
+		ServeUploadPack(body, w, b.repo)
+	} else {
+		ServeReceivePack(body, w, b.repo, b.bare)
+	}
+}
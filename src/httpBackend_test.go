@@ -0,0 +1,197 @@
+package src
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPktLine(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, WritePktLine(&buf, "want abc\n"))
+	assert.NoError(t, WritePktFlush(&buf))
+	assert.Equal(t, "000dwant abc\n0000", buf.String())
+
+	pr := GeneratePktReader(&buf)
+	line, isFlush, err := pr.ReadLine()
+	assert.NoError(t, err)
+	assert.False(t, isFlush)
+	assert.Equal(t, "want abc\n", line)
+	_, isFlush, err = pr.ReadLine()
+	assert.NoError(t, err)
+	assert.True(t, isFlush)
+
+	_, _, err = GeneratePktReader(bytes.NewBufferString("zzzz")).ReadLine()
+	assert.ErrorIs(t, err, ErrorInvalidPktLine)
+}
+
+//認証がないのでpushは設定しないと受け付けない
+func EnableHTTPReceivePackForTest(t *testing.T, repo *Repository) {
+	c, err := LoadConfig(repo)
+	assert.NoError(t, err)
+	c.Set("http", "", "receivepack", "true")
+	assert.NoError(t, c.Save())
+}
+
+func TestHTTPInfoRefs(t *testing.T) {
+	_, originPath, _ := PrepareRemoteRepo(t)
+	backend, err := GenerateHTTPBackend(originPath)
+	assert.NoError(t, err)
+	server := httptest.NewServer(backend)
+	t.Cleanup(server.Close)
+
+	//空のrepositoryでもcapabilityは送る
+	res, err := http.Get(server.URL + "/repo/info/refs?service=git-upload-pack")
+	assert.NoError(t, err)
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, "application/x-git-upload-pack-advertisement", res.Header.Get("Content-Type"))
+	assert.Equal(t, "001e# service=git-upload-pack\n0000"+fmt.Sprintf("%04x", 4+len(ZERO_OBJ_ID)+len(" capabilities^{}\x00\n")+len(AGENT))+ZERO_OBJ_ID+" capabilities^{}\x00"+AGENT+"\n0000", string(body))
+
+	//dumb HTTPには答えない
+	res, err = http.Get(server.URL + "/repo/info/refs")
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+}
+
+func TestHTTPCloneFetchPush(t *testing.T) {
+	tempPath, originPath, origin := PrepareRemoteRepo(t)
+	var buf bytes.Buffer
+
+	CommitFileForTest(t, originPath, "hello.txt", "hello\n", "first")
+	err := os.MkdirAll(filepath.Join(originPath, "dir"), os.ModePerm)
+	assert.NoError(t, err)
+	CommitFileForTest(t, originPath, "dir/world.txt", "world\n", "second")
+
+	backend, err := GenerateHTTPBackend(originPath)
+	assert.NoError(t, err)
+	server := httptest.NewServer(backend)
+	t.Cleanup(server.Close)
+	url := server.URL + "/origin.git"
+
+	clonePath := filepath.Join(tempPath, "clone")
+	err = StartClone([]string{url, clonePath}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "Cloning into 'clone'...\n", buf.String())
+
+	repo := OpenRepoForTest(clonePath)
+	originHead := ResolveForTest(t, "HEAD", origin)
+	assert.Equal(t, originHead, ResolveForTest(t, "HEAD", repo))
+	assert.Equal(t, originHead, ResolveForTest(t, "origin/master", repo))
+	content, err := ioutil.ReadFile(filepath.Join(clonePath, "dir", "world.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "world\n", string(content))
+
+	//増えた分だけ取ってくる
+	CommitFileForTest(t, originPath, "hello.txt", "hello again\n", "third")
+	newHead := ResolveForTest(t, "HEAD", origin)
+
+	buf.Reset()
+	err = StartFetch(clonePath, nil, &buf)
+	assert.NoError(t, err)
+	expected := fmt.Sprintf("From %s\n", url)
+	expected += fmt.Sprintf("   %-17s %-10s -> %s\n", fmt.Sprintf("%s..%s", ShortOid(originHead, repo.d), ShortOid(newHead, repo.d)), "master", "origin/master")
+	assert.Equal(t, expected, buf.String())
+	assert.Equal(t, newHead, ResolveForTest(t, "origin/master", repo))
+
+	//既定ではpushを受け付けない
+	res, err := http.Get(url + "/info/refs?service=git-receive-pack")
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+	res, err = http.Post(url+"/git-receive-pack", "application/x-git-receive-pack-request", bytes.NewBufferString("0000"))
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+	err = StartPush(clonePath, []string{"origin", "origin/master:refs/heads/release"}, &PushOption{}, &buf)
+	assert.ErrorIs(t, err, ErrorHTTPTransport)
+	_, err = origin.r.ReadRef("refs/heads/release")
+	assert.Error(t, err)
+
+	EnableHTTPReceivePackForTest(t, origin)
+
+	//checkoutされていないbranchへpushし、消す
+	buf.Reset()
+	err = StartPush(clonePath, []string{"origin", "origin/master:refs/heads/release"}, &PushOption{}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("To %s\n * %-17s origin/master -> release\n", url, "[new branch]"), buf.String())
+	assert.Equal(t, newHead, ResolveForTest(t, "release", origin))
+
+	buf.Reset()
+	err = StartPush(clonePath, []string{"origin", ":release"}, &PushOption{}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("To %s\n - %-17s release\n", url, "[deleted]"), buf.String())
+
+	//checkoutされているbranchはremoteが拒否する
+	CommitFileForTest(t, clonePath, "clone.txt", "clone\n", "from clone")
+	buf.Reset()
+	err = StartFetch(clonePath, nil, &buf)
+	assert.NoError(t, err)
+	buf.Reset()
+	err = StartPush(clonePath, []string{"origin", "+master"}, &PushOption{}, &buf)
+	assert.ErrorIs(t, err, ErrorPushRejected)
+	assert.Contains(t, buf.String(), "master -> master (branch is currently checked out)\n")
+	assert.Equal(t, newHead, ResolveForTest(t, "HEAD", origin))
+}
+
+func TestHTTPPushToBare(t *testing.T) {
+	cur, err := os.Getwd()
+	assert.NoError(t, err)
+	tempPath, err := ioutil.TempDir(cur, "")
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(tempPath)
+	})
+
+	var buf bytes.Buffer
+	barePath := filepath.Join(tempPath, "shared.git")
+	err = gitInit(barePath, &buf)
+	assert.NoError(t, err)
+	bare, _, err := OpenRepositoryAt(barePath)
+	assert.NoError(t, err)
+	EnableHTTPReceivePackForTest(t, bare)
+	backend, err := GenerateHTTPBackend(barePath)
+	assert.NoError(t, err)
+	server := httptest.NewServer(backend)
+	t.Cleanup(server.Close)
+	url := server.URL + "/shared.git"
+
+	alicePath := filepath.Join(tempPath, "alice")
+	err = StartClone([]string{url, alicePath}, &buf)
+	assert.NoError(t, err)
+	CommitFileForTest(t, alicePath, "hello.txt", "hello\n", "first")
+	aliceHead := ResolveForTest(t, "HEAD", OpenRepoForTest(alicePath))
+
+	buf.Reset()
+	err = StartPush(alicePath, nil, &PushOption{}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("To %s\n * %-17s master -> master\n", url, "[new branch]"), buf.String())
+	assert.Equal(t, aliceHead, ResolveForTest(t, "refs/heads/master", bare))
+
+	//2回目は相手が持っているcommitを送らずにすむ
+	CommitFileForTest(t, alicePath, "hello.txt", "hello again\n", "second")
+	buf.Reset()
+	err = StartPush(alicePath, nil, &PushOption{}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, ResolveForTest(t, "HEAD", OpenRepoForTest(alicePath)), ResolveForTest(t, "refs/heads/master", bare))
+
+	//receive.denyNonFastForwardsならforceでも拒否する
+	c, err := LoadConfig(bare)
+	assert.NoError(t, err)
+	c.Set("receive", "", "denyNonFastForwards", "true")
+	assert.NoError(t, c.Save())
+
+	buf.Reset()
+	err = StartPush(alicePath, []string{"origin", "+master~1:master"}, &PushOption{}, &buf)
+	assert.ErrorIs(t, err, ErrorPushRejected)
+	assert.Contains(t, buf.String(), "master~1 -> master (non-fast-forward)\n")
+}
@@ -0,0 +1,141 @@
+package src
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mygit/src/crypt"
+	"net/http"
+	"strings"
+)
+
+//smart HTTPのclient、http-backendかそれと同じprotocolを話すserverとやりとりする
+//negotiationは手元のrefの先をhaveとして一度に送るだけにする
+
+var ErrorHTTPTransport = errors.New("unexpected response from remote")
+
+type HTTPTransport struct {
+	url    string
+	client *http.Client
+	//広告のobject-format、ListRefsまではsha1
+	objectFormat crypt.Hash
+}
+
+func GenerateHTTPTransport(url string) *HTTPTransport {
+	return &HTTPTransport{
+		url:          strings.TrimRight(url, "/"),
+		client:       http.DefaultClient,
+		objectFormat: crypt.SHA1,
+	}
+}
+
+func (t *HTTPTransport) ListRefs() ([]*RemoteRef, error) {
+	refs, caps, err := t.discoverRefs(UPLOAD_PACK)
+	if err != nil {
+		return nil, err
+	}
+
+	setHeadTarget(refs, caps)
+
+	t.objectFormat, err = remoteObjectFormat(caps)
+	if err != nil {
+		return nil, err
+	}
+
+	return refs, nil
+}
+
+func (t *HTTPTransport) ObjectFormat() crypt.Hash {
+	return t.objectFormat
+}
+
+func (t *HTTPTransport) Fetch(wants []string, local *Repository) error {
+	var body bytes.Buffer
+	ok, err := writeFetchRequest(&body, wants, local)
+	if err != nil || !ok {
+		return err
+	}
+
+	res, err := t.rpc(UPLOAD_PACK, &body)
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+
+	return readFetchResponse(GeneratePktReader(res), local)
+}
+
+func (t *HTTPTransport) Push(updates []*RefUpdate, local *Repository) error {
+	advertised, _, err := t.discoverRefs(RECEIVE_PACK)
+	if err != nil {
+		return err
+	}
+
+	var body bytes.Buffer
+	err = writePushRequest(&body, updates, advertised, local)
+	if err != nil {
+		return err
+	}
+
+	res, err := t.rpc(RECEIVE_PACK, &body)
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+
+	return readReportStatus(GeneratePktReader(res), updates)
+}
+
+//GET info/refsで"# service=..."とflushのあとに続く広告を読む
+func (t *HTTPTransport) discoverRefs(service string) ([]*RemoteRef, []string, error) {
+	res, err := t.client.Get(fmt.Sprintf("%s/info/refs?service=%s", t.url, service))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusForbidden {
+		return nil, nil, fmt.Errorf("%s: %w", res.Status, ErrorHTTPTransport)
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("'%s' %w", t.url, ErrorNotARepository)
+	}
+	if res.Header.Get("Content-Type") != fmt.Sprintf("application/x-%s-advertisement", service) {
+		return nil, nil, ErrorHTTPTransport
+	}
+
+	pr := GeneratePktReader(res.Body)
+	line, _, err := pr.ReadLine()
+	if err != nil {
+		return nil, nil, err
+	}
+	if line != fmt.Sprintf("# service=%s\n", service) {
+		return nil, nil, ErrorHTTPTransport
+	}
+	if _, isFlush, err := pr.ReadLine(); err != nil || !isFlush {
+		return nil, nil, ErrorHTTPTransport
+	}
+
+	return readRefAdvertisement(pr)
+}
+
+func (t *HTTPTransport) rpc(service string, body io.Reader) (io.ReadCloser, error) {
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/%s", t.url, service), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", fmt.Sprintf("application/x-%s-request", service))
+	req.Header.Set("Accept", fmt.Sprintf("application/x-%s-result", service))
+
+	res, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("%s: %w", res.Status, ErrorHTTPTransport)
+	}
+
+	return res.Body, nil
+}
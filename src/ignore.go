@@ -0,0 +1,280 @@
+package src
+
+import (
+	"bufio"
+	data "mygit/src/database"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+//.gitignore,.git/info/exclude,globalのexcludesFileのパターンでworkSpaceのpathを除外する
+//優先度は global < info/exclude < root/.gitignore < 深い階層の.gitignoreの順で、後から見たもので一致したものが勝つ
+//親Dirが除外されているときはその中身を!で含め直すことはできない(本家と同じ)
+
+type IgnorePattern struct {
+	Pattern  string
+	Base     string //.gitignoreが置いてあるDirのworkSpaceからの相対path(rootなら"")
+	Negate   bool
+	DirOnly  bool
+	Anchored bool
+	re       *regexp.Regexp
+}
+
+type Ignore struct {
+	rootPath string
+	gitPath  string
+	//global,info/excludeの分
+	basePatterns []*IgnorePattern
+	//Dir(workSpaceからの相対path) -> そのDirの.gitignoreのpattern
+	dirPatterns map[string][]*IgnorePattern
+	//一度判定したDirの結果を持っておく
+	dirCache map[string]bool
+	//statusは並列にDirを調べるので、2つのcacheはmuで守る
+	mu sync.Mutex
+}
+
+func GenerateIgnore(rootPath, gitPath string) *Ignore {
+	ig := &Ignore{
+		rootPath:    rootPath,
+		gitPath:     gitPath,
+		dirPatterns: make(map[string][]*IgnorePattern),
+		dirCache:    make(map[string]bool),
+	}
+
+	if p := GlobalExcludesFile(gitPath); p != "" {
+		ig.basePatterns = append(ig.basePatterns, ReadIgnoreFile(p, "")...)
+	}
+	ig.basePatterns = append(ig.basePatterns, ReadIgnoreFile(filepath.Join(gitPath, "info", "exclude"), "")...)
+
+	return ig
+}
+
+//core.excludesFile、なければ本家のdefaultの場所
+func GlobalExcludesFile(gitPath string) string {
+	if cs, err := data.LoadConfigStack(gitPath); err == nil {
+		if p, ok := cs.GetPath("core", "", "excludesFile"); ok {
+			return p
+		}
+	}
+
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		return filepath.Join(xdg, "git", "ignore")
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(home, ".config", "git", "ignore")
+}
+
+//ファイルがなければ空(.gitignoreはないのが普通なのでerrorにはしない)
+func ReadIgnoreFile(path, base string) []*IgnorePattern {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var patterns []*IgnorePattern
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		p := ParseIgnorePattern(scanner.Text(), base)
+		if p != nil {
+			patterns = append(patterns, p)
+		}
+	}
+
+	return patterns
+}
+
+//空行と#から始まる行はnil
+func ParseIgnorePattern(line, base string) *IgnorePattern {
+	line = strings.TrimSuffix(line, "\r")
+	line = trimTrailingSpaces(line)
+
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+
+	p := &IgnorePattern{
+		Base: base,
+	}
+
+	if strings.HasPrefix(line, "!") {
+		p.Negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		p.DirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+
+	//先頭か途中に/があればそのDirからの相対pathとして扱う、なければどの階層のbasenameにもmatchする
+	if strings.Contains(line, "/") {
+		p.Anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+
+	if line == "" {
+		return nil
+	}
+
+	p.Pattern = line
+	p.re = regexp.MustCompile("^" + globToRegexp(line) + "$")
+
+	return p
+}
+
+//\で終わる空白は残す
+func trimTrailingSpaces(line string) string {
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	return line
+}
+
+func globToRegexp(pattern string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/") && (i == 0 || pattern[i-1] == '/'):
+			//**/fooは0個以上のDirの後のfoo
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**") && i+2 == len(pattern) && (i == 0 || pattern[i-1] == '/'):
+			//foo/**はfooの中身すべて
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end == -1 {
+				b.WriteString(regexp.QuoteMeta("["))
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			b.WriteString(regexp.QuoteMeta(string(pattern[i])))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	return b.String()
+}
+
+//pathはpatternのBaseからの相対path
+func (p *IgnorePattern) Match(path string, isDir bool) bool {
+	if p.DirOnly && !isDir {
+		return false
+	}
+
+	if p.Anchored {
+		return p.re.MatchString(path)
+	}
+
+	return p.re.MatchString(filepath.Base(path))
+}
+
+//pathはworkSpaceからの相対path
+func (ig *Ignore) IsIgnored(path string, isDir bool) bool {
+	path = filepath.ToSlash(filepath.Clean(path))
+	if path == "." || path == "" {
+		return false
+	}
+
+	//.gitはpatternに関係なく常に除外
+	if path == ".git" || strings.HasPrefix(path, ".git/") {
+		return true
+	}
+
+	//親Dirが除外されていれば中身も除外
+	parent := filepath.ToSlash(filepath.Dir(path))
+	if parent != "." && ig.isIgnoredDir(parent) {
+		return true
+	}
+
+	return ig.match(path, isDir)
+}
+
+func (ig *Ignore) isIgnoredDir(dir string) bool {
+	ig.mu.Lock()
+	ignored, ok := ig.dirCache[dir]
+	ig.mu.Unlock()
+	if ok {
+		return ignored
+	}
+
+	//IsIgnoredは親Dirを辿ってここに戻ってくるので、lockしたまま呼ばない
+	ignored = ig.IsIgnored(dir, true)
+	ig.mu.Lock()
+	ig.dirCache[dir] = ignored
+	ig.mu.Unlock()
+
+	return ignored
+}
+
+//最後にmatchしたpatternが!でなければ除外
+func (ig *Ignore) match(path string, isDir bool) bool {
+	var ignored bool
+
+	for _, p := range ig.patternsFor(path) {
+		rel := path
+		if p.Base != "" {
+			rel = strings.TrimPrefix(path, p.Base+"/")
+		}
+
+		if p.Match(rel, isDir) {
+			ignored = !p.Negate
+		}
+	}
+
+	return ignored
+}
+
+//pathに効くpatternを優先度の低い順に並べる
+func (ig *Ignore) patternsFor(path string) []*IgnorePattern {
+	patterns := append([]*IgnorePattern{}, ig.basePatterns...)
+	patterns = append(patterns, ig.loadDir("")...)
+
+	dirs := strings.Split(path, "/")
+	for i := 1; i < len(dirs); i++ {
+		patterns = append(patterns, ig.loadDir(strings.Join(dirs[:i], "/"))...)
+	}
+
+	return patterns
+}
+
+func (ig *Ignore) loadDir(dir string) []*IgnorePattern {
+	ig.mu.Lock()
+	defer ig.mu.Unlock()
+
+	if patterns, ok := ig.dirPatterns[dir]; ok {
+		return patterns
+	}
+
+	patterns := ReadIgnoreFile(filepath.Join(ig.rootPath, filepath.FromSlash(dir), ".gitignore"), dir)
+	ig.dirPatterns[dir] = patterns
+
+	return patterns
+}
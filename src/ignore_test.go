@@ -0,0 +1,177 @@
+package src
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_IgnorePattern(t *testing.T) {
+	for _, d := range []struct {
+		title   string
+		line    string
+		path    string
+		isDir   bool
+		matched bool
+	}{
+		{"basename matches any level", "*.log", "a/b/debug.log", false, true},
+		{"wildcard does not cross slash", "a/*.txt", "a/b/c.txt", false, false},
+		{"anchored by leading slash", "/build", "build", true, true},
+		{"anchored by leading slash not nested", "/build", "x/build", true, false},
+		{"dir only does not match file", "tmp/", "tmp", false, false},
+		{"dir only matches dir", "tmp/", "x/tmp", true, true},
+		{"leading double star", "**/foo", "a/b/foo", false, true},
+		{"leading double star top level", "**/foo", "foo", false, true},
+		{"trailing double star", "abc/**", "abc/x/y", false, true},
+		{"middle double star zero dir", "a/**/b", "a/b", false, true},
+		{"middle double star some dirs", "a/**/b", "a/x/y/b", false, true},
+		{"question mark", "file?.txt", "file1.txt", false, true},
+		{"char class", "file[0-9].txt", "filea.txt", false, false},
+		{"negated char class", "file[!0-9].txt", "filea.txt", false, true},
+		{"escaped hash", `\#note`, "#note", false, true},
+	} {
+		t.Run(d.title, func(t *testing.T) {
+			p := ParseIgnorePattern(d.line, "")
+			assert.NotNil(t, p)
+			assert.Equal(t, d.matched, p.Match(d.path, d.isDir))
+		})
+	}
+}
+
+func Test_ParseIgnorePatternSkipsCommentAndBlank(t *testing.T) {
+	assert.Nil(t, ParseIgnorePattern("", ""))
+	assert.Nil(t, ParseIgnorePattern("   ", ""))
+	assert.Nil(t, ParseIgnorePattern("# comment", ""))
+
+	p := ParseIgnorePattern("!keep.log  ", "")
+	assert.True(t, p.Negate)
+	assert.Equal(t, "keep.log", p.Pattern)
+}
+
+func Test_IgnoreFiles(t *testing.T) {
+	cur, err := os.Getwd()
+	assert.NoError(t, err)
+	tempPath, err := ioutil.TempDir(cur, "")
+	assert.NoError(t, err)
+
+	t.Cleanup(func() {
+		os.RemoveAll(tempPath)
+	})
+
+	//HOMEのglobalなignoreファイルが紛れないようにする
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(tempPath, "config"))
+
+	gitPath := filepath.Join(tempPath, ".git")
+	err = os.MkdirAll(filepath.Join(gitPath, "info"), os.ModePerm)
+	assert.NoError(t, err)
+	err = os.MkdirAll(filepath.Join(tempPath, "config", "git"), os.ModePerm)
+	assert.NoError(t, err)
+	err = os.MkdirAll(filepath.Join(tempPath, "sub", "deep"), os.ModePerm)
+	assert.NoError(t, err)
+
+	CreateFiles(t, filepath.Join(tempPath, "config", "git"), "ignore", "*.swp\n")
+	CreateFiles(t, filepath.Join(gitPath, "info"), "exclude", "secret.txt\n")
+	CreateFiles(t, tempPath, ".gitignore", "*.log\n!important.log\nbuild/\n/root-only.txt\n")
+	CreateFiles(t, filepath.Join(tempPath, "sub"), ".gitignore", "!sub.log\n*.tmp\n")
+
+	ig := GenerateIgnore(tempPath, gitPath)
+
+	for _, d := range []struct {
+		path    string
+		isDir   bool
+		ignored bool
+	}{
+		{".git", true, true},
+		{"a.swp", false, true},
+		{"secret.txt", false, true},
+		{"debug.log", false, true},
+		{"important.log", false, false},
+		{"sub/sub.log", false, false},
+		{"sub/other.log", false, true},
+		{"sub/deep/x.tmp", false, true},
+		{"x.tmp", false, false},
+		{"build", true, true},
+		{"build/out.txt", false, true},
+		{"root-only.txt", false, true},
+		{"sub/root-only.txt", false, false},
+		{"src/main.go", false, false},
+		{"cmd/root.go", false, false},
+	} {
+		t.Run(d.path, func(t *testing.T) {
+			assert.Equal(t, d.ignored, ig.IsIgnored(d.path, d.isDir))
+		})
+	}
+}
+
+func Test_IgnoreChildOfIgnoredDirCannotBeReincluded(t *testing.T) {
+	cur, err := os.Getwd()
+	assert.NoError(t, err)
+	tempPath, err := ioutil.TempDir(cur, "")
+	assert.NoError(t, err)
+
+	t.Cleanup(func() {
+		os.RemoveAll(tempPath)
+	})
+
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(tempPath, "config"))
+
+	CreateFiles(t, tempPath, ".gitignore", "vendor/\n!vendor/keep.txt\n")
+
+	ig := GenerateIgnore(tempPath, filepath.Join(tempPath, ".git"))
+	assert.True(t, ig.IsIgnored("vendor/keep.txt", false))
+}
+
+//gitfileの先の.gitのinfo/excludeとcore.excludesFileを読む
+func Test_IgnoreGitFileAndExcludesFile(t *testing.T) {
+	cur, err := os.Getwd()
+	assert.NoError(t, err)
+	tempPath, err := ioutil.TempDir(cur, "")
+	assert.NoError(t, err)
+
+	t.Cleanup(func() {
+		os.RemoveAll(tempPath)
+	})
+
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(tempPath, "config"))
+	err = os.MkdirAll(filepath.Join(tempPath, "config", "git"), os.ModePerm)
+	assert.NoError(t, err)
+	CreateFiles(t, filepath.Join(tempPath, "config", "git"), "ignore", "*.swp\n")
+
+	var buf bytes.Buffer
+	storePath := filepath.Join(tempPath, "store.git")
+	err = gitInit(storePath, &buf)
+	assert.NoError(t, err)
+	err = os.MkdirAll(filepath.Join(storePath, "info"), os.ModePerm)
+	assert.NoError(t, err)
+	CreateFiles(t, filepath.Join(storePath, "info"), "exclude", "secret.txt\n")
+
+	workPath := filepath.Join(tempPath, "work")
+	err = os.MkdirAll(workPath, os.ModePerm)
+	assert.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(workPath, ".git"), []byte("gitdir: ../store.git\n"), 0644)
+	assert.NoError(t, err)
+
+	repo, err := DiscoverWorkTree(workPath)
+	assert.NoError(t, err)
+	assert.True(t, repo.w.IsIgnored("secret.txt", false))
+	assert.True(t, repo.w.IsIgnored("a.swp", false))
+	//一度作ったものを使い回す
+	assert.Same(t, repo.w.Ignore(), repo.w.Ignore())
+
+	//core.excludesFileがあればXDGの方は読まない
+	CreateFiles(t, tempPath, "excludes", "*.bak\n")
+	c, err := LoadConfig(repo)
+	assert.NoError(t, err)
+	c.Set("core", "", "excludesFile", filepath.Join(tempPath, "excludes"))
+	assert.NoError(t, c.Save())
+
+	repo, err = DiscoverWorkTree(workPath)
+	assert.NoError(t, err)
+	assert.True(t, repo.w.IsIgnored("a.bak", false))
+	assert.False(t, repo.w.IsIgnored("a.swp", false))
+	assert.True(t, repo.w.IsIgnored("secret.txt", false))
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"mygit/src/crypt"
 	data "mygit/src/database"
 	"os"
 	"path/filepath"
@@ -59,13 +60,66 @@ func gitInit(gitPath string, w io.Writer) error {
 	return nil
 }
 
-func StartInit(args []string, w io.Writer) error {
+type InitOption struct {
+	//作業ディレクトリを作らず、pathそのものをrepositoryにする
+	Bare bool
+	//sha1かsha256、空ならGIT_DEFAULT_HASH、それもなければsha1
+	ObjectFormat string
+}
+
+//sha1以外は本家と同じくrepositoryformatversion=1にしてextensions.objectFormatを書く
+func writeObjectFormat(gitPath string, h crypt.Hash) error {
+	if h == crypt.SHA1 {
+		return nil
+	}
+
+	c := data.GenerateConfig(filepath.Join(gitPath, "config"))
+	if err := c.Load(); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	c.Set("core", "", "repositoryformatversion", "1")
+	c.Set("extensions", "", "objectformat", h.Name())
+
+	return c.Save()
+}
+
+func StartInit(args []string, option *InitOption, w io.Writer) error {
 	rootPath, err := filepath.Abs(createInitPath(args))
 
 	if err != nil {
 		return err
 	}
 
+	format := option.ObjectFormat
+	if format == "" {
+		format = os.Getenv("GIT_DEFAULT_HASH")
+	}
+	h, err := crypt.HashByName(format)
+	if err != nil {
+		return err
+	}
+
+	if option.Bare {
+		//本家と同じくbareならpathがなければ作る
+		err = os.MkdirAll(rootPath, os.ModePerm)
+		if err != nil {
+			return err
+		}
+
+		err = gitInit(rootPath, w)
+		if err != nil {
+			return err
+		}
+
+		c := data.GenerateConfig(filepath.Join(rootPath, "config"))
+		c.Set("core", "", "bare", "true")
+		if err := c.Save(); err != nil {
+			return err
+		}
+
+		return writeObjectFormat(rootPath, h)
+	}
+
 	//存在しないpathでもエラーは出ないので、ここでエラーを出している
 	if _, err := os.Stat(rootPath); err != nil {
 		return err
@@ -79,6 +133,6 @@ func StartInit(args []string, w io.Writer) error {
 		return err
 	}
 
-	return nil
+	return writeObjectFormat(gitPath, h)
 
 }
@@ -1,7 +1,6 @@
 package src
 
 import (
-	"mygit/src/crypt"
 	data "mygit/src/database"
 	con "mygit/src/database/content"
 	"path/filepath"
@@ -87,7 +86,7 @@ func (in *Inspector) CompareIndextoWorkSpace(entry *con.Entry, stat con.FileStat
 
 	content := data.GetStoreHeaderContent(b)
 
-	objId := crypt.HexDigestBySha1(content)
+	objId := in.repo.Hash().HexDigest(content)
 
 	if entry.ObjId != objId {
 		//中身が変更されていたら
@@ -0,0 +1,23 @@
+// +build !windows
+
+package src
+
+import (
+	"os"
+	"syscall"
+)
+
+//filesystemの境界を越えてrepositoryを探さないためにdeviceを比べる
+func deviceOf(path string) (uint64, bool) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return 0, false
+	}
+
+	sys, ok := stat.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+
+	return uint64(sys.Dev), true
+}
@@ -7,22 +7,23 @@ import (
 	"io"
 	con "mygit/src/database/content"
 	er "mygit/src/errors"
-	"path/filepath"
 )
 
 type LogOption struct {
 	IsAbbrev bool
 	Format   string
 	Patch    bool
+	//--show-signature
+	ShowSignature bool
 }
 
 //optionのdecorationは後で実装,display patchも後で
 
 func StartLog(rootPath string, args []string, option *LogOption, w io.Writer) error {
-	gitPath := filepath.Join(rootPath, ".git")
-	dbPath := filepath.Join(gitPath, "objects")
-
-	repo := GenerateRepository(rootPath, gitPath, dbPath)
+	repo, err := DiscoverRepository(rootPath)
+	if err != nil {
+		return err
+	}
 
 	revList, err := GenerateRevList(repo, args)
 	if err != nil {
@@ -59,6 +60,11 @@ func AbbrObjId(objId string, repo *Repository, option *LogOption) string {
 
 func ShowCommitMedium(c *con.CommitFromMem, option *LogOption, repo *Repository, w io.Writer) error {
 	w.Write([]byte(fmt.Sprintf("commit %s\n", AbbrObjId(c.ObjId, repo, option))))
+	if option.ShowSignature {
+		if signature, ok := c.Signature(repo.Hash()); ok {
+			w.Write([]byte(repo.SignatureStatus(signature, c.Payload(), c.Committer.GetUnixTime()) + "\n"))
+		}
+	}
 	w.Write([]byte(fmt.Sprintf("Author: %s <%s>\n", c.Author.Name, c.Author.Email)))
 	w.Write([]byte(fmt.Sprintf("Date: %s\n", c.Author.ReadableTime())))
 	w.Write([]byte("\n"))
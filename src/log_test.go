@@ -32,7 +32,7 @@ func PrepareMultipleBranch(t *testing.T) func() {
 	is := []string{tempPath}
 
 	var buf bytes.Buffer
-	err = StartInit(is, &buf)
+	err = StartInit(is, &InitOption{}, &buf)
 	assert.NoError(t, err)
 	ss := []string{"."}
 	err = StartAdd(tempPath, "test", "test@example.com", "test", ss)
@@ -174,7 +174,7 @@ func PrepareUninteresting(t *testing.T) func() {
 	is := []string{tempPath}
 
 	var buf bytes.Buffer
-	err = StartInit(is, &buf)
+	err = StartInit(is, &InitOption{}, &buf)
 	assert.NoError(t, err)
 	ss := []string{"."}
 	err = StartAdd(tempPath, "test", "test@example.com", "test", ss)
@@ -454,7 +454,7 @@ func PrepareMergedFileTreeSame(t *testing.T) func() {
 	is := []string{tempPath}
 
 	var buf bytes.Buffer
-	err = StartInit(is, &buf)
+	err = StartInit(is, &InitOption{}, &buf)
 	assert.NoError(t, err)
 	ss := []string{"."}
 	err = StartAdd(tempPath, "test", "test@example.com", "test", ss)
@@ -5,7 +5,6 @@ import (
 	"io"
 	"mygit/src/database/lock"
 	ers "mygit/src/errors"
-	"path/filepath"
 )
 
 //leftが基本的にHEADでrightがマージする対象
@@ -77,7 +76,7 @@ func (m *Merge) ResolveMerge(w io.Writer) error {
 }
 
 func (m *Merge) CommitMerge(name, email, message string) error {
-	err := ProcessCommit([]string{m.leftObjId, m.rightObjId}, name, email, message, m.repo)
+	err := ProcessCommit([]string{m.leftObjId, m.rightObjId}, name, email, message, &CommitOption{}, m.repo)
 	if err != nil {
 		return err
 	}
@@ -133,7 +132,7 @@ func (m *Merge) HandleFastForward(w io.Writer) error {
 	}
 
 	//Headをupdate,HEAD -> refs/heads/masterなので、masterが指す先をrightObjIdにする
-	m.repo.r.UpdateHead(m.rightObjId)
+	m.repo.r.WithReason(fmt.Sprintf("merge %s: Fast-forward", m.rightName)).UpdateHead(m.rightObjId)
 
 	return nil
 
@@ -141,6 +140,7 @@ func (m *Merge) HandleFastForward(w io.Writer) error {
 
 var AlreadyMergedMessage = "Already up to date\n"
 var MergeFaildMessage = "Automatic merge failed: fix conflicts and then commit the result.\n"
+var NotPossibleFastForwardMessage = "fatal: Not possible to fast-forward, aborting.\n"
 
 func HandleContinue(pc *PendingCommit, mc MergeCommand, repo *Repository) error {
 	//conflict後マージを再開するとき
@@ -216,7 +216,7 @@ func HandleAbort(pc *PendingCommit, mc MergeCommand, repo *Repository) error {
 func RunMerge(mc MergeCommand, m *Merge, w io.Writer) error {
 
 	//3-wayMerge開始時にcommit中断用のファイルを作る
-	pc := GeneratePendingCommit(filepath.Join(mc.RootPath, ".git"))
+	pc := GeneratePendingCommit(m.repo.r.Path)
 
 	//--abortの時
 	if mc.Option.hasAbort {
@@ -237,7 +237,18 @@ func RunMerge(mc MergeCommand, m *Merge, w io.Writer) error {
 		return HandleInProgressMerge()
 	}
 
-	err := pc.Start(m.rightObjId, mc.Message, PENDING_MERGE_TYPE)
+	//merge.ff = onlyならfast-forwardできない時は何もせずに止める
+	cs, err := m.repo.Config()
+	if err != nil {
+		return err
+	}
+	if cs.MergeFF() == "only" && !m.AlreadyMerged() && !m.FastForward() {
+		return &ers.MergeFailOnConflictError{
+			Message: NotPossibleFastForwardMessage,
+		}
+	}
+
+	err = pc.Start(m.rightObjId, mc.Message, PENDING_MERGE_TYPE)
 	if err != nil {
 		return err
 	}
@@ -297,9 +308,14 @@ type MergeCommand struct {
 
 func StartMerge(mc MergeCommand, w io.Writer) error {
 
-	gitPath := filepath.Join(mc.RootPath, ".git")
-	dbPath := filepath.Join(gitPath, "objects")
-	repo := GenerateRepository(mc.RootPath, gitPath, dbPath)
+	repo, err := DiscoverWorkTree(mc.RootPath)
+	if err != nil {
+		return err
+	}
+	mc.Name, mc.Email, err = repo.Identity(mc.Name, mc.Email)
+	if err != nil {
+		return err
+	}
 
 	m, err := GenerateMerge("HEAD", mc.Args[0], repo)
 	if err != nil {
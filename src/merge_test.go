@@ -31,7 +31,7 @@ func PrepareMerge(t *testing.T) string {
 	is := []string{tempPath}
 
 	var buf bytes.Buffer
-	err = StartInit(is, &buf)
+	err = StartInit(is, &InitOption{}, &buf)
 	assert.NoError(t, err)
 	ss := []string{"."}
 	err = StartAdd(tempPath, "test", "test@example.com", "test", ss)
@@ -110,7 +110,7 @@ func PrepareNULLMerge(t *testing.T) string {
 	is := []string{tempPath}
 
 	var buf bytes.Buffer
-	err = StartInit(is, &buf)
+	err = StartInit(is, &InitOption{}, &buf)
 	assert.NoError(t, err)
 	ss := []string{"."}
 	err = StartAdd(tempPath, "test", "test@example.com", "test", ss)
@@ -186,7 +186,7 @@ func PrepareFastForwardMerge(t *testing.T) string {
 	is := []string{tempPath}
 
 	var buf bytes.Buffer
-	err = StartInit(is, &buf)
+	err = StartInit(is, &InitOption{}, &buf)
 	assert.NoError(t, err)
 	ss := []string{"."}
 	err = StartAdd(tempPath, "test", "test@example.com", "test", ss)
@@ -291,7 +291,7 @@ func PrepareSamePathConflictContent(t *testing.T) string {
 	is := []string{tempPath}
 
 	var buf bytes.Buffer
-	err = StartInit(is, &buf)
+	err = StartInit(is, &InitOption{}, &buf)
 	assert.NoError(t, err)
 	ss := []string{"."}
 	err = StartAdd(tempPath, "test", "test@example.com", "test", ss)
@@ -410,7 +410,7 @@ func PrepareSamePathConflictMod(t *testing.T) string {
 	is := []string{tempPath}
 
 	var buf bytes.Buffer
-	err = StartInit(is, &buf)
+	err = StartInit(is, &InitOption{}, &buf)
 	assert.NoError(t, err)
 	ss := []string{"."}
 	err = StartAdd(tempPath, "test", "test@example.com", "test", ss)
@@ -529,7 +529,7 @@ func PrepareFileDirConflict(t *testing.T) string {
 	is := []string{tempPath}
 
 	var buf bytes.Buffer
-	err = StartInit(is, &buf)
+	err = StartInit(is, &InitOption{}, &buf)
 	assert.NoError(t, err)
 	ss := []string{"."}
 	err = StartAdd(tempPath, "test", "test@example.com", "test", ss)
@@ -674,7 +674,7 @@ func PrepareBeforeConflictMerge(t *testing.T) string {
 	is := []string{tempPath}
 
 	var buf bytes.Buffer
-	err = StartInit(is, &buf)
+	err = StartInit(is, &InitOption{}, &buf)
 	assert.NoError(t, err)
 	ss := []string{"."}
 	err = StartAdd(tempPath, "test", "test@example.com", "test", ss)
@@ -974,10 +974,8 @@ func TestAbortAfterCommitWithAddingIndex(t *testing.T) {
 	str := string(b)
 	if diff := cmp.Diff(`<<<<<<< HEAD
 masterChanged
-
 =======
 test1Changed
-
 >>>>>>> test1
 `, str); diff != "" {
 		t.Errorf("diff is %s\n", diff)
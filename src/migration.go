@@ -28,6 +28,9 @@ type Migration struct {
 	Changes   map[string]map[string]*con.Entry
 	Conflicts map[string]map[string]struct{}
 	Inspector *Inspector
+	//sparse-checkoutの外にあって、作業ディレクトリには書かずにindexにだけ入れるentry
+	Skipped map[string]*con.Entry
+	Sparse  *SparseCheckout
 }
 
 func GenerateMigration(t *TreeDiff, repo *Repository) *Migration {
@@ -46,11 +49,18 @@ func GenerateMigration(t *TreeDiff, repo *Repository) *Migration {
 		Inspector: &Inspector{
 			repo: repo,
 		},
+		Skipped: make(map[string]*con.Entry),
 	}
 }
 
 func (m *Migration) ApplyChanges() error {
-	err := m.PlanChanges()
+	sparse, err := LoadSparseCheckout(m.repo)
+	if err != nil {
+		return err
+	}
+	m.Sparse = sparse
+
+	err = m.PlanChanges()
 	if err != nil {
 		return err
 	}
@@ -82,6 +92,13 @@ func (m *Migration) UpdateIndex() error {
 		}
 	}
 
+	for path, e := range m.Skipped {
+		err := AddSkipWorktree(path, e, m.repo)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 
 }
@@ -226,6 +243,9 @@ func (m *Migration) CheckForConflict(path string, oldEntry, newEntry *con.Entry)
 			m.Conflicts[errorType][path] = struct{}{}
 		}
 
+	} else if nonExist == nil && stat.IsDir() && m.repo.w.IsNestedRepository(path) {
+		//submoduleの中の変更はsubmoduleをcheckoutするときに調べる
+		return nil
 	} else if nonExist == nil && stat.IsDir() {
 		//workspaceに存在してDirの時
 		hasUntrackable, err := m.Inspector.IsTrackableFile(path, true)
@@ -248,7 +268,7 @@ func (m *Migration) UntrackedParent(path string) (string, error) {
 	for _, d := range util.ParentDirs(path, false) {
 		//treediffに存在するPathで、worksapaceに存在せず、その親もworkspaceに存在しない場合があるので、
 		//まずとってきた親候補が存在するかチェックする
-		stat, _ := os.Stat(filepath.Join(m.repo.w.Path, d))
+		stat, _ := os.Lstat(filepath.Join(m.repo.w.Path, d))
 
 		if stat == nil {
 			//親も存在しないなら
@@ -311,6 +331,15 @@ func (m *Migration) IndexDifferFromTrees(indexEntry, oldEntry, newEntry *con.Ent
 
 func (m *Migration) RecordChange(path string, oldItem, newItem *con.Entry) {
 
+	if newItem != nil && !m.Sparse.Includes(path) {
+		//作業ディレクトリには書かない、変更があって残していたファイルはここで消す
+		m.Skipped[path] = &con.Entry{Path: path, ObjId: newItem.ObjId, Mode: newItem.Mode}
+		if oldItem != nil {
+			m.Changes[MIGRATION_DELETE][path] = nil
+		}
+		return
+	}
+
 	var action string
 	if oldItem == nil {
 		//ここではpathの親も一気に入れる(既存のやつとは被らないようにする)
@@ -331,6 +360,10 @@ func (m *Migration) RecordChange(path string, oldItem, newItem *con.Entry) {
 				//自分は除く、pathの親のみ入れる
 				continue
 			}
+			//作業ディレクトリを残すsubmoduleの親directoryは消さない
+			if oldItem.IsGitlink() && m.repo.w.IsNestedRepository(path) {
+				break
+			}
 			m.Rmdirs[p] = struct{}{}
 		}
 		action = MIGRATION_DELETE
@@ -29,7 +29,7 @@ func PrepareCompareTwoCommit(t *testing.T) string {
 
 	is := []string{tempPath}
 	var buf bytes.Buffer
-	err = StartInit(is, &buf)
+	err = StartInit(is, &InitOption{}, &buf)
 	assert.NoError(t, err)
 	ss := []string{"."}
 	err = StartAdd(tempPath, "test", "test@example.com", "test", ss)
@@ -68,7 +68,7 @@ func PrepareCompareTwoCommitForMigartion(t *testing.T) string {
 
 	is := []string{tempPath}
 	var buf bytes.Buffer
-	err = StartInit(is, &buf)
+	err = StartInit(is, &InitOption{}, &buf)
 	assert.NoError(t, err)
 	ss := []string{"."}
 	err = StartAdd(tempPath, "test", "test@example.com", "test", ss)
@@ -153,7 +153,7 @@ func TestUntrackedOverWritten(t *testing.T) {
 
 	is := []string{tempPath}
 	var buf bytes.Buffer
-	err = StartInit(is, &buf)
+	err = StartInit(is, &InitOption{}, &buf)
 	assert.NoError(t, err)
 	ss := []string{"."}
 	err = StartAdd(tempPath, "test", "test@example.com", "test", ss)
@@ -213,7 +213,7 @@ func TestLocalChangeOverWritten(t *testing.T) {
 
 	is := []string{tempPath}
 	var buf bytes.Buffer
-	err = StartInit(is, &buf)
+	err = StartInit(is, &InitOption{}, &buf)
 	assert.NoError(t, err)
 	ss := []string{"."}
 	err = StartAdd(tempPath, "test", "test@example.com", "test", ss)
@@ -275,7 +275,7 @@ func TestUntrackedRemoved(t *testing.T) {
 
 	is := []string{tempPath}
 	var buf bytes.Buffer
-	err = StartInit(is, &buf)
+	err = StartInit(is, &InitOption{}, &buf)
 	assert.NoError(t, err)
 	ss := []string{"."}
 	err = StartAdd(tempPath, "test", "test@example.com", "test", ss)
@@ -335,7 +335,7 @@ func TestUpdatingFollowingDirectoriesLose(t *testing.T) {
 
 	is := []string{tempPath}
 	var buf bytes.Buffer
-	err = StartInit(is, &buf)
+	err = StartInit(is, &InitOption{}, &buf)
 	assert.NoError(t, err)
 	ss := []string{"."}
 	err = StartAdd(tempPath, "test", "test@example.com", "test", ss)
@@ -411,7 +411,7 @@ func PrepareParentUntracked(t *testing.T) string {
 
 	is := []string{tempPath}
 	var buf bytes.Buffer
-	err = StartInit(is, &buf)
+	err = StartInit(is, &InitOption{}, &buf)
 	assert.NoError(t, err)
 	ss := []string{"."}
 	err = StartAdd(tempPath, "test", "test@example.com", "test", ss)
@@ -0,0 +1,164 @@
+package src
+
+import "strings"
+
+//diff3のために行単位のMyersDiffを自前で実装する
+//diff表示の方はgotextdiffを使っているが、diff3では行番号同士の対応関係が欲しいので自分で持つ
+
+type EditType string
+
+const (
+	EDIT_EQL EditType = "="
+	EDIT_INS EditType = "+"
+	EDIT_DEL EditType = "-"
+)
+
+//Numberは1始まり(diff3で1始まりの行番号を使うので合わせる)
+type Line struct {
+	Number int
+	Text   string
+}
+
+//aLine,bLineはEQLなら両方、DELならaLineのみ、INSならbLineのみ
+type Edit struct {
+	Type  EditType
+	ALine *Line
+	BLine *Line
+}
+
+//改行は各行に残したまま分割する(joinしたときに元に戻るように)
+func SplitLines(content string) []string {
+	if content == "" {
+		return []string{}
+	}
+
+	lines := strings.SplitAfter(content, "\n")
+
+	//最後が改行で終わっているとき、SplitAfterは末尾に""を作るので取り除く
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+func toLines(texts []string) []*Line {
+	lines := make([]*Line, 0, len(texts))
+	for i, t := range texts {
+		lines = append(lines, &Line{Number: i + 1, Text: t})
+	}
+	return lines
+}
+
+func LineDiff(a, b string) []*Edit {
+	return MyersDiff(SplitLines(a), SplitLines(b))
+}
+
+func MyersDiff(a, b []string) []*Edit {
+	m := &Myers{
+		a: toLines(a),
+		b: toLines(b),
+	}
+
+	return m.Diff()
+}
+
+type Myers struct {
+	a []*Line
+	b []*Line
+}
+
+func (m *Myers) Diff() []*Edit {
+	var diff []*Edit
+
+	m.Backtrack(func(prevX, prevY, x, y int) {
+		if x == prevX {
+			diff = append(diff, &Edit{Type: EDIT_INS, BLine: m.b[prevY]})
+		} else if y == prevY {
+			diff = append(diff, &Edit{Type: EDIT_DEL, ALine: m.a[prevX]})
+		} else {
+			diff = append(diff, &Edit{Type: EDIT_EQL, ALine: m.a[prevX], BLine: m.b[prevY]})
+		}
+	})
+
+	//backtrackは末尾から辿るので反転する
+	for i, j := 0, len(diff)-1; i < j; i, j = i+1, j-1 {
+		diff[i], diff[j] = diff[j], diff[i]
+	}
+
+	return diff
+}
+
+//各dでのvの状態を保存しておき、あとでbacktrackに使う
+func (m *Myers) ShortestEdit() [][]int {
+	n, mLen := len(m.a), len(m.b)
+	max := n + mLen
+
+	v := make([]int, 2*max+2)
+	var trace [][]int
+
+	//vのindexは-max~maxなのでoffsetをかける
+	offset := max
+
+	for d := 0; d <= max; d++ {
+		snapshot := make([]int, len(v))
+		copy(snapshot, v)
+		trace = append(trace, snapshot)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+
+			y := x - k
+
+			for x < n && y < mLen && m.a[x].Text == m.b[y].Text {
+				x, y = x+1, y+1
+			}
+
+			v[offset+k] = x
+
+			if x >= n && y >= mLen {
+				return trace
+			}
+		}
+	}
+
+	return trace
+}
+
+func (m *Myers) Backtrack(fn func(prevX, prevY, x, y int)) {
+	x, y := len(m.a), len(m.b)
+	offset := len(m.a) + len(m.b)
+
+	trace := m.ShortestEdit()
+
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			fn(x-1, y-1, x, y)
+			x, y = x-1, y-1
+		}
+
+		if d > 0 {
+			fn(prevX, prevY, x, y)
+		}
+
+		x, y = prevX, prevY
+	}
+}
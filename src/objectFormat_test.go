@@ -0,0 +1,147 @@
+package src
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mygit/src/crypt"
+	data "mygit/src/database"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//以下のobjIdはgit 2.39で--object-formatを変えて同じ内容をcommitして得たもの
+//GIT_AUTHOR_DATE,GIT_COMMITTER_DATEはどちらも"1700000000 +0900"
+var objectFormatCases = []struct {
+	hash   crypt.Hash
+	commit string
+	tree   string
+	blob   string
+}{
+	{
+		hash:   crypt.SHA1,
+		commit: "1c79145c81dd8acbe1b4e579487a34458f3bcfc9",
+		tree:   "9b1324acd1489845e4e66192a57a2e46609372e3",
+		blob:   "ce013625030ba8dba906f756967f9e9ca394464a",
+	},
+	{
+		hash:   crypt.SHA256,
+		commit: "c0df368d4ea992f40138a133b1226fc4ac33d1996ba2c984829ee07b2a44b576",
+		tree:   "f3987a8ee35105d9b2279bf42239fd7cace93bf097d0f1596634e0518e1a619e",
+		blob:   "2cf8d83d9ee29543b34a87727421fdecb7e3f3a183d337639025de576db9ebb4",
+	},
+}
+
+func PrepareObjectFormatRepo(t *testing.T, h crypt.Hash) (string, *Repository) {
+	return PrepareRepoWithOption(t, &InitOption{ObjectFormat: h.Name()})
+}
+
+func TestObjectFormatCommit(t *testing.T) {
+	SetConfigHomeForTest(t)
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+	t.Setenv("GIT_AUTHOR_DATE", "1700000000 +0900")
+	t.Setenv("GIT_COMMITTER_DATE", "1700000000 +0900")
+
+	for _, tc := range objectFormatCases {
+		t.Run(tc.hash.Name(), func(t *testing.T) {
+			tempPath, repo := PrepareObjectFormatRepo(t, tc.hash)
+			var buf bytes.Buffer
+			assert.Equal(t, tc.hash, repo.Hash())
+
+			err := os.MkdirAll(filepath.Join(tempPath, "dir"), os.ModePerm)
+			assert.NoError(t, err)
+			CreateFiles(t, tempPath, "hello.txt", "hello\n")
+			CreateFiles(t, filepath.Join(tempPath, "dir"), "world.txt", "world\n")
+			err = StartAdd(tempPath, "test", "test@example.com", "", []string{"."})
+			assert.NoError(t, err)
+			err = StartCommit(tempPath, "test", "test@example.com", "first", &buf)
+			assert.NoError(t, err)
+
+			assert.Equal(t, tc.commit, ResolveForTest(t, "HEAD", repo))
+			assert.Equal(t, tc.tree, ReadCommitForTest(t, "HEAD", repo).Tree)
+
+			//indexのentryとchecksumも同じhashで読み直せる
+			err = repo.i.Load()
+			assert.NoError(t, err)
+			e, ok := repo.i.EntryForPath("hello.txt")
+			assert.True(t, ok)
+			assert.Equal(t, tc.blob, e.ObjId)
+
+			buf.Reset()
+			err = StartStatus(&buf, tempPath, false)
+			assert.NoError(t, err)
+			assert.Equal(t, "", buf.String())
+
+			//packにしても読める
+			err = StartRepack(tempPath, &RepackOption{DeleteLoose: true}, &buf)
+			assert.NoError(t, err)
+			repo.d.ResetPacks()
+			assert.Equal(t, tc.tree, ReadCommitForTest(t, "HEAD", repo).Tree)
+
+			//reflogの作成はすべて0のobjId
+			entries, err := data.ReadReflogFile(filepath.Join(repo.r.LogsPath(), "HEAD"))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.hash.ZeroObjId(), entries[0].OldObjId)
+		})
+	}
+}
+
+func TestObjectFormatTransport(t *testing.T) {
+	SetConfigHomeForTest(t)
+	srcPath, _ := PrepareObjectFormatRepo(t, crypt.SHA256)
+	var buf bytes.Buffer
+
+	CommitFileForTest(t, srcPath, "hello.txt", "hello\n", "first")
+
+	//cloneしたrepositoryはremoteと同じsha256になる
+	cur, err := os.Getwd()
+	assert.NoError(t, err)
+	clonePath, err := ioutil.TempDir(cur, "")
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(clonePath)
+	})
+	err = StartClone([]string{srcPath, clonePath}, &buf)
+	assert.NoError(t, err)
+
+	cloned, err := DiscoverRepository(clonePath)
+	assert.NoError(t, err)
+	assert.Equal(t, crypt.SHA256, cloned.Hash())
+	src, err := DiscoverRepository(srcPath)
+	assert.NoError(t, err)
+	assert.Equal(t, ResolveForTest(t, "HEAD", src), ResolveForTest(t, "HEAD", cloned))
+
+	//sha1のrepositoryにはfetchできない
+	sha1Path, sha1Repo := PrepareObjectFormatRepo(t, crypt.SHA1)
+	err = AddRemote(DEFAULT_REMOTE, srcPath, sha1Repo)
+	assert.NoError(t, err)
+	err = StartFetch(sha1Path, []string{DEFAULT_REMOTE}, &buf)
+	assert.ErrorIs(t, err, ErrorObjectFormatMismatch)
+}
+
+func TestUnknownObjectFormat(t *testing.T) {
+	cur, err := os.Getwd()
+	assert.NoError(t, err)
+	tempPath, err := ioutil.TempDir(cur, "")
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(tempPath)
+	})
+	var buf bytes.Buffer
+
+	err = StartInit([]string{tempPath}, &InitOption{ObjectFormat: "md5"}, &buf)
+	assert.ErrorIs(t, err, crypt.ErrorUnknownObjectFormat)
+
+	err = StartInit([]string{tempPath}, &InitOption{}, &buf)
+	assert.NoError(t, err)
+	c := data.GenerateConfig(filepath.Join(tempPath, ".git", "config"))
+	c.Set("extensions", "", "objectFormat", "md5")
+	err = c.Save()
+	assert.NoError(t, err)
+
+	_, err = DiscoverRepository(tempPath)
+	assert.ErrorIs(t, err, crypt.ErrorUnknownObjectFormat)
+}
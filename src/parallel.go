@@ -0,0 +1,68 @@
+package src
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+//statusで作業ディレクトリを調べるgoroutineの数、index.threadsがなければGOMAXPROCS
+func (repo *Repository) statusThreads() (int, error) {
+	cs, err := repo.Config()
+	if err != nil {
+		return 0, err
+	}
+	threads, err := cs.IndexThreads()
+	if err != nil {
+		return 0, err
+	}
+	if threads == 0 {
+		threads = runtime.GOMAXPROCS(0)
+	}
+	return threads, nil
+}
+
+//0からn-1までをthreads個のgoroutineでfnに渡す、結果はfnが自分の番号のところに書く
+//errorになったらそれ以降は始めず、番号の一番小さいerrorを返す
+func runParallel(n, threads int, fn func(int) error) error {
+	if threads <= 1 || n <= 1 {
+		for j := 0; j < n; j++ {
+			if err := fn(j); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if n < threads {
+		threads = n
+	}
+
+	errs := make([]error, n)
+	var next int64 = -1
+	var failed int32
+	var wg sync.WaitGroup
+	for t := 0; t < threads; t++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for atomic.LoadInt32(&failed) == 0 {
+				j := int(atomic.AddInt64(&next, 1))
+				if n <= j {
+					return
+				}
+				if err := fn(j); err != nil {
+					errs[j] = err
+					atomic.StoreInt32(&failed, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
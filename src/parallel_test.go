@@ -0,0 +1,122 @@
+package src
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunParallel(t *testing.T) {
+	for _, threads := range []int{0, 1, 4, 100} {
+		results := make([]int, 50)
+		var calls int64
+		err := runParallel(len(results), threads, func(n int) error {
+			atomic.AddInt64(&calls, 1)
+			results[n] = n * n
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(50), calls)
+		for n, r := range results {
+			assert.Equal(t, n*n, r)
+		}
+	}
+
+	//一番小さい番号のerrorを返す
+	errA := errors.New("a")
+	errB := errors.New("b")
+	err := runParallel(10, 4, func(n int) error {
+		switch n {
+		case 3:
+			time.Sleep(10 * time.Millisecond)
+			return errA
+		case 5:
+			return errB
+		}
+		return nil
+	})
+	assert.True(t, errors.Is(err, errA) || errors.Is(err, errB))
+	err = runParallel(10, 1, func(n int) error {
+		if n >= 3 {
+			return fmt.Errorf("%d", n)
+		}
+		return nil
+	})
+	assert.EqualError(t, err, "3")
+}
+
+//並列にしても1つずつ調べたときと同じ結果になる
+func TestStatusThreads(t *testing.T) {
+	SetConfigHomeForTest(t)
+	tempPath, repo := PrepareRebaseRepo(t)
+	var buf bytes.Buffer
+
+	for d := 0; d < 5; d++ {
+		dir := filepath.Join(tempPath, fmt.Sprintf("dir%d", d), "sub")
+		err := os.MkdirAll(dir, os.ModePerm)
+		assert.NoError(t, err)
+		for f := 0; f < 20; f++ {
+			CreateFiles(t, dir, fmt.Sprintf("file%02d.txt", f), fmt.Sprintf("%d-%d\n", d, f))
+		}
+	}
+	err := StartAdd(tempPath, "test", "test@example.com", "", []string{"."})
+	assert.NoError(t, err)
+	err = StartCommit(tempPath, "test", "test@example.com", "first", &buf)
+	assert.NoError(t, err)
+
+	//同じ大きさで中身が違うものはhashしないとわからない
+	time.Sleep(1 * time.Second)
+	for d := 0; d < 5; d++ {
+		dir := filepath.Join(tempPath, fmt.Sprintf("dir%d", d), "sub")
+		CreateFiles(t, dir, "file03.txt", fmt.Sprintf("%d-x\n", d))
+		CreateFiles(t, dir, "file07.txt", fmt.Sprintf("%d-7\n", d))
+		err = os.Remove(filepath.Join(dir, "file11.txt"))
+		assert.NoError(t, err)
+		CreateFiles(t, dir, "new.txt", "new\n")
+	}
+	err = os.MkdirAll(filepath.Join(tempPath, "untracked", "deep"), os.ModePerm)
+	assert.NoError(t, err)
+	CreateFiles(t, filepath.Join(tempPath, "untracked", "deep"), "u.txt", "u\n")
+
+	var outputs []string
+	var refreshed [][]int64
+	for _, threads := range []string{"1", "8"} {
+		err = StartConfig(tempPath, []string{"index.threads", threads}, &ConfigOption{}, &buf)
+		assert.NoError(t, err)
+
+		var out bytes.Buffer
+		repo.i = repo.i.Clear()
+		err = repo.i.Load()
+		assert.NoError(t, err)
+		s := GenerateStatus()
+		err = s.IntitializeStatus(repo)
+		assert.NoError(t, err)
+		err = s.WriteStatus(&out, false)
+		assert.NoError(t, err)
+		outputs = append(outputs, out.String())
+
+		//timeだけ変わったものはindexのstatを更新する
+		e, ok := repo.i.EntryForPath("dir2/sub/file07.txt")
+		assert.True(t, ok)
+		refreshed = append(refreshed, []int64{e.MTime, int64(len(s.Changed))})
+	}
+
+	assert.Equal(t, outputs[0], outputs[1])
+	assert.Equal(t, refreshed[0], refreshed[1])
+	assert.Contains(t, outputs[0], " M dir0/sub/file03.txt\n D dir0/sub/file11.txt\n")
+	assert.Contains(t, outputs[0], "?? dir4/sub/new.txt\n")
+	assert.Contains(t, outputs[0], "?? untracked/\n")
+	assert.NotContains(t, outputs[0], "file07.txt")
+
+	err = StartConfig(tempPath, []string{"index.threads", "-1"}, &ConfigOption{}, &buf)
+	assert.NoError(t, err)
+	err = StartStatus(&buf, tempPath, false)
+	assert.Error(t, err)
+}
@@ -38,7 +38,8 @@ func GeneratePathFilter() *PathFilter {
 //つまりdiffがa.txt,b.txt,c.txtとあってもpathでa.txtしかとらなければ、a.txtのDiffしか表示されなくする
 func (p *PathFilter) EachEntry(entries map[string]con.Object, fn func(k string, v con.Object) error) error {
 	for k, v := range entries {
-		if p.routes.Matched || p.routes.ChildrenHasKey(k) {
+		//kはrootからのpath、Trieはpathの要素ごとに持つ
+		if p.routes.Matched || p.routes.ChildrenHasKey(filepath.Base(k)) {
 			err := fn(k, v)
 			if err != nil {
 				return err
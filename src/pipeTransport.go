@@ -0,0 +1,243 @@
+package src
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mygit/src/crypt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+//ssh://host/pathやuser@host:pathのremoteには、sshなどのcommandを起動してremoteのupload-pack,receive-packとstdin/stdoutで話す
+//本家と同じくGIT_SSH_COMMAND、core.sshCommand、sshの順に使うcommandを決める
+//ListRefs,Fetch,Pushのたびにcommandを起動しなおす
+
+const (
+	SSH_URL_PREFIX      = "ssh://"
+	DEFAULT_SSH_COMMAND = "ssh"
+	REMOTE_UPLOAD_PACK  = "mgit upload-pack"
+	REMOTE_RECEIVE_PACK = "mgit receive-pack"
+)
+
+var ErrorRemoteHungUp = errors.New("the remote end hung up unexpectedly")
+
+type SSHURL struct {
+	//user@hostのままsshに渡す
+	Host string
+	Port string
+	Path string
+}
+
+//ssh://[user@]host[:port]/pathか、最初の:より前に/がない[user@]host:pathの形
+//本家と同じく-で始まるhostやportはsshのoptionとして解釈されてしまうのでsshのurlとしない
+func ParseSSHURL(url string) (*SSHURL, bool) {
+	u, ok := parseSSHURL(url)
+	if !ok || strings.HasPrefix(u.Host, "-") || strings.HasPrefix(u.Port, "-") {
+		return nil, false
+	}
+	return u, true
+}
+
+func parseSSHURL(url string) (*SSHURL, bool) {
+	if strings.HasPrefix(url, SSH_URL_PREFIX) {
+		hostPart, path, found := strings.Cut(strings.TrimPrefix(url, SSH_URL_PREFIX), "/")
+		if !found || hostPart == "" {
+			return nil, false
+		}
+
+		u := &SSHURL{
+			Host: hostPart,
+			Path: "/" + path,
+		}
+		if i := strings.LastIndex(hostPart, ":"); i >= 0 {
+			u.Host = hostPart[:i]
+			u.Port = hostPart[i+1:]
+		}
+		return u, true
+	}
+
+	if strings.Contains(url, "://") {
+		return nil, false
+	}
+
+	i := strings.Index(url, ":")
+	if i <= 0 || strings.Contains(url[:i], "/") {
+		return nil, false
+	}
+
+	return &SSHURL{
+		Host: url[:i],
+		Path: url[i+1:],
+	}, true
+}
+
+func SSHCommand(local *Repository) string {
+	if command := os.Getenv("GIT_SSH_COMMAND"); command != "" {
+		return command
+	}
+
+	if c, err := LoadConfig(local); err == nil {
+		if command, ok := c.Get("core", "", "sshCommand"); ok && command != "" {
+			return command
+		}
+	}
+
+	return DEFAULT_SSH_COMMAND
+}
+
+type PipeTransport struct {
+	url        string
+	sshCommand string
+	remote     *SSHURL
+	//広告のobject-format、ListRefsまではsha1
+	objectFormat crypt.Hash
+}
+
+func GeneratePipeTransport(url string, remote *SSHURL, sshCommand string) *PipeTransport {
+	return &PipeTransport{
+		url:          url,
+		sshCommand:   sshCommand,
+		remote:       remote,
+		objectFormat: crypt.SHA1,
+	}
+}
+
+//起動したcommandと、最初に送られてきたrefの広告
+type pipeConn struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	pr    *PktReader
+	refs  []*RemoteRef
+	caps  []string
+}
+
+func (t *PipeTransport) connect(program string) (*pipeConn, error) {
+	//remoteではshellが解釈するのでpathをquoteする
+	remoteCommand := fmt.Sprintf("%s %s", program, shellQuote(t.remote.Path))
+
+	args := []string{"-c", t.sshCommand + ` "$@"`, t.sshCommand}
+	if t.remote.Port != "" {
+		args = append(args, "-p", t.remote.Port)
+	}
+	//hostより後はoptionとして読ませない
+	args = append(args, "--", t.remote.Host, remoteCommand)
+
+	cmd := exec.Command("sh", args...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &pipeConn{
+		cmd:   cmd,
+		stdin: stdin,
+		pr:    GeneratePktReader(stdout),
+	}
+
+	c.refs, c.caps, err = readRefAdvertisement(c.pr)
+	if err != nil {
+		c.close()
+		if err == io.EOF {
+			return nil, fmt.Errorf("'%s' %w", t.url, ErrorRemoteHungUp)
+		}
+		return nil, err
+	}
+
+	return c, nil
+}
+
+//stdinを閉じて終わるのを待つ、stdoutは読み終えていること
+func (c *pipeConn) close() error {
+	c.stdin.Close()
+	return c.cmd.Wait()
+}
+
+func (t *PipeTransport) ListRefs() ([]*RemoteRef, error) {
+	c, err := t.connect(REMOTE_UPLOAD_PACK)
+	if err != nil {
+		return nil, err
+	}
+
+	//何もほしくないことをflushで伝える
+	WritePktFlush(c.stdin)
+	if err := c.close(); err != nil {
+		return nil, err
+	}
+
+	setHeadTarget(c.refs, c.caps)
+
+	t.objectFormat, err = remoteObjectFormat(c.caps)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.refs, nil
+}
+
+func (t *PipeTransport) ObjectFormat() crypt.Hash {
+	return t.objectFormat
+}
+
+func (t *PipeTransport) Fetch(wants []string, local *Repository) error {
+	c, err := t.connect(REMOTE_UPLOAD_PACK)
+	if err != nil {
+		return err
+	}
+
+	ok, err := writeFetchRequest(c.stdin, wants, local)
+	if err != nil {
+		c.close()
+		return err
+	}
+	if !ok {
+		WritePktFlush(c.stdin)
+		return c.close()
+	}
+
+	err = readFetchResponse(c.pr, local)
+	if err != nil {
+		c.close()
+		return err
+	}
+
+	return c.close()
+}
+
+func (t *PipeTransport) Push(updates []*RefUpdate, local *Repository) error {
+	c, err := t.connect(REMOTE_RECEIVE_PACK)
+	if err != nil {
+		return err
+	}
+
+	err = writePushRequest(c.stdin, updates, c.refs, local)
+	if err != nil {
+		c.close()
+		return err
+	}
+	c.stdin.Close()
+
+	err = readReportStatus(c.pr, updates)
+	if err != nil {
+		c.close()
+		return err
+	}
+
+	return c.close()
+}
+
+//'で囲み、中の'は'\”にする
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
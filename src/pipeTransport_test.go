@@ -0,0 +1,166 @@
+package src
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//GIT_SSH_COMMANDとしてこのtestのbinaryを起動し、sshのかわりにupload-pack,receive-packを動かす
+func TestPipeHelperProcess(t *testing.T) {
+	if os.Getenv("MYGIT_PIPE_HELPER") != "1" {
+		return
+	}
+
+	args := os.Args
+	for len(args) > 0 && args[0] != "--" {
+		args = args[1:]
+	}
+	//-- [-p port] -- host "mgit upload-pack '/path'"
+	remoteCommand := args[len(args)-1]
+
+	var err error
+	switch {
+	case strings.HasPrefix(remoteCommand, REMOTE_UPLOAD_PACK+" "):
+		path := strings.Trim(strings.TrimPrefix(remoteCommand, REMOTE_UPLOAD_PACK+" "), "'")
+		err = StartUploadPack(path, os.Stdin, os.Stdout)
+	case strings.HasPrefix(remoteCommand, REMOTE_RECEIVE_PACK+" "):
+		path := strings.Trim(strings.TrimPrefix(remoteCommand, REMOTE_RECEIVE_PACK+" "), "'")
+		err = StartReceivePack(path, os.Stdin, os.Stdout)
+	default:
+		err = ErrorUnknownService
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func SetPipeHelperForTest(t *testing.T) {
+	t.Setenv("MYGIT_PIPE_HELPER", "1")
+	t.Setenv("GIT_SSH_COMMAND", fmt.Sprintf("%s -test.run=^TestPipeHelperProcess$ --", os.Args[0]))
+}
+
+func TestParseSSHURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		ok   bool
+		host string
+		port string
+		path string
+	}{
+		{url: "ssh://git@example.com/srv/repo.git", ok: true, host: "git@example.com", path: "/srv/repo.git"},
+		{url: "ssh://example.com:2222/repo", ok: true, host: "example.com", port: "2222", path: "/repo"},
+		{url: "git@example.com:team/repo.git", ok: true, host: "git@example.com", path: "team/repo.git"},
+		{url: "/srv/repo.git", ok: false},
+		{url: "./dir:with/colon", ok: false},
+		{url: "file:///srv/repo.git", ok: false},
+		{url: "http://example.com/repo", ok: false},
+		{url: "ssh://-oProxyCommand=touch%20pwned/repo", ok: false},
+		{url: "ssh://example.com:-oProxyCommand=x/repo", ok: false},
+		{url: "-oProxyCommand=touch pwned:repo", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			u, ok := ParseSSHURL(tt.url)
+			assert.Equal(t, tt.ok, ok)
+			if ok {
+				assert.Equal(t, &SSHURL{Host: tt.host, Port: tt.port, Path: tt.path}, u)
+			}
+		})
+	}
+}
+
+func TestPipeCloneFetch(t *testing.T) {
+	SetPipeHelperForTest(t)
+	tempPath, originPath, origin := PrepareRemoteRepo(t)
+	var buf bytes.Buffer
+
+	CommitFileForTest(t, originPath, "hello.txt", "hello\n", "first")
+	err := os.MkdirAll(filepath.Join(originPath, "dir"), os.ModePerm)
+	assert.NoError(t, err)
+	CommitFileForTest(t, originPath, "dir/world.txt", "world\n", "second")
+
+	url := "localhost:" + originPath
+	clonePath := filepath.Join(tempPath, "clone")
+	err = StartClone([]string{url, clonePath}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "Cloning into 'clone'...\n", buf.String())
+
+	repo := OpenRepoForTest(clonePath)
+	originHead := ResolveForTest(t, "HEAD", origin)
+	assert.Equal(t, originHead, ResolveForTest(t, "HEAD", repo))
+	content, err := ioutil.ReadFile(filepath.Join(clonePath, "dir", "world.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "world\n", string(content))
+
+	c, err := LoadConfig(repo)
+	assert.NoError(t, err)
+	remoteURL, _ := c.Get(REMOTE_SECTION, DEFAULT_REMOTE, "url")
+	assert.Equal(t, url, remoteURL)
+
+	CommitFileForTest(t, originPath, "hello.txt", "hello again\n", "third")
+	newHead := ResolveForTest(t, "HEAD", origin)
+
+	buf.Reset()
+	err = StartFetch(clonePath, nil, &buf)
+	assert.NoError(t, err)
+	expected := fmt.Sprintf("From %s\n", url)
+	expected += fmt.Sprintf("   %-17s %-10s -> %s\n", fmt.Sprintf("%s..%s", ShortOid(originHead, repo.d), ShortOid(newHead, repo.d)), "master", "origin/master")
+	assert.Equal(t, expected, buf.String())
+
+	//もう一度fetchしても何も出ない
+	buf.Reset()
+	err = StartFetch(clonePath, nil, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "", buf.String())
+}
+
+func TestPipePushToBare(t *testing.T) {
+	SetPipeHelperForTest(t)
+	cur, err := os.Getwd()
+	assert.NoError(t, err)
+	tempPath, err := ioutil.TempDir(cur, "")
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(tempPath)
+	})
+
+	var buf bytes.Buffer
+	barePath := filepath.Join(tempPath, "shared.git")
+	err = gitInit(barePath, &buf)
+	assert.NoError(t, err)
+	url := "ssh://localhost" + barePath
+
+	alicePath := filepath.Join(tempPath, "alice")
+	err = StartClone([]string{url, alicePath}, &buf)
+	assert.NoError(t, err)
+	CommitFileForTest(t, alicePath, "hello.txt", "hello\n", "first")
+	aliceHead := ResolveForTest(t, "HEAD", OpenRepoForTest(alicePath))
+
+	buf.Reset()
+	err = StartPush(alicePath, nil, &PushOption{}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("To %s\n * %-17s master -> master\n", url, "[new branch]"), buf.String())
+	bare, _, err := OpenRepositoryAt(barePath)
+	assert.NoError(t, err)
+	assert.Equal(t, aliceHead, ResolveForTest(t, "refs/heads/master", bare))
+
+	buf.Reset()
+	err = StartPush(alicePath, []string{"origin", ":master"}, &PushOption{}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("To %s\n - %-17s master\n", url, "[deleted]"), buf.String())
+
+	//repositoryでないpathはremoteが終了する
+	_, err = RunFetch(&Remote{Name: "broken", URL: "localhost:" + filepath.Join(tempPath, "none")}, OpenRepoForTest(alicePath), &buf)
+	assert.ErrorIs(t, err, ErrorRemoteHungUp)
+}
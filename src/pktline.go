@@ -0,0 +1,74 @@
+package src
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+//本家のpkt-line、先頭4文字が自分を含めた長さの16進数、0000はflush
+//0001から0003は使わない(protocol v2のdelimなど)
+
+const (
+	PKT_MAX_DATA = 65516
+	PKT_FLUSH    = "0000"
+)
+
+var ErrorInvalidPktLine = errors.New("invalid pkt-line")
+
+func WritePktLine(w io.Writer, data string) error {
+	if len(data) > PKT_MAX_DATA {
+		return ErrorInvalidPktLine
+	}
+
+	_, err := fmt.Fprintf(w, "%04x%s", len(data)+4, data)
+	return err
+}
+
+func WritePktFlush(w io.Writer) error {
+	_, err := io.WriteString(w, PKT_FLUSH)
+	return err
+}
+
+type PktReader struct {
+	r io.Reader
+}
+
+func GeneratePktReader(r io.Reader) *PktReader {
+	return &PktReader{
+		r: r,
+	}
+}
+
+//flushならisFlush=true
+func (pr *PktReader) ReadLine() (string, bool, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(pr.r, header); err != nil {
+		return "", false, err
+	}
+
+	n, err := strconv.ParseUint(string(header), 16, 16)
+	if err != nil {
+		return "", false, ErrorInvalidPktLine
+	}
+
+	if n == 0 {
+		return "", true, nil
+	}
+	if n < 4 {
+		return "", false, ErrorInvalidPktLine
+	}
+
+	data := make([]byte, n-4)
+	if _, err := io.ReadFull(pr.r, data); err != nil {
+		return "", false, err
+	}
+
+	return string(data), false, nil
+}
+
+//pkt-lineの後に続くpackなどをそのまま読む
+func (pr *PktReader) Reader() io.Reader {
+	return pr.r
+}
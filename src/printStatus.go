@@ -6,6 +6,7 @@ import (
 	"io"
 	"mygit/src/database/util"
 	"reflect"
+	"strings"
 
 	u "mygit/util"
 )
@@ -17,6 +18,8 @@ const (
 	WORKSPACE_DELETE
 	WORKSPACE_MODIFIED
 	WORKSPACE_ADDED
+	INDEX_TYPECHANGE
+	WORKSPACE_TYPECHANGE
 )
 
 func (s *Status) WriteStatus(w io.Writer, isLong bool) error {
@@ -64,6 +67,7 @@ var (
 	LongAdded              = "new file:"
 	LongDeleted            = "deleted:"
 	LongModified           = "modified:"
+	LongTypeChange         = "typechange:"
 	LABELWIDTH             = 20
 	CONFLICT_LABELWIDTH    = 17
 	CommitStatusWorkSpace  = "no changes added to commit"
@@ -77,11 +81,13 @@ var Normal = ":normal"
 var Conflict = ":conflict"
 
 var LongStatus = map[[3]int]string{
-	{INDEX_DELETE}:       LongDeleted,
-	{INDEX_MODIFIED}:     LongModified,
-	{INDEX_ADDED}:        LongAdded,
-	{WORKSPACE_MODIFIED}: LongModified,
-	{WORKSPACE_ADDED}:    LongAdded,
+	{INDEX_DELETE}:         LongDeleted,
+	{INDEX_MODIFIED}:       LongModified,
+	{INDEX_ADDED}:          LongAdded,
+	{WORKSPACE_MODIFIED}:   LongModified,
+	{WORKSPACE_ADDED}:      LongAdded,
+	{INDEX_TYPECHANGE}:     LongTypeChange,
+	{WORKSPACE_TYPECHANGE}: LongTypeChange,
 }
 
 //sliceは比較不可なのでkeyにはできないがarrayならOK
@@ -151,10 +157,8 @@ func (s *Status) WriteLongStatus(w io.Writer) error {
 	if err != nil {
 		return err
 	}
-	err = s.GenerateChangesMessage(WorkSpaceChangeMessage, s.WorkSpaceChanges, w)
-	if err != nil {
-		return err
-	}
+	//submoduleは何が変わったかも出す
+	w.Write([]byte(GenerateChangesMessageForChangeSet(WorkSpaceChangeMessage, s.WorkSpaceChanges, s.Submodules)))
 	err = s.GenerateChangesMessage(UntrackFileMessage, s.Untracked, w)
 	if err != nil {
 		return err
@@ -193,7 +197,7 @@ func (s *Status) GenerateChangesMessage(message string, changeSet interface{}, w
 	case []string:
 		w.Write([]byte(GenerateChangesMessageForUntaracked(message, v)))
 	case map[string]int:
-		w.Write([]byte(GenerateChangesMessageForChangeSet(message, v)))
+		w.Write([]byte(GenerateChangesMessageForChangeSet(message, v, nil)))
 	case map[string][]int:
 		content, err := GenerateChangesMessageForConflicts(message, v)
 		if err != nil {
@@ -229,7 +233,8 @@ func GenerateChangesMessageForConflicts(message string, changeSet map[string][]i
 }
 
 //色とかless対応はまたあとで
-func GenerateChangesMessageForChangeSet(message string, changeSet map[string]int) string {
+//detailsはpathごとに後ろに括弧で付け足す説明
+func GenerateChangesMessageForChangeSet(message string, changeSet map[string]int, details map[string][]string) string {
 	if len(changeSet) == 0 {
 		return ""
 	}
@@ -243,6 +248,9 @@ func GenerateChangesMessageForChangeSet(message string, changeSet map[string]int
 	for _, k := range sortedKey {
 		status := GetStatusString(changeSet[k], true)
 		content += fmt.Sprintf("\t%s%s", status, k)
+		if d, ok := details[k]; ok {
+			content += fmt.Sprintf(" (%s)", strings.Join(d, ", "))
+		}
 	}
 
 	content += "\n"
@@ -329,6 +337,10 @@ func GetStatusString(status int, isLong bool) string {
 			return PaddingSpace(LongModified, LABELWIDTH)
 		case WORKSPACE_DELETE:
 			return PaddingSpace(LongDeleted, LABELWIDTH)
+		case WORKSPACE_ADDED:
+			return PaddingSpace(LongAdded, LABELWIDTH)
+		case INDEX_TYPECHANGE, WORKSPACE_TYPECHANGE:
+			return PaddingSpace(LongTypeChange, LABELWIDTH)
 		default:
 			return " "
 		}
@@ -344,6 +356,10 @@ func GetStatusString(status int, isLong bool) string {
 			return "M"
 		case WORKSPACE_DELETE:
 			return "D"
+		case WORKSPACE_ADDED:
+			return "A"
+		case INDEX_TYPECHANGE, WORKSPACE_TYPECHANGE:
+			return "T"
 		default:
 			return " "
 		}
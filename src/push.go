@@ -0,0 +1,279 @@
+package src
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+//localのrefをremoteに送る、refspecを省略したら今のbranchを同じ名前で送る
+//fast-forwardでない更新は--forceか+src:dstでないと拒否する
+
+type PushOption struct {
+	Force bool
+}
+
+var (
+	ErrorPushRejected     = errors.New("failed to push some refs")
+	ErrorPushDetachedHead = errors.New("You are not currently on a branch.")
+)
+
+func StartPush(rootPath string, args []string, option *PushOption, w io.Writer) error {
+	repo, err := DiscoverRepository(rootPath)
+	if err != nil {
+		return err
+	}
+
+	name := DEFAULT_REMOTE
+	if len(args) > 0 {
+		name = args[0]
+		args = args[1:]
+	}
+
+	remote, err := LoadRemote(name, repo)
+	if err != nil {
+		return err
+	}
+
+	return RunPush(remote, args, option, repo, w)
+}
+
+func RunPush(remote *Remote, specs []string, option *PushOption, repo *Repository, w io.Writer) error {
+	t, err := OpenTransport(remote.URL, repo)
+	if err != nil {
+		return err
+	}
+
+	refs, err := t.ListRefs()
+	if err != nil {
+		return err
+	}
+	if err := checkObjectFormat(t, repo); err != nil {
+		return err
+	}
+	remoteRefs := make(map[string]string)
+	for _, ref := range refs {
+		remoteRefs[ref.Name] = ref.ObjId
+	}
+
+	if len(specs) == 0 {
+		currentRef, err := repo.r.CurrentRef("HEAD")
+		if err != nil {
+			return err
+		}
+		if currentRef.IsHead() {
+			return ErrorPushDetachedHead
+		}
+		specs = []string{filepath.ToSlash(currentRef.Path)}
+	}
+
+	var updates []*RefUpdate
+	var srcNames []string
+	for _, spec := range specs {
+		u, src, err := planPush(spec, option, remoteRefs, repo)
+		if err != nil {
+			return err
+		}
+		updates = append(updates, u)
+		srcNames = append(srcNames, src)
+	}
+
+	//手元で判断できるnon-fast-forwardは送る前に弾く
+	var toSend []*RefUpdate
+	for _, u := range updates {
+		if u.OldObjId == u.NewObjId || u.Force || u.NewObjId == "" {
+			if u.OldObjId != u.NewObjId {
+				toSend = append(toSend, u)
+			}
+			continue
+		}
+
+		//本家と同じくremoteにすでにあるtagはforceでないと動かさない
+		if u.OldObjId != "" && isTagRef(u.Name) {
+			u.Reason = "already exists"
+			continue
+		}
+
+		if u.OldObjId != "" && !repo.d.HasObject(u.OldObjId) {
+			u.Reason = "fetch first"
+			continue
+		}
+
+		ff, err := IsFastForward(u.OldObjId, u.NewObjId, repo.d)
+		if err != nil {
+			return err
+		}
+		if !ff {
+			u.Reason = "non-fast-forward"
+			continue
+		}
+		toSend = append(toSend, u)
+	}
+
+	if len(toSend) > 0 {
+		err = t.Push(toSend, repo)
+		if err != nil {
+			return err
+		}
+	}
+
+	return reportPush(remote, updates, srcNames, repo, w)
+}
+
+//src:dst,+src:dst,:dst(削除),srcの形
+func planPush(spec string, option *PushOption, remoteRefs map[string]string, repo *Repository) (*RefUpdate, string, error) {
+	force := option.Force
+	if strings.HasPrefix(spec, "+") {
+		force = true
+		spec = spec[1:]
+	}
+
+	src, dst, found := strings.Cut(spec, ":")
+	if !found {
+		dst = src
+	}
+	if dst == "" {
+		return nil, "", ErrorInvalidRefspec
+	}
+
+	dst = expandPushDst(dst, src, repo)
+
+	u := &RefUpdate{
+		Name:     dst,
+		OldObjId: remoteRefs[dst],
+		Force:    force,
+	}
+
+	if src == "" {
+		return u, src, nil
+	}
+
+	objId, err := resolvePushSrc(src, repo)
+	if err != nil {
+		return nil, "", err
+	}
+	u.NewObjId = objId
+
+	return u, src, nil
+}
+
+//refの名前ならannotated tagをcommitにせず、tag objectのまま送る
+//それ以外はmaster~1のようなrevisionとして解く
+func resolvePushSrc(src string, repo *Repository) (string, error) {
+	if _, ok := repo.r.PathForName(src); ok {
+		return repo.r.ReadRef(src)
+	}
+
+	return resolveCommit(src, repo)
+}
+
+//masterはrefs/heads/master、tagの名前ならrefs/tags/xxxにする
+func expandPushDst(dst, src string, repo *Repository) string {
+	if strings.HasPrefix(dst, "refs/") {
+		return dst
+	}
+
+	srcName := src
+	if srcName == "" {
+		srcName = dst
+	}
+	if path, ok := repo.r.PathForName(srcName); ok {
+		if rel, err := filepath.Rel(repo.r.TagsPath(), path); err == nil && !strings.HasPrefix(rel, "..") {
+			return fmt.Sprintf("refs/tags/%s", dst)
+		}
+	}
+
+	return fmt.Sprintf("refs/heads/%s", dst)
+}
+
+func reportPush(remote *Remote, updates []*RefUpdate, srcNames []string, repo *Repository, w io.Writer) error {
+	var lines string
+	rejected := false
+	upToDate := true
+
+	for i, u := range updates {
+		src := ShortRefName(srcNames[i])
+		dst := ShortRefName(u.Name)
+
+		if u.Reason != "" {
+			rejected = true
+			upToDate = false
+			lines += fmt.Sprintf(" ! %-17s %s -> %s (%s)\n", "[rejected]", src, dst, u.Reason)
+			continue
+		}
+
+		if u.OldObjId == u.NewObjId {
+			continue
+		}
+		upToDate = false
+
+		switch {
+		case u.NewObjId == "":
+			lines += fmt.Sprintf(" - %-17s %s\n", "[deleted]", dst)
+		case u.OldObjId == "":
+			kind := "[new branch]"
+			if isTagRef(u.Name) {
+				kind = "[new tag]"
+			}
+			lines += fmt.Sprintf(" * %-17s %s -> %s\n", kind, src, dst)
+		default:
+			//tagはcommitとは限らないので辿らずに上書きとして出す
+			ff := false
+			if !isTagRef(u.Name) {
+				var err error
+				ff, err = IsFastForward(u.OldObjId, u.NewObjId, repo.d)
+				if err != nil {
+					return err
+				}
+			}
+			if ff {
+				lines += fmt.Sprintf("   %-17s %s -> %s\n", fmt.Sprintf("%s..%s", ShortOid(u.OldObjId, repo.d), ShortOid(u.NewObjId, repo.d)), src, dst)
+			} else {
+				lines += fmt.Sprintf(" + %-17s %s -> %s (forced update)\n", fmt.Sprintf("%s...%s", ShortOid(u.OldObjId, repo.d), ShortOid(u.NewObjId, repo.d)), src, dst)
+			}
+		}
+
+		err := updateTrackingRef(remote, u, repo)
+		if err != nil {
+			return err
+		}
+	}
+
+	if upToDate {
+		w.Write([]byte("Everything up-to-date\n"))
+		return nil
+	}
+
+	w.Write([]byte(fmt.Sprintf("To %s\n", remote.URL)))
+	w.Write([]byte(lines))
+
+	if rejected {
+		w.Write([]byte(fmt.Sprintf("error: failed to push some refs to '%s'\n", remote.URL)))
+		return ErrorPushRejected
+	}
+
+	return nil
+}
+
+//pushできたbranchはfetchしなくてもremote-tracking branchを合わせておく
+func updateTrackingRef(remote *Remote, u *RefUpdate, repo *Repository) error {
+	tracking, ok := remote.TrackingRef(u.Name)
+	if !ok {
+		return nil
+	}
+
+	if u.NewObjId == "" {
+		if _, err := repo.r.ReadRef(tracking); err != nil {
+			return nil
+		}
+		return repo.r.DeleteRef(tracking)
+	}
+
+	return repo.r.WithReason("update by push").UpdateRef(tracking, u.NewObjId)
+}
+
+func isTagRef(name string) bool {
+	return strings.HasPrefix(name, "refs/tags/")
+}
@@ -0,0 +1,475 @@
+package src
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	data "mygit/src/database"
+	con "mygit/src/database/content"
+	"mygit/src/database/lock"
+	ers "mygit/src/errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//rebaseはupstream..HEADのcommitをontoの上にcherryPickし直して、最後にbranchを動かす
+//pickの部分はcherryPickと同じくSequencerで行うので、conflictしても--continueで再開できる
+//branchを最後に動かすための情報はsequencerが消えても残るように.git/rebase-mergeに書く
+
+type RebaseOption struct {
+	Onto        string
+	Interactive bool
+	Continue    bool
+	Abort       bool
+	Quit        bool
+}
+
+type Rebase struct {
+	upstream string
+}
+
+var (
+	ErrorRebaseInProgress    = errors.New("It seems that there is already a rebase-merge directory")
+	ErrorNoRebaseInProgress  = errors.New("No rebase in progress?")
+	ErrorRebaseDirtyWorkTree = errors.New("cannot rebase: You have unstaged changes.")
+	ErrorRebaseUpstream      = errors.New("rebase requires upstream")
+)
+
+var DETACHED_HEAD_NAME = "detached HEAD"
+
+func (rb *Rebase) GetPendingType() PendingType {
+	return PEDING_CHERRY_PICK_TYPE
+}
+
+//upstream..HEADを古い順に積む、本家と同じくmerge commitは飛ばす
+func (rb *Rebase) StoreCommitToSeq(sd *SequenceData) error {
+	revlist, err := GenerateRevListWithWalk(true, sd.repo, []string{fmt.Sprintf("%s..%s", rb.upstream, sd.args[0])})
+	if err != nil {
+		return err
+	}
+
+	commitList, err := revlist.GetAllCommits()
+	if err != nil {
+		return err
+	}
+
+	for _, c := range CommitReverse(commitList) {
+		if len(c.Parents) > 1 {
+			continue
+		}
+		sd.seq.Push(PICK, c)
+	}
+
+	return nil
+}
+
+//cherryPickのcontinueと違い、元のcommitのmessageをそのまま使う
+//rebase -iではtodoの先頭に止まったコマンドが残っているので、それに合わせてcommitの作り方を変える
+func (rb *Rebase) ContinueWriteCommit(sd *SequenceData) error {
+	if sd.repo.i.IsConflicted() {
+		return HandleConflictedIndex()
+	}
+
+	command := peekToDo(sd.repo)
+
+	//conflictではなくeditかexecで止まっていた、reword,squashはmessageが空で止まっていた
+	if !sd.pc.InProgress() && command != nil {
+		switch command.Type {
+		case EDIT:
+			return AmendIfStaged(sd.repo)
+		case EXEC:
+			return nil
+		case REWORD:
+			return RewordHead(sd.repo)
+		case SQUASH:
+			return SquashIntoHead(command.Type, command.c, sd.repo)
+		}
+	}
+
+	headObjId, err := sd.repo.r.ReadHead()
+	if err != nil {
+		return err
+	}
+
+	pickObjId, err := sd.pc.GetMergeObjId(PEDING_CHERRY_PICK_TYPE)
+	if err != nil {
+		return err
+	}
+
+	o, err := LoadTypedObject(pickObjId, "commit", sd.repo)
+	if err != nil {
+		return err
+	}
+	c, _ := o.(*con.CommitFromMem)
+
+	if command != nil && (command.Type == SQUASH || command.Type == FIXUP) {
+		err = SquashIntoHead(command.Type, c, sd.repo)
+		if err != nil {
+			return err
+		}
+		return sd.pc.Clear(PEDING_CHERRY_PICK_TYPE)
+	}
+
+	pickedCommit, err := CreateCommitWithAuthor([]string{headObjId}, c.Author, c.Message, sd.repo)
+	if err != nil {
+		return err
+	}
+	err = WriteCommit(pickedCommit, sd.repo)
+	if err != nil {
+		return err
+	}
+
+	err = sd.pc.Clear(PEDING_CHERRY_PICK_TYPE)
+	if err != nil {
+		return err
+	}
+
+	//pickはできているので、messageが空で失敗したら次の--continueではrewordだけやり直す
+	if command != nil && command.Type == REWORD {
+		return RewordHead(sd.repo)
+	}
+
+	return nil
+}
+
+type RebaseState struct {
+	Path string
+}
+
+func GenerateRebaseState(repo *Repository) *RebaseState {
+	return &RebaseState{
+		Path: filepath.Join(repo.r.Path, "rebase-merge"),
+	}
+}
+
+func (rs *RebaseState) InProgress() bool {
+	stat, err := os.Stat(rs.Path)
+	return err == nil && stat.IsDir()
+}
+
+//head-name: refs/heads/xxx(detachedならdetached HEAD),onto: 移動先のobjId,orig-head: rebase前のobjId
+func (rs *RebaseState) Start(headName, onto, origHead string) error {
+	err := os.MkdirAll(rs.Path, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	for name, content := range map[string]string{
+		"head-name": headName,
+		"onto":      onto,
+		"orig-head": origHead,
+	} {
+		err := ioutil.WriteFile(filepath.Join(rs.Path, name), []byte(content+"\n"), 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (rs *RebaseState) Read(name string) (string, error) {
+	content, err := ioutil.ReadFile(filepath.Join(rs.Path, name))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(content)), nil
+}
+
+func (rs *RebaseState) Clear() error {
+	return os.RemoveAll(rs.Path)
+}
+
+func StartRebase(rootPath string, args []string, option *RebaseOption, w io.Writer) error {
+	repo, err := DiscoverWorkTree(rootPath)
+	if err != nil {
+		return err
+	}
+
+	seq := GenerateSequencer(repo)
+	pc := GeneratePendingCommit(repo.r.Path)
+	sd := GenerateSequenceData(args, seq, pc, repo, &SequenceOption{
+		hasContinue: option.Continue,
+		hasAbort:    option.Abort,
+		hasQuit:     option.Quit,
+	}, w)
+
+	return ers.HandleWillWriteError(RunRebase(sd, option), w)
+}
+
+func RunRebase(sd *SequenceData, option *RebaseOption) error {
+	rs := GenerateRebaseState(sd.repo)
+	rb := &Rebase{}
+
+	if option.Continue || option.Abort || option.Quit {
+		if !rs.InProgress() {
+			return ErrorNoRebaseInProgress
+		}
+	}
+
+	if option.Quit {
+		//HEADはdetachedのまま、状態ファイルだけ消す
+		err := HandleSequencingQuit(sd, rb)
+		if err != nil {
+			return err
+		}
+		return rs.Clear()
+	}
+
+	if option.Abort {
+		return AbortRebase(sd, rs, rb)
+	}
+
+	if option.Continue {
+		err := HandleSequencingContinue(sd, rb)
+		if err != nil {
+			return err
+		}
+		return FinishRebase(sd, rs)
+	}
+
+	if rs.InProgress() {
+		return ErrorRebaseInProgress
+	}
+
+	if len(sd.args) == 0 {
+		return ErrorRebaseUpstream
+	}
+	rb.upstream = sd.args[0]
+
+	onto := rb.upstream
+	if option.Onto != "" {
+		onto = option.Onto
+	}
+
+	ontoObjId, err := resolveCommit(onto, sd.repo)
+	if err != nil {
+		return err
+	}
+	upstreamObjId, err := resolveCommit(rb.upstream, sd.repo)
+	if err != nil {
+		return err
+	}
+
+	origHead, err := sd.repo.r.ReadHead()
+	if err != nil {
+		return err
+	}
+
+	currentRef, err := sd.repo.r.CurrentRef("HEAD")
+	if err != nil {
+		return err
+	}
+	headName := DETACHED_HEAD_NAME
+	if !currentRef.IsHead() {
+		headName = currentRef.Path
+	}
+
+	//ontoがすでにHEADの祖先でupstreamとの分岐点なら何もしない、-iはtodoを編集するので続ける
+	base, err := GetBCA(origHead, upstreamObjId, sd.repo.d)
+	if err != nil {
+		return err
+	}
+	if base == ontoObjId && !option.Interactive {
+		sd.w.Write([]byte(fmt.Sprintf("Current branch %s is up to date.\n", currentRef.ShortName())))
+		return nil
+	}
+
+	err = CheckRebaseWorkTree(sd.repo)
+	if err != nil {
+		return err
+	}
+
+	//HEADを動かした後にrangeを計算するので、HEAD^のような指定もobjIdにしておく
+	rb.upstream = upstreamObjId
+	sd.args = []string{origHead}
+
+	err = rs.Start(headName, ontoObjId, origHead)
+	if err != nil {
+		return err
+	}
+
+	err = sd.repo.r.UpdateRef(data.ORIG_HEAD, origHead)
+	if err != nil {
+		return err
+	}
+
+	//sequencer/headはabortで戻る先なのでrebase前のHEADを書く
+	err = sd.seq.Start()
+	if err != nil {
+		return err
+	}
+
+	l := lock.NewFileLock(sd.seq.GetToDoPath())
+	l.Lock()
+	defer l.Unlock()
+
+	err = rb.StoreCommitToSeq(sd)
+	if err != nil {
+		return err
+	}
+
+	//todoの編集はHEADを動かす前に行うので、errorや空のtodoなら状態ファイルを消すだけで元に戻る
+	if option.Interactive {
+		err = EditToDo(sd, ontoObjId, origHead)
+		if err == nil && len(sd.seq.Command) == 0 {
+			sd.w.Write([]byte(NothingToDoMessage))
+		}
+		if err != nil || len(sd.seq.Command) == 0 {
+			sd.seq.Clear()
+			rs.Clear()
+			return err
+		}
+	}
+
+	err = DetachHeadTo(ontoObjId, fmt.Sprintf("rebase (start): checkout %s", onto), sd.repo)
+	if err != nil {
+		return err
+	}
+
+	//HEADをontoに動かしたのでabort-safetyもontoにする
+	err = sd.seq.UpdateAbortSafetyLatest()
+	if err != nil {
+		return err
+	}
+
+	err = ResumeSeq(sd)
+	if err != nil {
+		return err
+	}
+
+	return FinishRebase(sd, rs)
+}
+
+func resolveCommit(name string, repo *Repository) (string, error) {
+	rev, err := ParseRev(name)
+	if err != nil {
+		return "", err
+	}
+
+	return ResolveRev(rev, repo)
+}
+
+//indexかworkspaceに変更があるとpickの途中で失うのでrebaseできない
+func CheckRebaseWorkTree(repo *Repository) error {
+	_, indexNonExist := os.Stat(repo.i.Path)
+
+	l := lock.NewFileLock(repo.i.Path)
+	l.Lock()
+	defer l.Unlock()
+
+	if indexNonExist == nil {
+		err := repo.i.Load()
+		if err != nil {
+			return err
+		}
+	}
+
+	s := GenerateStatus()
+	err := s.IntitializeStatus(repo)
+	if err != nil {
+		return err
+	}
+
+	if len(s.IndexChanges) != 0 || len(s.WorkSpaceChanges) != 0 || len(s.Conflicts) != 0 {
+		return ErrorRebaseDirtyWorkTree
+	}
+
+	return nil
+}
+
+//reset --hardしてHEADをobjIdにdetachする
+func DetachHeadTo(objId, reason string, repo *Repository) error {
+	l := lock.NewFileLock(repo.i.Path)
+	l.Lock()
+	defer l.Unlock()
+
+	err := HanldeHard(objId, repo)
+	if err != nil {
+		return err
+	}
+
+	err = repo.i.Write(repo.i.Path)
+	if err != nil {
+		return err
+	}
+
+	//objIdはbranchのファイルではないのでHEADにobjIdがそのまま書かれる
+	return repo.r.WithReason(reason).SetHead(objId, objId)
+}
+
+//pickが全部終わったらbranchを新しいHEADに動かしてHEADをbranchに戻す
+func FinishRebase(sd *SequenceData, rs *RebaseState) error {
+	headName, err := rs.Read("head-name")
+	if err != nil {
+		return err
+	}
+	onto, err := rs.Read("onto")
+	if err != nil {
+		return err
+	}
+
+	newHead, err := sd.repo.r.ReadHead()
+	if err != nil {
+		return err
+	}
+
+	if headName != DETACHED_HEAD_NAME {
+		err = sd.repo.r.WithReason(fmt.Sprintf("rebase (finish): %s onto %s", headName, onto)).UpdateRef(headName, newHead)
+		if err != nil {
+			return err
+		}
+
+		branch, err := filepath.Rel(sd.repo.r.HeadsPath(), filepath.Join(sd.repo.r.Path, headName))
+		if err != nil {
+			return err
+		}
+		err = sd.repo.r.WithReason(fmt.Sprintf("rebase (finish): returning to %s", headName)).SetHead(branch, newHead)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = rs.Clear()
+	if err != nil {
+		return err
+	}
+
+	sd.w.Write([]byte(fmt.Sprintf("Successfully rebased and updated %s.\n", headName)))
+
+	return nil
+}
+
+//sequencerのabortでrebase前のcommitまでreset --hardし、HEADをbranchに戻す
+func AbortRebase(sd *SequenceData, rs *RebaseState, rb *Rebase) error {
+	headName, err := rs.Read("head-name")
+	if err != nil {
+		return err
+	}
+	origHead, err := rs.Read("orig-head")
+	if err != nil {
+		return err
+	}
+
+	err = HandleSequencingAbort(sd, rb)
+	if err != nil {
+		return err
+	}
+
+	//branch自体はFinishRebaseまで動かしていないのでHEADをつなぎ直すだけでいい
+	if headName != DETACHED_HEAD_NAME {
+		branch, err := filepath.Rel(sd.repo.r.HeadsPath(), filepath.Join(sd.repo.r.Path, headName))
+		if err != nil {
+			return err
+		}
+		err = sd.repo.r.WithReason(fmt.Sprintf("rebase (abort): returning to %s", headName)).SetHead(branch, origHead)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rs.Clear()
+}
@@ -0,0 +1,361 @@
+package src
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	con "mygit/src/database/content"
+	ers "mygit/src/errors"
+)
+
+//rebase -iのtodoのコマンドごとの処理
+//pick以外もcherryPickと同じmergeの仕組みを使い、conflictしたら--continueで再開する
+
+var REBASE_TODO_HELP = `
+# Commands:
+# p, pick <commit> = use commit
+# r, reword <commit> = use commit, but edit the commit message
+# e, edit <commit> = use commit, but stop for amending
+# s, squash <commit> = use commit, but meld into previous commit
+# f, fixup <commit> = like "squash", but discard this commit's log message
+# x, exec <command> = run command (the rest of the line) using shell
+# d, drop <commit> = remove commit
+#
+# These lines can be re-ordered; they are executed from top to bottom.
+#
+# If you remove a line here THAT COMMIT WILL BE LOST.
+#
+# However, if you remove everything, the rebase will be aborted.
+#
+`
+
+var NothingToDoMessage = "Nothing to do\n"
+
+func commitEditMsgPath(repo *Repository) string {
+	return filepath.Join(repo.r.Path, "COMMIT_EDITMSG")
+}
+
+func readHeadCommit(repo *Repository) (*con.CommitFromMem, error) {
+	headObjId, err := repo.r.ReadHead()
+	if err != nil {
+		return nil, err
+	}
+
+	o, err := LoadTypedObject(headObjId, "commit", repo)
+	if err != nil {
+		return nil, err
+	}
+	c, _ := o.(*con.CommitFromMem)
+
+	return c, nil
+}
+
+//HEADのcommitを今のindexとmessageで作り直す(commit --amend相当)
+func AmendHead(message string, repo *Repository) error {
+	head, err := readHeadCommit(repo)
+	if err != nil {
+		return err
+	}
+
+	c, err := CreateCommitWithAuthor(head.Parents, head.Author, message, repo)
+	if err != nil {
+		return err
+	}
+
+	return FinishRunCommit(c, repo)
+}
+
+func RewordHead(repo *Repository) error {
+	head, err := readHeadCommit(repo)
+	if err != nil {
+		return err
+	}
+
+	message, err := EditMessage(commitEditMsgPath(repo), head.Message+"\n", repo)
+	if err != nil {
+		return err
+	}
+
+	return AmendHead(message, repo)
+}
+
+//squashは両方のmessageをeditorで編集、fixupは前のcommitのmessageだけ残す
+//squash,fixupが続く時はmessage-squashにそれまでのmessageを残し、何個目のcommitかを数える
+func SquashIntoHead(toDoType ToDoType, c *con.CommitFromMem, repo *Repository) error {
+	head, err := readHeadCommit(repo)
+	if err != nil {
+		return err
+	}
+
+	count, messages, err := readSquashMessage(repo)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		count = 1
+		messages = "# This is the 1st commit message:\n\n" + strings.TrimSpace(head.Message) + "\n"
+	}
+	count++
+
+	if toDoType == SQUASH {
+		messages += fmt.Sprintf("\n# This is the commit message #%d:\n\n", count)
+		messages += strings.TrimSpace(c.Message) + "\n"
+	} else {
+		messages += fmt.Sprintf("\n# The commit message #%d will be skipped:\n\n", count)
+		for _, line := range strings.Split(strings.TrimSpace(c.Message), "\n") {
+			messages += "# " + line + "\n"
+		}
+	}
+	str := fmt.Sprintf("# This is a combination of %d commits.\n", count) + messages
+
+	message := head.Message
+	if toDoType == SQUASH {
+		message, err = EditMessage(commitEditMsgPath(repo), str, repo)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = AmendHead(message, repo)
+	if err != nil {
+		return err
+	}
+
+	//amendできてから書く、空のmessageで止まった時にやり直しても二重に数えない
+	return ioutil.WriteFile(GenerateSequencer(repo).GetSquashMessagePath(), []byte(str), 0644)
+}
+
+//1行目の"# This is a combination of N commits."からNを読み、残りのmessageと返す
+func readSquashMessage(repo *Repository) (int, string, error) {
+	content, err := ioutil.ReadFile(GenerateSequencer(repo).GetSquashMessagePath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, "", nil
+		}
+		return 0, "", err
+	}
+
+	lines := strings.SplitN(string(content), "\n", 2)
+	var count int
+	if _, err := fmt.Sscanf(lines[0], "# This is a combination of %d commits.", &count); err != nil || len(lines) < 2 {
+		return 0, "", nil
+	}
+
+	return count, lines[1], nil
+}
+
+//squash,fixupの続きが途切れたらmessage-squashを消す
+func ResetSquashMessage(toDoType ToDoType, repo *Repository) error {
+	if toDoType == SQUASH || toDoType == FIXUP {
+		return nil
+	}
+
+	err := os.Remove(GenerateSequencer(repo).GetSquashMessagePath())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+//editorで空のmessageにされたらcommitせず、todoの先頭にコマンドを残して止まる
+//--continueでもう一度editorを開く
+func stopAtEmptyMessage(sd *SequenceData) error {
+	err := sd.seq.WriteToDo()
+	if err != nil {
+		return err
+	}
+
+	var str string
+	str += ErrorEmptyCommitMessage.Error() + "\n"
+	str += "You can fix the message, and then run\n\n"
+	str += "  mygit rebase --continue\n"
+
+	return &ers.SequenceStoppedError{
+		Message: str,
+	}
+}
+
+//editで止まった後に変更がaddされていればHEADに入れる
+func AmendIfStaged(repo *Repository) error {
+	head, err := readHeadCommit(repo)
+	if err != nil {
+		return err
+	}
+
+	t, err := CreateTree(repo)
+	if err != nil {
+		return err
+	}
+	StoreTree(t, repo)
+
+	if t.GetObjId() == head.Tree {
+		return nil
+	}
+
+	return AmendHead(head.Message, repo)
+}
+
+func RunReword(c *con.CommitFromMem, sd *SequenceData) error {
+	err := RunPick(c, sd)
+	if err != nil {
+		return err
+	}
+
+	err = RewordHead(sd.repo)
+	if errors.Is(err, ErrorEmptyCommitMessage) {
+		return stopAtEmptyMessage(sd)
+	}
+
+	return err
+}
+
+//editはpickしてから止まる、todoの先頭にeditを残しておき--continueの時にShiftで取り除く
+func RunEdit(c *con.CommitFromMem, sd *SequenceData) error {
+	err := RunPick(c, sd)
+	if err != nil {
+		return err
+	}
+
+	err = sd.seq.WriteToDo()
+	if err != nil {
+		return err
+	}
+
+	var str string
+	str += fmt.Sprintf("Stopped at %s... %s\n", ShortOid(c.ObjId, sd.repo.d), c.GetFirstLineMessage())
+	str += "You can amend the commit now, stage the changes with\n\n"
+	str += "  mygit add <paths>\n\n"
+	str += "Once you are satisfied with your changes, run\n\n"
+	str += "  mygit rebase --continue\n"
+
+	return &ers.SequenceStoppedError{
+		Message: str,
+	}
+}
+
+func RunSquash(command *CommandContent, sd *SequenceData) error {
+	m, err := GenerateCherryPickMerge(command.c, sd.repo)
+	if err != nil {
+		return err
+	}
+
+	if sd.pc.InProgress() {
+		return HandleInProgress(m)
+	}
+
+	err = m.ResolveMerge(sd.w)
+	if err != nil {
+		return err
+	}
+
+	if sd.repo.i.IsConflicted() {
+		return HandleConflict(command.c.Message, PEDING_CHERRY_PICK_TYPE, command.c, m, sd)
+	}
+
+	err = SquashIntoHead(command.Type, command.c, sd.repo)
+	if errors.Is(err, ErrorEmptyCommitMessage) {
+		return stopAtEmptyMessage(sd)
+	}
+
+	return err
+}
+
+//失敗したらtodoを残して止まる、--continueでexecの行は飛ばす
+func RunExec(command string, sd *SequenceData) error {
+	sd.w.Write([]byte(fmt.Sprintf("Executing: %s\n", command)))
+
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Dir = sd.repo.w.Path
+	cmd.Stdout = sd.w
+	cmd.Stderr = sd.w
+
+	if err := cmd.Run(); err == nil {
+		return nil
+	}
+
+	err := sd.seq.WriteToDo()
+	if err != nil {
+		return err
+	}
+
+	var str string
+	str += fmt.Sprintf("warning: execution failed: %s\n", command)
+	str += "You can fix the problem, and then run\n\n"
+	str += "  mygit rebase --continue\n"
+
+	return &ers.SequenceStoppedError{
+		Message: str,
+	}
+}
+
+//todoを書いてGIT_SEQUENCE_EDITORで編集させ、読み直す
+func EditToDo(sd *SequenceData, onto, origHead string) error {
+	err := sd.seq.WriteToDo()
+	if err != nil {
+		return err
+	}
+
+	help := fmt.Sprintf("\n# Rebase %s..%s onto %s (%d commands)\n", ShortOid(onto, sd.repo.d), ShortOid(origHead, sd.repo.d), ShortOid(onto, sd.repo.d), len(sd.seq.Command))
+	content, err := ioutil.ReadFile(sd.seq.GetToDoPath())
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(sd.seq.GetToDoPath(), append(content, []byte(help+REBASE_TODO_HELP)...), 0644)
+	if err != nil {
+		return err
+	}
+
+	err = LaunchEditor(SequenceEditor(sd.repo), sd.seq.GetToDoPath())
+	if err != nil {
+		return err
+	}
+
+	sd.seq.Command = nil
+	err = sd.seq.Load()
+	if err != nil {
+		return err
+	}
+
+	return ValidateToDo(sd.seq.Command)
+}
+
+//squash,fixupは前のcommitにまとめるので、その前にcommitを作るコマンドが必要
+func ValidateToDo(commands []*CommandContent) error {
+	hasCommit := false
+	for _, command := range commands {
+		switch command.Type {
+		case SQUASH, FIXUP:
+			if !hasCommit {
+				return &ers.InvalidToDoLineError{
+					Line:    command.line,
+					Content: command.text,
+					Reason:  fmt.Sprintf("cannot '%s' without a previous commit", command.Type),
+				}
+			}
+		case PICK, REWORD, EDIT:
+			hasCommit = true
+		}
+	}
+
+	return nil
+}
+
+//--continueの時にどのコマンドで止まっていたかを見る、sd.seqとは別に読むのでCommandが重複しない
+func peekToDo(repo *Repository) *CommandContent {
+	seq := GenerateSequencer(repo)
+	if !seq.IsExists(seq.GetToDoPath()) {
+		return nil
+	}
+
+	if err := seq.Load(); err != nil {
+		return nil
+	}
+
+	return seq.NextCommand()
+}
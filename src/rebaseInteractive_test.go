@@ -0,0 +1,272 @@
+package src
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	con "mygit/src/database/content"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//masterのAからtopicを作り、topicにC1,C2,C3を積んでおく
+func PrepareInteractiveRebaseRepo(t *testing.T) (string, *Repository) {
+	tempPath, repo := PrepareRebaseRepo(t)
+	var buf bytes.Buffer
+
+	CommitFileForTest(t, tempPath, "hello.txt", "hello\n", "A")
+	err := StartBranch(tempPath, []string{"topic"}, &BranchOption{}, &buf)
+	assert.NoError(t, err)
+	err = StartCheckout(tempPath, []string{"topic"}, &buf)
+	assert.NoError(t, err)
+	CommitFileForTest(t, tempPath, "topic1.txt", "topic1\n", "C1")
+	CommitFileForTest(t, tempPath, "topic2.txt", "topic2\n", "C2")
+	CommitFileForTest(t, tempPath, "topic3.txt", "topic3\n", "C3")
+
+	return tempPath, repo
+}
+
+//todoを渡した内容で上書きするscriptをGIT_SEQUENCE_EDITORにする
+func SetSequenceEditorForTest(t *testing.T, rootPath, todo string) {
+	script := filepath.Join(rootPath, ".git", "sequence-editor.sh")
+	err := ioutil.WriteFile(script, []byte(fmt.Sprintf("#!/bin/sh\ncat > \"$1\" <<'EOF'\n%sEOF\n", todo)), 0755)
+	assert.NoError(t, err)
+	t.Setenv("GIT_SEQUENCE_EDITOR", script)
+}
+
+func TestRebaseInteractiveRewordFixupDrop(t *testing.T) {
+	tempPath, repo := PrepareInteractiveRebaseRepo(t)
+	var buf bytes.Buffer
+
+	c1 := ResolveForTest(t, "topic~2", repo)
+	c2 := ResolveForTest(t, "topic~1", repo)
+	c3 := ResolveForTest(t, "topic", repo)
+	base := ResolveForTest(t, "master", repo)
+
+	SetSequenceEditorForTest(t, tempPath, fmt.Sprintf("reword %s C1\nf %s C2\n# comment\n\nd %s C3\n", c1, c2, c3))
+	t.Setenv("GIT_EDITOR", "echo Reworded >")
+
+	err := StartRebase(tempPath, []string{"master"}, &RebaseOption{Interactive: true}, &buf)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "Successfully rebased and updated refs/heads/topic.\n")
+
+	//C1のmessageを書き換え、C2をmessageなしでまとめ、C3は消える
+	head := ReadCommitForTest(t, "topic", repo)
+	assert.Equal(t, "Reworded", head.GetFirstLineMessage())
+	assert.Equal(t, []string{base}, head.Parents)
+
+	tree, err := repo.d.LoadTreeList(head.ObjId)
+	assert.NoError(t, err)
+	assert.Contains(t, tree, "topic1.txt")
+	assert.Contains(t, tree, "topic2.txt")
+	assert.NotContains(t, tree, "topic3.txt")
+
+	_, err = os.Stat(filepath.Join(tempPath, "topic3.txt"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRebaseInteractiveSquash(t *testing.T) {
+	tempPath, repo := PrepareInteractiveRebaseRepo(t)
+	var buf bytes.Buffer
+
+	c1 := ResolveForTest(t, "topic~2", repo)
+	c2 := ResolveForTest(t, "topic~1", repo)
+	c3 := ResolveForTest(t, "topic", repo)
+
+	//並べ替えもできる
+	SetSequenceEditorForTest(t, tempPath, fmt.Sprintf("pick %s C3\npick %s C1\nsquash %s C2\n", c3, c1, c2))
+	t.Setenv("GIT_EDITOR", "true")
+
+	err := StartRebase(tempPath, []string{"master"}, &RebaseOption{Interactive: true}, &buf)
+	assert.NoError(t, err)
+
+	head := ReadCommitForTest(t, "topic", repo)
+	assert.Equal(t, "C1\n\nC2", head.Message)
+
+	parent := ReadCommitForTest(t, "topic^", repo)
+	assert.Equal(t, "C3", parent.GetFirstLineMessage())
+}
+
+func TestRebaseInteractiveSquashChain(t *testing.T) {
+	tempPath, repo := PrepareInteractiveRebaseRepo(t)
+	var buf bytes.Buffer
+
+	c1 := ResolveForTest(t, "topic~2", repo)
+	c2 := ResolveForTest(t, "topic~1", repo)
+	c3 := ResolveForTest(t, "topic", repo)
+
+	//editorに渡されたmessageを残しておく
+	edited := filepath.Join(tempPath, ".git", "edited")
+	SetSequenceEditorForTest(t, tempPath, fmt.Sprintf("pick %s C1\nsquash %s C2\nsquash %s C3\n", c1, c2, c3))
+	t.Setenv("GIT_EDITOR", fmt.Sprintf("cp -f \"$1\" %s; true", edited))
+
+	err := StartRebase(tempPath, []string{"master"}, &RebaseOption{Interactive: true}, &buf)
+	assert.NoError(t, err)
+
+	content, err := ioutil.ReadFile(edited)
+	assert.NoError(t, err)
+	assert.Equal(t, "# This is a combination of 3 commits.\n# This is the 1st commit message:\n\nC1\n\n# This is the commit message #2:\n\nC2\n\n# This is the commit message #3:\n\nC3\n", string(content))
+
+	head := ReadCommitForTest(t, "topic", repo)
+	assert.Equal(t, "C1\n\nC2\n\nC3", head.Message)
+	assert.Equal(t, "A", ReadCommitForTest(t, "topic^", repo).GetFirstLineMessage())
+}
+
+//messageを空にするとcommitせずに止まり、--continueでeditorを開き直す
+func TestRebaseInteractiveEmptyMessage(t *testing.T) {
+	tempPath, repo := PrepareInteractiveRebaseRepo(t)
+	var buf bytes.Buffer
+
+	c1 := ResolveForTest(t, "topic~2", repo)
+	c2 := ResolveForTest(t, "topic~1", repo)
+	c3 := ResolveForTest(t, "topic", repo)
+
+	SetSequenceEditorForTest(t, tempPath, fmt.Sprintf("reword %s C1\npick %s C2\nsquash %s C3\n", c1, c2, c3))
+	t.Setenv("GIT_EDITOR", ": >")
+
+	err := StartRebase(tempPath, []string{"master"}, &RebaseOption{Interactive: true}, &buf)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "Aborting commit due to empty commit message.\n")
+	assert.True(t, GenerateRebaseState(repo).InProgress())
+	assert.Equal(t, "C1", ReadCommitForTest(t, "HEAD", repo).Message)
+
+	//C1のrewordだけ書き換え、続くsquashではまた空にする
+	t.Setenv("GIT_EDITOR", `f() { if grep -q '^C1$' "$1"; then echo Reworded > "$1"; else : > "$1"; fi; }; f`)
+	buf.Reset()
+	err = StartRebase(tempPath, nil, &RebaseOption{Continue: true}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "Reworded", ReadCommitForTest(t, "HEAD~1", repo).Message)
+
+	//squashでも同じく止まり、HEADはC2のまま
+	assert.Contains(t, buf.String(), "Aborting commit due to empty commit message.\n")
+	assert.Equal(t, "C2", ReadCommitForTest(t, "HEAD", repo).Message)
+
+	t.Setenv("GIT_EDITOR", "true")
+	buf.Reset()
+	err = StartRebase(tempPath, nil, &RebaseOption{Continue: true}, &buf)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "Successfully rebased and updated refs/heads/topic.\n")
+
+	head := ReadCommitForTest(t, "topic", repo)
+	assert.Equal(t, "C2\n\nC3", head.Message)
+	assert.Equal(t, "Reworded", ReadCommitForTest(t, "topic^", repo).Message)
+}
+
+func TestRebaseInteractiveExec(t *testing.T) {
+	tempPath, repo := PrepareInteractiveRebaseRepo(t)
+	var buf bytes.Buffer
+
+	c1 := ResolveForTest(t, "topic~2", repo)
+	c2 := ResolveForTest(t, "topic~1", repo)
+
+	SetSequenceEditorForTest(t, tempPath, fmt.Sprintf("pick %s C1\nexec echo ran > exec.out\nx false\npick %s C2\n", c1, c2))
+
+	err := StartRebase(tempPath, []string{"master"}, &RebaseOption{Interactive: true}, &buf)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "Executing: echo ran > exec.out\n")
+	assert.Contains(t, buf.String(), "warning: execution failed: false\n")
+
+	content, err := ioutil.ReadFile(filepath.Join(tempPath, "exec.out"))
+	assert.NoError(t, err)
+	assert.Equal(t, "ran\n", string(content))
+
+	//失敗したexecで止まっているので、HEADはC1のまま
+	assert.Equal(t, "C1", ReadCommitForTest(t, "HEAD", repo).GetFirstLineMessage())
+	assert.True(t, GenerateRebaseState(repo).InProgress())
+
+	buf.Reset()
+	err = StartRebase(tempPath, nil, &RebaseOption{Continue: true}, &buf)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "Successfully rebased and updated refs/heads/topic.\n")
+
+	head := ReadCommitForTest(t, "topic", repo)
+	assert.Equal(t, "C2", head.GetFirstLineMessage())
+	assert.Equal(t, "C1", ReadCommitForTest(t, "topic^", repo).GetFirstLineMessage())
+}
+
+func TestRebaseInteractiveEdit(t *testing.T) {
+	tempPath, repo := PrepareInteractiveRebaseRepo(t)
+	var buf bytes.Buffer
+
+	c1 := ResolveForTest(t, "topic~2", repo)
+	c2 := ResolveForTest(t, "topic~1", repo)
+
+	SetSequenceEditorForTest(t, tempPath, fmt.Sprintf("edit %s C1\npick %s C2\n", c1, c2))
+
+	err := StartRebase(tempPath, []string{"master"}, &RebaseOption{Interactive: true}, &buf)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), fmt.Sprintf("Stopped at %s... C1\n", ShortOid(c1, repo.d)))
+
+	//止まっている間に変更をaddしてcontinueするとC1に入る
+	CreateFiles(t, tempPath, "topic1.txt", "edited\n")
+	err = StartAdd(tempPath, "test", "test@example.com", "test", []string{"topic1.txt"})
+	assert.NoError(t, err)
+
+	buf.Reset()
+	err = StartRebase(tempPath, nil, &RebaseOption{Continue: true}, &buf)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "Successfully rebased and updated refs/heads/topic.\n")
+
+	edited := ReadCommitForTest(t, "topic^", repo)
+	assert.Equal(t, "C1", edited.GetFirstLineMessage())
+	tree, err := repo.d.LoadTreeList(edited.ObjId)
+	assert.NoError(t, err)
+	o, err := repo.d.ReadObject(tree["topic1.txt"].ObjId)
+	assert.NoError(t, err)
+	blob, _ := o.(*con.Blob)
+	assert.Equal(t, "edited\n", blob.Content)
+
+	assert.Equal(t, "C2", ReadCommitForTest(t, "topic", repo).GetFirstLineMessage())
+}
+
+func TestRebaseInteractiveInvalidToDo(t *testing.T) {
+	tempPath, repo := PrepareInteractiveRebaseRepo(t)
+	var buf bytes.Buffer
+
+	c1 := ResolveForTest(t, "topic~2", repo)
+	c2 := ResolveForTest(t, "topic~1", repo)
+	origHead := ResolveForTest(t, "topic", repo)
+
+	tests := []struct {
+		name   string
+		todo   string
+		expect string
+	}{
+		{
+			name:   "invalid command",
+			todo:   fmt.Sprintf("pick %s C1\nbogus %s C2\n", c1, c2),
+			expect: fmt.Sprintf("error: invalid line 2: bogus %s C2\nerror: invalid command 'bogus'\n", c2),
+		},
+		{
+			name:   "unknown commit",
+			todo:   "# header\npick zzzzzzz C1\n",
+			expect: "error: invalid line 2: pick zzzzzzz C1\nerror: could not parse 'zzzzzzz'\n",
+		},
+		{
+			name:   "squash first",
+			todo:   fmt.Sprintf("squash %s C1\n", c1),
+			expect: fmt.Sprintf("error: invalid line 1: squash %s C1\nerror: cannot 'squash' without a previous commit\n", c1),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			SetSequenceEditorForTest(t, tempPath, tt.todo)
+
+			err := StartRebase(tempPath, []string{"master"}, &RebaseOption{Interactive: true}, &buf)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expect, buf.String())
+
+			//HEADを動かす前に止まるので何も変わらない
+			assert.Equal(t, origHead, ResolveForTest(t, "HEAD", repo))
+			assert.False(t, GenerateRebaseState(repo).InProgress())
+			currentRef, err := repo.r.CurrentRef("HEAD")
+			assert.NoError(t, err)
+			assert.Equal(t, "topic", currentRef.ShortName())
+		})
+	}
+}
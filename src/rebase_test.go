@@ -0,0 +1,214 @@
+package src
+
+import (
+	"bytes"
+	"io/ioutil"
+	data "mygit/src/database"
+	con "mygit/src/database/content"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func PrepareRebaseRepo(t *testing.T) (string, *Repository) {
+	return PrepareRepoWithOption(t, &InitOption{})
+}
+
+//testの終わりに消えるdirectoryにoptionでinitする
+func PrepareRepoWithOption(t *testing.T, option *InitOption) (string, *Repository) {
+	cur, err := os.Getwd()
+	assert.NoError(t, err)
+	tempPath, err := ioutil.TempDir(cur, "")
+	assert.NoError(t, err)
+
+	t.Cleanup(func() {
+		os.RemoveAll(tempPath)
+	})
+
+	var buf bytes.Buffer
+	err = StartInit([]string{tempPath}, option, &buf)
+	assert.NoError(t, err)
+
+	gitPath := filepath.Join(tempPath, ".git")
+	return tempPath, GenerateRepository(tempPath, gitPath, filepath.Join(gitPath, "objects"))
+}
+
+func CommitFileForTest(t *testing.T, rootPath, name, content, message string) {
+	var buf bytes.Buffer
+	CreateFiles(t, rootPath, name, content)
+	err := StartAdd(rootPath, "test", "test@example.com", "test", []string{name})
+	assert.NoError(t, err)
+	err = StartCommit(rootPath, "test", "test@example.com", message, &buf)
+	assert.NoError(t, err)
+	//revListは時間順に並べるので同じ秒にならないようにする
+	time.Sleep(1 * time.Second)
+}
+
+func ReadCommitForTest(t *testing.T, name string, repo *Repository) *con.CommitFromMem {
+	o, err := LoadTypedObject(ResolveForTest(t, name, repo), "commit", repo)
+	assert.NoError(t, err)
+	c, _ := o.(*con.CommitFromMem)
+	return c
+}
+
+func TestRebase(t *testing.T) {
+	tempPath, repo := PrepareRebaseRepo(t)
+	var buf bytes.Buffer
+
+	CommitFileForTest(t, tempPath, "hello.txt", "hello\n", "A")
+	err := StartBranch(tempPath, []string{"topic"}, &BranchOption{}, &buf)
+	assert.NoError(t, err)
+	err = StartCheckout(tempPath, []string{"topic"}, &buf)
+	assert.NoError(t, err)
+	CommitFileForTest(t, tempPath, "topic1.txt", "topic1\n", "C1")
+	CommitFileForTest(t, tempPath, "topic2.txt", "topic2\n", "C2")
+	origHead := ResolveForTest(t, "HEAD", repo)
+	origC1 := ReadCommitForTest(t, "topic^", repo)
+
+	err = StartCheckout(tempPath, []string{"master"}, &buf)
+	assert.NoError(t, err)
+	CommitFileForTest(t, tempPath, "master.txt", "master\n", "B")
+	masterObjId := ResolveForTest(t, "master", repo)
+
+	err = StartCheckout(tempPath, []string{"topic"}, &buf)
+	assert.NoError(t, err)
+
+	buf.Reset()
+	err = StartRebase(tempPath, []string{"master"}, &RebaseOption{}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "Successfully rebased and updated refs/heads/topic.\n", buf.String())
+
+	//C1,C2がBの上に同じ順で乗る
+	c2 := ReadCommitForTest(t, "topic", repo)
+	assert.Equal(t, "C2", c2.GetFirstLineMessage())
+	c1 := ReadCommitForTest(t, "topic^", repo)
+	assert.Equal(t, "C1", c1.GetFirstLineMessage())
+	assert.Equal(t, []string{masterObjId}, c1.Parents)
+	//authorは日時も元のcommitのまま、committerは新しくなる
+	assert.Equal(t, origC1.Author, c1.Author)
+	assert.NotEqual(t, origC1.Committer.CreatedAt, c1.Committer.CreatedAt)
+
+	currentRef, err := repo.r.CurrentRef("HEAD")
+	assert.NoError(t, err)
+	assert.Equal(t, "refs/heads/topic", currentRef.Path)
+
+	for _, name := range []string{"hello.txt", "master.txt", "topic1.txt", "topic2.txt"} {
+		_, err := os.Stat(filepath.Join(tempPath, name))
+		assert.NoError(t, err)
+	}
+
+	orig, err := data.ReadRefFile(repo.r.OrigHeadPath())
+	assert.NoError(t, err)
+	assert.Equal(t, origHead, orig)
+	assert.False(t, GenerateRebaseState(repo).InProgress())
+
+	buf.Reset()
+	err = StartRebase(tempPath, []string{"master"}, &RebaseOption{}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "Current branch topic is up to date.\n", buf.String())
+}
+
+func prepareRebaseConflict(t *testing.T) (string, *Repository, string) {
+	tempPath, repo := PrepareRebaseRepo(t)
+	var buf bytes.Buffer
+
+	CommitFileForTest(t, tempPath, "hello.txt", "hello\n", "A")
+	err := StartBranch(tempPath, []string{"topic"}, &BranchOption{}, &buf)
+	assert.NoError(t, err)
+	CommitFileForTest(t, tempPath, "hello.txt", "master\n", "B")
+	err = StartCheckout(tempPath, []string{"topic"}, &buf)
+	assert.NoError(t, err)
+	CommitFileForTest(t, tempPath, "hello.txt", "topic\n", "C")
+	CommitFileForTest(t, tempPath, "topic.txt", "topic\n", "D")
+	origHead := ResolveForTest(t, "HEAD", repo)
+
+	buf.Reset()
+	err = StartRebase(tempPath, []string{"master"}, &RebaseOption{}, &buf)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "error: could not apply")
+	assert.True(t, GenerateRebaseState(repo).InProgress())
+
+	content, err := ioutil.ReadFile(filepath.Join(tempPath, "hello.txt"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "<<<<<<< HEAD\nmaster\n=======\ntopic\n")
+
+	return tempPath, repo, origHead
+}
+
+func TestRebaseContinue(t *testing.T) {
+	tempPath, repo, origHead := prepareRebaseConflict(t)
+	var buf bytes.Buffer
+	origC := ReadCommitForTest(t, origHead+"^", repo)
+
+	//indexを解消しないとcontinueできない
+	err := StartRebase(tempPath, []string{}, &RebaseOption{Continue: true}, &buf)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), CONFLICT_INDEXMESSAGE)
+
+	CreateFiles(t, tempPath, "hello.txt", "resolved\n")
+	err = StartAdd(tempPath, "test", "test@example.com", "test", []string{"hello.txt"})
+	assert.NoError(t, err)
+
+	buf.Reset()
+	err = StartRebase(tempPath, []string{}, &RebaseOption{Continue: true}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "Successfully rebased and updated refs/heads/topic.\n", buf.String())
+
+	d := ReadCommitForTest(t, "topic", repo)
+	assert.Equal(t, "D", d.GetFirstLineMessage())
+	c := ReadCommitForTest(t, "topic^", repo)
+	assert.Equal(t, "C", c.GetFirstLineMessage())
+	assert.Equal(t, []string{ResolveForTest(t, "master", repo)}, c.Parents)
+	//conflictを解消して作り直したcommitもauthorの日時は元のまま
+	assert.Equal(t, origC.Author, c.Author)
+
+	content, err := ioutil.ReadFile(filepath.Join(tempPath, "hello.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "resolved\n", string(content))
+	assert.False(t, GenerateRebaseState(repo).InProgress())
+}
+
+func TestRebaseAbort(t *testing.T) {
+	tempPath, repo, origHead := prepareRebaseConflict(t)
+	var buf bytes.Buffer
+
+	err := StartRebase(tempPath, []string{}, &RebaseOption{Abort: true}, &buf)
+	assert.NoError(t, err)
+
+	currentRef, err := repo.r.CurrentRef("HEAD")
+	assert.NoError(t, err)
+	assert.Equal(t, "refs/heads/topic", currentRef.Path)
+	assert.Equal(t, origHead, ResolveForTest(t, "HEAD", repo))
+
+	content, err := ioutil.ReadFile(filepath.Join(tempPath, "hello.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "topic\n", string(content))
+	assert.False(t, GenerateRebaseState(repo).InProgress())
+
+	err = StartRebase(tempPath, []string{}, &RebaseOption{Abort: true}, &buf)
+	assert.Equal(t, ErrorNoRebaseInProgress, err)
+}
+
+func TestRebaseOnto(t *testing.T) {
+	tempPath, repo := PrepareRebaseRepo(t)
+	var buf bytes.Buffer
+
+	CommitFileForTest(t, tempPath, "hello.txt", "hello\n", "A")
+	a := ResolveForTest(t, "HEAD", repo)
+	CommitFileForTest(t, tempPath, "b.txt", "b\n", "B")
+	CommitFileForTest(t, tempPath, "c.txt", "c\n", "C")
+
+	//Bだけを取り除く
+	err := StartRebase(tempPath, []string{"HEAD^"}, &RebaseOption{Onto: a}, &buf)
+	assert.NoError(t, err)
+
+	c := ReadCommitForTest(t, "master", repo)
+	assert.Equal(t, "C", c.GetFirstLineMessage())
+	assert.Equal(t, []string{a}, c.Parents)
+
+	_, err = os.Stat(filepath.Join(tempPath, "b.txt"))
+	assert.True(t, os.IsNotExist(err))
+}
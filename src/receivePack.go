@@ -0,0 +1,233 @@
+package src
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mygit/src/crypt"
+	"strings"
+)
+
+//本家のreceive-pack(pushされる側)とそれに話しかけるclient側
+//"old new ref"の命令をflushまで読み、削除だけでなければ続くpackを展開してからrefを更新する
+//report-statusを求められたら"unpack ok"とrefごとのok/ngを返す
+
+const RECEIVE_PACK_CAPS = "report-status delete-refs " + AGENT
+
+//mgit receive-pack <dir>、sshなどの先で起動されstdin/stdoutで話す
+func StartReceivePack(path string, r io.Reader, w io.Writer) error {
+	repo, bare, err := OpenRepositoryAt(path)
+	if err != nil {
+		return err
+	}
+
+	err = AdvertiseReceivePack(w, repo)
+	if err != nil {
+		return err
+	}
+
+	return ServeReceivePack(r, w, repo, bare)
+}
+
+func AdvertiseReceivePack(w io.Writer, repo *Repository) error {
+	refs, err := AdvertiseRefs(repo)
+	if err != nil {
+		return err
+	}
+
+	//pushではHEADは更新できないので広告しない
+	var advertised []*RemoteRef
+	for _, ref := range refs {
+		if ref.Name != "HEAD" {
+			advertised = append(advertised, ref)
+		}
+	}
+
+	return writeRefAdvertisement(w, advertised, RECEIVE_PACK_CAPS, repo.Hash())
+}
+
+func ServeReceivePack(r io.Reader, w io.Writer, repo *Repository, bare bool) error {
+	pr := GeneratePktReader(r)
+
+	var updates []*RefUpdate
+	reportStatus := false
+	hasPack := false
+	for {
+		line, isFlush, err := pr.ReadLine()
+		if err != nil {
+			return err
+		}
+		if isFlush {
+			break
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+		if body, capLine, found := strings.Cut(line, "\x00"); found {
+			line = body
+			for _, c := range strings.Fields(capLine) {
+				if c == "report-status" {
+					reportStatus = true
+				}
+			}
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return ErrorProtocol
+		}
+
+		u := &RefUpdate{
+			Name:     fields[2],
+			OldObjId: fromZeroObjId(fields[0]),
+			NewObjId: fromZeroObjId(fields[1]),
+		}
+		if u.NewObjId != "" {
+			hasPack = true
+		}
+		updates = append(updates, u)
+	}
+
+	if len(updates) == 0 {
+		return nil
+	}
+
+	unpackStatus := "ok"
+	if hasPack {
+		if _, err := repo.d.ReadPackStream(pr.Reader()); err != nil {
+			unpackStatus = err.Error()
+			for _, u := range updates {
+				u.Reason = "unpacker error"
+			}
+		}
+	}
+
+	if unpackStatus == "ok" {
+		if err := ReceiveRefUpdates(repo, bare, updates); err != nil {
+			return err
+		}
+	}
+
+	if !reportStatus {
+		return nil
+	}
+
+	if err := WritePktLine(w, fmt.Sprintf("unpack %s\n", unpackStatus)); err != nil {
+		return err
+	}
+	for _, u := range updates {
+		line := fmt.Sprintf("ok %s\n", u.Name)
+		if u.Reason != "" {
+			line = fmt.Sprintf("ng %s %s\n", u.Name, u.Reason)
+		}
+		if err := WritePktLine(w, line); err != nil {
+			return err
+		}
+	}
+
+	return WritePktFlush(w)
+}
+
+//"old new ref"の命令とflushのあとにpackを書く、相手が持っているcommitから辿れるobjectは送らない
+func writePushRequest(w io.Writer, updates []*RefUpdate, advertised []*RemoteRef, local *Repository) error {
+	var commons []string
+	for _, ref := range advertised {
+		if local.d.HasObject(ref.ObjId) {
+			commons = append(commons, ref.ObjId)
+		}
+	}
+	excludes, err := CollectMissingObjects(local, commons, func(string) bool { return false })
+	if err != nil {
+		return err
+	}
+	excluded := make(map[string]bool)
+	for _, objId := range excludes {
+		excluded[objId] = true
+	}
+
+	var body bytes.Buffer
+	var wants []string
+	for i, u := range updates {
+		line := fmt.Sprintf("%s %s %s", toZeroObjId(u.OldObjId, local.Hash()), toZeroObjId(u.NewObjId, local.Hash()), u.Name)
+		if i == 0 {
+			line += "\x00" + RECEIVE_PACK_CAPS
+		}
+		WritePktLine(&body, line+"\n")
+
+		if u.NewObjId != "" {
+			wants = append(wants, u.NewObjId)
+		}
+	}
+	WritePktFlush(&body)
+
+	if len(wants) > 0 {
+		objIds, err := CollectMissingObjects(local, wants, func(objId string) bool { return excluded[objId] })
+		if err != nil {
+			return err
+		}
+		err = local.d.WritePackStream(&body, objIds)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = w.Write(body.Bytes())
+	return err
+}
+
+//"unpack ok"のあとにrefごとの"ok ref"か"ng ref reason"が続く
+func readReportStatus(pr *PktReader, updates []*RefUpdate) error {
+	line, _, err := pr.ReadLine()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "unpack ") {
+		return ErrorProtocol
+	}
+
+	byName := make(map[string]*RefUpdate)
+	for _, u := range updates {
+		byName[u.Name] = u
+	}
+
+	for {
+		line, isFlush, err := pr.ReadLine()
+		if err != nil {
+			return err
+		}
+		if isFlush {
+			return nil
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+		if name, ok := strings.CutPrefix(line, "ok "); ok {
+			if u, ok := byName[name]; ok {
+				u.Reason = ""
+			}
+			continue
+		}
+		if rest, ok := strings.CutPrefix(line, "ng "); ok {
+			name, reason, _ := strings.Cut(rest, " ")
+			if u, ok := byName[name]; ok {
+				u.Reason = reason
+			}
+			continue
+		}
+
+		return ErrorProtocol
+	}
+}
+
+//sha1でもsha256でもすべて0なら作成か削除
+func fromZeroObjId(objId string) string {
+	if strings.Trim(objId, "0") == "" {
+		return ""
+	}
+	return objId
+}
+
+func toZeroObjId(objId string, h crypt.Hash) string {
+	if objId == "" {
+		return h.ZeroObjId()
+	}
+	return objId
+}
@@ -0,0 +1,37 @@
+package src
+
+import (
+	"fmt"
+	"io"
+)
+
+//mgit reflog [ref]、新しい順に<shortObjId> <ref>@{n}: messageを出す
+func StartReflog(rootPath string, args []string, w io.Writer) error {
+	repo, err := DiscoverRepository(rootPath)
+	if err != nil {
+		return err
+	}
+
+	name := "HEAD"
+	//本家と同じくreflog show xxxの形も受け付ける
+	if len(args) > 0 && args[0] == "show" {
+		args = args[1:]
+	}
+	if len(args) > 0 {
+		name = args[0]
+	}
+	if alias, ok := aliasMap[name]; ok {
+		name = alias
+	}
+
+	entries, err := repo.r.ReadReflog(name)
+	if err != nil {
+		return err
+	}
+
+	for i, e := range entries {
+		w.Write([]byte(fmt.Sprintf("%s %s@{%d}: %s\n", ShortOid(e.NewObjId, repo.d), name, i, e.Message)))
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package src
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReflog(t *testing.T) {
+	tempPath, repo := PrepareTagRepo(t)
+	var buf bytes.Buffer
+
+	second, err := repo.r.ReadHead()
+	assert.NoError(t, err)
+	first := ResolveForTest(t, "HEAD^", repo)
+
+	err = StartBranch(tempPath, []string{"topic", "HEAD^"}, &BranchOption{}, &buf)
+	assert.NoError(t, err)
+	buf.Reset()
+	err = StartCheckout(tempPath, []string{"topic"}, &buf)
+	assert.NoError(t, err)
+
+	res := &Reset{Args: []string{"master"}, repo: repo, Option: &ResetOption{hasHard: true}}
+	err = RunReset(res)
+	assert.NoError(t, err)
+
+	buf.Reset()
+	err = StartReflog(tempPath, []string{}, &buf)
+	assert.NoError(t, err)
+	short := func(objId string) string {
+		return ShortOid(objId, repo.d)
+	}
+	expected := fmt.Sprintf("%s HEAD@{0}: reset: moving to master\n", short(second)) +
+		fmt.Sprintf("%s HEAD@{1}: checkout: moving from master to topic\n", short(first)) +
+		fmt.Sprintf("%s HEAD@{2}: commit: commit2\n", short(second)) +
+		fmt.Sprintf("%s HEAD@{3}: commit (initial): commit1\n", short(first))
+	assert.Equal(t, expected, buf.String())
+
+	buf.Reset()
+	err = StartReflog(tempPath, []string{"show", "topic"}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("%s topic@{0}: reset: moving to master\n%s topic@{1}: branch: Created from HEAD^\n", short(second), short(first)), buf.String())
+
+	assert.Equal(t, first, ResolveForTest(t, "HEAD@{1}", repo))
+	assert.Equal(t, first, ResolveForTest(t, "topic@{1}", repo))
+	assert.Equal(t, first, ResolveForTest(t, "master@{0}^", repo))
+
+	rev, err := ParseRev("HEAD@{10}")
+	assert.NoError(t, err)
+	_, err = ResolveRev(rev, repo)
+	assert.Equal(t, ErrorReflogEntryNotFound, err)
+
+	//@{n}はHEADではなく今のbranch(topic)のreflogを見る
+	assert.Equal(t, second, ResolveForTest(t, "HEAD@{2}", repo))
+	assert.Equal(t, first, ResolveForTest(t, "@{1}", repo))
+	rev, err = ParseRev("@{2}")
+	assert.NoError(t, err)
+	_, err = ResolveRev(rev, repo)
+	assert.Equal(t, ErrorReflogEntryNotFound, err)
+
+	//branchを消したらlogも消える
+	err = StartCheckout(tempPath, []string{"master"}, &buf)
+	assert.NoError(t, err)
+	err = StartBranch(tempPath, []string{"topic"}, &BranchOption{HasD: true, HasF: true}, &buf)
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(repo.r.LogsPath(), "refs", "heads", "topic"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,316 @@
+package src
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	data "mygit/src/database"
+	"mygit/src/database/util"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+//remoteは.git/configの[remote "name"]に持つ
+//fetchしたbranchはrefs/remotes/<name>/*にremote-tracking branchとして置く
+
+type Remote struct {
+	Name  string
+	URL   string
+	Fetch []*Refspec
+}
+
+type RemoteOption struct {
+	Verbose bool
+}
+
+var (
+	ErrorRemoteAlreadyExists = errors.New("remote already exists")
+	ErrorNoSuchRemote        = errors.New("no such remote")
+	ErrorUnknownRemoteCmd    = errors.New("unknown remote subcommand")
+	ErrorInvalidRefspec      = errors.New("invalid refspec")
+)
+
+const (
+	DEFAULT_REMOTE = "origin"
+	REMOTE_SECTION = "remote"
+	BRANCH_SECTION = "branch"
+)
+
+func ConfigPath(repo *Repository) string {
+	return filepath.Join(repo.r.Path, "config")
+}
+
+func LoadConfig(repo *Repository) (*data.Config, error) {
+	c := data.GenerateConfig(ConfigPath(repo))
+	err := c.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+//+src:dstの形、srcとdstの末尾の*でglobできる
+type Refspec struct {
+	Force bool
+	Src   string
+	Dst   string
+}
+
+func ParseRefspec(spec string) (*Refspec, error) {
+	r := &Refspec{}
+	if strings.HasPrefix(spec, "+") {
+		r.Force = true
+		spec = spec[1:]
+	}
+
+	src, dst, found := strings.Cut(spec, ":")
+	if !found {
+		dst = src
+	}
+	r.Src = src
+	r.Dst = dst
+
+	if strings.Count(src, "*") > 1 || strings.Count(dst, "*") > 1 || strings.Contains(src, "*") != strings.Contains(dst, "*") {
+		return nil, ErrorInvalidRefspec
+	}
+
+	return r, nil
+}
+
+func (r *Refspec) ToString() string {
+	force := ""
+	if r.Force {
+		force = "+"
+	}
+
+	return fmt.Sprintf("%s%s:%s", force, r.Src, r.Dst)
+}
+
+//refがsrcに当てはまればdstの名前を返す
+func (r *Refspec) Match(ref string) (string, bool) {
+	if !strings.Contains(r.Src, "*") {
+		return r.Dst, ref == r.Src
+	}
+
+	prefix, suffix, _ := strings.Cut(r.Src, "*")
+	if !strings.HasPrefix(ref, prefix) || !strings.HasSuffix(ref, suffix) || len(ref) < len(prefix)+len(suffix) {
+		return "", false
+	}
+
+	matched := ref[len(prefix) : len(ref)-len(suffix)]
+	return strings.Replace(r.Dst, "*", matched, 1), true
+}
+
+func DefaultFetchRefspec(name string) *Refspec {
+	return &Refspec{
+		Force: true,
+		Src:   "refs/heads/*",
+		Dst:   fmt.Sprintf("refs/remotes/%s/*", name),
+	}
+}
+
+func LoadRemote(name string, repo *Repository) (*Remote, error) {
+	c, err := LoadConfig(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	url, ok := c.Get(REMOTE_SECTION, name, "url")
+	if !ok {
+		return nil, ErrorNoSuchRemote
+	}
+
+	remote := &Remote{
+		Name: name,
+		URL:  url,
+	}
+
+	for _, spec := range c.GetAll(REMOTE_SECTION, name, "fetch") {
+		r, err := ParseRefspec(spec)
+		if err != nil {
+			return nil, err
+		}
+		remote.Fetch = append(remote.Fetch, r)
+	}
+
+	return remote, nil
+}
+
+//refs/remotes/origin/HEAD、remoteのdefault branchを指す
+func (r *Remote) TrackingHeadName() string {
+	return fmt.Sprintf("refs/remotes/%s/HEAD", r.Name)
+}
+
+//remote-tracking branchへのmappingがあれば返す、pushした後に更新するのに使う
+func (r *Remote) TrackingRef(ref string) (string, bool) {
+	for _, spec := range r.Fetch {
+		if dst, ok := spec.Match(ref); ok {
+			return dst, true
+		}
+	}
+
+	return "", false
+}
+
+func AddRemote(name, url string, repo *Repository) error {
+	err := data.CheckValidRef(name)
+	if err != nil {
+		return err
+	}
+
+	c, err := LoadConfig(repo)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := c.Get(REMOTE_SECTION, name, "url"); ok {
+		return ErrorRemoteAlreadyExists
+	}
+
+	c.Set(REMOTE_SECTION, name, "url", url)
+	c.Add(REMOTE_SECTION, name, "fetch", DefaultFetchRefspec(name).ToString())
+
+	return c.Save()
+}
+
+//configとremote-tracking branch、そのremoteをupstreamにしているbranchの設定を消す
+func RemoveRemote(name string, repo *Repository) error {
+	c, err := LoadConfig(repo)
+	if err != nil {
+		return err
+	}
+
+	if !c.RemoveSection(REMOTE_SECTION, name) {
+		return ErrorNoSuchRemote
+	}
+
+	for _, branch := range c.Subsections(BRANCH_SECTION) {
+		if remote, ok := c.Get(BRANCH_SECTION, branch, "remote"); ok && remote == name {
+			c.Unset(BRANCH_SECTION, branch, "remote")
+			c.Unset(BRANCH_SECTION, branch, "merge")
+		}
+	}
+
+	err = c.Save()
+	if err != nil {
+		return err
+	}
+
+	remoteRefsPath := filepath.Join(repo.r.RemotesPath(), name)
+	if _, err := os.Stat(remoteRefsPath); err != nil {
+		return nil
+	}
+
+	err = os.RemoveAll(remoteRefsPath)
+	if err != nil {
+		return err
+	}
+
+	return os.RemoveAll(filepath.Join(repo.r.LogsPath(), "refs", "remotes", name))
+}
+
+func ListRemotes(repo *Repository) ([]*Remote, error) {
+	c, err := LoadConfig(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	var remotes []*Remote
+	for _, name := range c.Subsections(REMOTE_SECTION) {
+		remote, err := LoadRemote(name, repo)
+		if err != nil {
+			return nil, err
+		}
+		remotes = append(remotes, remote)
+	}
+
+	return remotes, nil
+}
+
+func StartRemote(rootPath string, args []string, option *RemoteOption, w io.Writer) error {
+	repo, err := DiscoverRepository(rootPath)
+	if err != nil {
+		return err
+	}
+
+	command := "list"
+	if len(args) > 0 {
+		command = args[0]
+		args = args[1:]
+	}
+
+	switch command {
+	case "add":
+		if len(args) != 2 {
+			return ErrorUnknownRemoteCmd
+		}
+		return AddRemote(args[0], args[1], repo)
+	case "remove", "rm":
+		if len(args) != 1 {
+			return ErrorUnknownRemoteCmd
+		}
+		return RemoveRemote(args[0], repo)
+	case "list":
+		remotes, err := ListRemotes(repo)
+		if err != nil {
+			return err
+		}
+		for _, remote := range remotes {
+			if option.Verbose {
+				w.Write([]byte(fmt.Sprintf("%s\t%s (fetch)\n", remote.Name, remote.URL)))
+				w.Write([]byte(fmt.Sprintf("%s\t%s (push)\n", remote.Name, remote.URL)))
+				continue
+			}
+			w.Write([]byte(fmt.Sprintf("%s\n", remote.Name)))
+		}
+		return nil
+	default:
+		return ErrorUnknownRemoteCmd
+	}
+}
+
+//refs/heads/masterのようなref名とobjIdの一覧、名前順
+func ListLocalRefs(repo *Repository, prefixes ...string) (map[string]string, []string, error) {
+	refs := make(map[string]string)
+
+	for _, prefix := range prefixes {
+		dir := filepath.Join(repo.r.Path, prefix)
+		if _, err := os.Stat(dir); err != nil {
+			continue
+		}
+
+		files, err := util.FilePathWalkDir(dir, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, f := range files {
+			path := filepath.Join(dir, f)
+			objId, err := repo.r.ReadSymRef(path)
+			if err != nil {
+				return nil, nil, err
+			}
+			//initしたばかりのmasterのように空のrefはとばす
+			if objId == "" {
+				continue
+			}
+
+			name, err := filepath.Rel(repo.r.Path, path)
+			if err != nil {
+				return nil, nil, err
+			}
+			refs[filepath.ToSlash(name)] = objId
+		}
+	}
+
+	var names []string
+	for name := range refs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return refs, names, nil
+}
@@ -0,0 +1,395 @@
+package src
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	data "mygit/src/database"
+	con "mygit/src/database/content"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//originとなるrepositoryをtempDirの下に作る
+func PrepareRemoteRepo(t *testing.T) (string, string, *Repository) {
+	cur, err := os.Getwd()
+	assert.NoError(t, err)
+	tempPath, err := ioutil.TempDir(cur, "")
+	assert.NoError(t, err)
+
+	t.Cleanup(func() {
+		os.RemoveAll(tempPath)
+	})
+
+	originPath := filepath.Join(tempPath, "origin")
+	err = os.MkdirAll(originPath, os.ModePerm)
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	err = StartInit([]string{originPath}, &InitOption{}, &buf)
+	assert.NoError(t, err)
+
+	gitPath := filepath.Join(originPath, ".git")
+	return tempPath, originPath, GenerateRepository(originPath, gitPath, filepath.Join(gitPath, "objects"))
+}
+
+func OpenRepoForTest(rootPath string) *Repository {
+	gitPath := filepath.Join(rootPath, ".git")
+	return GenerateRepository(rootPath, gitPath, filepath.Join(gitPath, "objects"))
+}
+
+func TestRemoteAddListRemove(t *testing.T) {
+	tempPath, _ := PrepareRebaseRepo(t)
+	var buf bytes.Buffer
+
+	err := StartRemote(tempPath, []string{"add", "origin", "/srv/repo"}, &RemoteOption{}, &buf)
+	assert.NoError(t, err)
+	err = StartRemote(tempPath, []string{"add", "backup", "file:///mnt/backup"}, &RemoteOption{}, &buf)
+	assert.NoError(t, err)
+
+	err = StartRemote(tempPath, []string{"add", "origin", "/other"}, &RemoteOption{}, &buf)
+	assert.ErrorIs(t, err, ErrorRemoteAlreadyExists)
+
+	buf.Reset()
+	err = StartRemote(tempPath, nil, &RemoteOption{Verbose: true}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "origin\t/srv/repo (fetch)\norigin\t/srv/repo (push)\nbackup\tfile:///mnt/backup (fetch)\nbackup\tfile:///mnt/backup (push)\n", buf.String())
+
+	content, err := ioutil.ReadFile(filepath.Join(tempPath, ".git", "config"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "[remote \"origin\"]\n\turl = /srv/repo\n\tfetch = +refs/heads/*:refs/remotes/origin/*\n")
+
+	err = StartRemote(tempPath, []string{"remove", "origin"}, &RemoteOption{}, &buf)
+	assert.NoError(t, err)
+	err = StartRemote(tempPath, []string{"remove", "origin"}, &RemoteOption{}, &buf)
+	assert.ErrorIs(t, err, ErrorNoSuchRemote)
+
+	buf.Reset()
+	err = StartRemote(tempPath, []string{"list"}, &RemoteOption{}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "backup\n", buf.String())
+}
+
+func TestRefspecMatch(t *testing.T) {
+	tests := []struct {
+		spec   string
+		ref    string
+		dst    string
+		ok     bool
+		force  bool
+		hasErr bool
+	}{
+		{spec: "+refs/heads/*:refs/remotes/origin/*", ref: "refs/heads/feature/x", dst: "refs/remotes/origin/feature/x", ok: true, force: true},
+		{spec: "refs/heads/master:refs/remotes/origin/main", ref: "refs/heads/master", dst: "refs/remotes/origin/main", ok: true},
+		{spec: "refs/heads/*:refs/remotes/origin/*", ref: "refs/tags/v1", ok: false},
+		{spec: "refs/heads/*:refs/remotes/origin/main", hasErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			r, err := ParseRefspec(tt.spec)
+			if tt.hasErr {
+				assert.ErrorIs(t, err, ErrorInvalidRefspec)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.force, r.Force)
+
+			dst, ok := r.Match(tt.ref)
+			assert.Equal(t, tt.ok, ok)
+			if ok {
+				assert.Equal(t, tt.dst, dst)
+			}
+		})
+	}
+}
+
+func TestCloneAndFetch(t *testing.T) {
+	tempPath, originPath, origin := PrepareRemoteRepo(t)
+	var buf bytes.Buffer
+
+	CommitFileForTest(t, originPath, "hello.txt", "hello\n", "first")
+	err := os.MkdirAll(filepath.Join(originPath, "dir"), os.ModePerm)
+	assert.NoError(t, err)
+	CommitFileForTest(t, originPath, "dir/world.txt", "world\n", "second")
+	err = StartTag(originPath, "test", "test@example.com", []string{"v1"}, &TagOption{}, &buf)
+	assert.NoError(t, err)
+
+	clonePath := filepath.Join(tempPath, "clone")
+	buf.Reset()
+	err = StartClone([]string{"file://" + originPath, clonePath}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "Cloning into 'clone'...\n", buf.String())
+
+	repo := OpenRepoForTest(clonePath)
+	originHead := ResolveForTest(t, "HEAD", origin)
+	assert.Equal(t, originHead, ResolveForTest(t, "HEAD", repo))
+	assert.Equal(t, originHead, ResolveForTest(t, "origin/master", repo))
+	assert.Equal(t, originHead, ResolveForTest(t, "v1", repo))
+
+	content, err := ioutil.ReadFile(filepath.Join(clonePath, "dir", "world.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "world\n", string(content))
+
+	originHeadRef, err := ioutil.ReadFile(filepath.Join(clonePath, ".git", "refs", "remotes", "origin", "HEAD"))
+	assert.NoError(t, err)
+	assert.Equal(t, "ref: refs/remotes/origin/master\n", string(originHeadRef))
+
+	c, err := LoadConfig(repo)
+	assert.NoError(t, err)
+	remoteName, _ := c.Get(BRANCH_SECTION, "master", "remote")
+	assert.Equal(t, "origin", remoteName)
+
+	//cloneした直後はworkspaceに差分がない
+	buf.Reset()
+	err = StartStatus(&buf, clonePath, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "", buf.String())
+
+	//originで進めた分と新しいbranchを取ってくる
+	CommitFileForTest(t, originPath, "hello.txt", "hello again\n", "third")
+	err = StartBranch(originPath, []string{"topic"}, &BranchOption{}, &buf)
+	assert.NoError(t, err)
+	newHead := ResolveForTest(t, "HEAD", origin)
+
+	buf.Reset()
+	err = StartFetch(clonePath, nil, &buf)
+	assert.NoError(t, err)
+	expected := fmt.Sprintf("From file://%s\n", originPath)
+	expected += fmt.Sprintf("   %-17s %-10s -> %s\n", fmt.Sprintf("%s..%s", ShortOid(originHead, repo.d), ShortOid(newHead, repo.d)), "master", "origin/master")
+	expected += fmt.Sprintf(" * %-17s %-10s -> %s\n", "[new branch]", "topic", "origin/topic")
+	assert.Equal(t, expected, buf.String())
+
+	assert.Equal(t, newHead, ResolveForTest(t, "origin/master", repo))
+	assert.Equal(t, newHead, ResolveForTest(t, "origin/topic", repo))
+	//local branchは動かない
+	assert.Equal(t, originHead, ResolveForTest(t, "master", repo))
+	assert.True(t, repo.d.HasObject(newHead))
+
+	//もう一度fetchしても何も出ない
+	buf.Reset()
+	err = StartFetch(clonePath, []string{"origin"}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "", buf.String())
+}
+
+func TestCloneEmpty(t *testing.T) {
+	tempPath, originPath, _ := PrepareRemoteRepo(t)
+	var buf bytes.Buffer
+
+	err := StartClone([]string{originPath, filepath.Join(tempPath, "clone")}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "Cloning into 'clone'...\n"+EmptyCloneMessage, buf.String())
+
+	//空でないdirectoryにはcloneできない
+	err = StartClone([]string{originPath, filepath.Join(tempPath, "clone")}, &buf)
+	assert.ErrorIs(t, err, ErrorCloneDestinationExists)
+}
+
+func TestPushToBare(t *testing.T) {
+	cur, err := os.Getwd()
+	assert.NoError(t, err)
+	tempPath, err := ioutil.TempDir(cur, "")
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(tempPath)
+	})
+
+	var buf bytes.Buffer
+	barePath := filepath.Join(tempPath, "shared.git")
+	err = gitInit(barePath, &buf)
+	assert.NoError(t, err)
+	bare, isBare, err := OpenRepositoryAt(barePath)
+	assert.NoError(t, err)
+	assert.True(t, isBare)
+
+	alicePath := filepath.Join(tempPath, "alice")
+	err = StartClone([]string{barePath, alicePath}, &buf)
+	assert.NoError(t, err)
+	alice := OpenRepoForTest(alicePath)
+
+	CommitFileForTest(t, alicePath, "hello.txt", "hello\n", "first")
+	aliceHead := ResolveForTest(t, "HEAD", alice)
+
+	buf.Reset()
+	err = StartPush(alicePath, nil, &PushOption{}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("To %s\n * %-17s master -> master\n", barePath, "[new branch]"), buf.String())
+	assert.Equal(t, aliceHead, ResolveForTest(t, "refs/heads/master", bare))
+	assert.Equal(t, aliceHead, ResolveForTest(t, "origin/master", alice))
+
+	buf.Reset()
+	err = StartPush(alicePath, []string{"origin", "master"}, &PushOption{}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "Everything up-to-date\n", buf.String())
+
+	//bobがcloneして先にpushする
+	bobPath := filepath.Join(tempPath, "bob")
+	err = StartClone([]string{barePath, bobPath}, &buf)
+	assert.NoError(t, err)
+	CommitFileForTest(t, bobPath, "bob.txt", "bob\n", "bob")
+	buf.Reset()
+	err = StartPush(bobPath, nil, &PushOption{}, &buf)
+	assert.NoError(t, err)
+	bobHead := ResolveForTest(t, "HEAD", OpenRepoForTest(bobPath))
+	assert.Equal(t, fmt.Sprintf("To %s\n   %-17s master -> master\n", barePath, fmt.Sprintf("%s..%s", ShortOid(aliceHead, bare.d), ShortOid(bobHead, bare.d))), buf.String())
+
+	//aliceはbobのcommitを持っていないのでfast-forwardにならない
+	CommitFileForTest(t, alicePath, "alice.txt", "alice\n", "alice")
+	buf.Reset()
+	err = StartPush(alicePath, nil, &PushOption{}, &buf)
+	assert.ErrorIs(t, err, ErrorPushRejected)
+	assert.Equal(t, fmt.Sprintf("To %s\n ! %-17s master -> master (fetch first)\nerror: failed to push some refs to '%s'\n", barePath, "[rejected]", barePath), buf.String())
+	assert.Equal(t, bobHead, ResolveForTest(t, "refs/heads/master", bare))
+
+	//fetchしてもmergeしていなければnon-fast-forward
+	err = StartFetch(alicePath, nil, &buf)
+	assert.NoError(t, err)
+	buf.Reset()
+	err = StartPush(alicePath, nil, &PushOption{}, &buf)
+	assert.ErrorIs(t, err, ErrorPushRejected)
+	assert.Contains(t, buf.String(), "(non-fast-forward)\n")
+
+	//forceなら上書きできる
+	newAliceHead := ResolveForTest(t, "HEAD", alice)
+	buf.Reset()
+	err = StartPush(alicePath, []string{"origin", "+master"}, &PushOption{}, &buf)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "master -> master (forced update)\n")
+	assert.Equal(t, newAliceHead, ResolveForTest(t, "refs/heads/master", bare))
+
+	//新しいbranchを作って消す
+	buf.Reset()
+	err = StartPush(alicePath, []string{"origin", "master:refs/heads/release"}, &PushOption{}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, newAliceHead, ResolveForTest(t, "refs/heads/release", bare))
+	assert.Equal(t, newAliceHead, ResolveForTest(t, "origin/release", alice))
+
+	buf.Reset()
+	err = StartPush(alicePath, []string{"origin", ":release"}, &PushOption{}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("To %s\n - %-17s release\n", barePath, "[deleted]"), buf.String())
+	_, err = bare.r.ReadRef("refs/heads/release")
+	assert.ErrorIs(t, err, data.ErrorPathNotExists)
+	_, err = alice.r.ReadRef("refs/remotes/origin/release")
+	assert.ErrorIs(t, err, data.ErrorPathNotExists)
+}
+
+func TestPushAnnotatedTag(t *testing.T) {
+	tempPath, originPath, origin := PrepareRemoteRepo(t)
+	var buf bytes.Buffer
+
+	CommitFileForTest(t, originPath, "hello.txt", "hello\n", "first")
+	clonePath := filepath.Join(tempPath, "clone")
+	err := StartClone([]string{originPath, clonePath}, &buf)
+	assert.NoError(t, err)
+	clone := OpenRepoForTest(clonePath)
+
+	err = StartTag(clonePath, "test", "test@example.com", []string{"v1.0"}, &TagOption{Annotate: true, Message: "release v1.0"}, &buf)
+	assert.NoError(t, err)
+	tagObjId, err := clone.r.ReadRef("refs/tags/v1.0")
+	assert.NoError(t, err)
+	assert.NotEqual(t, ResolveForTest(t, "HEAD", clone), tagObjId)
+
+	//commitではなくtag objectを送る
+	buf.Reset()
+	err = StartPush(clonePath, []string{"origin", "v1.0"}, &PushOption{}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("To %s\n * %-17s v1.0 -> v1.0\n", originPath, "[new tag]"), buf.String())
+	remoteObjId, err := origin.r.ReadRef("refs/tags/v1.0")
+	assert.NoError(t, err)
+	assert.Equal(t, tagObjId, remoteObjId)
+	o, err := origin.d.ReadObject(remoteObjId)
+	assert.NoError(t, err)
+	assert.IsType(t, &con.Tag{}, o)
+
+	//すでにあるtagはforceでないと動かせない
+	CommitFileForTest(t, clonePath, "hello.txt", "changed\n", "second")
+	err = StartTag(clonePath, "test", "test@example.com", []string{"v1.0"}, &TagOption{Annotate: true, Message: "release v1.0 again", Force: true}, &buf)
+	assert.NoError(t, err)
+	newTagObjId, err := clone.r.ReadRef("refs/tags/v1.0")
+	assert.NoError(t, err)
+
+	buf.Reset()
+	err = StartPush(clonePath, []string{"origin", "v1.0"}, &PushOption{}, &buf)
+	assert.ErrorIs(t, err, ErrorPushRejected)
+	assert.Contains(t, buf.String(), "v1.0 -> v1.0 (already exists)\n")
+
+	buf.Reset()
+	err = StartPush(clonePath, []string{"origin", "+v1.0"}, &PushOption{}, &buf)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "v1.0 -> v1.0 (forced update)\n")
+	remoteObjId, err = origin.r.ReadRef("refs/tags/v1.0")
+	assert.NoError(t, err)
+	assert.Equal(t, newTagObjId, remoteObjId)
+}
+
+func TestPushToCheckedOutBranch(t *testing.T) {
+	tempPath, originPath, origin := PrepareRemoteRepo(t)
+	var buf bytes.Buffer
+
+	CommitFileForTest(t, originPath, "hello.txt", "hello\n", "first")
+	originHead := ResolveForTest(t, "HEAD", origin)
+
+	clonePath := filepath.Join(tempPath, "clone")
+	err := StartClone([]string{originPath, clonePath}, &buf)
+	assert.NoError(t, err)
+	CommitFileForTest(t, clonePath, "hello.txt", "changed\n", "second")
+
+	buf.Reset()
+	err = StartPush(clonePath, nil, &PushOption{}, &buf)
+	assert.ErrorIs(t, err, ErrorPushRejected)
+	assert.Contains(t, buf.String(), "master -> master (branch is currently checked out)\n")
+	assert.Equal(t, originHead, ResolveForTest(t, "HEAD", origin))
+
+	//checkoutされていないbranchにはpushできる
+	buf.Reset()
+	err = StartPush(clonePath, []string{"origin", "master:topic"}, &PushOption{}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, ResolveForTest(t, "HEAD", OpenRepoForTest(clonePath)), ResolveForTest(t, "topic", origin))
+}
+
+func TestPushToProtectedBranch(t *testing.T) {
+	cur, err := os.Getwd()
+	assert.NoError(t, err)
+	tempPath, err := ioutil.TempDir(cur, "")
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(tempPath)
+	})
+
+	var buf bytes.Buffer
+	barePath := filepath.Join(tempPath, "shared.git")
+	err = gitInit(barePath, &buf)
+	assert.NoError(t, err)
+	bare, _, err := OpenRepositoryAt(barePath)
+	assert.NoError(t, err)
+	c, err := LoadConfig(bare)
+	assert.NoError(t, err)
+	c.Set(BRANCH_SECTION, "master", "protected", "true")
+	assert.NoError(t, c.Save())
+
+	alicePath := filepath.Join(tempPath, "alice")
+	err = StartClone([]string{barePath, alicePath}, &buf)
+	assert.NoError(t, err)
+	CommitFileForTest(t, alicePath, "hello.txt", "hello\n", "first")
+	CommitFileForTest(t, alicePath, "hello.txt", "hello again\n", "second")
+	err = StartPush(alicePath, nil, &PushOption{}, &buf)
+	assert.NoError(t, err)
+	aliceHead := ResolveForTest(t, "HEAD", OpenRepoForTest(alicePath))
+
+	//forceでも保護されたbranchは巻き戻せない
+	buf.Reset()
+	err = StartPush(alicePath, []string{"origin", "+master~1:master"}, &PushOption{}, &buf)
+	assert.ErrorIs(t, err, ErrorPushRejected)
+	assert.Contains(t, buf.String(), "master~1 -> master (protected branch)\n")
+
+	buf.Reset()
+	err = StartPush(alicePath, []string{"origin", ":master"}, &PushOption{}, &buf)
+	assert.ErrorIs(t, err, ErrorPushRejected)
+	assert.Contains(t, buf.String(), "(protected branch)\n")
+	assert.Equal(t, aliceHead, ResolveForTest(t, "refs/heads/master", bare))
+}
@@ -0,0 +1,38 @@
+package src
+
+import (
+	"fmt"
+	"io"
+)
+
+type RepackOption struct {
+	//packに入れたlooseのobjectを消す(本家の-d)
+	DeleteLoose bool
+}
+
+func StartRepack(rootPath string, option *RepackOption, w io.Writer) error {
+	repo, err := DiscoverRepository(rootPath)
+	if err != nil {
+		return err
+	}
+
+	//到達できないものをpackに入れるとgcで消せなくなる
+	reachable, err := ReachableObjects(repo)
+	if err != nil {
+		return err
+	}
+
+	name, objIds, err := repo.d.PackLooseObjects(reachable, option.DeleteLoose)
+	if err != nil {
+		return err
+	}
+
+	if name == "" {
+		w.Write([]byte("Nothing new to pack.\n"))
+		return nil
+	}
+
+	w.Write([]byte(fmt.Sprintf("Total %d objects packed into pack-%s.pack\n", len(objIds), name)))
+
+	return nil
+}
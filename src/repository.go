@@ -1,8 +1,15 @@
 package src
 
 import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mygit/src/crypt"
 	data "mygit/src/database"
+	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 )
 
 type Repository struct {
@@ -10,11 +17,25 @@ type Repository struct {
 	d *data.Database
 	r *data.Refs
 	i *data.Index
+	//作業ディレクトリのないrepository
+	bare bool
+	//作業ディレクトリのtopからcwdへの相対path、pathspecの解決に使う
+	prefix string
 }
 
+var (
+	ErrorNotAGitRepository = errors.New("not a mygit repository (or any of the parent directories): .git")
+	ErrorBareRepository    = errors.New("this operation must be run in a work tree")
+	ErrorInvalidGitFile    = errors.New("invalid gitfile format")
+)
+
+//.gitがdirectoryでなくファイルの時は、本家と同じく"gitdir: <path>"で実際の場所を指す
+const GITFILE_PREFIX = "gitdir: "
+
 func GenerateRepository(rootPath, gitPath, dbPath string) *Repository {
 	wk := &WorkSpace{
-		Path: rootPath,
+		Path:    rootPath,
+		gitPath: gitPath,
 	}
 
 	r := &data.Refs{
@@ -24,13 +45,248 @@ func GenerateRepository(rootPath, gitPath, dbPath string) *Repository {
 	d := &data.Database{
 		Path: dbPath,
 	}
+	r.FastForward = func(oldObjId, newObjId string) (bool, error) {
+		return IsFastForward(oldObjId, newObjId, d)
+	}
 
 	i := data.GenerateIndex(filepath.Join(gitPath, "index"))
+	wk.index = i
 
-	return &Repository{
+	repo := &Repository{
 		w: wk,
 		d: d,
 		r: r,
 		i: i,
 	}
+	i.ConfiguredVersion = repo.indexVersion
+	//知らないobjectFormatはDiscoverRepositoryで弾くので、ここではsha1のままにする
+	if h, err := objectFormat(gitPath); err == nil {
+		repo.SetHash(h)
+	}
+
+	return repo
+}
+
+//objId,index,pack,refのobjIdをすべて同じhashにする
+func (repo *Repository) SetHash(h crypt.Hash) {
+	repo.d.Hash = h
+	repo.r.Hash = h
+	repo.i.Hash = h
+}
+
+func (repo *Repository) Hash() crypt.Hash {
+	return repo.d.GetHash()
+}
+
+//本家と同じくGIT_INDEX_VERSION、index.versionの順に見る
+func (repo *Repository) indexVersion() (uint32, error) {
+	if env := os.Getenv("GIT_INDEX_VERSION"); env != "" {
+		version, err := strconv.Atoi(env)
+		if err != nil || version < 0 {
+			return 0, fmt.Errorf("GIT_INDEX_VERSION=%s: %w", env, data.ErrorInvalidVersion)
+		}
+		return uint32(version), nil
+	}
+
+	cs, err := repo.Config()
+	if err != nil {
+		return 0, err
+	}
+	version, err := cs.IndexVersion()
+	if err != nil || version < 0 {
+		return 0, fmt.Errorf("index.version: %w", data.ErrorInvalidVersion)
+	}
+
+	return uint32(version), nil
+}
+
+//extensions.objectFormatはlocalのconfigにしか書かれない、なければsha1
+func objectFormat(gitPath string) (crypt.Hash, error) {
+	c := data.GenerateConfig(filepath.Join(gitPath, "config"))
+	if err := c.Load(); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	name, _ := c.Get("extensions", "", "objectformat")
+	return crypt.HashByName(name)
+}
+
+//cmdから渡されるcwdを起点にrepositoryを探す、Start*はすべてここを通す
+//GIT_DIRがあればそれを使い、なければcwdから上に向かって.gitを探す(filesystemをまたいだら止める)
+//GIT_WORK_TREEがあれば作業ディレクトリはそこにする
+func DiscoverRepository(cwd string) (*Repository, error) {
+	cwd, err := filepath.Abs(cwd)
+	if err != nil {
+		return nil, err
+	}
+
+	if gitDir := os.Getenv("GIT_DIR"); gitDir != "" {
+		gitPath := absFrom(cwd, gitDir)
+		if !isGitDir(gitPath) {
+			return nil, fmt.Errorf("'%s' %w", gitDir, ErrorNotARepository)
+		}
+
+		workTree := os.Getenv("GIT_WORK_TREE")
+		if workTree == "" {
+			if isBareConfig(gitPath) {
+				return openRepository("", gitPath, cwd)
+			}
+			//本家と同じくGIT_DIRだけの時はcwdを作業ディレクトリのtopとみなす
+			workTree = cwd
+		}
+		return openRepository(absFrom(cwd, workTree), gitPath, cwd)
+	}
+
+	dev, hasDev := deviceOf(cwd)
+	for dir := cwd; ; dir = filepath.Dir(dir) {
+		if d, ok := deviceOf(dir); hasDev && ok && d != dev {
+			break
+		}
+
+		gitPath, workTree, found, err := findGitDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			if envWorkTree := os.Getenv("GIT_WORK_TREE"); envWorkTree != "" {
+				workTree = absFrom(cwd, envWorkTree)
+			}
+			return openRepository(workTree, gitPath, cwd)
+		}
+
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+
+	return nil, ErrorNotAGitRepository
+}
+
+//status,addなど作業ディレクトリが必要なcommand用
+func DiscoverWorkTree(cwd string) (*Repository, error) {
+	repo, err := DiscoverRepository(cwd)
+	if err != nil {
+		return nil, err
+	}
+
+	if repo.bare {
+		return nil, ErrorBareRepository
+	}
+
+	return repo, nil
+}
+
+//dirに.git(directoryかgitfile)があるか、dir自体がbareのrepositoryかを見る、上には辿らない
+func findGitDir(dir string) (string, string, bool, error) {
+	dotGit := filepath.Join(dir, ".git")
+	if stat, err := os.Stat(dotGit); err == nil {
+		if !stat.IsDir() {
+			gitPath, err := readGitFile(dotGit)
+			if err != nil {
+				return "", "", false, err
+			}
+			return gitPath, dir, true, nil
+		}
+		if isGitDir(dotGit) {
+			return dotGit, dir, true, nil
+		}
+	}
+
+	//bareのrepositoryか.gitの中にいる
+	if isGitDir(dir) {
+		return dir, "", true, nil
+	}
+
+	return "", "", false, nil
+}
+
+func readGitFile(path string) (string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	line := strings.TrimSpace(string(content))
+	if !strings.HasPrefix(line, GITFILE_PREFIX) {
+		return "", fmt.Errorf("%s: %w", path, ErrorInvalidGitFile)
+	}
+
+	//相対pathはgitfileのあるdirectoryから
+	gitPath := absFrom(filepath.Dir(path), strings.TrimPrefix(line, GITFILE_PREFIX))
+	if !isGitDir(gitPath) {
+		return "", fmt.Errorf("%s: %w", path, ErrorInvalidGitFile)
+	}
+
+	return gitPath, nil
+}
+
+//HEADとobjects,refsがあればrepositoryとみなす
+func isGitDir(path string) bool {
+	if stat, err := os.Stat(filepath.Join(path, "HEAD")); err != nil || stat.IsDir() {
+		return false
+	}
+	for _, dir := range []string{"objects", "refs"} {
+		if stat, err := os.Stat(filepath.Join(path, dir)); err != nil || !stat.IsDir() {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isBareConfig(gitPath string) bool {
+	c := data.GenerateConfig(filepath.Join(gitPath, "config"))
+	if err := c.Load(); err != nil {
+		return false
+	}
+
+	v, _ := c.Get("core", "", "bare")
+	return v == "true"
+}
+
+//workTreeが空ならbare
+func openRepository(workTree, gitPath, cwd string) (*Repository, error) {
+	if _, err := objectFormat(gitPath); err != nil {
+		return nil, err
+	}
+
+	if workTree == "" {
+		repo := GenerateRepository(gitPath, gitPath, filepath.Join(gitPath, "objects"))
+		repo.bare = true
+		return repo, nil
+	}
+
+	repo := GenerateRepository(workTree, gitPath, filepath.Join(gitPath, "objects"))
+	if rel, err := filepath.Rel(workTree, cwd); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+		repo.prefix = rel
+	}
+
+	return repo, nil
+}
+
+func absFrom(base, path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(base, path)
+}
+
+//cwdからの相対pathを作業ディレクトリのtopからの相対pathにする
+func (repo *Repository) Pathspec(path string) string {
+	if filepath.IsAbs(path) {
+		if rel, err := filepath.Rel(repo.w.Path, path); err == nil {
+			return rel
+		}
+		return path
+	}
+
+	return filepath.Join(repo.prefix, path)
+}
+
+func (repo *Repository) Pathspecs(paths []string) []string {
+	var specs []string
+	for _, path := range paths {
+		specs = append(specs, repo.Pathspec(path))
+	}
+	return specs
 }
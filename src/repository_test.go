@@ -0,0 +1,155 @@
+package src
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiscoverFromSubdirectory(t *testing.T) {
+	tempPath, repo := PrepareRebaseRepo(t)
+	var buf bytes.Buffer
+
+	subPath := filepath.Join(tempPath, "sub", "dir")
+	err := os.MkdirAll(subPath, os.ModePerm)
+	assert.NoError(t, err)
+
+	found, err := DiscoverWorkTree(subPath)
+	assert.NoError(t, err)
+	assert.Equal(t, tempPath, found.w.Path)
+	assert.Equal(t, repo.r.Path, found.r.Path)
+	assert.Equal(t, filepath.Join("sub", "dir"), found.prefix)
+
+	//pathspecはcwdからの相対
+	err = ioutil.WriteFile(filepath.Join(subPath, "new.txt"), []byte("new\n"), 0644)
+	assert.NoError(t, err)
+	err = StartAdd(subPath, "test", "test@example.com", "", []string{"new.txt"})
+	assert.NoError(t, err)
+
+	assert.NoError(t, repo.i.Load())
+	assert.True(t, repo.i.IsIndexed(filepath.Join("sub", "dir", "new.txt")))
+
+	err = StartStatus(&buf, subPath, false)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "sub/dir/new.txt")
+}
+
+func TestLogPathFromSubdirectory(t *testing.T) {
+	tempPath, _ := PrepareRebaseRepo(t)
+	var buf bytes.Buffer
+
+	subPath := filepath.Join(tempPath, "sub")
+	err := os.MkdirAll(subPath, os.ModePerm)
+	assert.NoError(t, err)
+	CommitFileForTest(t, tempPath, "sub/a.txt", "a\n", "add a")
+	CommitFileForTest(t, tempPath, "a.txt", "root\n", "add root a")
+
+	//subの中のa.txtはsub/a.txtのこと
+	err = StartLog(subPath, []string{"a.txt"}, &LogOption{}, &buf)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "add a\n")
+	assert.NotContains(t, buf.String(), "add root a")
+}
+
+func TestDiscoverGitFileAndEnv(t *testing.T) {
+	cur, err := os.Getwd()
+	assert.NoError(t, err)
+	tempPath, err := ioutil.TempDir(cur, "")
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(tempPath)
+	})
+
+	var buf bytes.Buffer
+	storePath := filepath.Join(tempPath, "store.git")
+	err = gitInit(storePath, &buf)
+	assert.NoError(t, err)
+
+	//.gitが別の場所を指すファイル
+	workPath := filepath.Join(tempPath, "work")
+	err = os.MkdirAll(filepath.Join(workPath, "sub"), os.ModePerm)
+	assert.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(workPath, ".git"), []byte("gitdir: ../store.git\n"), 0644)
+	assert.NoError(t, err)
+
+	repo, err := DiscoverWorkTree(filepath.Join(workPath, "sub"))
+	assert.NoError(t, err)
+	assert.Equal(t, workPath, repo.w.Path)
+	assert.Equal(t, storePath, repo.r.Path)
+
+	err = ioutil.WriteFile(filepath.Join(workPath, ".git"), []byte("gitdir: ../none\n"), 0644)
+	assert.NoError(t, err)
+	_, err = DiscoverRepository(workPath)
+	assert.ErrorIs(t, err, ErrorInvalidGitFile)
+
+	//GIT_DIRとGIT_WORK_TREEが優先される
+	otherPath := filepath.Join(tempPath, "other")
+	err = os.MkdirAll(otherPath, os.ModePerm)
+	assert.NoError(t, err)
+	t.Setenv("GIT_DIR", storePath)
+	t.Setenv("GIT_WORK_TREE", workPath)
+
+	repo, err = DiscoverWorkTree(otherPath)
+	assert.NoError(t, err)
+	assert.Equal(t, workPath, repo.w.Path)
+	assert.Equal(t, storePath, repo.r.Path)
+	assert.Equal(t, "", repo.prefix)
+
+	//GIT_DIRだけならcwdが作業ディレクトリになる
+	t.Setenv("GIT_WORK_TREE", "")
+	repo, err = DiscoverWorkTree(otherPath)
+	assert.NoError(t, err)
+	assert.Equal(t, otherPath, repo.w.Path)
+}
+
+func TestInitBare(t *testing.T) {
+	cur, err := os.Getwd()
+	assert.NoError(t, err)
+	tempPath, err := ioutil.TempDir(cur, "")
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(tempPath)
+	})
+
+	var buf bytes.Buffer
+	barePath := filepath.Join(tempPath, "shared.git")
+	err = StartInit([]string{barePath}, &InitOption{Bare: true}, &buf)
+	assert.NoError(t, err)
+
+	repo, err := DiscoverRepository(barePath)
+	assert.NoError(t, err)
+	assert.True(t, repo.bare)
+	assert.Equal(t, barePath, repo.r.Path)
+
+	c, err := LoadConfig(repo)
+	assert.NoError(t, err)
+	v, _ := c.Get("core", "", "bare")
+	assert.Equal(t, "true", v)
+
+	//作業ディレクトリの必要なcommandはエラー
+	err = StartStatus(&buf, barePath, false)
+	assert.ErrorIs(t, err, ErrorBareRepository)
+	err = StartAdd(barePath, "test", "test@example.com", "", []string{"."})
+	assert.ErrorIs(t, err, ErrorBareRepository)
+
+	//refsの中からでもbareのrepositoryが見つかる
+	repo, err = DiscoverRepository(filepath.Join(barePath, "refs", "heads"))
+	assert.NoError(t, err)
+	assert.True(t, repo.bare)
+}
+
+func TestDiscoverNotARepository(t *testing.T) {
+	//このpackageはrepositoryの中にあるので、外の一時directoryで試す
+	tempPath, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(tempPath)
+	})
+
+	_, err = DiscoverRepository(tempPath)
+	assert.ErrorIs(t, err, ErrorNotAGitRepository)
+}
@@ -1,11 +1,11 @@
 package src
 
 import (
+	"fmt"
 	data "mygit/src/database"
 	con "mygit/src/database/content"
 	"mygit/src/database/lock"
 	"os"
-	"path/filepath"
 )
 
 type Reset struct {
@@ -14,6 +14,8 @@ type Reset struct {
 	repo        *Repository
 	Option      *ResetOption
 	Status      *Status
+	//reflogに書くためのreset先の名前
+	target string
 }
 
 type ResetOption struct {
@@ -39,6 +41,7 @@ func (res *Reset) SelectCommitObjId(args []string) error {
 	objId, err := ResolveRev(rev, res.repo)
 	if err == nil {
 		res.CommitObjId = objId
+		res.target = target
 		//argsの先頭をCommitObjIdの対象として使ったのでpop
 		res.Args = res.Args[1:]
 
@@ -52,6 +55,7 @@ func (res *Reset) SelectCommitObjId(args []string) error {
 		return err
 	}
 	res.CommitObjId = objId
+	res.target = "HEAD"
 
 	return nil
 
@@ -63,6 +67,11 @@ func (res *Reset) ResetPath(path string) error {
 		return err
 	}
 
+	sc, err := LoadSparseCheckout(res.repo)
+	if err != nil {
+		return err
+	}
+
 	//指定したpathをindexから削除
 	if path != "" {
 		res.repo.i.Remove(path)
@@ -70,13 +79,29 @@ func (res *Reset) ResetPath(path string) error {
 
 	//戻したいCommitの情報をindexに追加
 	for path, e := range list {
-		res.repo.i.AddFromDB(path, e)
+		err := AddFromDBWithSparse(path, e, sc, res.repo)
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
 
 }
 
+//sparse-checkoutの外にあって作業ディレクトリにもないpathは、skip-worktreeの印をつけてindexに入れる
+//印がないと作業ディレクトリから消えたものとして扱われてしまう
+func AddFromDBWithSparse(path string, e *con.Entry, sc *SparseCheckout, repo *Repository) error {
+	if !sc.Includes(path) {
+		if _, err := repo.w.StatFile(path); err != nil {
+			return AddSkipWorktree(path, e, repo)
+		}
+	}
+
+	repo.i.AddFromDB(path, e)
+	return nil
+}
+
 func (res *Reset) HandleMixed() error {
 	//argsが0は何を意味するかというと、特定のファイルではなく、すべてを指定したコミットまで戻すということ
 	//まずindexを全部削除してからResetPashで対象Commnitのindexをadd,元のindexを削除しないとindexが混ざりあってしまう
@@ -99,11 +124,15 @@ func (res *Reset) HandleMixed() error {
 	return nil
 }
 
-func HardResetPath(path string, s *Status, repo *Repository) error {
+//sparse-checkoutの外のpathは作業ディレクトリには書かず、skip-worktreeでindexにだけ入れる
+func HardResetPath(path string, s *Status, sc *SparseCheckout, repo *Repository) error {
 	repo.i.Remove(path)
-	err := repo.w.Remove(path)
-	if err != nil {
-		return err
+	//本家と同じくsubmoduleの作業ディレクトリには触らない
+	if !repo.w.IsNestedRepository(path) {
+		err := repo.w.Remove(path)
+		if err != nil {
+			return err
+		}
 	}
 	//ここまで削除
 
@@ -112,6 +141,12 @@ func HardResetPath(path string, s *Status, repo *Repository) error {
 	if !ok {
 		return nil
 	}
+	if e.IsGitlink() {
+		return resetGitlink(path, e, repo)
+	}
+	if !sc.Includes(path) {
+		return AddSkipWorktree(path, e, repo)
+	}
 	o, err := repo.d.ReadObject(e.ObjId)
 	if err != nil {
 		return err
@@ -139,6 +174,21 @@ func HardResetPath(path string, s *Status, repo *Repository) error {
 	return nil
 }
 
+//gitlinkはindexだけを戻し、submoduleのHEADはsubmodule updateで合わせる
+func resetGitlink(path string, e *con.Entry, repo *Repository) error {
+	err := repo.w.MakeDir(path)
+	if err != nil {
+		return err
+	}
+
+	stat, err := repo.w.StatFile(path)
+	if err != nil {
+		return err
+	}
+
+	return repo.i.Add(path, e.ObjId, stat, data.CreateIndex)
+}
+
 //HandleHardは他コマンドでも使うのでresとは分けてある
 
 //Gitでは--hardでファイル指定はできない、ファイル指定は--hardとかをつけてはできないので、--mixedのみということになる
@@ -153,8 +203,13 @@ func HanldeHard(commitObjId string, repo *Repository) error {
 		return err
 	}
 
+	sc, err := LoadSparseCheckout(repo)
+	if err != nil {
+		return err
+	}
+
 	for _, path := range s.Changed {
-		err := HardResetPath(path, s, repo)
+		err := HardResetPath(path, s, sc, repo)
 		if err != nil {
 			return err
 		}
@@ -182,6 +237,8 @@ func RunReset(res *Reset) error {
 	if err != nil {
 		return err
 	}
+	//commitの指定を除いた残りはcwdからの相対path
+	res.Args = res.repo.Pathspecs(res.Args)
 
 	_, indexNonExist := os.Stat(res.repo.i.Path)
 
@@ -211,7 +268,7 @@ func RunReset(res *Reset) error {
 	//ファイル単位でないすべてresetのときはHaedの位置を指定したCommitまで
 	//ファイル指定したらそのファイルだけ戻す
 	if len(res.Args) == 0 {
-		headObjId, err := res.repo.r.UpdateHead(res.CommitObjId)
+		headObjId, err := res.repo.r.WithReason(fmt.Sprintf("reset: moving to %s", res.target)).UpdateHead(res.CommitObjId)
 		if err != nil {
 			return err
 		}
@@ -226,9 +283,10 @@ func RunReset(res *Reset) error {
 }
 
 func StartReset(rootPath string, args []string, option *ResetOption) error {
-	gitPath := filepath.Join(rootPath, ".git")
-	dbPath := filepath.Join(gitPath, "objects")
-	repo := GenerateRepository(rootPath, gitPath, dbPath)
+	repo, err := DiscoverWorkTree(rootPath)
+	if err != nil {
+		return err
+	}
 
 	res := &Reset{Args: args, repo: repo, Option: option}
 
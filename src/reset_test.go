@@ -29,7 +29,7 @@ func PrepareTwoCommitForReset(t *testing.T) string {
 
 	is := []string{tempPath}
 	var buf bytes.Buffer
-	err = StartInit(is, &buf)
+	err = StartInit(is, &InitOption{}, &buf)
 	assert.NoError(t, err)
 	ss := []string{"."}
 	err = StartAdd(tempPath, "test", "test@example.com", "test", ss)
@@ -344,3 +344,40 @@ func TestResetSoft(t *testing.T) {
 	assert.Equal(t, beforeResetHeadObjId, str)
 
 }
+
+func TestResetHardSymlink(t *testing.T) {
+	fn := Prepare(t)
+	t.Cleanup(fn)
+
+	cur, err := os.Getwd()
+	assert.NoError(t, err)
+	tempPath := filepath.Join(cur, "tempDir")
+	linkPath := filepath.Join(tempPath, "link")
+
+	err = os.Symlink("hello.txt", linkPath)
+	assert.NoError(t, err)
+	var buf bytes.Buffer
+	err = StartAdd(tempPath, "test", "test@example.com", "test", []string{"link"})
+	assert.NoError(t, err)
+	err = StartCommit(tempPath, "test", "test@example.com", "link", &buf)
+	assert.NoError(t, err)
+
+	//linkをファイルに置き換えてもreset --hardでsymlinkに戻る
+	err = os.Remove(linkPath)
+	assert.NoError(t, err)
+	CreateFiles(t, tempPath, "link", "not a link\n")
+
+	repo := GenerateRepository(tempPath, filepath.Join(tempPath, ".git"), filepath.Join(tempPath, ".git/objects"))
+	res := &Reset{Args: []string{"@"}, repo: repo, Option: &ResetOption{hasHard: true}}
+	err = RunReset(res)
+	assert.NoError(t, err)
+
+	target, err := os.Readlink(linkPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello.txt", target)
+
+	statusBuf := new(bytes.Buffer)
+	err = StartStatus(statusBuf, tempPath, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "", statusBuf.String())
+}
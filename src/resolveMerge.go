@@ -326,7 +326,11 @@ func (rm *ResolveMerge) SamePathConflict(path string, baseEntry, rightEntry *con
 		return
 	}
 
-	objId, objIdOk := rm.MergeBlobs(
+	mergeObjIds := rm.MergeBlobs
+	if isGitlinkEntry(leftDiffEntry) || isGitlinkEntry(rightEntry) {
+		mergeObjIds = rm.MergeGitlinks
+	}
+	objId, objIdOk := mergeObjIds(
 		baseEntry.GetObjIdForNormalAndNilEntry(),
 		leftDiffEntry.GetObjIdForNormalAndNilEntry(),
 		rightEntry.GetObjIdForNormalAndNilEntry())
@@ -414,7 +418,8 @@ func (rm *ResolveMerge) MergeModes(baseMode, leftMode, rightMode int) (int, bool
 //merge3のresultが""ということは、deleted modifiedのconflictではない
 //delete,deleteの組は問題ないのでsamePathConflictのleft == rightの部分でreturnしている]
 //ということはここに来るのはmodifed,modifiedのconflictなので
-//gitのようにv
+//base->left,base->rightの行単位のdiffをとってdiff3でmergeする
+//重なっていない変更は自動でmergeされ、重なっている部分だけ
 // <<<<<<<<<<
 //  .....
 // ======
@@ -428,41 +433,68 @@ func (rm *ResolveMerge) MergeBlobs(baseObjId, leftObjId, rightObjId string) (str
 	}
 
 	//modifed,modifiedのconflict
-	content, err := rm.MergedData(leftObjId, rightObjId)
+	result, err := rm.MergedData(baseObjId, leftObjId, rightObjId)
 
 	if err != nil {
 		return "", false
 	}
 	blob := &con.Blob{
-		Content: content,
+		Content: result.ToString(rm.m.leftName, rm.m.rightName),
 	}
 
 	rm.m.repo.d.Store(blob)
-	return blob.ObjId, false
+	return blob.ObjId, result.IsClean()
+
+}
 
+func isGitlinkEntry(e *con.Entry) bool {
+	return e != nil && e.IsGitlink()
 }
 
-func (rm *ResolveMerge) MergedData(leftObjId, rightObjId string) (string, error) {
-	leftObj, err := rm.m.repo.d.ReadObject(leftObjId)
+//submoduleのcommitは中身をmergeできないので、本家と同じくconflictにしてleftのcommitを残す
+func (rm *ResolveMerge) MergeGitlinks(baseObjId, leftObjId, rightObjId string) (string, bool) {
+	retObjId, canMerge := rm.Merge3ObjId(baseObjId, leftObjId, rightObjId)
+	if retObjId != "" {
+		return retObjId, canMerge
+	}
+
+	return leftObjId, false
+}
+
+func (rm *ResolveMerge) ReadBlobContent(objId string) (string, error) {
+	//add/addのconflictの時はbaseが存在しないので空として扱う
+	if objId == "" {
+		return "", nil
+	}
+
+	o, err := rm.m.repo.d.ReadObject(objId)
 	if err != nil {
 		return "", err
 	}
-	leftBlob, ok := leftObj.(*con.Blob)
+	blob, ok := o.(*con.Blob)
 	if !ok {
 		return "", ErrorObjeToEntryConvError
 	}
 
-	rightObj, err := rm.m.repo.d.ReadObject(rightObjId)
+	return blob.Content, nil
+}
+
+func (rm *ResolveMerge) MergedData(baseObjId, leftObjId, rightObjId string) (*Diff3Result, error) {
+	baseContent, err := rm.ReadBlobContent(baseObjId)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	rightBlob, ok := rightObj.(*con.Blob)
-	if !ok {
-		return "", ErrorObjeToEntryConvError
+
+	leftContent, err := rm.ReadBlobContent(leftObjId)
+	if err != nil {
+		return nil, err
 	}
 
-	str := fmt.Sprintf("<<<<<<< %s\n%s\n=======\n%s\n>>>>>>> %s\n", rm.m.leftName, leftBlob.Content, rightBlob.Content, rm.m.rightName)
+	rightContent, err := rm.ReadBlobContent(rightObjId)
+	if err != nil {
+		return nil, err
+	}
 
-	return str, nil
+	return Diff3Merge(baseContent, leftContent, rightContent), nil
 
 }
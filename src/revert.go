@@ -5,7 +5,6 @@ import (
 	"io"
 	con "mygit/src/database/content"
 	ers "mygit/src/errors"
-	"path/filepath"
 	"strings"
 )
 
@@ -150,9 +149,10 @@ func RunRevert(c *con.CommitFromMem, sd *SequenceData) error {
 }
 
 func StartRevert(rootPath string, args []string, option *SequenceOption, w io.Writer) error {
-	gitPath := filepath.Join(rootPath, ".git")
-	dbPath := filepath.Join(gitPath, "objects")
-	repo := GenerateRepository(rootPath, gitPath, dbPath)
+	repo, err := DiscoverWorkTree(rootPath)
+	if err != nil {
+		return err
+	}
 
 	seq := GenerateSequencer(repo)
 	pc := GeneratePendingCommit(repo.r.Path)
@@ -7,6 +7,7 @@ import (
 	con "mygit/src/database/content"
 	"mygit/src/database/util"
 	e "mygit/src/errors"
+	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -38,6 +39,27 @@ func (a *Ancestor) ToString() string {
 	return ""
 }
 
+//v1.0^{}やv1.0^{commit}のようにtagをcommitまで剥がす
+type Peel struct {
+	Rev  BranchObj
+	Type string
+}
+
+func (p *Peel) ToString() string {
+	return ""
+}
+
+//HEAD@{1}やmaster@{2}のようにreflogのn個前の位置
+//@{1}のようにNameが""なら今のbranchのreflogを見る
+type Reflog struct {
+	Name string
+	N    int
+}
+
+func (rl *Reflog) ToString() string {
+	return ""
+}
+
 type BranchObj interface {
 	ToString() string
 }
@@ -49,8 +71,13 @@ var aliasMap = map[string]string{
 var (
 	PARENT   = `^(.+)\^(\d*)$`
 	ANCESTOR = `^(.+)~(\d+)$`
+	PEEL     = `^(.+)\^\{(\w*)\}$`
+	REFLOG   = `^(.*)@\{(\d+)\}$`
 )
 
+var ErrorInvalidPeelType = errors.New("invalid peel type")
+var ErrorReflogEntryNotFound = errors.New("reflog entry not found")
+
 func CommitParentWithMultipleParentVersion(objId string, parentNum int, repo *Repository) (string, error) {
 	return CommitParents(objId, parentNum, repo)
 }
@@ -128,12 +155,44 @@ func ResolveRev(obj BranchObj, repo *Repository) (string, error) {
 			targetObjId = target
 		}
 		return targetObjId, nil
+	case *Peel:
+		//Refの時点でcommitまで剥がしているので、commit以外を指定された時だけerror
+		if v.Type != "" && v.Type != con.COMMIT {
+			return "", ErrorInvalidPeelType
+		}
+		return ResolveRev(v.Rev, repo)
+	case *Reflog:
+		name := v.Name
+		if name == "" {
+			//本家と同じく今のbranchのreflog、detached HEADならHEADのreflog
+			current, err := repo.r.CurrentRef("HEAD")
+			if err != nil {
+				return "", err
+			}
+			name = current.Path
+		}
+
+		entries, err := repo.r.ReadReflog(name)
+		if err != nil {
+			return "", ErrorReflogEntryNotFound
+		}
+		if v.N >= len(entries) {
+			return "", ErrorReflogEntryNotFound
+		}
+
+		return entries[v.N].NewObjId, nil
 	case *Ref:
 		targetObjId, err := ResolveRef(v, repo)
 		if err != nil {
 			return "", AddInfoToObjConvertionError(v.Name, err)
 		}
 
+		//annotated tagならtagが指しているobjectまで辿る
+		targetObjId, err = PeelTag(targetObjId, repo)
+		if err != nil {
+			return "", AddInfoToObjConvertionError(v.Name, err)
+		}
+
 		//objIdがコミットかチェック
 		_, err = LoadTypedObject(targetObjId, "commit", repo)
 
@@ -149,6 +208,23 @@ func ResolveRev(obj BranchObj, repo *Repository) (string, error) {
 	}
 }
 
+//tagのtagもあるのでtag以外になるまで辿る
+func PeelTag(objId string, repo *Repository) (string, error) {
+	for {
+		o, err := repo.d.ReadObject(objId)
+		if err != nil {
+			return "", err
+		}
+
+		t, ok := o.(*con.Tag)
+		if !ok {
+			return objId, nil
+		}
+
+		objId = t.Object
+	}
+}
+
 func ConvertToWillWriteError(err *e.InvalidObjectError) error {
 
 	var str string
@@ -188,9 +264,10 @@ var ErrorNonExistObjId = errors.New("non exists objId")
 func PrefixMatch(name string, repo *Repository) (string, error) {
 	objDir := repo.d.ObjDirname(name)
 
-	candicates, err := repo.w.ListFiles(objDir)
-	if err != nil {
-		return "", err
+	//packされているとobjects/xxがないこともあるので、その時はpackの方だけで探す
+	candicates, looseErr := repo.w.ListFiles(objDir)
+	if looseErr != nil && !os.IsNotExist(looseErr) {
+		return "", looseErr
 	}
 
 	objIds := make([]string, 0, len(candicates))
@@ -202,6 +279,21 @@ func PrefixMatch(name string, repo *Repository) (string, error) {
 		}
 	}
 
+	packed, err := repo.d.PackedPrefixMatch(name)
+	if err != nil {
+		return "", err
+	}
+
+	for _, objId := range packed {
+		if !util.Contains(objIds, objId) {
+			objIds = append(objIds, objId)
+		}
+	}
+
+	if len(objIds) == 0 && looseErr != nil {
+		return "", looseErr
+	}
+
 	//完全なobjIdじゃなかったとしてもcandicateが一つなら通常実行
 	if len(objIds) == 1 {
 		return objIds[0], nil
@@ -270,6 +362,19 @@ func RunPrefixMatch(name, dirname, filename string) (string, bool) {
 
 func ParseRev(branchName string) (BranchObj, error) {
 
+	peelExp := util.CheckRegExpSubString(PEEL, branchName)
+	if len(peelExp) != 0 {
+		rev, err := ParseRev(peelExp[0][1])
+		if err != nil {
+			return nil, err
+		}
+
+		return &Peel{
+			Rev:  rev,
+			Type: peelExp[0][2],
+		}, nil
+	}
+
 	parentExp := util.CheckRegExpSubString(PARENT, branchName)
 	if len(parentExp) != 0 {
 		rev, err := ParseRev(parentExp[0][1])
@@ -317,6 +422,26 @@ func ParseRev(branchName string) (BranchObj, error) {
 		return ans, nil
 	}
 
+	//@{n}はCheckValidRefで弾かれるので先に見る
+	reflogExp := util.CheckRegExpSubString(REFLOG, branchName)
+	if len(reflogExp) != 0 {
+		n, err := strconv.Atoi(reflogExp[0][2])
+		if err != nil {
+			return nil, err
+		}
+
+		//@{1}だけならNameは""のまま、解決する時に今のbranchにする
+		name := reflogExp[0][1]
+		if alias, ok := aliasMap[name]; ok {
+			name = alias
+		}
+
+		return &Reflog{
+			Name: name,
+			N:    n,
+		}, nil
+	}
+
 	err := data.CheckValidRef(branchName)
 
 	if err != nil {
@@ -54,6 +54,40 @@ func Test_ParseRev(t *testing.T) {
 			},
 			ParentNum: 1,
 		}},
+		{"parsePeel", `v1.0^{}`, &Peel{
+			Rev: &Ref{
+				Name: "v1.0",
+			},
+			Type: "",
+		}},
+		{"parsePeelWithType", `v1.0^{commit}~2`, &Ancestor{
+			Rev: &Peel{
+				Rev: &Ref{
+					Name: "v1.0",
+				},
+				Type: "commit",
+			},
+			N: 2,
+		}},
+		{"parseReflog", `HEAD@{1}`, &Reflog{
+			Name: "HEAD",
+			N:    1,
+		}},
+		{"parseReflogWithParent", `master@{2}^`, &Parent{
+			Rev: &Reflog{
+				Name: "master",
+				N:    2,
+			},
+			ParentNum: 1,
+		}},
+		{"parseReflogAlias", `@@{0}`, &Reflog{
+			Name: "HEAD",
+			N:    0,
+		}},
+		{"parseReflogCurrentBranch", `@{0}`, &Reflog{
+			Name: "",
+			N:    0,
+		}},
 	} {
 		t.Run(d.title, func(t *testing.T) {
 			ret, err := ParseRev(d.targetString)
@@ -469,10 +469,12 @@ func (r *RevList) HandleRevision(name string) error {
 	rangeSlice := dUtil.CheckRegExpSubString(RANGE, name)
 	excludeSlice := dUtil.CheckRegExpSubString(EXCLUDE, name)
 
-	stat, _ := r.repo.w.StatFile(name)
+	//pathはcwdからの相対なので作業ディレクトリのrootからにする
+	path := r.repo.Pathspec(name)
+	stat, _ := r.repo.w.StatFile(path)
 	if stat != nil {
 		//branchNameじゃなくてFilePathだった場合
-		r.prune = append(r.prune, name)
+		r.prune = append(r.prune, path)
 	} else if len(rangeSlice) != 0 {
 		r.SetStartPoint(rangeSlice[0][1], true)
 		r.SetStartPoint(rangeSlice[0][2], false)
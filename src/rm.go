@@ -6,7 +6,6 @@ import (
 	"mygit/src/database/lock"
 	ers "mygit/src/errors"
 	"os"
-	"path/filepath"
 )
 
 type RmOption struct {
@@ -196,6 +195,17 @@ func RunRm(args []string, option *RmOption, repo *Repository, w io.Writer) error
 		return err
 	}
 
+	//skip-worktreeのentryは作業ディレクトリにないので消せない
+	var sparsePaths []string
+	for _, path := range examinedPaths {
+		if e, ok := repo.i.EntryForPath(path); ok && e.IsSkipWorktree() {
+			sparsePaths = append(sparsePaths, path)
+		}
+	}
+	if len(sparsePaths) > 0 {
+		return sparsePathError(sparsePaths)
+	}
+
 	for _, path := range examinedPaths {
 		err := rm.PlanRemoval(path)
 		if err != nil {
@@ -226,10 +236,10 @@ func RunRm(args []string, option *RmOption, repo *Repository, w io.Writer) error
 
 //RmはHEADと一致しているやつのみremove(これならもしrmしてもcommit済みということなので、そこのobjectsから取り出して、workspaceとindexを元に戻せるから)
 func StartRm(rootPath string, args []string, option *RmOption, w io.Writer) error {
-	gitPath := filepath.Join(rootPath, ".git")
-	dbPath := filepath.Join(gitPath, "objects")
-
-	repo := GenerateRepository(rootPath, gitPath, dbPath)
+	repo, err := DiscoverWorkTree(rootPath)
+	if err != nil {
+		return err
+	}
 
 	_, indexNonExist := os.Stat(repo.i.Path)
 
@@ -245,6 +255,6 @@ func StartRm(rootPath string, args []string, option *RmOption, w io.Writer) erro
 		}
 	}
 
-	return ers.HandleWillWriteError(RunRm(args, option, repo, w), w)
+	return ers.HandleWillWriteError(RunRm(repo.Pathspecs(args), option, repo, w), w)
 
 }
@@ -32,7 +32,7 @@ func PrepareCommit(t *testing.T) string {
 	is := []string{tempPath}
 
 	var buf bytes.Buffer
-	err = StartInit(is, &buf)
+	err = StartInit(is, &InitOption{}, &buf)
 	assert.NoError(t, err)
 	ss := []string{rel1, rel2}
 	err = StartAdd(tempPath, "test", "test@example.com", "test", ss)
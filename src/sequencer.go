@@ -8,7 +8,6 @@ import (
 	"io/ioutil"
 	con "mygit/src/database/content"
 	"mygit/src/database/lock"
-	"mygit/src/database/util"
 	ers "mygit/src/errors"
 	"os"
 	"path/filepath"
@@ -20,11 +19,42 @@ type ToDoType string
 const (
 	PICK   ToDoType = "pick"
 	REVERT          = "revert"
+	//ここからrebase -iで使う
+	REWORD ToDoType = "reword"
+	EDIT   ToDoType = "edit"
+	SQUASH ToDoType = "squash"
+	FIXUP  ToDoType = "fixup"
+	DROP   ToDoType = "drop"
+	EXEC   ToDoType = "exec"
 )
 
+//todoでは本家と同じく一文字の省略形も使える
+var toDoTypes = map[string]ToDoType{
+	"p":      PICK,
+	"pick":   PICK,
+	"revert": REVERT,
+	"r":      REWORD,
+	"reword": REWORD,
+	"e":      EDIT,
+	"edit":   EDIT,
+	"s":      SQUASH,
+	"squash": SQUASH,
+	"f":      FIXUP,
+	"fixup":  FIXUP,
+	"d":      DROP,
+	"drop":   DROP,
+	"x":      EXEC,
+	"exec":   EXEC,
+}
+
 type CommandContent struct {
 	c    *con.CommitFromMem
 	Type ToDoType
+	//execの時に実行するコマンド、execにはcommitがない
+	Arg string
+	//todoの何行目か、errorで行を示すのに使う
+	line int
+	text string
 }
 
 type Sequencer struct {
@@ -56,6 +86,11 @@ func (s *Sequencer) GetHeadPath() string {
 	return filepath.Join(s.Path, "head")
 }
 
+//message-squashはsquash,fixupが続いた時にそれまでのmessageを書いておく
+func (s *Sequencer) GetSquashMessagePath() string {
+	return filepath.Join(s.Path, "message-squash")
+}
+
 func (s *Sequencer) IsExists(path string) bool {
 	stat, _ := os.Stat(path)
 
@@ -128,7 +163,7 @@ func (s *Sequencer) Abort() error {
 	}
 
 	//headも戻しておく
-	origHead, err := s.repo.r.UpdateHead(beforeCherryObjId)
+	origHead, err := s.repo.r.WithReason(fmt.Sprintf("reset: moving to %s", beforeCherryObjId)).UpdateHead(beforeCherryObjId)
 	if err != nil {
 		return err
 	}
@@ -214,6 +249,8 @@ func (s *Sequencer) NextCommand() *CommandContent {
 //todoFileにはcherryPickの際にconflictしてmergeされなかったcommitが下記のように書き込まれる
 // pick shortObjId message(firstLine)
 // pick ...
+//rebase -iではユーザーが編集するので、空行と#のコメントは読み飛ばし、不正な行は行番号つきのerrorにする
+//exec <command>だけはcommitをとらない
 
 //\Sは非空白文字のこと
 var PickExp = `^(\S+) (\S+) (.*)$`
@@ -223,19 +260,52 @@ func (s *Sequencer) ParseToDo(content string) error {
 
 	sc := bufio.NewScanner(buf)
 
+	lineNum := 0
 	for sc.Scan() {
-		pickExped := util.CheckRegExpSubString(PickExp, sc.Text())
-		if len(pickExped) == 0 {
-			return ErrorInvalidToDoContent
+		lineNum++
+		line := sc.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
 		}
 
-		toDoType := pickExped[0][1]
+		invalid := func(reason string) error {
+			return &ers.InvalidToDoLineError{
+				Line:    lineNum,
+				Content: line,
+				Reason:  reason,
+			}
+		}
 
-		pickObjId := pickExped[0][2]
+		word, rest, _ := strings.Cut(trimmed, " ")
+		toDoType, ok := toDoTypes[word]
+		if !ok {
+			return invalid(fmt.Sprintf("invalid command '%s'", word))
+		}
 
-		objId, err := PrefixMatch(pickObjId, s.repo)
+		rest = strings.TrimSpace(rest)
+
+		if toDoType == EXEC {
+			if rest == "" {
+				return invalid("missing command for 'exec'")
+			}
+			s.Command = append(s.Command, &CommandContent{
+				Type: EXEC,
+				Arg:  rest,
+				line: lineNum,
+				text: line,
+			})
+			continue
+		}
+
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			return invalid(fmt.Sprintf("missing commit for '%s'", toDoType))
+		}
+
+		objId, err := PrefixMatch(fields[0], s.repo)
 		if err != nil {
-			return err
+			return invalid(fmt.Sprintf("could not parse '%s'", fields[0]))
 		}
 
 		o, err := s.repo.d.ReadObject(objId)
@@ -245,12 +315,14 @@ func (s *Sequencer) ParseToDo(content string) error {
 
 		c, ok := o.(*con.CommitFromMem)
 		if !ok {
-			return ErrorObjeToEntryConvError
+			return invalid(fmt.Sprintf("'%s' is not a commit", fields[0]))
 		}
 
 		s.Command = append(s.Command, &CommandContent{
-			Type: ToDoType(toDoType),
+			Type: toDoType,
 			c:    c,
+			line: lineNum,
+			text: line,
 		})
 	}
 
@@ -287,6 +359,10 @@ func (s *Sequencer) WriteToDo() error {
 	}
 
 	for _, content := range s.Command {
+		if content.Type == EXEC {
+			f.Write([]byte(fmt.Sprintf("%s %s\n", content.Type, content.Arg)))
+			continue
+		}
 		shortObjId := s.repo.d.ShortObjId(content.c.ObjId)
 		f.Write([]byte(fmt.Sprintf("%s %s %s\n", content.Type, shortObjId, content.c.GetFirstLineMessage())))
 	}
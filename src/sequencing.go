@@ -66,12 +66,32 @@ func HandleSequencingContinue(sd *SequenceData, sc SequencingClass) error {
 }
 
 func RunCommand(command *CommandContent, sd *SequenceData) error {
+	err := ResetSquashMessage(command.Type, sd.repo)
+	if err != nil {
+		return err
+	}
+
 	switch command.Type {
 	case PICK:
 		return RunPick(command.c, sd)
 
 	case REVERT:
 		return RunRevert(command.c, sd)
+
+	case REWORD:
+		return RunReword(command.c, sd)
+
+	case EDIT:
+		return RunEdit(command.c, sd)
+
+	case SQUASH, FIXUP:
+		return RunSquash(command, sd)
+
+	case DROP:
+		return nil
+
+	case EXEC:
+		return RunExec(command.Arg, sd)
 	default:
 		return ErrorInvalidToDoContent
 	}
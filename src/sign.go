@@ -0,0 +1,141 @@
+package src
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	con "mygit/src/database/content"
+	"mygit/src/sshsig"
+	"os"
+	"strings"
+	"time"
+)
+
+//commit -S,tag -sはuser.signingKeyの鍵でsshsigの署名を作る(gpg.format=sshだけ)
+//commitは署名をgpgsigのheaderに、tagはmessageのあとにつける
+//検証はgpg.ssh.allowedSignersFileに書かれた鍵で署名されたものだけをGoodとする
+
+var (
+	ErrorUnsupportedSignFormat = errors.New("only gpg.format=ssh is supported for signing")
+	ErrorNoSigningKey          = errors.New("user.signingkey needs to be set for ssh signing")
+	ErrorNoAllowedSigners      = errors.New("gpg.ssh.allowedSignersFile needs to be configured and exist for ssh signature verification")
+	ErrorNoSignature           = errors.New("no signature found")
+	ErrorNoPrincipal           = errors.New("no principal matched")
+)
+
+//検証できた署名
+type SignatureResult struct {
+	Principal string
+	Key       *sshsig.PublicKey
+}
+
+//本家のssh-keygen -Y verifyと同じ1行
+func (r *SignatureResult) String() string {
+	return fmt.Sprintf("Good \"%s\" signature for %s with %s key %s", sshsig.NAMESPACE_GIT, r.Principal, r.Key.KeyName(), r.Key.Fingerprint())
+}
+
+//user.signingKeyの秘密鍵、.pubを指していれば同じ名前の秘密鍵を読む
+func (repo *Repository) signingKey() (*sshsig.PrivateKey, error) {
+	cs, err := repo.Config()
+	if err != nil {
+		return nil, err
+	}
+	if cs.GpgFormat() != "ssh" {
+		return nil, ErrorUnsupportedSignFormat
+	}
+
+	path, ok := cs.SigningKey()
+	//key::ssh-ed25519 AAAA...の形はssh-agentが要るので扱わない
+	if !ok || strings.HasPrefix(path, "key::") {
+		return nil, ErrorNoSigningKey
+	}
+
+	content, err := ioutil.ReadFile(strings.TrimSuffix(path, ".pub"))
+	if err != nil {
+		return nil, err
+	}
+
+	return sshsig.ParsePrivateKey(content)
+}
+
+func (repo *Repository) sign(payload string) (string, error) {
+	key, err := repo.signingKey()
+	if err != nil {
+		return "", err
+	}
+
+	return sshsig.Sign(key, []byte(payload), sshsig.NAMESPACE_GIT)
+}
+
+//署名はgpgsigを除いたcommitに対して作る、sha256のrepositoryではgpgsig-sha256に入れる
+func (repo *Repository) SignCommit(c *con.Commit) error {
+	//treeのobjIdはStoreするまで決まらないので先に計算しておく
+	c.Tree.Traverse(func(t *con.Tree) {
+		repo.d.SetObjId(t, repo.d.CreateContent(t))
+	})
+
+	signature, err := repo.sign(c.ToString())
+	if err != nil {
+		return err
+	}
+
+	c.Headers = append(c.Headers, &con.CommitHeader{
+		Key:   con.SignatureHeader(repo.Hash()),
+		Value: strings.TrimSuffix(signature, "\n"),
+	})
+
+	return nil
+}
+
+func (repo *Repository) SignTag(t *con.Tag) error {
+	signature, err := repo.sign(t.Payload())
+	if err != nil {
+		return err
+	}
+
+	t.Signature = signature
+
+	return nil
+}
+
+//atは署名したcommitやtagの日時、allowed signersのvalid-after,valid-beforeと比べる
+func (repo *Repository) VerifySignature(signature, payload string, at time.Time) (*SignatureResult, error) {
+	cs, err := repo.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	path, ok := cs.AllowedSignersFile()
+	if !ok {
+		return nil, ErrorNoAllowedSigners
+	}
+	signers, err := sshsig.LoadAllowedSigners(path)
+	if os.IsNotExist(err) {
+		return nil, ErrorNoAllowedSigners
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := sshsig.Verify(signature, []byte(payload), sshsig.NAMESPACE_GIT)
+	if err != nil {
+		return nil, err
+	}
+
+	principals := sshsig.FindPrincipals(signers, key, sshsig.NAMESPACE_GIT, at)
+	if len(principals) == 0 {
+		return nil, fmt.Errorf("%s key %s: %w", key.KeyName(), key.Fingerprint(), ErrorNoPrincipal)
+	}
+
+	return &SignatureResult{Principal: principals[0], Key: key}, nil
+}
+
+//log --show-signatureで出す行
+func (repo *Repository) SignatureStatus(signature, payload string, at time.Time) string {
+	result, err := repo.VerifySignature(signature, payload, at)
+	if err != nil {
+		return fmt.Sprintf("Could not verify signature: %v", err)
+	}
+
+	return result.String()
+}
@@ -0,0 +1,186 @@
+package src
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mygit/src/crypt"
+	con "mygit/src/database/content"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//sshsig/testDataのssh-keygenで作った鍵を使う
+const signingKeyFingerprint = "SHA256:1NYEQyGuWKo+meAb1K6MzuuYiSeERhwNwwAi2yREmyk"
+
+//user.signingKeyとgpg.ssh.allowedSignersFileを設定したrepository
+func PrepareSigningRepo(t *testing.T) (string, *Repository, string) {
+	home := SetConfigHomeForTest(t)
+	tempPath, repo := PrepareTagRepo(t)
+
+	return tempPath, repo, ConfigureSigningForTest(t, home, tempPath)
+}
+
+//globalのconfigに鍵を設定して、allowed signersのpathを返す
+func ConfigureSigningForTest(t *testing.T, home, tempPath string) string {
+	var buf bytes.Buffer
+
+	pub, err := ioutil.ReadFile(filepath.Join("sshsig", "testData", "id_ed25519.pub"))
+	assert.NoError(t, err)
+	allowedPath := filepath.Join(home, "allowed_signers")
+	err = ioutil.WriteFile(allowedPath, append([]byte("test@example.com "), pub...), 0644)
+	assert.NoError(t, err)
+
+	keyPath, err := filepath.Abs(filepath.Join("sshsig", "testData", "id_ed25519.pub"))
+	assert.NoError(t, err)
+
+	for _, kv := range [][]string{
+		{"gpg.format", "ssh"},
+		{"user.signingKey", keyPath},
+		{"gpg.ssh.allowedSignersFile", allowedPath},
+	} {
+		err := StartConfig(tempPath, kv, &ConfigOption{Global: true}, &buf)
+		assert.NoError(t, err)
+	}
+
+	return allowedPath
+}
+
+func TestSignedCommit(t *testing.T) {
+	tempPath, repo, allowedPath := PrepareSigningRepo(t)
+	var buf bytes.Buffer
+
+	CreateFiles(t, tempPath, "hello.txt", "signed\n")
+	err := StartAdd(tempPath, "test", "test@example.com", "", []string{"."})
+	assert.NoError(t, err)
+	err = StartCommitWithOption(tempPath, "test", "test@example.com", "signed", &CommitOption{Sign: true}, &buf)
+	assert.NoError(t, err)
+
+	head := ReadCommitForTest(t, "HEAD", repo)
+	signature, ok := head.Signature(repo.Hash())
+	assert.True(t, ok)
+	assert.Contains(t, signature, "-----BEGIN SSH SIGNATURE-----\n")
+	assert.NotContains(t, head.Payload(), con.SIGNATURE_HEADER)
+	assert.Equal(t, "signed", head.Message)
+
+	good := "Good \"git\" signature for test@example.com with ED25519 key " + signingKeyFingerprint + "\n"
+	buf.Reset()
+	err = StartVerifyCommit(tempPath, []string{"HEAD"}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, good, buf.String())
+
+	buf.Reset()
+	err = StartLog(tempPath, []string{"HEAD~1..HEAD"}, &LogOption{ShowSignature: true}, &buf)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "\n"+good+"Author: test <test@example.com>\n")
+
+	//署名のないcommit
+	err = StartVerifyCommit(tempPath, []string{"HEAD^"}, &buf)
+	assert.ErrorIs(t, err, ErrorNoSignature)
+
+	//commitの時点でvalid-beforeを過ぎている鍵は使えない
+	pub, err := ioutil.ReadFile(filepath.Join("sshsig", "testData", "id_ed25519.pub"))
+	assert.NoError(t, err)
+	err = ioutil.WriteFile(allowedPath, append([]byte(`test@example.com valid-before="20200101Z" `), pub...), 0644)
+	assert.NoError(t, err)
+	err = StartVerifyCommit(tempPath, []string{"HEAD"}, &buf)
+	assert.ErrorIs(t, err, ErrorNoPrincipal)
+
+	//allowed signersにない鍵はGoodにならない
+	err = ioutil.WriteFile(allowedPath, []byte("# nobody\n"), 0644)
+	assert.NoError(t, err)
+	err = StartVerifyCommit(tempPath, []string{"HEAD"}, &buf)
+	assert.ErrorIs(t, err, ErrorNoPrincipal)
+	buf.Reset()
+	err = StartLog(tempPath, []string{"HEAD~1..HEAD"}, &LogOption{ShowSignature: true}, &buf)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "Could not verify signature")
+}
+
+//sha256のrepositoryでは本家と同じくgpgsig-sha256に署名を入れる
+func TestSignedCommitSHA256(t *testing.T) {
+	home := SetConfigHomeForTest(t)
+	tempPath, repo := PrepareObjectFormatRepo(t, crypt.SHA256)
+	ConfigureSigningForTest(t, home, tempPath)
+	var buf bytes.Buffer
+
+	CreateFiles(t, tempPath, "hello.txt", "signed\n")
+	err := StartAdd(tempPath, "test", "test@example.com", "", []string{"."})
+	assert.NoError(t, err)
+	err = StartCommitWithOption(tempPath, "test", "test@example.com", "signed", &CommitOption{Sign: true}, &buf)
+	assert.NoError(t, err)
+
+	head := ReadCommitForTest(t, "HEAD", repo)
+	assert.Contains(t, head.ToString(), "\n"+con.SIGNATURE_HEADER_SHA256+" -----BEGIN SSH SIGNATURE-----\n")
+	_, ok := head.Signature(crypt.SHA1)
+	assert.False(t, ok)
+	_, ok = head.Signature(repo.Hash())
+	assert.True(t, ok)
+	assert.NotContains(t, head.Payload(), con.SIGNATURE_HEADER_SHA256)
+
+	buf.Reset()
+	err = StartVerifyCommit(tempPath, []string{"HEAD"}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "Good \"git\" signature for test@example.com with ED25519 key "+signingKeyFingerprint+"\n", buf.String())
+}
+
+func TestCommitGpgSignConfig(t *testing.T) {
+	tempPath, repo, _ := PrepareSigningRepo(t)
+	var buf bytes.Buffer
+
+	err := StartConfig(tempPath, []string{"commit.gpgSign", "true"}, &ConfigOption{}, &buf)
+	assert.NoError(t, err)
+	CreateFiles(t, tempPath, "hello.txt", "config\n")
+	err = StartAdd(tempPath, "test", "test@example.com", "", []string{"."})
+	assert.NoError(t, err)
+	err = StartCommit(tempPath, "test", "test@example.com", "by config", &buf)
+	assert.NoError(t, err)
+
+	_, ok := ReadCommitForTest(t, "HEAD", repo).Signature(repo.Hash())
+	assert.True(t, ok)
+
+	//gpg.format=sshでなければ署名しない
+	err = StartConfig(tempPath, []string{"gpg.format", "openpgp"}, &ConfigOption{}, &buf)
+	assert.NoError(t, err)
+	CreateFiles(t, tempPath, "hello.txt", "openpgp\n")
+	err = StartAdd(tempPath, "test", "test@example.com", "", []string{"."})
+	assert.NoError(t, err)
+	err = StartCommit(tempPath, "test", "test@example.com", "openpgp", &buf)
+	assert.ErrorIs(t, err, ErrorUnsupportedSignFormat)
+}
+
+func TestSignedTag(t *testing.T) {
+	tempPath, repo, _ := PrepareSigningRepo(t)
+	var buf bytes.Buffer
+
+	err := StartTag(tempPath, "test", "test@example.com", []string{"v1.0"}, &TagOption{Sign: true, Message: "release v1.0"}, &buf)
+	assert.NoError(t, err)
+	err = StartTag(tempPath, "test", "test@example.com", []string{"v0.1", "HEAD^"}, &TagOption{}, &buf)
+	assert.NoError(t, err)
+
+	objId, err := repo.r.ReadRef("v1.0")
+	assert.NoError(t, err)
+	o, err := repo.d.ReadObject(objId)
+	assert.NoError(t, err)
+	tag, ok := o.(*con.Tag)
+	assert.True(t, ok)
+	assert.Equal(t, "release v1.0", tag.Message)
+	assert.Contains(t, tag.Signature, "-----BEGIN SSH SIGNATURE-----\n")
+	//読み直しても同じobjIdになる
+	repo.d.SetObjId(tag, repo.d.CreateContent(tag))
+	assert.Equal(t, objId, tag.GetObjId())
+
+	buf.Reset()
+	err = StartVerifyTag(tempPath, []string{"v1.0"}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "Good \"git\" signature for test@example.com with ED25519 key "+signingKeyFingerprint+"\n", buf.String())
+
+	//lightweight tagはcommitを指すので検証できない
+	err = StartVerifyTag(tempPath, []string{"v0.1"}, &buf)
+	assert.Error(t, err)
+
+	//-sは-mが要る
+	err = StartTag(tempPath, "test", "test@example.com", []string{"v2.0"}, &TagOption{Sign: true}, &buf)
+	assert.ErrorIs(t, err, ErrorEmptyTagMessage)
+}
@@ -0,0 +1,379 @@
+package src
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	data "mygit/src/database"
+	con "mygit/src/database/content"
+	"mygit/src/database/lock"
+	ers "mygit/src/errors"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+//本家のcone modeと同じく、.git/info/sparse-checkoutにdirectoryだけを書く
+//rootのファイルと、指定したdirectoryの中すべてと、その親directoryの直下のファイルを作業ディレクトリに置く
+//それ以外のentryはskip-worktreeの印をつけてindexにだけ残す
+
+var (
+	ErrorUnknownSparseCheckoutCmd = errors.New("unknown sparse-checkout subcommand")
+	ErrorNotSparse                = errors.New("this worktree is not sparse")
+	ErrorSparseCheckoutNotCone    = errors.New("sparse-checkout file is not in cone mode")
+)
+
+const (
+	SPARSE_CHECKOUT_FILE = "sparse-checkout"
+	//rootのファイルはすべて、rootのdirectoryは指定したものだけ
+	SPARSE_CONE_ROOT     = "/*"
+	SPARSE_CONE_ROOT_DIR = "!/*/"
+)
+
+type SparseCheckout struct {
+	//中すべてを置くdirectory、/区切り
+	Dirs []string
+	//Dirsの親、直下のファイルだけを置く
+	parents map[string]struct{}
+}
+
+func GenerateSparseCheckout(dirs []string) *SparseCheckout {
+	sc := &SparseCheckout{
+		parents: make(map[string]struct{}),
+	}
+
+	sorted := append([]string{}, dirs...)
+	sort.Strings(sorted)
+	for _, d := range sorted {
+		//すでに親が入っているものはいらない
+		if sc.includesDir(d) {
+			continue
+		}
+		sc.Dirs = append(sc.Dirs, d)
+	}
+	for _, d := range sc.Dirs {
+		for p := path.Dir(d); p != "."; p = path.Dir(p) {
+			sc.parents[p] = struct{}{}
+		}
+	}
+
+	return sc
+}
+
+func (sc *SparseCheckout) includesDir(dir string) bool {
+	for _, d := range sc.Dirs {
+		if dir == d || strings.HasPrefix(dir, d+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+//nilならsparse-checkoutしていないので、すべて作業ディレクトリに置く
+func (sc *SparseCheckout) Includes(p string) bool {
+	if sc == nil {
+		return true
+	}
+
+	dir := path.Dir(filepath.ToSlash(p))
+	if dir == "." {
+		return true
+	}
+	if _, ok := sc.parents[dir]; ok {
+		return true
+	}
+
+	return sc.includesDir(dir)
+}
+
+//本家と同じくaddやrmでsparse-checkoutの外のpathを指定したときのmessage
+func sparsePathError(paths []string) error {
+	return &ers.SparsePathError{
+		Message: fmt.Sprintf("The following paths and/or pathspecs matched paths that exist\noutside of your sparse-checkout definition, so will not be\nupdated in the index:\n%s\n", strings.Join(paths, "\n")),
+	}
+}
+
+func SparseCheckoutPath(repo *Repository) string {
+	return filepath.Join(repo.r.Path, "info", SPARSE_CHECKOUT_FILE)
+}
+
+//core.sparseCheckoutがtrueでなければnil
+func LoadSparseCheckout(repo *Repository) (*SparseCheckout, error) {
+	cs, err := repo.Config()
+	if err != nil {
+		return nil, err
+	}
+	enabled, err := cs.CoreSparseCheckout()
+	if err != nil || !enabled {
+		return nil, err
+	}
+
+	content, err := ioutil.ReadFile(SparseCheckoutPath(repo))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return GenerateSparseCheckout(nil), nil
+		}
+		return nil, err
+	}
+
+	return ParseSparseCheckout(string(content))
+}
+
+///a/と!/a/*/があればaは親、/a/だけならaの中すべて
+func ParseSparseCheckout(content string) (*SparseCheckout, error) {
+	var dirs []string
+	parents := make(map[string]struct{})
+
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+			continue
+		case line == SPARSE_CONE_ROOT || line == SPARSE_CONE_ROOT_DIR:
+			continue
+		case strings.HasPrefix(line, "!/") && strings.HasSuffix(line, "/*/"):
+			parents[strings.TrimSuffix(strings.TrimPrefix(line, "!/"), "/*/")] = struct{}{}
+		case strings.HasPrefix(line, "/") && strings.HasSuffix(line, "/") && len(line) > 2 && !strings.Contains(line, "*"):
+			dirs = append(dirs, strings.Trim(line, "/"))
+		default:
+			return nil, fmt.Errorf("%w: '%s'", ErrorSparseCheckoutNotCone, line)
+		}
+	}
+
+	var recursive []string
+	for _, d := range dirs {
+		if _, ok := parents[d]; ok {
+			continue
+		}
+		recursive = append(recursive, d)
+	}
+
+	return GenerateSparseCheckout(recursive), nil
+}
+
+func (sc *SparseCheckout) String() string {
+	var paths []string
+	for p := range sc.parents {
+		paths = append(paths, p)
+	}
+	paths = append(paths, sc.Dirs...)
+	sort.Strings(paths)
+
+	content := SPARSE_CONE_ROOT + "\n" + SPARSE_CONE_ROOT_DIR + "\n"
+	for _, p := range paths {
+		content += fmt.Sprintf("/%s/\n", p)
+		if _, ok := sc.parents[p]; ok {
+			content += fmt.Sprintf("!/%s/*/\n", p)
+		}
+	}
+
+	return content
+}
+
+func (sc *SparseCheckout) Write(repo *Repository) error {
+	p := SparseCheckoutPath(repo)
+	err := os.MkdirAll(filepath.Dir(p), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(p, []byte(sc.String()), 0644)
+}
+
+func StartSparseCheckout(rootPath string, args []string, w io.Writer) error {
+	repo, err := DiscoverWorkTree(rootPath)
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		return ErrorUnknownSparseCheckoutCmd
+	}
+	command := args[0]
+	args = args[1:]
+
+	_, indexNonExist := os.Stat(repo.i.Path)
+
+	l := lock.NewFileLock(repo.i.Path)
+	l.Lock()
+	defer l.Unlock()
+
+	if indexNonExist == nil {
+		err := repo.i.Load()
+		if err != nil {
+			return err
+		}
+	}
+
+	current, err := LoadSparseCheckout(repo)
+	if err != nil {
+		return err
+	}
+
+	var sc *SparseCheckout
+	switch command {
+	case "set":
+		sc = GenerateSparseCheckout(sparseDirs(args, repo))
+	case "add":
+		if current == nil {
+			return ErrorNotSparse
+		}
+		sc = GenerateSparseCheckout(append(current.Dirs, sparseDirs(args, repo)...))
+	case "reapply":
+		if current == nil {
+			return ErrorNotSparse
+		}
+		sc = current
+	case "list":
+		if current == nil {
+			return ErrorNotSparse
+		}
+		for _, d := range current.Dirs {
+			w.Write([]byte(d + "\n"))
+		}
+		return nil
+	case "disable":
+		//すべてのentryを作業ディレクトリに戻してからsparseをやめる
+		err := UpdateSparsity(nil, repo, w)
+		if err != nil {
+			return err
+		}
+		return setSparseCheckoutConfig(false, repo)
+	default:
+		return ErrorUnknownSparseCheckoutCmd
+	}
+
+	err = sc.Write(repo)
+	if err != nil {
+		return err
+	}
+	err = setSparseCheckoutConfig(true, repo)
+	if err != nil {
+		return err
+	}
+
+	return UpdateSparsity(sc, repo, w)
+}
+
+//作業ディレクトリのrootからの/区切りのdirectory
+func sparseDirs(args []string, repo *Repository) []string {
+	var dirs []string
+	for _, arg := range args {
+		d := filepath.ToSlash(repo.Pathspec(arg))
+		if d == "." || d == "" {
+			continue
+		}
+		dirs = append(dirs, strings.Trim(d, "/"))
+	}
+	return dirs
+}
+
+func setSparseCheckoutConfig(enabled bool, repo *Repository) error {
+	c, err := LoadConfig(repo)
+	if err != nil {
+		return err
+	}
+	c.Set("core", "", "sparseCheckout", fmt.Sprintf("%t", enabled))
+	if enabled {
+		c.Set("core", "", "sparseCheckoutCone", "true")
+	}
+
+	return c.Save()
+}
+
+//scに合わせてentryを作業ディレクトリに書き出すか消して、skip-worktreeの印をつけ直す
+//作業ディレクトリで変更されているものは本家と同じく消さずに残す
+func UpdateSparsity(sc *SparseCheckout, repo *Repository, w io.Writer) error {
+	entries, err := repo.i.GetEntries()
+	if err != nil {
+		return err
+	}
+
+	in := &Inspector{repo: repo}
+	var notUpToDate []string
+	for _, e := range entries {
+		if e.GetStage() != 0 || e.IsGitlink() {
+			continue
+		}
+
+		if sc.Includes(e.Path) {
+			if !e.IsSkipWorktree() {
+				continue
+			}
+			err := checkoutSkippedEntry(e, repo)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if e.IsSkipWorktree() {
+			continue
+		}
+		if stat, err := repo.w.StatFile(e.Path); err == nil {
+			changed, err := in.CompareIndextoWorkSpace(e, stat)
+			if err != nil {
+				return err
+			}
+			if changed != "" {
+				notUpToDate = append(notUpToDate, e.Path)
+				continue
+			}
+			err = repo.w.Remove(e.Path)
+			if err != nil {
+				return err
+			}
+		}
+		repo.i.SetSkipWorktree(e, true)
+	}
+
+	if len(notUpToDate) > 0 {
+		content := "warning: The following paths are not up to date and were left despite sparse patterns:\n"
+		for _, p := range notUpToDate {
+			content += fmt.Sprintf("\t%s\n", p)
+		}
+		content += "\nAfter fixing the above paths, you may want to run `mgit sparse-checkout reapply`.\n"
+		w.Write([]byte(content))
+	}
+
+	return repo.i.Write(repo.i.Path)
+}
+
+func checkoutSkippedEntry(e *con.Entry, repo *Repository) error {
+	o, err := repo.d.ReadObject(e.ObjId)
+	if err != nil {
+		return err
+	}
+	b, ok := o.(*con.Blob)
+	if !ok {
+		return ErrorObjeToEntryConvError
+	}
+
+	err = repo.w.WriteFileWithMode(e.Path, b.Content, e.Mode)
+	if err != nil {
+		return err
+	}
+	stat, err := repo.w.StatFile(e.Path)
+	if err != nil {
+		return err
+	}
+
+	return repo.i.Add(e.Path, e.ObjId, stat, data.CreateIndex)
+}
+
+//作業ディレクトリには書かないので、statは0のままにしてmodeだけ入れる
+func AddSkipWorktree(path string, e *con.Entry, repo *Repository) error {
+	return repo.i.Add(path, e.ObjId, nil, func(path, objId string, state con.FileState) *con.Entry {
+		entry := &con.Entry{
+			Mode:  e.Mode,
+			ObjId: objId,
+			Flags: con.CreateFlags(0, path),
+			Path:  path,
+		}
+		entry.SetSkipWorktree(true)
+		return entry
+	})
+}
@@ -0,0 +1,305 @@
+package src
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	ers "mygit/src/errors"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//rootとa,a/b,a/c,dにファイルを置いてcommitする
+func PrepareSparseRepo(t *testing.T) (string, *Repository) {
+	tempPath, repo := PrepareRebaseRepo(t)
+	var buf bytes.Buffer
+
+	for _, dir := range []string{"a/b", "a/c", "d"} {
+		err := os.MkdirAll(filepath.Join(tempPath, dir), os.ModePerm)
+		assert.NoError(t, err)
+	}
+	for name, content := range map[string]string{
+		"root.txt":  "root\n",
+		"a/x.txt":   "x\n",
+		"a/b/y.txt": "y\n",
+		"a/c/z.txt": "z\n",
+		"d/w.txt":   "w\n",
+	} {
+		CreateFiles(t, tempPath, name, content)
+	}
+	err := StartAdd(tempPath, "test", "test@example.com", "test", []string{"."})
+	assert.NoError(t, err)
+	err = StartCommit(tempPath, "test", "test@example.com", "first", &buf)
+	assert.NoError(t, err)
+
+	return tempPath, repo
+}
+
+func AssertWorkSpaceFiles(t *testing.T, rootPath string, present, absent []string) {
+	for _, p := range present {
+		_, err := os.Stat(filepath.Join(rootPath, p))
+		assert.NoError(t, err, p)
+	}
+	for _, p := range absent {
+		_, err := os.Stat(filepath.Join(rootPath, p))
+		assert.True(t, os.IsNotExist(err), p)
+	}
+}
+
+func TestSparseCheckoutPatterns(t *testing.T) {
+	sc := GenerateSparseCheckout([]string{"c", "a/b", "a/b/deep"})
+	assert.Equal(t, []string{"a/b", "c"}, sc.Dirs)
+	assert.Equal(t, "/*\n!/*/\n/a/\n!/a/*/\n/a/b/\n/c/\n", sc.String())
+
+	parsed, err := ParseSparseCheckout(sc.String())
+	assert.NoError(t, err)
+	assert.Equal(t, sc.Dirs, parsed.Dirs)
+
+	for _, tt := range []struct {
+		path     string
+		includes bool
+	}{
+		{"root.txt", true},
+		{"a/x.txt", true},
+		{"a/b/y.txt", true},
+		{"a/b/deep/y.txt", true},
+		{"a/c/z.txt", false},
+		{"a/bb/z.txt", false},
+		{"c/w.txt", true},
+		{"d/w.txt", false},
+	} {
+		assert.Equal(t, tt.includes, sc.Includes(tt.path), tt.path)
+	}
+
+	var nilSparse *SparseCheckout
+	assert.True(t, nilSparse.Includes("d/w.txt"))
+
+	_, err = ParseSparseCheckout("/*\n!/*/\n*.txt\n")
+	assert.ErrorIs(t, err, ErrorSparseCheckoutNotCone)
+}
+
+func TestSparseCheckoutSetAddDisable(t *testing.T) {
+	tempPath, repo := PrepareSparseRepo(t)
+	var buf bytes.Buffer
+
+	err := StartSparseCheckout(tempPath, []string{"list"}, &buf)
+	assert.ErrorIs(t, err, ErrorNotSparse)
+
+	err = StartSparseCheckout(tempPath, []string{"set", "a/b"}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "", buf.String())
+	AssertWorkSpaceFiles(t, tempPath, []string{"root.txt", "a/x.txt", "a/b/y.txt"}, []string{"a/c", "d"})
+
+	content, err := ioutil.ReadFile(SparseCheckoutPath(repo))
+	assert.NoError(t, err)
+	assert.Equal(t, "/*\n!/*/\n/a/\n!/a/*/\n/a/b/\n", string(content))
+
+	err = repo.i.Load()
+	assert.NoError(t, err)
+	e, ok := repo.i.EntryForPath("d/w.txt")
+	assert.True(t, ok)
+	assert.True(t, e.IsSkipWorktree())
+	e, ok = repo.i.EntryForPath("a/b/y.txt")
+	assert.True(t, ok)
+	assert.False(t, e.IsSkipWorktree())
+
+	//skipしたpathは消えたことにならない
+	buf.Reset()
+	err = StartStatus(&buf, tempPath, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "", buf.String())
+
+	buf.Reset()
+	err = StartSparseCheckout(tempPath, []string{"add", "d"}, &buf)
+	assert.NoError(t, err)
+	AssertWorkSpaceFiles(t, tempPath, []string{"d/w.txt"}, []string{"a/c"})
+
+	buf.Reset()
+	err = StartSparseCheckout(tempPath, []string{"list"}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "a/b\nd\n", buf.String())
+
+	buf.Reset()
+	err = StartSparseCheckout(tempPath, []string{"disable"}, &buf)
+	assert.NoError(t, err)
+	AssertWorkSpaceFiles(t, tempPath, []string{"root.txt", "a/x.txt", "a/b/y.txt", "a/c/z.txt", "d/w.txt"}, nil)
+	z, err := ioutil.ReadFile(filepath.Join(tempPath, "a", "c", "z.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "z\n", string(z))
+
+	err = repo.i.Load()
+	assert.NoError(t, err)
+	e, ok = repo.i.EntryForPath("a/c/z.txt")
+	assert.True(t, ok)
+	assert.False(t, e.IsSkipWorktree())
+
+	buf.Reset()
+	err = StartStatus(&buf, tempPath, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "", buf.String())
+
+	err = StartSparseCheckout(tempPath, []string{"list"}, &buf)
+	assert.ErrorIs(t, err, ErrorNotSparse)
+}
+
+func TestSparseCheckoutKeepsModifiedFiles(t *testing.T) {
+	tempPath, repo := PrepareSparseRepo(t)
+	var buf bytes.Buffer
+
+	CreateFiles(t, tempPath, "d/w.txt", "changed\n")
+
+	err := StartSparseCheckout(tempPath, []string{"set", "a"}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "warning: The following paths are not up to date and were left despite sparse patterns:\n\td/w.txt\n\nAfter fixing the above paths, you may want to run `mgit sparse-checkout reapply`.\n", buf.String())
+	AssertWorkSpaceFiles(t, tempPath, []string{"d/w.txt", "a/c/z.txt"}, nil)
+
+	err = repo.i.Load()
+	assert.NoError(t, err)
+	e, ok := repo.i.EntryForPath("d/w.txt")
+	assert.True(t, ok)
+	assert.False(t, e.IsSkipWorktree())
+
+	//変更を戻してからreapplyすると消える
+	CreateFiles(t, tempPath, "d/w.txt", "w\n")
+	buf.Reset()
+	err = StartSparseCheckout(tempPath, []string{"reapply"}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "", buf.String())
+	AssertWorkSpaceFiles(t, tempPath, nil, []string{"d"})
+}
+
+func TestSparseCheckoutCheckout(t *testing.T) {
+	tempPath, repo := PrepareSparseRepo(t)
+	var buf bytes.Buffer
+
+	err := StartBranch(tempPath, []string{"topic"}, &BranchOption{}, &buf)
+	assert.NoError(t, err)
+	err = StartCheckout(tempPath, []string{"topic"}, &buf)
+	assert.NoError(t, err)
+	CreateFiles(t, tempPath, "a/b/y.txt", "y2\n")
+	CreateFiles(t, tempPath, "d/w.txt", "w2\n")
+	err = StartAdd(tempPath, "test", "test@example.com", "test", []string{"."})
+	assert.NoError(t, err)
+	err = StartCommit(tempPath, "test", "test@example.com", "second", &buf)
+	assert.NoError(t, err)
+	err = StartCheckout(tempPath, []string{"master"}, &buf)
+	assert.NoError(t, err)
+
+	err = StartSparseCheckout(tempPath, []string{"set", "a/b"}, &buf)
+	assert.NoError(t, err)
+
+	//sparse-checkoutの外の変更はindexにだけ入る
+	err = StartCheckout(tempPath, []string{"topic"}, &buf)
+	assert.NoError(t, err)
+	AssertWorkSpaceFiles(t, tempPath, []string{"a/b/y.txt"}, []string{"d"})
+	y, err := ioutil.ReadFile(filepath.Join(tempPath, "a", "b", "y.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "y2\n", string(y))
+
+	err = repo.i.Load()
+	assert.NoError(t, err)
+	e, ok := repo.i.EntryForPath("d/w.txt")
+	assert.True(t, ok)
+	assert.True(t, e.IsSkipWorktree())
+	w2, err := CreateObjIdFromContent("w2\n")
+	assert.NoError(t, err)
+	assert.Equal(t, w2, e.ObjId)
+
+	buf.Reset()
+	err = StartStatus(&buf, tempPath, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "", buf.String())
+
+	//外に出すとtopicの中身が書かれる
+	err = StartSparseCheckout(tempPath, []string{"disable"}, &buf)
+	assert.NoError(t, err)
+	w, err := ioutil.ReadFile(filepath.Join(tempPath, "d", "w.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "w2\n", string(w))
+}
+
+//resetやstashでindexを作り直してもsparse-checkoutの外はskip-worktreeのまま
+func TestSparseCheckoutResetAndStash(t *testing.T) {
+	tempPath, repo := PrepareSparseRepo(t)
+	var buf bytes.Buffer
+
+	err := StartSparseCheckout(tempPath, []string{"set", "a/b"}, &buf)
+	assert.NoError(t, err)
+
+	assertSkipped := func() {
+		t.Helper()
+		AssertWorkSpaceFiles(t, tempPath, []string{"a/b/y.txt"}, []string{"d", "a/c"})
+
+		err := repo.i.Load()
+		assert.NoError(t, err)
+		for _, p := range []string{"d/w.txt", "a/c/z.txt"} {
+			e, ok := repo.i.EntryForPath(p)
+			assert.True(t, ok, p)
+			assert.True(t, e.IsSkipWorktree(), p)
+		}
+	}
+
+	err = StartReset(tempPath, []string{"HEAD"}, &ResetOption{})
+	assert.NoError(t, err)
+	assertSkipped()
+	//消えたとは出ない
+	buf.Reset()
+	err = StartStatus(&buf, tempPath, false)
+	assert.NoError(t, err)
+	assert.NotContains(t, buf.String(), "d/w.txt")
+	assert.NotContains(t, buf.String(), "a/c/z.txt")
+
+	err = StartReset(tempPath, []string{"HEAD"}, &ResetOption{hasHard: true})
+	assert.NoError(t, err)
+	assertSkipped()
+
+	//stash pushはHEADにhard resetし、applyはindexをHEADに戻す
+	CreateFiles(t, tempPath, "a/b/y.txt", "y2\n")
+	err = StartStash(tempPath, "test", "test@example.com", []string{"push"}, &StashOption{}, &buf)
+	assert.NoError(t, err)
+	assertSkipped()
+	err = StartStash(tempPath, "test", "test@example.com", []string{"pop"}, &StashOption{}, &buf)
+	assert.NoError(t, err)
+	assertSkipped()
+
+	buf.Reset()
+	err = StartStatus(&buf, tempPath, false)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), " M a/b/y.txt\n")
+	assert.NotContains(t, buf.String(), "d/w.txt")
+	assert.NotContains(t, buf.String(), "a/c/z.txt")
+}
+
+func TestSparseCheckoutAddAndRm(t *testing.T) {
+	tempPath, repo := PrepareSparseRepo(t)
+	var buf bytes.Buffer
+
+	err := StartSparseCheckout(tempPath, []string{"set", "a/b"}, &buf)
+	assert.NoError(t, err)
+
+	err = os.MkdirAll(filepath.Join(tempPath, "d"), os.ModePerm)
+	assert.NoError(t, err)
+	CreateFiles(t, tempPath, "d/new.txt", "new\n")
+	CreateFiles(t, tempPath, "a/b/new.txt", "new\n")
+	err = StartAdd(tempPath, "test", "test@example.com", "test", []string{"d/new.txt", "a/b/new.txt"})
+	var sparseErr *ers.SparsePathError
+	assert.ErrorAs(t, err, &sparseErr)
+	assert.Equal(t, "The following paths and/or pathspecs matched paths that exist\noutside of your sparse-checkout definition, so will not be\nupdated in the index:\nd/new.txt\n", sparseErr.GetContent())
+
+	err = repo.i.Load()
+	assert.NoError(t, err)
+	assert.False(t, repo.i.IsIndexed("d/new.txt"))
+	assert.True(t, repo.i.IsIndexed("a/b/new.txt"))
+
+	buf.Reset()
+	err = StartRm(tempPath, []string{"d/w.txt"}, &RmOption{}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "The following paths and/or pathspecs matched paths that exist\noutside of your sparse-checkout definition, so will not be\nupdated in the index:\nd/w.txt\n", buf.String())
+
+	err = repo.i.Load()
+	assert.NoError(t, err)
+	assert.True(t, repo.i.IsIndexed("d/w.txt"))
+}
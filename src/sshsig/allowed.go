@@ -0,0 +1,207 @@
+package sshsig
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+//gpg.ssh.allowedSignersFileの1行(ssh-keygenのALLOWED SIGNERS)
+//principals [options] keytype base64key [comment]
+//principalsは,区切り、optionsはnamespaces="git,file"やcert-authorityなど
+type AllowedSigner struct {
+	Principals []string
+	//空ならどのnamespaceでもよい
+	Namespaces []string
+	//CAの鍵、証明書は扱わないので照合には使わない
+	CertAuthority bool
+	//valid-after,valid-before、zeroなら制限なし
+	ValidAfter  time.Time
+	ValidBefore time.Time
+	Key         *PublicKey
+}
+
+var ErrorInvalidAllowedSigners = errors.New("invalid allowed signers line")
+
+func LoadAllowedSigners(path string) ([]*AllowedSigner, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseAllowedSigners(f)
+}
+
+func ParseAllowedSigners(r io.Reader) ([]*AllowedSigner, error) {
+	var signers []*AllowedSigner
+	s := bufio.NewScanner(r)
+	lineNo := 0
+
+	for s.Scan() {
+		lineNo++
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		signer, err := parseAllowedSigner(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		signers = append(signers, signer)
+	}
+
+	return signers, s.Err()
+}
+
+func parseAllowedSigner(line string) (*AllowedSigner, error) {
+	principals, rest := nextField(line)
+	if principals == "" || rest == "" {
+		return nil, ErrorInvalidAllowedSigners
+	}
+
+	signer := &AllowedSigner{Principals: strings.Split(strings.Trim(principals, `"`), ",")}
+
+	//鍵の種類で始まらなければoptionsがある
+	if !isKeyType(rest) {
+		var options string
+		options, rest = nextField(rest)
+		for _, option := range splitOptions(options) {
+			name, value, _ := strings.Cut(option, "=")
+			switch strings.ToLower(name) {
+			case "namespaces":
+				signer.Namespaces = strings.Split(strings.Trim(value, `"`), ",")
+			case "cert-authority":
+				signer.CertAuthority = true
+			case "valid-after":
+				t, err := parseValidityTime(strings.Trim(value, `"`))
+				if err != nil {
+					return nil, err
+				}
+				signer.ValidAfter = t
+			case "valid-before":
+				t, err := parseValidityTime(strings.Trim(value, `"`))
+				if err != nil {
+					return nil, err
+				}
+				signer.ValidBefore = t
+			}
+		}
+	}
+
+	key, err := ParseAuthorizedKey(rest)
+	if err != nil {
+		return nil, err
+	}
+	signer.Key = key
+
+	return signer, nil
+}
+
+//ssh-keygenと同じくYYYYMMDD[HHMM[SS]]、末尾にZがあればUTCでなければlocal time
+func parseValidityTime(value string) (time.Time, error) {
+	loc := time.Local
+	if strings.HasSuffix(value, "Z") || strings.HasSuffix(value, "z") {
+		loc = time.UTC
+		value = value[:len(value)-1]
+	}
+
+	var layout string
+	switch len(value) {
+	case 8:
+		layout = "20060102"
+	case 12:
+		layout = "200601021504"
+	case 14:
+		layout = "20060102150405"
+	default:
+		return time.Time{}, fmt.Errorf("%w: invalid time %q", ErrorInvalidAllowedSigners, value)
+	}
+
+	t, err := time.ParseInLocation(layout, value, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: invalid time %q", ErrorInvalidAllowedSigners, value)
+	}
+
+	return t, nil
+}
+
+//atがvalid-after以降かつvalid-beforeより前か
+func (s *AllowedSigner) validAt(at time.Time) bool {
+	if !s.ValidAfter.IsZero() && at.Before(s.ValidAfter) {
+		return false
+	}
+	if !s.ValidBefore.IsZero() && !at.Before(s.ValidBefore) {
+		return false
+	}
+	return true
+}
+
+func (s *AllowedSigner) allowsNamespace(namespace string) bool {
+	if len(s.Namespaces) == 0 {
+		return true
+	}
+	for _, ns := range s.Namespaces {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+//ssh-keygen -Y find-principalsと同じく鍵とnamespaceが合い、atの時点で有効な行のprincipalを返す
+//gitと同じくatには署名したcommitやtagの日時を渡す
+func FindPrincipals(signers []*AllowedSigner, key *PublicKey, namespace string, at time.Time) []string {
+	var principals []string
+	for _, s := range signers {
+		if s.CertAuthority || !s.Key.Equal(key) || !s.allowsNamespace(namespace) || !s.validAt(at) {
+			continue
+		}
+		principals = append(principals, s.Principals...)
+	}
+
+	return principals
+}
+
+func isKeyType(s string) bool {
+	field, _ := nextField(s)
+	return field == KEY_ED25519 || field == KEY_RSA || strings.HasPrefix(field, "ecdsa-sha2-") || strings.HasPrefix(field, "sk-")
+}
+
+//""の中の空白では区切らない
+func nextField(s string) (string, string) {
+	s = strings.TrimLeft(s, " \t")
+	quoted := false
+	for i, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case (r == ' ' || r == '\t') && !quoted:
+			return s[:i], strings.TrimLeft(s[i:], " \t")
+		}
+	}
+	return s, ""
+}
+
+//""の中の,では区切らない
+func splitOptions(s string) []string {
+	var options []string
+	quoted := false
+	start := 0
+	for i, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ',' && !quoted:
+			options = append(options, s[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(options, s[start:])
+}
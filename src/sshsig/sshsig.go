@@ -0,0 +1,523 @@
+package sshsig
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"strings"
+)
+
+//本家がgpg.format=sshの時にssh-keygen -Y signで作る署名(OpenSSHのPROTOCOL.sshsig)
+//署名するdata:
+//  "SSHSIG" string namespace, string reserved, string hash_algorithm, string H(message)
+//署名:
+//  "SSHSIG" uint32 version, string publickey, string namespace, string reserved, string hash_algorithm, string signature
+//署名はbase64にして-----BEGIN SSH SIGNATURE-----と-----END SSH SIGNATURE-----で囲む
+
+const (
+	MAGIC         = "SSHSIG"
+	VERSION       = 1
+	NAMESPACE_GIT = "git"
+	HASH_SHA512   = "sha512"
+	HASH_SHA256   = "sha256"
+
+	BEGIN_SIGNATURE = "-----BEGIN SSH SIGNATURE-----"
+	END_SIGNATURE   = "-----END SSH SIGNATURE-----"
+	//armorの1行の文字数、ssh-keygenと同じ
+	LINE_LENGTH = 70
+
+	KEY_ED25519    = "ssh-ed25519"
+	KEY_RSA        = "ssh-rsa"
+	SIG_RSA_SHA512 = "rsa-sha2-512"
+	SIG_RSA_SHA256 = "rsa-sha2-256"
+
+	OPENSSH_PRIVATE_KEY = "OPENSSH PRIVATE KEY"
+	OPENSSH_KEY_MAGIC   = "openssh-key-v1\x00"
+)
+
+var (
+	ErrorUnsupportedKey    = errors.New("unsupported key type")
+	ErrorEncryptedKey      = errors.New("encrypted private keys are not supported")
+	ErrorInvalidKey        = errors.New("invalid key format")
+	ErrorInvalidSignature  = errors.New("invalid ssh signature format")
+	ErrorBadSignature      = errors.New("signature verification failed")
+	ErrorNamespaceMismatch = errors.New("signature namespace mismatch")
+)
+
+type PublicKey struct {
+	Type    string
+	ed25519 ed25519.PublicKey
+	rsa     *rsa.PublicKey
+	blob    []byte
+}
+
+//ssh wire形式の公開鍵を読む
+func ParsePublicKey(blob []byte) (*PublicKey, error) {
+	keyType, rest, ok := readString(blob)
+	if !ok {
+		return nil, ErrorInvalidKey
+	}
+
+	k := &PublicKey{Type: string(keyType), blob: blob}
+	switch k.Type {
+	case KEY_ED25519:
+		pub, _, ok := readString(rest)
+		if !ok || len(pub) != ed25519.PublicKeySize {
+			return nil, ErrorInvalidKey
+		}
+		k.ed25519 = ed25519.PublicKey(pub)
+	case KEY_RSA:
+		e, rest, ok := readMpint(rest)
+		if !ok {
+			return nil, ErrorInvalidKey
+		}
+		n, _, ok := readMpint(rest)
+		if !ok || !e.IsInt64() {
+			return nil, ErrorInvalidKey
+		}
+		k.rsa = &rsa.PublicKey{N: n, E: int(e.Int64())}
+	default:
+		return nil, fmt.Errorf("%s: %w", k.Type, ErrorUnsupportedKey)
+	}
+
+	return k, nil
+}
+
+//"ssh-ed25519 AAAA... comment"の形
+func ParseAuthorizedKey(line string) (*PublicKey, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return nil, ErrorInvalidKey
+	}
+
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", err, ErrorInvalidKey)
+	}
+
+	k, err := ParsePublicKey(blob)
+	if err != nil {
+		return nil, err
+	}
+	if k.Type != fields[0] {
+		return nil, ErrorInvalidKey
+	}
+
+	return k, nil
+}
+
+func (k *PublicKey) Marshal() []byte {
+	return k.blob
+}
+
+func (k *PublicKey) Equal(other *PublicKey) bool {
+	return other != nil && bytes.Equal(k.blob, other.blob)
+}
+
+//ssh-keygen -lと同じSHA256:xxxの形
+func (k *PublicKey) Fingerprint() string {
+	sum := sha256.Sum256(k.blob)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+//"Good signature ... with ED25519 key"のED25519の部分
+func (k *PublicKey) KeyName() string {
+	switch k.Type {
+	case KEY_ED25519:
+		return "ED25519"
+	case KEY_RSA:
+		return "RSA"
+	default:
+		return strings.ToUpper(k.Type)
+	}
+}
+
+//allowed signersやuser.signingKeyに書く1行
+func (k *PublicKey) AuthorizedKey() string {
+	return fmt.Sprintf("%s %s", k.Type, base64.StdEncoding.EncodeToString(k.blob))
+}
+
+func (k *PublicKey) verify(data, sig []byte) error {
+	algo, rest, ok := readString(sig)
+	if !ok {
+		return ErrorInvalidSignature
+	}
+	blob, _, ok := readString(rest)
+	if !ok {
+		return ErrorInvalidSignature
+	}
+
+	switch k.Type {
+	case KEY_ED25519:
+		if string(algo) != KEY_ED25519 || !ed25519.Verify(k.ed25519, data, blob) {
+			return ErrorBadSignature
+		}
+		return nil
+	case KEY_RSA:
+		//sshsigではsha1のssh-rsaは使えない
+		var h crypto.Hash
+		switch string(algo) {
+		case SIG_RSA_SHA512:
+			h = crypto.SHA512
+		case SIG_RSA_SHA256:
+			h = crypto.SHA256
+		default:
+			return ErrorBadSignature
+		}
+		digest := h.New()
+		digest.Write(data)
+		if err := rsa.VerifyPKCS1v15(k.rsa, h, digest.Sum(nil), blob); err != nil {
+			return ErrorBadSignature
+		}
+		return nil
+	default:
+		return ErrorUnsupportedKey
+	}
+}
+
+type PrivateKey struct {
+	Public  *PublicKey
+	ed25519 ed25519.PrivateKey
+	rsa     *rsa.PrivateKey
+}
+
+func GenerateEd25519Key(priv ed25519.PrivateKey) *PrivateKey {
+	pub := priv.Public().(ed25519.PublicKey)
+	blob := appendString(appendString(nil, []byte(KEY_ED25519)), pub)
+
+	return &PrivateKey{
+		Public:  &PublicKey{Type: KEY_ED25519, ed25519: pub, blob: blob},
+		ed25519: priv,
+	}
+}
+
+func GenerateRSAKey(priv *rsa.PrivateKey) *PrivateKey {
+	blob := appendString(nil, []byte(KEY_RSA))
+	blob = appendMpint(blob, big.NewInt(int64(priv.E)))
+	blob = appendMpint(blob, priv.N)
+
+	return &PrivateKey{
+		Public: &PublicKey{Type: KEY_RSA, rsa: &priv.PublicKey, blob: blob},
+		rsa:    priv,
+	}
+}
+
+//ssh-keygenが作るOPENSSH PRIVATE KEYと、PKCS#8,PKCS#1のPEMを読む
+//passphraseのついた鍵は読まない
+func ParsePrivateKey(content []byte) (*PrivateKey, error) {
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, ErrorInvalidKey
+	}
+
+	switch block.Type {
+	case OPENSSH_PRIVATE_KEY:
+		return parseOpenSSHPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		priv, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", err, ErrorInvalidKey)
+		}
+		return GenerateRSAKey(priv), nil
+	case "PRIVATE KEY":
+		priv, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", err, ErrorInvalidKey)
+		}
+		switch priv := priv.(type) {
+		case ed25519.PrivateKey:
+			return GenerateEd25519Key(priv), nil
+		case *rsa.PrivateKey:
+			return GenerateRSAKey(priv), nil
+		}
+		return nil, ErrorUnsupportedKey
+	default:
+		return nil, fmt.Errorf("%s: %w", block.Type, ErrorUnsupportedKey)
+	}
+}
+
+//"openssh-key-v1\0" string cipher, string kdf, string kdfoptions, uint32 鍵の数, string 公開鍵, string 秘密鍵の部分
+func parseOpenSSHPrivateKey(b []byte) (*PrivateKey, error) {
+	if !bytes.HasPrefix(b, []byte(OPENSSH_KEY_MAGIC)) {
+		return nil, ErrorInvalidKey
+	}
+	b = b[len(OPENSSH_KEY_MAGIC):]
+
+	cipher, b, ok := readString(b)
+	if !ok {
+		return nil, ErrorInvalidKey
+	}
+	if string(cipher) != "none" {
+		return nil, ErrorEncryptedKey
+	}
+	_, b, ok = readString(b)
+	if !ok {
+		return nil, ErrorInvalidKey
+	}
+	_, b, ok = readString(b)
+	if !ok {
+		return nil, ErrorInvalidKey
+	}
+	n, b, ok := readUint32(b)
+	if !ok || n != 1 {
+		return nil, ErrorInvalidKey
+	}
+	_, b, ok = readString(b)
+	if !ok {
+		return nil, ErrorInvalidKey
+	}
+	priv, _, ok := readString(b)
+	if !ok {
+		return nil, ErrorInvalidKey
+	}
+
+	//暗号化されていなくても最初の2つのcheck用の値は同じになる
+	check1, priv, ok := readUint32(priv)
+	if !ok {
+		return nil, ErrorInvalidKey
+	}
+	check2, priv, ok := readUint32(priv)
+	if !ok || check1 != check2 {
+		return nil, ErrorInvalidKey
+	}
+	keyType, priv, ok := readString(priv)
+	if !ok {
+		return nil, ErrorInvalidKey
+	}
+
+	switch string(keyType) {
+	case KEY_ED25519:
+		_, priv, ok = readString(priv)
+		if !ok {
+			return nil, ErrorInvalidKey
+		}
+		key, _, ok := readString(priv)
+		if !ok || len(key) != ed25519.PrivateKeySize {
+			return nil, ErrorInvalidKey
+		}
+		return GenerateEd25519Key(ed25519.PrivateKey(key)), nil
+	case KEY_RSA:
+		var values []*big.Int
+		for i := 0; i < 6; i++ {
+			var v *big.Int
+			v, priv, ok = readMpint(priv)
+			if !ok {
+				return nil, ErrorInvalidKey
+			}
+			values = append(values, v)
+		}
+		//n,e,d,iqmp,p,qの順
+		if !values[1].IsInt64() {
+			return nil, ErrorInvalidKey
+		}
+		key := &rsa.PrivateKey{
+			PublicKey: rsa.PublicKey{N: values[0], E: int(values[1].Int64())},
+			D:         values[2],
+			Primes:    []*big.Int{values[4], values[5]},
+		}
+		if err := key.Validate(); err != nil {
+			return nil, fmt.Errorf("%v: %w", err, ErrorInvalidKey)
+		}
+		key.Precompute()
+		return GenerateRSAKey(key), nil
+	default:
+		return nil, fmt.Errorf("%s: %w", keyType, ErrorUnsupportedKey)
+	}
+}
+
+//ssh wire形式の署名(string algorithm, string signature)
+func (k *PrivateKey) sign(data []byte) ([]byte, error) {
+	switch {
+	case k.ed25519 != nil:
+		sig := ed25519.Sign(k.ed25519, data)
+		return appendString(appendString(nil, []byte(KEY_ED25519)), sig), nil
+	case k.rsa != nil:
+		digest := sha512.Sum512(data)
+		sig, err := rsa.SignPKCS1v15(rand.Reader, k.rsa, crypto.SHA512, digest[:])
+		if err != nil {
+			return nil, err
+		}
+		return appendString(appendString(nil, []byte(SIG_RSA_SHA512)), sig), nil
+	default:
+		return nil, ErrorUnsupportedKey
+	}
+}
+
+func signedData(namespace, hashAlgo string, message []byte) ([]byte, error) {
+	var h hash.Hash
+	switch hashAlgo {
+	case HASH_SHA512:
+		h = sha512.New()
+	case HASH_SHA256:
+		h = sha256.New()
+	default:
+		return nil, fmt.Errorf("%s: %w", hashAlgo, ErrorInvalidSignature)
+	}
+	h.Write(message)
+
+	data := []byte(MAGIC)
+	data = appendString(data, []byte(namespace))
+	data = appendString(data, nil)
+	data = appendString(data, []byte(hashAlgo))
+	data = appendString(data, h.Sum(nil))
+
+	return data, nil
+}
+
+//messageに対するarmor済みの署名、最後は改行で終わる
+func Sign(k *PrivateKey, message []byte, namespace string) (string, error) {
+	data, err := signedData(namespace, HASH_SHA512, message)
+	if err != nil {
+		return "", err
+	}
+	sig, err := k.sign(data)
+	if err != nil {
+		return "", err
+	}
+
+	blob := []byte(MAGIC)
+	blob = binary.BigEndian.AppendUint32(blob, VERSION)
+	blob = appendString(blob, k.Public.Marshal())
+	blob = appendString(blob, []byte(namespace))
+	blob = appendString(blob, nil)
+	blob = appendString(blob, []byte(HASH_SHA512))
+	blob = appendString(blob, sig)
+
+	return armor(blob), nil
+}
+
+//署名に入っている公開鍵で検証して、その公開鍵を返す
+//その鍵を信用するかどうかはallowed signersで決める
+func Verify(armored string, message []byte, namespace string) (*PublicKey, error) {
+	blob, err := dearmor(armored)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.HasPrefix(blob, []byte(MAGIC)) {
+		return nil, ErrorInvalidSignature
+	}
+	b := blob[len(MAGIC):]
+
+	version, b, ok := readUint32(b)
+	if !ok || version != VERSION {
+		return nil, ErrorInvalidSignature
+	}
+	pub, b, ok := readString(b)
+	if !ok {
+		return nil, ErrorInvalidSignature
+	}
+	ns, b, ok := readString(b)
+	if !ok {
+		return nil, ErrorInvalidSignature
+	}
+	_, b, ok = readString(b)
+	if !ok {
+		return nil, ErrorInvalidSignature
+	}
+	hashAlgo, b, ok := readString(b)
+	if !ok {
+		return nil, ErrorInvalidSignature
+	}
+	sig, _, ok := readString(b)
+	if !ok {
+		return nil, ErrorInvalidSignature
+	}
+
+	if string(ns) != namespace {
+		return nil, fmt.Errorf("%s: %w", ns, ErrorNamespaceMismatch)
+	}
+
+	key, err := ParsePublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	data, err := signedData(namespace, string(hashAlgo), message)
+	if err != nil {
+		return nil, err
+	}
+	if err := key.verify(data, sig); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func armor(blob []byte) string {
+	encoded := base64.StdEncoding.EncodeToString(blob)
+
+	var str string
+	str += BEGIN_SIGNATURE + "\n"
+	for len(encoded) > LINE_LENGTH {
+		str += encoded[:LINE_LENGTH] + "\n"
+		encoded = encoded[LINE_LENGTH:]
+	}
+	str += encoded + "\n"
+	str += END_SIGNATURE + "\n"
+
+	return str
+}
+
+func dearmor(armored string) ([]byte, error) {
+	armored = strings.TrimSpace(armored)
+	if !strings.HasPrefix(armored, BEGIN_SIGNATURE) || !strings.HasSuffix(armored, END_SIGNATURE) {
+		return nil, ErrorInvalidSignature
+	}
+	body := armored[len(BEGIN_SIGNATURE) : len(armored)-len(END_SIGNATURE)]
+
+	blob, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(body), ""))
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", err, ErrorInvalidSignature)
+	}
+
+	return blob, nil
+}
+
+func readUint32(b []byte) (uint32, []byte, bool) {
+	if len(b) < 4 {
+		return 0, nil, false
+	}
+	return binary.BigEndian.Uint32(b), b[4:], true
+}
+
+func readString(b []byte) ([]byte, []byte, bool) {
+	n, b, ok := readUint32(b)
+	if !ok || uint32(len(b)) < n {
+		return nil, nil, false
+	}
+	return b[:n], b[n:], true
+}
+
+func readMpint(b []byte) (*big.Int, []byte, bool) {
+	v, rest, ok := readString(b)
+	if !ok || (len(v) > 0 && v[0]&0x80 != 0) {
+		return nil, nil, false
+	}
+	return new(big.Int).SetBytes(v), rest, true
+}
+
+func appendString(b, s []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(s)))
+	return append(b, s...)
+}
+
+//正の数だけ、先頭のbitが立っていれば0を1byte足す
+func appendMpint(b []byte, n *big.Int) []byte {
+	v := n.Bytes()
+	if len(v) > 0 && v[0]&0x80 != 0 {
+		v = append([]byte{0}, v...)
+	}
+	return appendString(b, v)
+}
@@ -0,0 +1,111 @@
+package sshsig
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//testDataの鍵と署名はssh-keygen -Y sign -n gitで"hello\n"に署名したもの
+var helloMessage = []byte("hello\n")
+
+func readTestData(t *testing.T, name string) []byte {
+	content, err := ioutil.ReadFile(filepath.Join("testData", name))
+	assert.NoError(t, err)
+	return content
+}
+
+func TestSignMatchesSSHKeygen(t *testing.T) {
+	for _, name := range []string{"ed25519", "rsa"} {
+		t.Run(name, func(t *testing.T) {
+			key, err := ParsePrivateKey(readTestData(t, "id_"+name))
+			assert.NoError(t, err)
+			pub, err := ParseAuthorizedKey(string(readTestData(t, "id_"+name+".pub")))
+			assert.NoError(t, err)
+			assert.True(t, key.Public.Equal(pub))
+
+			//ed25519もrsa-sha2-512(PKCS#1 v1.5)も同じ入力なら同じ署名になる
+			sig, err := Sign(key, helloMessage, NAMESPACE_GIT)
+			assert.NoError(t, err)
+			assert.Equal(t, string(readTestData(t, "hello_"+name+".sig")), sig)
+
+			signer, err := Verify(sig, helloMessage, NAMESPACE_GIT)
+			assert.NoError(t, err)
+			assert.True(t, signer.Equal(pub))
+
+			_, err = Verify(sig, []byte("hello!\n"), NAMESPACE_GIT)
+			assert.ErrorIs(t, err, ErrorBadSignature)
+			_, err = Verify(sig, helloMessage, "file")
+			assert.ErrorIs(t, err, ErrorNamespaceMismatch)
+		})
+	}
+
+	_, err := Verify("not a signature", helloMessage, NAMESPACE_GIT)
+	assert.ErrorIs(t, err, ErrorInvalidSignature)
+}
+
+func TestFingerprint(t *testing.T) {
+	//ssh-keygen -lf id_ed25519.pubと同じ
+	pub, err := ParseAuthorizedKey(string(readTestData(t, "id_ed25519.pub")))
+	assert.NoError(t, err)
+	assert.Equal(t, "SHA256:1NYEQyGuWKo+meAb1K6MzuuYiSeERhwNwwAi2yREmyk", pub.Fingerprint())
+	assert.Equal(t, "ED25519", pub.KeyName())
+}
+
+func TestAllowedSigners(t *testing.T) {
+	ed := strings.TrimSpace(string(readTestData(t, "id_ed25519.pub")))
+	rsa := strings.TrimSpace(string(readTestData(t, "id_rsa.pub")))
+
+	content := "# comment\n" +
+		"jane@example.com,jane@work.example.com " + ed + "\n" +
+		`other@example.com namespaces="file,ssh" ` + rsa + "\n" +
+		`ca@example.com cert-authority,namespaces="git" ` + rsa + "\n"
+
+	signers, err := ParseAllowedSigners(strings.NewReader(content))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(signers))
+	assert.Equal(t, []string{"file", "ssh"}, signers[1].Namespaces)
+	assert.True(t, signers[2].CertAuthority)
+
+	now := time.Now()
+	edKey, _ := ParseAuthorizedKey(ed)
+	rsaKey, _ := ParseAuthorizedKey(rsa)
+	assert.Equal(t, []string{"jane@example.com", "jane@work.example.com"}, FindPrincipals(signers, edKey, NAMESPACE_GIT, now))
+	//namespaceが違う行とCAの行は使わない
+	assert.Equal(t, 0, len(FindPrincipals(signers, rsaKey, NAMESPACE_GIT, now)))
+	assert.Equal(t, []string{"other@example.com"}, FindPrincipals(signers, rsaKey, "file", now))
+
+	_, err = ParseAllowedSigners(strings.NewReader("jane@example.com\n"))
+	assert.ErrorIs(t, err, ErrorInvalidAllowedSigners)
+	_, err = ParseAllowedSigners(strings.NewReader(`jane@example.com valid-before="2020" ` + ed + "\n"))
+	assert.ErrorIs(t, err, ErrorInvalidAllowedSigners)
+}
+
+func TestAllowedSignersValidity(t *testing.T) {
+	ed := strings.TrimSpace(string(readTestData(t, "id_ed25519.pub")))
+
+	content := `old@example.com valid-before="20200101Z" ` + ed + "\n" +
+		`new@example.com valid-after="202001011200Z",valid-before="20300101000000Z" ` + ed + "\n"
+
+	signers, err := ParseAllowedSigners(strings.NewReader(content))
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), signers[0].ValidBefore)
+	assert.Equal(t, time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC), signers[1].ValidAfter)
+
+	edKey, _ := ParseAuthorizedKey(ed)
+	for _, d := range []struct {
+		at       time.Time
+		expected []string
+	}{
+		{time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC), []string{"old@example.com"}},
+		{time.Date(2020, 1, 1, 6, 0, 0, 0, time.UTC), nil},
+		{time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), []string{"new@example.com"}},
+		{time.Date(2031, 1, 1, 0, 0, 0, 0, time.UTC), nil},
+	} {
+		assert.Equal(t, d.expected, FindPrincipals(signers, edKey, NAMESPACE_GIT, d.at), d.at.String())
+	}
+}
@@ -0,0 +1,383 @@
+package src
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	data "mygit/src/database"
+	con "mygit/src/database/content"
+	"mygit/src/database/lock"
+	ers "mygit/src/errors"
+	"os"
+	"strconv"
+)
+
+//本家と同じくstashは2つのcommitで持つ
+//index commit: parent=HEAD、treeはstash時のindex
+//worktree commit: parent=HEAD,index commit、treeはindexにworkspaceの変更を足したもの
+//refs/stashはworktree commitを指し、一覧はrefs/stashのreflogで持つ
+
+type StashOption struct {
+	Message string
+}
+
+var (
+	ErrorNoStashEntries      = errors.New("No stash entries found.")
+	ErrorInvalidStash        = errors.New("not a valid stash reference")
+	ErrorStashUnmerged       = errors.New("cannot stash with unmerged paths")
+	ErrorUnknownStashCommand = errors.New("unknown stash subcommand")
+)
+
+var NoLocalChangesMessage = "No local changes to save\n"
+var StashConflictKeptMessage = "The stash entry is kept in case you need it again.\n"
+
+const (
+	STASH_NAME = "stash"
+	//conflict markerに出すleftとrightの名前、本家と同じ
+	STASH_UPSTREAM_LABEL = "Updated upstream"
+	STASH_STASHED_LABEL  = "Stashed changes"
+)
+
+func StartStash(rootPath, uName, uEmail string, args []string, option *StashOption, w io.Writer) error {
+	repo, err := DiscoverWorkTree(rootPath)
+	if err != nil {
+		return err
+	}
+	uName, uEmail, err = repo.Identity(uName, uEmail)
+	if err != nil {
+		return err
+	}
+
+	command := "push"
+	if len(args) > 0 {
+		command = args[0]
+		args = args[1:]
+	}
+
+	switch command {
+	case "push":
+		return StashPush(uName, uEmail, option, repo, w)
+	case "list":
+		return StashList(repo, w)
+	case "apply":
+		return ers.HandleWillWriteError(StashApply(args, repo, w), w)
+	case "pop":
+		return ers.HandleWillWriteError(StashPop(args, repo, w), w)
+	case "drop":
+		return StashDrop(args, repo, w)
+	default:
+		return ErrorUnknownStashCommand
+	}
+}
+
+func StashPush(uName, uEmail string, option *StashOption, repo *Repository, w io.Writer) error {
+	_, indexNonExist := os.Stat(repo.i.Path)
+
+	l := lock.NewFileLock(repo.i.Path)
+	l.Lock()
+	defer l.Unlock()
+
+	if indexNonExist == nil {
+		err := repo.i.Load()
+		if err != nil {
+			return err
+		}
+	}
+
+	if repo.i.IsConflicted() {
+		return ErrorStashUnmerged
+	}
+
+	s := GenerateStatus()
+	err := s.IntitializeStatus(repo)
+	if err != nil {
+		return err
+	}
+
+	//untrackedは本家のdefaultと同じくstashしない
+	if len(s.IndexChanges) == 0 && len(s.WorkSpaceChanges) == 0 {
+		w.Write([]byte(NoLocalChangesMessage))
+		return nil
+	}
+
+	headObjId, err := repo.r.ReadHead()
+	if err != nil {
+		return err
+	}
+
+	o, err := LoadTypedObject(headObjId, "commit", repo)
+	if err != nil {
+		return err
+	}
+	head, _ := o.(*con.CommitFromMem)
+
+	branch, err := stashBranchName(repo)
+	if err != nil {
+		return err
+	}
+	subject := fmt.Sprintf("%s %s", ShortOid(headObjId, repo.d), head.GetFirstLineMessage())
+	author := con.GenerateAuthor(uName, uEmail)
+
+	indexCommit, err := storeStashCommit([]string{headObjId}, fmt.Sprintf("index on %s: %s", branch, subject), author, repo)
+	if err != nil {
+		return err
+	}
+
+	//workspaceの変更をメモリ上のindexに足してworktree commitのtreeにする
+	for path, cause := range s.WorkSpaceChanges {
+		switch cause {
+		case WORKSPACE_MODIFIED, WORKSPACE_TYPECHANGE:
+			err := AddIndex(path, repo)
+			if err != nil {
+				return err
+			}
+		case WORKSPACE_DELETE:
+			repo.i.Remove(path)
+		}
+	}
+
+	message := fmt.Sprintf("WIP on %s: %s", branch, subject)
+	if option.Message != "" {
+		message = fmt.Sprintf("On %s: %s", branch, option.Message)
+	}
+
+	worktreeCommit, err := storeStashCommit([]string{headObjId, indexCommit.ObjId}, message, author, repo)
+	if err != nil {
+		return err
+	}
+
+	err = repo.r.WithIdentity(uName, uEmail).WithReason(message).UpdateRef(data.STASH_REF, worktreeCommit.ObjId)
+	if err != nil {
+		return err
+	}
+
+	//reset --hard HEADと同じ
+	err = HanldeHard(headObjId, repo)
+	if err != nil {
+		return err
+	}
+
+	err = repo.i.Write(repo.i.Path)
+	if err != nil {
+		return err
+	}
+
+	w.Write([]byte(fmt.Sprintf("Saved working directory and index state %s\n", message)))
+
+	return nil
+}
+
+func stashBranchName(repo *Repository) (string, error) {
+	currentRef, err := repo.r.CurrentRef("HEAD")
+	if err != nil {
+		return "", err
+	}
+
+	if currentRef.IsHead() {
+		return "(no branch)", nil
+	}
+
+	return currentRef.ShortName(), nil
+}
+
+//WriteCommitと違ってHEADは動かさない
+func storeStashCommit(parents []string, message string, author *con.Author, repo *Repository) (*con.Commit, error) {
+	t, err := CreateTree(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	StoreTree(t, repo)
+
+	c := &con.Commit{
+		ObjId:   t.GetObjId(),
+		Parents: parents,
+		Tree:    t,
+		Author:  author,
+		Message: message,
+	}
+	repo.d.Store(c)
+
+	return c, nil
+}
+
+func StashList(repo *Repository, w io.Writer) error {
+	entries, err := repo.r.ReadReflog(STASH_NAME)
+	if err != nil {
+		//stashがなければ何も出さない
+		return nil
+	}
+
+	for i, e := range entries {
+		w.Write([]byte(fmt.Sprintf("stash@{%d}: %s\n", i, e.Message)))
+	}
+
+	return nil
+}
+
+//stash@{n}かnを受け付ける、指定がなければstash@{0}
+func resolveStash(args []string, repo *Repository) (int, string, error) {
+	name := "stash@{0}"
+	if len(args) > 0 {
+		name = args[0]
+	}
+
+	if n, err := strconv.Atoi(name); err == nil {
+		name = fmt.Sprintf("stash@{%d}", n)
+	}
+
+	rev, err := ParseRev(name)
+	if err != nil {
+		return 0, "", ErrorInvalidStash
+	}
+
+	reflog, ok := rev.(*Reflog)
+	if !ok || reflog.Name != STASH_NAME {
+		return 0, "", ErrorInvalidStash
+	}
+
+	if _, ok := repo.r.ReflogPath(STASH_NAME); !ok {
+		return 0, "", ErrorNoStashEntries
+	}
+
+	objId, err := ResolveRev(reflog, repo)
+	if err != nil {
+		return 0, "", ErrorInvalidStash
+	}
+
+	return reflog.N, objId, nil
+}
+
+//stash時のHEADをbase、今のHEADをleft、worktree commitをrightとして3wayMergeする
+func StashApply(args []string, repo *Repository, w io.Writer) error {
+	_, stashObjId, err := resolveStash(args, repo)
+	if err != nil {
+		return err
+	}
+
+	o, err := LoadTypedObject(stashObjId, "commit", repo)
+	if err != nil {
+		return err
+	}
+	stash, _ := o.(*con.CommitFromMem)
+
+	headObjId, err := repo.r.ReadHead()
+	if err != nil {
+		return err
+	}
+
+	m := &Merge{
+		repo:       repo,
+		leftName:   STASH_UPSTREAM_LABEL,
+		leftObjId:  headObjId,
+		rightName:  STASH_STASHED_LABEL,
+		rightObjId: stash.ObjId,
+		baseObjId:  stash.Parents[0],
+	}
+
+	err = m.ResolveMerge(w)
+	if err != nil {
+		return err
+	}
+
+	//conflictしたら通常のmergeと同じくindexにstage1~3を残す
+	if repo.i.IsConflicted() {
+		return &ers.ConflictOccurError{
+			ConflictDetail: StashConflictKeptMessage,
+		}
+	}
+
+	l := lock.NewFileLock(repo.i.Path)
+	l.Lock()
+	defer l.Unlock()
+
+	err = unstageStashedChanges(headObjId, repo)
+	if err != nil {
+		return err
+	}
+
+	return repo.i.Write(repo.i.Path)
+}
+
+//本家のapply(--indexなし)と同じく、新しく追加されたファイル以外はindexをHEADに戻してworkspaceだけ変更が残るようにする
+func unstageStashedChanges(headObjId string, repo *Repository) error {
+	headTree, err := repo.d.LoadTreeList(headObjId)
+	if err != nil {
+		return err
+	}
+
+	es, err := repo.i.GetEntries()
+	if err != nil {
+		return err
+	}
+
+	sc, err := LoadSparseCheckout(repo)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range es {
+		he, ok := headTree[e.Path]
+		if !ok {
+			continue
+		}
+
+		if he.ObjId != e.ObjId || he.Mode != e.Mode {
+			err := AddFromDBWithSparse(e.Path, he, sc, repo)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for path, he := range headTree {
+		if !repo.i.IsIndexedFile(path) {
+			err := AddFromDBWithSparse(path, he, sc, repo)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func StashPop(args []string, repo *Repository, w io.Writer) error {
+	err := StashApply(args, repo, w)
+	if err != nil {
+		return err
+	}
+
+	return StashDrop(args, repo, w)
+}
+
+func StashDrop(args []string, repo *Repository, w io.Writer) error {
+	n, _, err := resolveStash(args, repo)
+	if err != nil {
+		return err
+	}
+
+	dropped, err := repo.r.DropReflogEntry(STASH_NAME, n)
+	if err != nil {
+		return err
+	}
+
+	entries, err := repo.r.ReadReflog(STASH_NAME)
+	if err != nil {
+		return err
+	}
+
+	//最後の一つを消したらrefs/stashごと消す、残っていれば一番新しいものを指す
+	if len(entries) == 0 {
+		err = repo.r.DeleteRef(data.STASH_REF)
+	} else {
+		err = repo.r.UpdateRefWithoutReflog(data.STASH_REF, entries[0].NewObjId)
+	}
+	if err != nil {
+		return err
+	}
+
+	w.Write([]byte(fmt.Sprintf("Dropped refs/stash@{%d} (%s)\n", n, dropped.NewObjId)))
+
+	return nil
+}
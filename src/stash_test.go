@@ -0,0 +1,133 @@
+package src
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStash(t *testing.T) {
+	tempPath, repo := PrepareTagRepo(t)
+	var buf bytes.Buffer
+
+	headObjId, err := repo.r.ReadHead()
+	assert.NoError(t, err)
+	short := ShortOid(headObjId, repo.d)
+
+	//変更がなければ何もしない
+	err = StartStash(tempPath, "test", "test@example.com", []string{}, &StashOption{}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, NoLocalChangesMessage, buf.String())
+
+	CreateFiles(t, tempPath, "hello.txt", "stashed\n")
+	CreateFiles(t, tempPath, "new.txt", "new\n")
+	err = StartAdd(tempPath, "test", "test@example.com", "test", []string{"new.txt"})
+	assert.NoError(t, err)
+
+	buf.Reset()
+	err = StartStash(tempPath, "test", "test@example.com", []string{"push"}, &StashOption{}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("Saved working directory and index state WIP on master: %s commit2\n", short), buf.String())
+
+	//workspaceとindexはHEADに戻る
+	content, err := ioutil.ReadFile(filepath.Join(tempPath, "hello.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "second\n", string(content))
+	_, err = os.Stat(filepath.Join(tempPath, "new.txt"))
+	assert.True(t, os.IsNotExist(err))
+
+	buf.Reset()
+	err = StartStatus(&buf, tempPath, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "", buf.String())
+
+	buf.Reset()
+	err = StartStash(tempPath, "test", "test@example.com", []string{"list"}, &StashOption{}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("stash@{0}: WIP on master: %s commit2\n", short), buf.String())
+
+	//worktree commitのparentはHEADとindex commit
+	stashObjId := ResolveForTest(t, "stash@{0}", repo)
+	assert.Equal(t, headObjId, ResolveForTest(t, "stash@{0}^1", repo))
+	indexObjId := ResolveForTest(t, "stash@{0}^2", repo)
+	indexTree, err := repo.d.LoadTreeList(indexObjId)
+	assert.NoError(t, err)
+	assert.Contains(t, indexTree, "new.txt")
+	assert.NotEqual(t, indexObjId, stashObjId)
+
+	//applyではstashは残り、新規ファイル以外はunstagedになる
+	buf.Reset()
+	err = StartStash(tempPath, "test", "test@example.com", []string{"apply"}, &StashOption{}, &buf)
+	assert.NoError(t, err)
+	content, err = ioutil.ReadFile(filepath.Join(tempPath, "hello.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "stashed\n", string(content))
+
+	buf.Reset()
+	err = StartStatus(&buf, tempPath, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "A  new.txt\n M hello.txt\n", buf.String())
+
+	//HEADを進めてからpopするとconflictして、stashは残る
+	res := &Reset{Args: []string{"HEAD"}, repo: repo, Option: &ResetOption{hasHard: true}}
+	err = RunReset(res)
+	assert.NoError(t, err)
+	os.Remove(filepath.Join(tempPath, "new.txt"))
+
+	CreateFiles(t, tempPath, "hello.txt", "upstream\n")
+	err = StartAdd(tempPath, "test", "test@example.com", "test", []string{"hello.txt"})
+	assert.NoError(t, err)
+	err = StartCommit(tempPath, "test", "test@example.com", "commit3", &buf)
+	assert.NoError(t, err)
+
+	buf.Reset()
+	err = StartStash(tempPath, "test", "test@example.com", []string{"pop"}, &StashOption{}, &buf)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), StashConflictKeptMessage)
+
+	repo = GenerateRepository(tempPath, filepath.Join(tempPath, ".git"), filepath.Join(tempPath, ".git", "objects"))
+	err = repo.i.Load()
+	assert.NoError(t, err)
+	assert.True(t, repo.i.IsConflicted())
+	content, err = ioutil.ReadFile(filepath.Join(tempPath, "hello.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "<<<<<<< Updated upstream\nupstream\n=======\nstashed\n>>>>>>> Stashed changes\n", string(content))
+
+	buf.Reset()
+	err = StartStash(tempPath, "test", "test@example.com", []string{"drop", "0"}, &StashOption{}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("Dropped refs/stash@{0} (%s)\n", stashObjId), buf.String())
+
+	_, err = os.Stat(filepath.Join(repo.r.Path, "refs", "stash"))
+	assert.True(t, os.IsNotExist(err))
+
+	err = StartStash(tempPath, "test", "test@example.com", []string{"pop"}, &StashOption{}, &buf)
+	assert.Equal(t, ErrorNoStashEntries, err)
+}
+
+func TestStashDropKeepsOthers(t *testing.T) {
+	tempPath, repo := PrepareTagRepo(t)
+	var buf bytes.Buffer
+
+	for _, content := range []string{"one\n", "two\n"} {
+		CreateFiles(t, tempPath, "hello.txt", content)
+		err := StartStash(tempPath, "test", "test@example.com", []string{}, &StashOption{Message: content[:3]}, &buf)
+		assert.NoError(t, err)
+	}
+	first := ResolveForTest(t, "stash@{1}", repo)
+
+	buf.Reset()
+	err := StartStash(tempPath, "test", "test@example.com", []string{"drop"}, &StashOption{}, &buf)
+	assert.NoError(t, err)
+
+	buf.Reset()
+	err = StartStash(tempPath, "test", "test@example.com", []string{"list"}, &StashOption{}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "stash@{0}: On master: one\n", buf.String())
+	assert.Equal(t, first, ResolveForTest(t, "refs/stash", repo))
+}
@@ -3,13 +3,13 @@ package src
 import (
 	"errors"
 	"io"
-	"mygit/src/crypt"
 	data "mygit/src/database"
 	con "mygit/src/database/content"
 	"mygit/src/database/lock"
 	"mygit/src/database/util"
 	"os"
 	"path/filepath"
+	"sort"
 )
 
 //untrackedFileか、untrackFileを含んでいるならtrue-
@@ -45,31 +45,82 @@ func IsTrackableFile(i *data.Index, path string, isDir bool, w *WorkSpace) (bool
 
 }
 
+//directoryを深さごとにまとめて、同じ深さのものは並列にlistしてstatする
+//結果はdirectoryの順にStatusに入れるので、並列にしても同じになる
 func ScanWorkSpace(w *WorkSpace, path string, i *data.Index, s *Status) error {
+	dirs := []string{path}
+
+	for depth := 0; len(dirs) > 0; depth++ {
+		results := make([]*scanResult, len(dirs))
+		err := runParallel(len(dirs), s.Threads, func(n int) error {
+			r, err := scanDir(w, dirs[n], i)
+			if err != nil && depth == 0 {
+				return err
+			}
+			//下のdirectoryが読めないときは今まで通り飛ばす
+			results[n] = r
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		dirs = nil
+		for _, r := range results {
+			if r == nil {
+				continue
+			}
+			for k, stat := range r.stats {
+				s.Stats[k] = stat
+			}
+			s.Untracked = append(s.Untracked, r.untracked...)
+			dirs = append(dirs, r.subDirs...)
+		}
+	}
+
+	return nil
+}
+
+type scanResult struct {
+	stats     map[string]con.FileState
+	untracked []string
+	//indexに入っていて中を調べるdirectory
+	subDirs []string
+}
+
+func scanDir(w *WorkSpace, path string, i *data.Index) (*scanResult, error) {
 	pathList, err := w.ListDir(path)
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	r := &scanResult{
+		stats: make(map[string]con.FileState),
+	}
 	for k, stat := range pathList {
 
-		if err != nil {
-			return err
+		if isSubmoduleDir(w, i, k, stat) {
+			if i.IsIndexed(k) {
+				r.stats[k] = stat
+			} else {
+				r.untracked = append(r.untracked, k+"/")
+			}
+			continue
 		}
 
 		if i.IsIndexed(k) {
 
 			if stat.IsDir() {
-				ScanWorkSpace(w, filepath.Join(w.Path, k), i, s)
+				r.subDirs = append(r.subDirs, filepath.Join(w.Path, k))
 			} else {
-				s.Stats[k] = stat
+				r.stats[k] = stat
 			}
 		} else {
 			trackable, err := IsTrackableFile(i, k, stat.IsDir(), w)
 
 			if err != nil {
-				return err
+				return nil, err
 			}
 
 			if trackable {
@@ -79,14 +130,27 @@ func ScanWorkSpace(w *WorkSpace, path string, i *data.Index, s *Status) error {
 					result += "/"
 				}
 
-				s.Untracked = append(s.Untracked, result)
+				r.untracked = append(r.untracked, result)
 			}
 
 		}
 	}
+	sort.Strings(r.subDirs)
+	sort.Strings(r.untracked)
 
-	return nil
+	return r, nil
+}
+
+//gitlinkのentryがあるdirectoryか、indexにない入れ子のrepositoryは中を調べずにそのものを1つのentryとして扱う
+func isSubmoduleDir(w *WorkSpace, i *data.Index, path string, stat con.FileState) bool {
+	if !stat.IsDir() {
+		return false
+	}
+	if e, ok := i.EntryForPath(path); ok {
+		return e.IsGitlink()
+	}
 
+	return !i.IsIndexedDir(path) && w.IsNestedRepository(path)
 }
 
 var ErrorObjeToEntryConvError = errors.New("conversion error object to entry")
@@ -117,20 +181,77 @@ func (s *Status) RecordChange(path string, set map[string]int, cause int) {
 }
 
 func (s *Status) CheckIndexAgainstWorkSpace(path string, e *con.Entry, i *data.Index, w *WorkSpace) error {
+	r, err := s.checkWorkSpace(path, e, i, w)
+	if err != nil {
+		return err
+	}
+
+	s.applyWorkSpaceCheck(path, e, i, r)
+	return nil
+}
+
+//作業ディレクトリとindexを比べた結果、Statusやindexには触らないので並列に求められる
+type workSpaceCheck struct {
+	//0なら変わっていない
+	cause int
+	//内容は同じでtimeだけ違うときに、indexに入れ直すstat
+	refreshStat con.FileState
+	//submoduleのどこが変わったか
+	submodule []string
+}
+
+func (s *Status) applyWorkSpaceCheck(path string, e *con.Entry, i *data.Index, r *workSpaceCheck) {
+	if r.cause != 0 {
+		s.RecordChange(path, s.WorkSpaceChanges, r.cause)
+	}
+	if len(r.submodule) != 0 {
+		s.Submodules[path] = r.submodule
+	}
+	if r.refreshStat != nil {
+		i.UpdateEntryStat(e, r.refreshStat)
+	}
+}
+
+func (s *Status) checkWorkSpace(path string, e *con.Entry, i *data.Index, w *WorkSpace) (*workSpaceCheck, error) {
+	if _, ok := s.FsmonitorValid[path]; ok {
+		//fsmonitorで変わっていないとわかっている
+		return &workSpaceCheck{}, nil
+	}
+
+	if e.IsSkipWorktree() {
+		//sparse-checkoutの外にあるので作業ディレクトリになくても消えたとはしない
+		return &workSpaceCheck{}, nil
+	}
+
 	stat, ok := s.Stats[path]
 
 	//WorkSpaceに存在するかどうか Index vs WorkSpace
 
 	if !ok {
 		//もしStatsに存在しないならDELETE
-		s.RecordChange(path, s.WorkSpaceChanges, WORKSPACE_DELETE)
-		return nil
+		return &workSpaceCheck{cause: WORKSPACE_DELETE}, nil
+	}
+
+	if e.IsGitlink() && stat.IsDir() {
+		//submoduleは記録したcommitとHEADや、submoduleの中の変更を見る
+		changes, err := SubmoduleChanges(w, e)
+		if err != nil {
+			return nil, err
+		}
+		if len(changes) != 0 {
+			return &workSpaceCheck{cause: WORKSPACE_MODIFIED, submodule: changes}, nil
+		}
+		return &workSpaceCheck{}, nil
+	}
+
+	if con.IsTypeChange(e.Mode, data.ModeForStat(stat)) {
+		//ファイルとsymlinkが入れ替わった
+		return &workSpaceCheck{cause: WORKSPACE_TYPECHANGE}, nil
 	}
 
 	if !i.StatMatch(e, stat) {
 		//Statが一致しないならMODIFIED
-		s.RecordChange(path, s.WorkSpaceChanges, WORKSPACE_MODIFIED)
-		return nil
+		return &workSpaceCheck{cause: WORKSPACE_MODIFIED}, nil
 	}
 
 	//modeとsizeがmatchしているならtimeがmatchしているか調べる
@@ -141,7 +262,7 @@ func (s *Status) CheckIndexAgainstWorkSpace(path string, e *con.Entry, i *data.I
 	if !e.TimeMatch(stat) {
 		d, err := w.ReadFile(path)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		b := &con.Blob{
@@ -150,26 +271,26 @@ func (s *Status) CheckIndexAgainstWorkSpace(path string, e *con.Entry, i *data.I
 
 		content := data.GetStoreHeaderContent(b)
 
-		objId := crypt.HexDigestBySha1(content)
+		objId := i.GetHash().HexDigest(content)
 
 		if e.ObjId == objId {
-			i.UpdateEntryStat(e, stat)
+			return &workSpaceCheck{refreshStat: stat}, nil
 		} else {
 			//ObjIdが一致しないならContentが変化してModified
-			s.RecordChange(path, s.WorkSpaceChanges, WORKSPACE_MODIFIED)
+			return &workSpaceCheck{cause: WORKSPACE_MODIFIED}, nil
 		}
 	}
 
-	return nil
+	return &workSpaceCheck{}, nil
 
 }
 
 func StartStatus(w io.Writer, rootPath string, isLong bool) error {
 
-	gitPath := filepath.Join(rootPath, ".git")
-	dbPath := filepath.Join(gitPath, "objects")
-
-	repo := GenerateRepository(rootPath, gitPath, dbPath)
+	repo, err := DiscoverWorkTree(rootPath)
+	if err != nil {
+		return err
+	}
 
 	// i := data.GenerateIndex(filepath.Join(gitPath, "index"))
 
@@ -191,7 +312,7 @@ func StartStatus(w io.Writer, rootPath string, isLong bool) error {
 
 	s := GenerateStatus()
 
-	err := s.IntitializeStatus(repo)
+	err = s.IntitializeStatus(repo)
 	if err != nil {
 		return err
 	}
@@ -220,8 +341,24 @@ func (s *Status) IntitializeStatusWithObjId(commitObjId string, repo *Repository
 }
 
 func (s *Status) RunIntitializeStatus(commitObjId string, repo *Repository) error {
+	if s.Threads == 0 {
+		threads, err := repo.statusThreads()
+		if err != nil {
+			return err
+		}
+		s.Threads = threads
+	}
 
-	err := ScanWorkSpace(repo.w, repo.w.Path, repo.i, s)
+	//tokenは調べ始める前にもらい、調べている間の変更は次に回す
+	mon := repo.queryFsmonitor()
+
+	var err error
+	if mon != nil && !mon.Trivial && repo.i.FsmonitorToken != "" {
+		s.FsmonitorValid = fsmonitorValidPaths(repo.i, mon.Paths)
+		err = ScanWorkSpaceWithFsmonitor(repo.w, repo.w.Path, repo.i, s)
+	} else {
+		err = ScanWorkSpace(repo.w, repo.w.Path, repo.i, s)
+	}
 
 	if err != nil {
 		return err
@@ -248,6 +385,10 @@ func (s *Status) RunIntitializeStatus(commitObjId string, repo *Repository) erro
 		return err
 	}
 
+	if mon != nil {
+		repo.i.UpdateFsmonitor(mon.Token, s.fsmonitorDirty(repo.i))
+	}
+
 	//最後にpath順にソート
 	util.SortStringSlice(s.Changed)
 	//mapのindexChangedとworkspaceChangedは使う側でソート
@@ -286,25 +427,19 @@ func (s *Status) LoadHead(r *data.Refs, d *data.Database) error {
 		return data.ErrorUnexpectedObjType
 	}
 
-	s.ReadTree(d, c.Tree)
+	s.ReadTree(d, c.Tree, "")
 
 	return nil
 
 }
 
-func (s *Status) ReadTree(d *data.Database, objId string) error {
+func (s *Status) ReadTree(d *data.Database, objId, prefix string) error {
 
-	o, err := d.ReadObject(objId)
+	t, err := d.ReadTree(objId, prefix)
 	if err != nil {
 		return err
 	}
 
-	t, ok := o.(*con.Tree)
-
-	if !ok {
-		return data.ErrorUnexpectedObjType
-	}
-
 	for _, v := range t.Entries {
 		e, ok := v.(*con.Entry)
 		if !ok {
@@ -312,7 +447,7 @@ func (s *Status) ReadTree(d *data.Database, objId string) error {
 		}
 
 		if e.IsTree() {
-			s.ReadTree(d, e.ObjId)
+			s.ReadTree(d, e.ObjId, e.Path)
 		} else {
 			s.HeadTree[e.Path] = e
 		}
@@ -331,7 +466,9 @@ func (s *Status) CheckIndexAgainstHeadTree(path string, e *con.Entry) error {
 		s.RecordChange(e.Path, s.IndexChanges, INDEX_ADDED)
 	} else {
 		//Indexにもあり、commitにもある
-		if !(ce.Mode == e.Mode && ce.ObjId == e.ObjId) {
+		if con.IsTypeChange(ce.Mode, e.Mode) {
+			s.RecordChange(e.Path, s.IndexChanges, INDEX_TYPECHANGE)
+		} else if !(ce.Mode == e.Mode && ce.ObjId == e.ObjId) {
 			//両方にあるがModeかOnjIdが違っていたらModeified
 			s.RecordChange(e.Path, s.IndexChanges, INDEX_MODIFIED)
 		}
@@ -341,21 +478,27 @@ func (s *Status) CheckIndexAgainstHeadTree(path string, e *con.Entry) error {
 }
 
 func (s *Status) CheckIndexEntry(i *data.Index, w *WorkSpace) error {
-	for k, v := range i.Entries {
-		e, ok := v.(*con.Entry)
+	//作業ディレクトリとの比較はファイルを読んでhashするので並列にし、結果はpath順に入れる
+	var targets []*con.Entry
+
+	for _, k := range i.Entries.GetSortedkey() {
+		e, ok := i.Entries[k].(*con.Entry)
 
 		if !ok {
 			return ErrorObjeToEntryConvError
 		}
 
-		if e.GetStage() == 0 {
-			err := s.CheckIndexAgainstWorkSpace(k.Path, e, i, w)
-
-			if err != nil {
-				return err
+		if e.IsIntentToAdd() {
+			//add -Nしたものはcommitの対象ではなく、作業ディレクトリで追加されたものとして出す
+			if _, ok := s.Stats[k.Path]; ok {
+				s.RecordChange(k.Path, s.WorkSpaceChanges, WORKSPACE_ADDED)
+			} else {
+				s.RecordChange(k.Path, s.WorkSpaceChanges, WORKSPACE_DELETE)
 			}
+		} else if e.GetStage() == 0 {
+			targets = append(targets, e)
 
-			err = s.CheckIndexAgainstHeadTree(k.Path, e)
+			err := s.CheckIndexAgainstHeadTree(k.Path, e)
 			if err != nil {
 				return err
 			}
@@ -368,6 +511,19 @@ func (s *Status) CheckIndexEntry(i *data.Index, w *WorkSpace) error {
 
 	}
 
+	results := make([]*workSpaceCheck, len(targets))
+	err := runParallel(len(targets), s.Threads, func(n int) error {
+		r, err := s.checkWorkSpace(targets[n].Path, targets[n], i, w)
+		results[n] = r
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for n, e := range targets {
+		s.applyWorkSpaceCheck(e.Path, e, i, results[n])
+	}
+
 	return nil
 }
 
@@ -378,6 +534,7 @@ func GenerateStatus() *Status {
 		Stats:            make(map[string]con.FileState),
 		HeadTree:         make(map[string]*con.Entry),
 		Conflicts:        make(map[string][]int),
+		Submodules:       make(map[string][]string),
 	}
 }
 
@@ -389,4 +546,10 @@ type Status struct {
 	HeadTree         map[string]*con.Entry
 	IndexChanges     map[string]int
 	WorkSpaceChanges map[string]int
+	//fsmonitorで変わっていないとわかりstatしなかったentry
+	FsmonitorValid map[string]struct{}
+	//submoduleのpath -> new commitsやmodified contentなど
+	Submodules map[string][]string
+	//作業ディレクトリを調べるgoroutineの数、1以下なら並列にしない
+	Threads int
 }
@@ -2,6 +2,8 @@ package src
 
 import (
 	"bytes"
+	"fmt"
+	er "mygit/src/errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -34,7 +36,7 @@ func Prepare(t *testing.T) func() {
 
 	is := []string{tempPath}
 	var buf bytes.Buffer
-	err = StartInit(is, &buf)
+	err = StartInit(is, &InitOption{}, &buf)
 	assert.NoError(t, err)
 	ss := []string{rel1, rel2, rel3}
 	err = StartAdd(tempPath, "test", "test@example.com", "test", ss)
@@ -205,3 +207,120 @@ func Test_Detect_Deleted_Dir(t *testing.T) {
 	assert.Equal(t, expected, bs)
 
 }
+
+func Test_Detect_Untracked_With_GitIgnore(t *testing.T) {
+	fn := Prepare(t)
+
+	t.Cleanup(fn)
+
+	curDir, err := os.Getwd()
+	assert.NoError(t, err)
+	tempPath := filepath.Join(curDir, "tempDir")
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(tempPath, ".config"))
+
+	//xxx/dummy.txtはtrackされているので*.txtで除外されない
+	CreateFiles(t, tempPath, ".gitignore", "*.txt\n.config/\nbuild/\n")
+	CreateFiles(t, filepath.Join(tempPath, "xxx"), "dummy.txt", "changed\n")
+	CreateFiles(t, tempPath, "new.txt", "new\n")
+
+	for _, dir := range []string{"src", "build"} {
+		err = os.MkdirAll(filepath.Join(tempPath, dir), os.ModePerm)
+		assert.NoError(t, err)
+		CreateFiles(t, filepath.Join(tempPath, dir), "main.go", "package main\n")
+	}
+
+	buf := new(bytes.Buffer)
+	err = StartStatus(buf, tempPath, false)
+	assert.NoError(t, err)
+
+	expected := " M xxx/dummy.txt\n?? src/\n?? .gitignore\n"
+
+	assert.Equal(t, expected, buf.String())
+
+	//除外されたpathを直接addしようとするとerror、それ以外はaddされる
+	err = StartAdd(tempPath, "test", "test@example.com", "test", []string{"new.txt", "src", "build"})
+	assert.Equal(t, &er.IgnoredPathOnAddError{
+		Message: "The following paths are ignored by one of your .gitignore files:\nnew.txt\nbuild\n",
+	}, err)
+
+	buf = new(bytes.Buffer)
+	err = StartStatus(buf, tempPath, false)
+	assert.NoError(t, err)
+
+	expected = "A  src/main.go\n M xxx/dummy.txt\n?? .gitignore\n"
+
+	assert.Equal(t, expected, buf.String())
+}
+
+func Test_Detect_Symlink(t *testing.T) {
+	fn := Prepare(t)
+
+	t.Cleanup(fn)
+
+	curDir, err := os.Getwd()
+	assert.NoError(t, err)
+	tempPath := filepath.Join(curDir, "tempDir")
+	linkPath := filepath.Join(tempPath, "link")
+
+	err = os.Symlink("hello.txt", linkPath)
+	assert.NoError(t, err)
+	err = StartAdd(tempPath, "test", "test@example.com", "test", []string{"."})
+	assert.NoError(t, err)
+	var commitBuf bytes.Buffer
+	err = StartCommit(tempPath, "test", "test@example.com", "link", &commitBuf)
+	assert.NoError(t, err)
+
+	//linkの先の中身が変わってもlinkそのものは変わらない
+	CreateFiles(t, tempPath, "hello.txt", "changed\n")
+
+	buf := new(bytes.Buffer)
+	err = StartStatus(buf, tempPath, false)
+	assert.NoError(t, err)
+	assert.Equal(t, " M hello.txt\n", buf.String())
+
+	//linkの先のpathが変わったらmodified
+	err = os.Remove(linkPath)
+	assert.NoError(t, err)
+	err = os.Symlink("xxx/dummy.txt", linkPath)
+	assert.NoError(t, err)
+
+	buf = new(bytes.Buffer)
+	err = StartStatus(buf, tempPath, false)
+	assert.NoError(t, err)
+	assert.Equal(t, " M link\n M hello.txt\n", buf.String())
+}
+
+func Test_Detect_TypeChange(t *testing.T) {
+	fn := Prepare(t)
+
+	t.Cleanup(fn)
+
+	curDir, err := os.Getwd()
+	assert.NoError(t, err)
+	tempPath := filepath.Join(curDir, "tempDir")
+	helloPath := filepath.Join(tempPath, "hello.txt")
+
+	//ファイルをsymlinkに置き換える
+	err = os.Remove(helloPath)
+	assert.NoError(t, err)
+	err = os.Symlink("xxx/dummy.txt", helloPath)
+	assert.NoError(t, err)
+
+	buf := new(bytes.Buffer)
+	err = StartStatus(buf, tempPath, false)
+	assert.NoError(t, err)
+	assert.Equal(t, " T hello.txt\n", buf.String())
+
+	buf = new(bytes.Buffer)
+	err = StartStatus(buf, tempPath, true)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), fmt.Sprintf("\t%*s%s", LABELWIDTH, "typechange:", "hello.txt"))
+
+	err = StartAdd(tempPath, "test", "test@example.com", "test", []string{"."})
+	assert.NoError(t, err)
+
+	buf = new(bytes.Buffer)
+	err = StartStatus(buf, tempPath, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "T  hello.txt\n", buf.String())
+}
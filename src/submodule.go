@@ -0,0 +1,523 @@
+package src
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	data "mygit/src/database"
+	con "mygit/src/database/content"
+	"mygit/src/database/lock"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+//submoduleは本家と同じく.gitmodulesの[submodule "name"]にpathとurlを書き、
+//indexとtreeにはmode 160000(gitlink)のentryとしてsubmoduleのcommitのobjIdを入れる
+//cloneしたsubmoduleの.gitは.git/modules/<name>に置き、作業ディレクトリの.gitはそこを指すgitfileにする
+
+type Submodule struct {
+	Name string
+	Path string
+	URL  string
+}
+
+var (
+	ErrorUnknownSubmoduleCmd    = errors.New("unknown submodule subcommand")
+	ErrorSubmoduleAlreadyExists = errors.New("already exists in the index")
+	ErrorNoSubmoduleMapping     = errors.New("no submodule mapping found in .gitmodules")
+	ErrorSubmoduleNoCommit      = errors.New("does not have a commit checked out")
+	ErrorInvalidSubmoduleName   = errors.New("is not a valid submodule name")
+)
+
+const (
+	GITMODULES_FILE   = ".gitmodules"
+	SUBMODULE_SECTION = "submodule"
+)
+
+//long statusでmodified:の後ろに出す
+var (
+	SUBMODULE_NEW_COMMITS       = "new commits"
+	SUBMODULE_MODIFIED_CONTENT  = "modified content"
+	SUBMODULE_UNTRACKED_CONTENT = "untracked content"
+)
+
+func StartSubmodule(rootPath string, args []string, w io.Writer) error {
+	repo, err := DiscoverWorkTree(rootPath)
+	if err != nil {
+		return err
+	}
+
+	command := "status"
+	if len(args) > 0 {
+		command = args[0]
+		args = args[1:]
+	}
+
+	_, indexNonExist := os.Stat(repo.i.Path)
+
+	l := lock.NewFileLock(repo.i.Path)
+	l.Lock()
+	defer l.Unlock()
+
+	if indexNonExist == nil {
+		err := repo.i.Load()
+		if err != nil {
+			return err
+		}
+	}
+
+	switch command {
+	case "add":
+		if len(args) == 0 || len(args) > 2 {
+			return ErrorUnknownSubmoduleCmd
+		}
+		path := ""
+		if len(args) == 2 {
+			path = repo.Pathspec(args[1])
+		} else {
+			path = cloneDirName(args[0])
+		}
+		err := AddSubmodule(args[0], path, repo, w)
+		if err != nil {
+			return err
+		}
+		return repo.i.Write(repo.i.Path)
+	case "init":
+		return InitSubmodules(repo, w)
+	case "update":
+		return UpdateSubmodules(repo, w)
+	case "status":
+		return PrintSubmoduleStatus(repo, w)
+	default:
+		return ErrorUnknownSubmoduleCmd
+	}
+}
+
+func gitmodulesPath(repo *Repository) string {
+	return filepath.Join(repo.w.Path, GITMODULES_FILE)
+}
+
+//nameは.git/modules/<name>になるので、本家のcheck_submodule_nameと同じく外に出られるものは使わない
+func CheckSubmoduleName(name string) bool {
+	if name == "" || strings.HasPrefix(name, "/") || filepath.IsAbs(name) {
+		return false
+	}
+	for _, c := range strings.FieldsFunc(name, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if c == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+//.gitmodulesに書かれた順に返す、pathのないものは使えないので飛ばす
+//.gitmodulesはcloneしてきたものなので、おかしなnameは警告して飛ばす
+func LoadGitmodules(repo *Repository, w io.Writer) ([]*Submodule, error) {
+	c := data.GenerateConfig(gitmodulesPath(repo))
+	err := c.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	var submodules []*Submodule
+	for _, name := range c.Subsections(SUBMODULE_SECTION) {
+		if !CheckSubmoduleName(name) {
+			w.Write([]byte(fmt.Sprintf("warning: ignoring suspicious submodule name: %s\n", name)))
+			continue
+		}
+		path, ok := c.Get(SUBMODULE_SECTION, name, "path")
+		if !ok {
+			continue
+		}
+		url, _ := c.Get(SUBMODULE_SECTION, name, "url")
+		submodules = append(submodules, &Submodule{
+			Name: name,
+			Path: filepath.Clean(filepath.FromSlash(path)),
+			URL:  url,
+		})
+	}
+
+	return submodules, nil
+}
+
+func SubmoduleGitPath(name string, repo *Repository) string {
+	return filepath.Join(repo.r.Path, "modules", filepath.FromSlash(name))
+}
+
+//本家と同じく./や../で始まるurlはsuperprojectのoriginのurl(なければ作業ディレクトリ)からの相対
+//それ以外のlocalのpathは作業ディレクトリが変わっても辿れるように絶対pathにする
+func resolveSubmoduleURL(url string, repo *Repository) (string, error) {
+	if strings.HasPrefix(url, "./") || strings.HasPrefix(url, "../") {
+		base := repo.w.Path
+		if remote, err := LoadRemote(DEFAULT_REMOTE, repo); err == nil {
+			base = remote.URL
+		}
+		return filepath.Join(base, url), nil
+	}
+
+	if _, isSSH := ParseSSHURL(url); !isSSH && !strings.Contains(url, "://") {
+		return filepath.Abs(url)
+	}
+
+	return url, nil
+}
+
+//indexのgitlinkをpath順に返す、conflictしているものはstage0がないので最初のstageのものを返す
+func submoduleEntries(repo *Repository) ([]*con.Entry, map[string]bool, error) {
+	entries, err := repo.i.GetEntries()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var gitlinks []*con.Entry
+	conflicted := make(map[string]bool)
+	seen := make(map[string]bool)
+	for _, e := range entries {
+		if !e.IsGitlink() {
+			continue
+		}
+		if e.GetStage() != 0 {
+			conflicted[e.Path] = true
+		}
+		if seen[e.Path] {
+			continue
+		}
+		seen[e.Path] = true
+		gitlinks = append(gitlinks, e)
+	}
+	sort.Slice(gitlinks, func(a, b int) bool {
+		return gitlinks[a].Path < gitlinks[b].Path
+	})
+
+	return gitlinks, conflicted, nil
+}
+
+func submoduleForPath(path string, submodules []*Submodule) (*Submodule, error) {
+	for _, sm := range submodules {
+		if sm.Path == path {
+			return sm, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w for path '%s'", ErrorNoSubmoduleMapping, path)
+}
+
+//pathにあるsubmoduleのrepositoryを開く、上のdirectoryには辿らない
+func openSubmodule(w *WorkSpace, path string) (*Repository, error) {
+	workTree := filepath.Join(w.Path, path)
+	gitPath, workTree, found, err := findGitDir(workTree)
+	if err != nil {
+		return nil, err
+	}
+	if !found || workTree == "" {
+		return nil, ErrorNotAGitRepository
+	}
+
+	return openRepository(workTree, gitPath, workTree)
+}
+
+//入れ子のrepositoryは中身ではなくHEADのcommitをgitlinkとしてindexに入れる
+func AddGitlink(path string, repo *Repository) error {
+	sub, err := openSubmodule(repo.w, path)
+	if err != nil {
+		return err
+	}
+
+	head, err := sub.r.ReadHead()
+	if err != nil {
+		return err
+	}
+	if head == "" {
+		return fmt.Errorf("'%s' %w", path, ErrorSubmoduleNoCommit)
+	}
+
+	stat, err := repo.w.StatFile(path)
+	if err != nil {
+		return err
+	}
+
+	return repo.i.Add(path, head, stat, data.CreateIndex)
+}
+
+//すでにrepositoryがあればそれを使い、なければcloneして.gitmodulesとindexに登録する
+func AddSubmodule(url, path string, repo *Repository, w io.Writer) error {
+	path = filepath.Clean(path)
+	if repo.i.IsIndexed(path) {
+		return fmt.Errorf("'%s' %w", path, ErrorSubmoduleAlreadyExists)
+	}
+	name := filepath.ToSlash(path)
+	if !CheckSubmoduleName(name) {
+		return fmt.Errorf("'%s' %w", name, ErrorInvalidSubmoduleName)
+	}
+
+	resolved, err := resolveSubmoduleURL(url, repo)
+	if err != nil {
+		return err
+	}
+	//.gitmodulesには本家と同じく相対urlはそのまま書く
+	if !strings.HasPrefix(url, "./") && !strings.HasPrefix(url, "../") {
+		url = resolved
+	}
+
+	if !repo.w.IsNestedRepository(path) {
+		err := RunCloneWithGitPath(resolved, filepath.Join(repo.w.Path, path), SubmoduleGitPath(name, repo), w)
+		if err != nil {
+			return err
+		}
+	}
+
+	gitmodules := data.GenerateConfig(gitmodulesPath(repo))
+	err = gitmodules.Load()
+	if err != nil {
+		return err
+	}
+	gitmodules.Set(SUBMODULE_SECTION, name, "path", name)
+	gitmodules.Set(SUBMODULE_SECTION, name, "url", url)
+	//lockは実行権限付きでファイルを作ってしまうので、commitするファイルは先に作っておく
+	if _, err := os.Stat(gitmodules.Path); os.IsNotExist(err) {
+		err := ioutil.WriteFile(gitmodules.Path, nil, 0644)
+		if err != nil {
+			return err
+		}
+	}
+	err = gitmodules.Save()
+	if err != nil {
+		return err
+	}
+
+	err = registerSubmodule(name, resolved, repo)
+	if err != nil {
+		return err
+	}
+
+	err = AddIndex(GITMODULES_FILE, repo)
+	if err != nil {
+		return err
+	}
+
+	return AddGitlink(path, repo)
+}
+
+//.git/configにurlを書いたsubmoduleだけがupdateの対象になる
+func registerSubmodule(name, url string, repo *Repository) error {
+	c, err := LoadConfig(repo)
+	if err != nil {
+		return err
+	}
+	c.Set(SUBMODULE_SECTION, name, "url", url)
+	c.Set(SUBMODULE_SECTION, name, "active", "true")
+
+	return c.Save()
+}
+
+//.gitmodulesのurlを.git/configに写す、すでに登録してあるものは本家と同じく上書きしない
+func InitSubmodules(repo *Repository, w io.Writer) error {
+	submodules, err := LoadGitmodules(repo, w)
+	if err != nil {
+		return err
+	}
+	gitlinks, _, err := submoduleEntries(repo)
+	if err != nil {
+		return err
+	}
+
+	c, err := LoadConfig(repo)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range gitlinks {
+		sm, err := submoduleForPath(e.Path, submodules)
+		if err != nil {
+			return err
+		}
+		if _, ok := c.Get(SUBMODULE_SECTION, sm.Name, "url"); ok {
+			continue
+		}
+
+		url, err := resolveSubmoduleURL(sm.URL, repo)
+		if err != nil {
+			return err
+		}
+		err = registerSubmodule(sm.Name, url, repo)
+		if err != nil {
+			return err
+		}
+		w.Write([]byte(fmt.Sprintf("Submodule '%s' (%s) registered for path '%s'\n", sm.Name, url, filepath.ToSlash(sm.Path))))
+	}
+
+	return nil
+}
+
+//initしたsubmoduleをcloneし、indexに記録されたcommitにdetachする
+func UpdateSubmodules(repo *Repository, w io.Writer) error {
+	submodules, err := LoadGitmodules(repo, w)
+	if err != nil {
+		return err
+	}
+	gitlinks, conflicted, err := submoduleEntries(repo)
+	if err != nil {
+		return err
+	}
+
+	c, err := LoadConfig(repo)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range gitlinks {
+		if conflicted[e.Path] {
+			w.Write([]byte(fmt.Sprintf("Skipping unmerged submodule %s\n", filepath.ToSlash(e.Path))))
+			continue
+		}
+		sm, err := submoduleForPath(e.Path, submodules)
+		if err != nil {
+			return err
+		}
+		url, ok := c.Get(SUBMODULE_SECTION, sm.Name, "url")
+		if !ok {
+			continue
+		}
+
+		rootPath := filepath.Join(repo.w.Path, e.Path)
+		cloned := false
+		if !repo.w.IsNestedRepository(e.Path) {
+			err := RunCloneWithGitPath(url, rootPath, SubmoduleGitPath(sm.Name, repo), w)
+			if err != nil {
+				return err
+			}
+			cloned = true
+		}
+
+		sub, err := openSubmodule(repo.w, e.Path)
+		if err != nil {
+			return err
+		}
+		head, err := sub.r.ReadHead()
+		if err != nil {
+			return err
+		}
+		if head == e.ObjId && !cloned {
+			continue
+		}
+
+		err = CheckoutSubmodule(rootPath, e.ObjId)
+		if err != nil {
+			return err
+		}
+		w.Write([]byte(fmt.Sprintf("Submodule path '%s': checked out '%s'\n", filepath.ToSlash(e.Path), e.ObjId)))
+	}
+
+	return nil
+}
+
+//submoduleのHEADをobjIdにdetachする、submoduleにないcommitならoriginからfetchしてくる
+func CheckoutSubmodule(rootPath, objId string) error {
+	sub, err := DiscoverWorkTree(rootPath)
+	if err != nil {
+		return err
+	}
+
+	head, err := sub.r.ReadHead()
+	if err != nil {
+		return err
+	}
+	if head == objId {
+		return nil
+	}
+
+	if !sub.d.HasObject(objId) {
+		remote, err := LoadRemote(DEFAULT_REMOTE, sub)
+		if err != nil {
+			return err
+		}
+		_, err = RunFetch(remote, sub, ioutil.Discard)
+		if err != nil {
+			return err
+		}
+	}
+
+	return StartCheckout(rootPath, []string{objId}, ioutil.Discard)
+}
+
+//本家と同じく、cloneしていないものは-、indexと違うcommitにいるものは+、conflictしているものはUをつける
+func PrintSubmoduleStatus(repo *Repository, w io.Writer) error {
+	gitlinks, conflicted, err := submoduleEntries(repo)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range gitlinks {
+		path := filepath.ToSlash(e.Path)
+
+		if conflicted[e.Path] {
+			w.Write([]byte(fmt.Sprintf("U%s %s\n", repo.Hash().ZeroObjId(), path)))
+			continue
+		}
+		if !repo.w.IsNestedRepository(e.Path) {
+			w.Write([]byte(fmt.Sprintf("-%s %s\n", e.ObjId, path)))
+			continue
+		}
+
+		sub, err := openSubmodule(repo.w, e.Path)
+		if err != nil {
+			return err
+		}
+		head, err := sub.r.ReadHead()
+		if err != nil {
+			return err
+		}
+
+		prefix := " "
+		if head != e.ObjId {
+			prefix = "+"
+		}
+		w.Write([]byte(fmt.Sprintf("%s%s %s\n", prefix, head, path)))
+	}
+
+	return nil
+}
+
+//statusで使う、記録したcommitとsubmoduleのHEADの違いと、submoduleの中の変更を返す
+//cloneしていないsubmoduleは変わっていないものとする
+func SubmoduleChanges(w *WorkSpace, e *con.Entry) ([]string, error) {
+	if !w.IsNestedRepository(e.Path) {
+		return nil, nil
+	}
+
+	sub, err := openSubmodule(w, e.Path)
+	if err != nil {
+		return nil, err
+	}
+	head, err := sub.r.ReadHead()
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []string
+	if head != e.ObjId {
+		changes = append(changes, SUBMODULE_NEW_COMMITS)
+	}
+
+	if _, err := os.Stat(sub.i.Path); err == nil {
+		if err := sub.i.Load(); err != nil {
+			return nil, err
+		}
+	}
+	s := GenerateStatus()
+	err = s.IntitializeStatus(sub)
+	if err != nil {
+		return nil, err
+	}
+	if len(s.IndexChanges) != 0 || len(s.WorkSpaceChanges) != 0 || len(s.Conflicts) != 0 {
+		changes = append(changes, SUBMODULE_MODIFIED_CONTENT)
+	}
+	if len(s.Untracked) != 0 {
+		changes = append(changes, SUBMODULE_UNTRACKED_CONTENT)
+	}
+
+	return changes, nil
+}
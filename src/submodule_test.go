@@ -0,0 +1,256 @@
+package src
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//originの下にsubmoduleにするlibと、それを入れるsuperを作る
+func PrepareSubmoduleRepo(t *testing.T) (string, string, string) {
+	tempPath, libPath, _ := PrepareRemoteRepo(t)
+	CommitFileForTest(t, libPath, "a.txt", "a\n", "lib first")
+
+	superPath := filepath.Join(tempPath, "super")
+	err := os.MkdirAll(superPath, os.ModePerm)
+	assert.NoError(t, err)
+	var buf bytes.Buffer
+	err = StartInit([]string{superPath}, &InitOption{}, &buf)
+	assert.NoError(t, err)
+	CommitFileForTest(t, superPath, "readme", "readme\n", "super first")
+
+	return tempPath, libPath, superPath
+}
+
+func SubmoduleHeadForTest(t *testing.T, rootPath string) string {
+	sub, err := DiscoverWorkTree(rootPath)
+	assert.NoError(t, err)
+	head, err := sub.r.ReadHead()
+	assert.NoError(t, err)
+	return head
+}
+
+func TestSubmoduleAddAndStatus(t *testing.T) {
+	_, libPath, superPath := PrepareSubmoduleRepo(t)
+	var buf bytes.Buffer
+
+	first := SubmoduleHeadForTest(t, libPath)
+
+	err := StartSubmodule(superPath, []string{"add", libPath, "lib"}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "Cloning into 'lib'...\n", buf.String())
+
+	gitmodules, err := ioutil.ReadFile(filepath.Join(superPath, GITMODULES_FILE))
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("[submodule \"lib\"]\n\tpath = lib\n\turl = %s\n", libPath), string(gitmodules))
+	stat, err := os.Stat(filepath.Join(superPath, GITMODULES_FILE))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), stat.Mode().Perm())
+
+	//.gitは.git/modulesの下に置く
+	gitFile, err := ioutil.ReadFile(filepath.Join(superPath, "lib", ".git"))
+	assert.NoError(t, err)
+	assert.Equal(t, "gitdir: ../.git/modules/lib\n", string(gitFile))
+
+	super, err := DiscoverWorkTree(superPath)
+	assert.NoError(t, err)
+	err = super.i.Load()
+	assert.NoError(t, err)
+	e, ok := super.i.EntryForPath("lib")
+	assert.True(t, ok)
+	assert.True(t, e.IsGitlink())
+	assert.Equal(t, first, e.ObjId)
+
+	err = StartCommit(superPath, "test", "test@example.com", "add lib", &buf)
+	assert.NoError(t, err)
+
+	buf.Reset()
+	err = StartStatus(&buf, superPath, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "", buf.String())
+
+	buf.Reset()
+	err = StartSubmodule(superPath, nil, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf(" %s lib\n", first), buf.String())
+
+	//submoduleの中でcommitするとnew commits
+	subPath := filepath.Join(superPath, "lib")
+	CommitFileForTest(t, subPath, "b.txt", "b\n", "lib second")
+	second := SubmoduleHeadForTest(t, subPath)
+
+	buf.Reset()
+	err = StartStatus(&buf, superPath, false)
+	assert.NoError(t, err)
+	assert.Equal(t, " M lib\n", buf.String())
+
+	buf.Reset()
+	err = StartStatus(&buf, superPath, true)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), fmt.Sprintf("\t%*s%s (%s)", LABELWIDTH, LongModified, "lib", SUBMODULE_NEW_COMMITS))
+
+	buf.Reset()
+	err = StartSubmodule(superPath, []string{"status"}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("+%s lib\n", second), buf.String())
+
+	//submoduleの作業ディレクトリの変更はmodified content
+	CreateFiles(t, subPath, "a.txt", "changed\n")
+	CreateFiles(t, subPath, "c.txt", "c\n")
+	buf.Reset()
+	err = StartStatus(&buf, superPath, true)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), fmt.Sprintf("\t%*s%s (%s, %s, %s)", LABELWIDTH, LongModified, "lib", SUBMODULE_NEW_COMMITS, SUBMODULE_MODIFIED_CONTENT, SUBMODULE_UNTRACKED_CONTENT))
+
+	//diffは本家と同じくcommitのobjIdを出す
+	buf.Reset()
+	err = StartDiff(&buf, superPath, &DiffOption{})
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), fmt.Sprintf("-Subproject commit %s\n+Subproject commit %s\n", first, second))
+
+	err = StartSubmodule(superPath, []string{"add", libPath, "lib"}, &buf)
+	assert.ErrorIs(t, err, ErrorSubmoduleAlreadyExists)
+}
+
+func TestSubmoduleCheckout(t *testing.T) {
+	_, libPath, superPath := PrepareSubmoduleRepo(t)
+	var buf bytes.Buffer
+
+	first := SubmoduleHeadForTest(t, libPath)
+	err := StartSubmodule(superPath, []string{"add", libPath, "lib"}, &buf)
+	assert.NoError(t, err)
+	err = StartCommit(superPath, "test", "test@example.com", "add lib", &buf)
+	assert.NoError(t, err)
+
+	subPath := filepath.Join(superPath, "lib")
+	CommitFileForTest(t, subPath, "b.txt", "b\n", "lib second")
+	second := SubmoduleHeadForTest(t, subPath)
+
+	err = StartAdd(superPath, "test", "test@example.com", "test", []string{"lib"})
+	assert.NoError(t, err)
+	err = StartCommit(superPath, "test", "test@example.com", "bump lib", &buf)
+	assert.NoError(t, err)
+
+	//superをcheckoutするとsubmoduleも記録されたcommitに移る
+	err = StartCheckout(superPath, []string{"master^"}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, first, SubmoduleHeadForTest(t, subPath))
+	_, err = os.Stat(filepath.Join(subPath, "b.txt"))
+	assert.True(t, os.IsNotExist(err))
+
+	buf.Reset()
+	err = StartStatus(&buf, superPath, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "", buf.String())
+
+	err = StartCheckout(superPath, []string{"master"}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, second, SubmoduleHeadForTest(t, subPath))
+}
+
+func TestSubmoduleInitAndUpdate(t *testing.T) {
+	tempPath, libPath, superPath := PrepareSubmoduleRepo(t)
+	var buf bytes.Buffer
+
+	first := SubmoduleHeadForTest(t, libPath)
+	err := StartSubmodule(superPath, []string{"add", libPath, "lib"}, &buf)
+	assert.NoError(t, err)
+	err = StartCommit(superPath, "test", "test@example.com", "add lib", &buf)
+	assert.NoError(t, err)
+
+	//cloneしただけではsubmoduleは空のdirectory
+	clonePath := filepath.Join(tempPath, "clone")
+	err = StartClone([]string{superPath, clonePath}, &buf)
+	assert.NoError(t, err)
+	files, err := ioutil.ReadDir(filepath.Join(clonePath, "lib"))
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+
+	buf.Reset()
+	err = StartSubmodule(clonePath, []string{"status"}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("-%s lib\n", first), buf.String())
+
+	buf.Reset()
+	err = StartStatus(&buf, clonePath, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "", buf.String())
+
+	//initしていないsubmoduleはupdateしない
+	buf.Reset()
+	err = StartSubmodule(clonePath, []string{"update"}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "", buf.String())
+
+	buf.Reset()
+	err = StartSubmodule(clonePath, []string{"init"}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("Submodule 'lib' (%s) registered for path 'lib'\n", libPath), buf.String())
+
+	buf.Reset()
+	err = StartSubmodule(clonePath, []string{"update"}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("Cloning into 'lib'...\nSubmodule path 'lib': checked out '%s'\n", first), buf.String())
+
+	content, err := ioutil.ReadFile(filepath.Join(clonePath, "lib", "a.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "a\n", string(content))
+
+	buf.Reset()
+	err = StartSubmodule(clonePath, nil, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf(" %s lib\n", first), buf.String())
+
+	//originのlibが進んでいても記録されたcommitに合わせる
+	CommitFileForTest(t, libPath, "b.txt", "b\n", "lib second")
+	buf.Reset()
+	err = StartSubmodule(clonePath, []string{"update"}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "", buf.String())
+	assert.Equal(t, first, SubmoduleHeadForTest(t, filepath.Join(clonePath, "lib")))
+}
+
+func TestCheckSubmoduleName(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		valid bool
+	}{
+		{"lib", true},
+		{"deps/lib", true},
+		{"lib..old", true},
+		{"", false},
+		{"/abs", false},
+		{"..", false},
+		{"../../hooks", false},
+		{"a/../../b", false},
+		{"a\\..\\b", false},
+	} {
+		assert.Equal(t, tt.valid, CheckSubmoduleName(tt.name), tt.name)
+	}
+}
+
+func TestLoadGitmodulesSkipsSuspiciousName(t *testing.T) {
+	_, libPath, superPath := PrepareSubmoduleRepo(t)
+	var buf bytes.Buffer
+
+	content := fmt.Sprintf("[submodule \"../../hooks\"]\n\tpath = evil\n\turl = %s\n[submodule \"lib\"]\n\tpath = lib\n\turl = %s\n", libPath, libPath)
+	CreateFiles(t, superPath, GITMODULES_FILE, content)
+
+	super, err := DiscoverWorkTree(superPath)
+	assert.NoError(t, err)
+	submodules, err := LoadGitmodules(super, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "warning: ignoring suspicious submodule name: ../../hooks\n", buf.String())
+	assert.Equal(t, 1, len(submodules))
+	assert.Equal(t, "lib", submodules[0].Name)
+
+	err = StartSubmodule(superPath, []string{"add", libPath, "../../hooks"}, &buf)
+	assert.ErrorIs(t, err, ErrorInvalidSubmoduleName)
+	_, err = os.Stat(filepath.Join(superPath, ".git", "hooks", ".git"))
+	assert.True(t, os.IsNotExist(err))
+}
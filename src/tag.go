@@ -0,0 +1,117 @@
+package src
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	con "mygit/src/database/content"
+	"path/filepath"
+)
+
+type TagOption struct {
+	//-a,-mの時はtag objectを作る(annotated tag)、それ以外はrefs/tagsにobjIdを書くだけ(lightweight tag)
+	Annotate bool
+	//-s、署名したannotated tagを作る
+	Sign    bool
+	Message string
+	Delete  bool
+	Force   bool
+}
+
+var ErrorEmptyTagMessage = errors.New("annotated tag requires message")
+
+func StartTag(rootPath, uName, uEmail string, args []string, option *TagOption, w io.Writer) error {
+	repo, err := DiscoverRepository(rootPath)
+	if err != nil {
+		return err
+	}
+	uName, uEmail, err = repo.Identity(uName, uEmail)
+	if err != nil {
+		return err
+	}
+
+	if option.Delete {
+		return DeleteTags(args, repo, w)
+	}
+
+	if len(args) == 0 {
+		return ListTags(repo, w)
+	}
+
+	tagName := args[0]
+	target := "HEAD"
+	if len(args) > 1 {
+		target = args[1]
+	}
+
+	rev, err := ParseRev(target)
+	if err != nil {
+		return err
+	}
+
+	objId, err := ResolveRev(rev, repo)
+	if err != nil {
+		return err
+	}
+
+	//-mを指定したら-aがなくてもannotated tag(本家と同じ)
+	if option.Annotate || option.Sign || option.Message != "" {
+		if option.Message == "" {
+			return ErrorEmptyTagMessage
+		}
+
+		tag := con.GenerateTag(objId, con.COMMIT, tagName, con.GenerateAuthor(uName, uEmail), option.Message)
+
+		sign := option.Sign
+		if !sign {
+			cs, err := repo.Config()
+			if err != nil {
+				return err
+			}
+			if sign, err = cs.TagGpgSign(); err != nil {
+				return err
+			}
+		}
+		if sign {
+			if err := repo.SignTag(tag); err != nil {
+				return err
+			}
+		}
+
+		repo.d.Store(tag)
+		objId = tag.GetObjId()
+	}
+
+	return repo.r.CreateTag(tagName, objId, option.Force)
+}
+
+func DeleteTags(args []string, repo *Repository, w io.Writer) error {
+	for _, tagName := range args {
+		objId, err := repo.r.DeleteTag(tagName)
+		if err != nil {
+			return err
+		}
+
+		w.Write([]byte(fmt.Sprintf("Deleted tag '%s' (was %s)\n", tagName, ShortOid(objId, repo.d))))
+	}
+
+	return nil
+}
+
+func ListTags(repo *Repository, w io.Writer) error {
+	tags, err := repo.r.ListTags()
+	if err != nil {
+		return err
+	}
+
+	for _, t := range tags {
+		//release/v1のようにnestしていることがあるのでrefs/tagsからの相対pathで出す
+		name, err := filepath.Rel(repo.r.TagsPath(), filepath.Join(repo.r.Path, t.Path))
+		if err != nil {
+			return err
+		}
+		w.Write([]byte(fmt.Sprintf("%s\n", name)))
+	}
+
+	return nil
+}
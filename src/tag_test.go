@@ -0,0 +1,112 @@
+package src
+
+import (
+	"bytes"
+	"fmt"
+	data "mygit/src/database"
+	con "mygit/src/database/content"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func PrepareTagRepo(t *testing.T) (string, *Repository) {
+	tempPath, repo := PrepareRebaseRepo(t)
+	var buf bytes.Buffer
+
+	for i, content := range []string{"first\n", "second\n"} {
+		CreateFiles(t, tempPath, "hello.txt", content)
+		err := StartAdd(tempPath, "test", "test@example.com", "test", []string{"."})
+		assert.NoError(t, err)
+		err = StartCommit(tempPath, "test", "test@example.com", fmt.Sprintf("commit%d", i+1), &buf)
+		assert.NoError(t, err)
+	}
+
+	return tempPath, repo
+}
+
+func ResolveForTest(t *testing.T, name string, repo *Repository) string {
+	rev, err := ParseRev(name)
+	assert.NoError(t, err)
+	objId, err := ResolveRev(rev, repo)
+	assert.NoError(t, err)
+	return objId
+}
+
+func TestTag(t *testing.T) {
+	tempPath, repo := PrepareTagRepo(t)
+	var buf bytes.Buffer
+
+	headObjId, err := repo.r.ReadHead()
+	assert.NoError(t, err)
+	parentObjId := ResolveForTest(t, "HEAD^", repo)
+
+	//lightweight tagはcommitのobjIdをそのまま書く
+	err = StartTag(tempPath, "test", "test@example.com", []string{"v0.1", "HEAD^"}, &TagOption{}, &buf)
+	assert.NoError(t, err)
+	v01, err := data.ReadRefFile(filepath.Join(repo.r.TagsPath(), "v0.1"))
+	assert.NoError(t, err)
+	assert.Equal(t, parentObjId, v01)
+
+	//annotated tagはtag objectを作ってそのobjIdを書く
+	err = StartTag(tempPath, "test", "test@example.com", []string{"release/v1.0"}, &TagOption{Annotate: true, Message: "release v1.0"}, &buf)
+	assert.NoError(t, err)
+	v10, err := data.ReadRefFile(filepath.Join(repo.r.TagsPath(), "release", "v1.0"))
+	assert.NoError(t, err)
+
+	o, err := repo.d.ReadObject(v10)
+	assert.NoError(t, err)
+	tag, ok := o.(*con.Tag)
+	assert.True(t, ok)
+	assert.Equal(t, headObjId, tag.Object)
+	assert.Equal(t, con.COMMIT, tag.ObjType)
+	assert.Equal(t, "release/v1.0", tag.TagName)
+	assert.Equal(t, "test", tag.Tagger.Name)
+	assert.Equal(t, "release v1.0", tag.Message)
+
+	//revisionではtagをcommitまで剥がす
+	assert.Equal(t, parentObjId, ResolveForTest(t, "v0.1", repo))
+	assert.Equal(t, headObjId, ResolveForTest(t, "release/v1.0", repo))
+	assert.Equal(t, headObjId, ResolveForTest(t, "release/v1.0^{}", repo))
+	assert.Equal(t, parentObjId, ResolveForTest(t, "release/v1.0^", repo))
+	assert.Equal(t, parentObjId, ResolveForTest(t, "release/v1.0^{commit}~1", repo))
+
+	err = StartTag(tempPath, "test", "test@example.com", []string{"v0.1"}, &TagOption{}, &buf)
+	assert.Equal(t, data.ErrorTagAlreadyExists, err)
+	err = StartTag(tempPath, "test", "test@example.com", []string{"v0.1"}, &TagOption{Force: true}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, headObjId, ResolveForTest(t, "v0.1", repo))
+
+	err = StartTag(tempPath, "test", "test@example.com", []string{"bad..name"}, &TagOption{}, &buf)
+	assert.Equal(t, data.ErrorDiskTraversal, err)
+
+	buf.Reset()
+	err = StartTag(tempPath, "test", "test@example.com", []string{}, &TagOption{}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "release/v1.0\nv0.1\n", buf.String())
+
+	reachable, err := ReachableObjects(repo)
+	assert.NoError(t, err)
+	assert.True(t, reachable[v10])
+
+	//refs/tagsの外にあるbranchは消せない
+	err = StartTag(tempPath, "test", "test@example.com", []string{"../heads/master"}, &TagOption{Delete: true}, &buf)
+	assert.Equal(t, data.ErrorInitialDot, err)
+	assert.Equal(t, headObjId, ResolveForTest(t, "refs/heads/master", repo))
+
+	buf.Reset()
+	err = StartTag(tempPath, "test", "test@example.com", []string{"release/v1.0"}, &TagOption{Delete: true}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("Deleted tag 'release/v1.0' (was %s)\n", repo.d.ShortObjId(v10)), buf.String())
+
+	//空になったrefs/tags/releaseも消える
+	_, err = os.Stat(filepath.Join(repo.r.TagsPath(), "release"))
+	assert.True(t, os.IsNotExist(err))
+
+	//tag objectはunreachableになる
+	reachable, err = ReachableObjects(GenerateRepository(tempPath, repo.r.Path, repo.d.Path))
+	assert.NoError(t, err)
+	assert.False(t, reachable[v10])
+}
@@ -0,0 +1,362 @@
+package src
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mygit/src/crypt"
+	data "mygit/src/database"
+	con "mygit/src/database/content"
+	"path/filepath"
+	"strings"
+)
+
+//fetch,pushでremoteとやりとりする部分
+//Transportはremoteのrefの一覧を返し、足りないobjectを受け取る(fetch)か送ってrefを更新する(push)
+//localのfilesystem上のrepository(pathかfile://)と、http(s)://のsmart HTTP、ssh://かhost:pathのpipeを扱う
+
+type RemoteRef struct {
+	Name  string
+	ObjId string
+	//HEADがbranchを指していればrefs/heads/xxx
+	Target string
+}
+
+type RefUpdate struct {
+	//remote側のref名
+	Name     string
+	OldObjId string
+	//空ならrefを消す
+	NewObjId string
+	Force    bool
+	//受け付けられなかった理由、空なら成功
+	Reason string
+}
+
+type Transport interface {
+	ListRefs() ([]*RemoteRef, error)
+	//wantsから辿れるobjectのうちlocalにないものを持ってくる
+	Fetch(wants []string, local *Repository) error
+	//localのobjectを送ってからremoteのrefを更新する、結果はRefUpdate.Reasonに書く
+	Push(updates []*RefUpdate, local *Repository) error
+	//ListRefsで分かったremoteのhash
+	ObjectFormat() crypt.Hash
+}
+
+var (
+	ErrorNotARepository       = errors.New("does not appear to be a mygit repository")
+	ErrorUnsupportedTransport = errors.New("unsupported transport")
+)
+
+const (
+	FILE_URL_PREFIX  = "file://"
+	HTTP_URL_PREFIX  = "http://"
+	HTTPS_URL_PREFIX = "https://"
+)
+
+//localのrepositoryを起点にurlを解決する、相対pathはworkspaceからの相対
+func OpenTransport(url string, local *Repository) (Transport, error) {
+	if strings.HasPrefix(url, HTTP_URL_PREFIX) || strings.HasPrefix(url, HTTPS_URL_PREFIX) {
+		return GenerateHTTPTransport(url), nil
+	}
+	if remote, ok := ParseSSHURL(url); ok {
+		return GeneratePipeTransport(url, remote, SSHCommand(local)), nil
+	}
+
+	path := url
+	if strings.HasPrefix(url, FILE_URL_PREFIX) {
+		path = strings.TrimPrefix(url, FILE_URL_PREFIX)
+	} else if strings.Contains(url, "://") {
+		return nil, ErrorUnsupportedTransport
+	}
+
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(local.w.Path, path)
+	}
+
+	remote, bare, err := OpenRepositoryAt(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileTransport{
+		repo: remote,
+		bare: bare,
+	}, nil
+}
+
+//path/.git(directoryかgitfile)があれば作業ディレクトリつき、path自体がrepositoryならbare
+//remoteのpathは上に辿らない
+func OpenRepositoryAt(path string) (*Repository, bool, error) {
+	gitPath, workTree, found, err := findGitDir(path)
+	if err != nil {
+		return nil, false, err
+	}
+	if !found {
+		return nil, false, fmt.Errorf("'%s' %w", path, ErrorNotARepository)
+	}
+
+	repo, err := openRepository(workTree, gitPath, path)
+	if err != nil {
+		return nil, false, err
+	}
+	return repo, repo.bare, nil
+}
+
+type FileTransport struct {
+	repo *Repository
+	bare bool
+}
+
+func (t *FileTransport) ListRefs() ([]*RemoteRef, error) {
+	return AdvertiseRefs(t.repo)
+}
+
+func (t *FileTransport) ObjectFormat() crypt.Hash {
+	return t.repo.Hash()
+}
+
+func (t *FileTransport) Fetch(wants []string, local *Repository) error {
+	objIds, err := CollectMissingObjects(t.repo, wants, local.d.HasObject)
+	if err != nil {
+		return err
+	}
+
+	return CopyObjects(t.repo, local, objIds)
+}
+
+func (t *FileTransport) Push(updates []*RefUpdate, local *Repository) error {
+	var wants []string
+	for _, u := range updates {
+		if u.NewObjId != "" {
+			wants = append(wants, u.NewObjId)
+		}
+	}
+
+	objIds, err := CollectMissingObjects(local, wants, t.repo.d.HasObject)
+	if err != nil {
+		return err
+	}
+
+	err = CopyObjects(local, t.repo, objIds)
+	if err != nil {
+		return err
+	}
+
+	return ReceiveRefUpdates(t.repo, t.bare, updates)
+}
+
+//HEAD,refs/heads,refs/tagsを返す、まだcommitのないbranchは出さない
+func AdvertiseRefs(repo *Repository) ([]*RemoteRef, error) {
+	var refs []*RemoteRef
+
+	headObjId, err := repo.r.ReadHead()
+	if err == nil && headObjId != "" {
+		head := &RemoteRef{
+			Name:  "HEAD",
+			ObjId: headObjId,
+		}
+		if currentRef, err := repo.r.CurrentRef("HEAD"); err == nil && !currentRef.IsHead() {
+			head.Target = filepath.ToSlash(currentRef.Path)
+		}
+		refs = append(refs, head)
+	}
+
+	objIds, names, err := ListLocalRefs(repo, "refs/heads", "refs/tags")
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		refs = append(refs, &RemoteRef{
+			Name:  name,
+			ObjId: objIds[name],
+		})
+	}
+
+	return refs, nil
+}
+
+//wantsからcommitのparent,tree,blob,tagを辿り、hasがtrueのobjectで止める
+//相手がcommitを持っていればそこから先も持っているとみなす(本家と同じ前提)
+func CollectMissingObjects(repo *Repository, wants []string, has func(objId string) bool) ([]string, error) {
+	var objIds []string
+	visited := make(map[string]bool)
+
+	queue := append([]string{}, wants...)
+	for len(queue) > 0 {
+		objId := queue[0]
+		queue = queue[1:]
+
+		if objId == "" || visited[objId] || has(objId) {
+			continue
+		}
+		visited[objId] = true
+		objIds = append(objIds, objId)
+
+		o, err := repo.d.ReadObject(objId)
+		if err != nil {
+			return nil, err
+		}
+
+		switch v := o.(type) {
+		case *con.CommitFromMem:
+			for _, p := range v.Parents {
+				if p != "" {
+					queue = append(queue, p)
+				}
+			}
+			queue = append(queue, v.Tree)
+		case *con.Tag:
+			queue = append(queue, v.Object)
+		case *con.Tree:
+			for _, e := range v.Entries {
+				entry, ok := e.(*con.Entry)
+				if !ok {
+					return nil, ErrorObjeToEntryConvError
+				}
+				if entry.IsTree() {
+					queue = append(queue, entry.ObjId)
+					continue
+				}
+				//submoduleのcommitはsubmoduleのrepositoryにあるので送らない
+				if entry.IsGitlink() {
+					continue
+				}
+				if !visited[entry.ObjId] && !has(entry.ObjId) {
+					visited[entry.ObjId] = true
+					objIds = append(objIds, entry.ObjId)
+				}
+			}
+		}
+	}
+
+	return objIds, nil
+}
+
+//packに入っているobjectもlooseとして書き出す
+func CopyObjects(from, to *Repository, objIds []string) error {
+	for _, objId := range objIds {
+		r, err := from.d.GetContent(objId)
+		if err != nil {
+			return err
+		}
+
+		content, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+
+		err = to.d.WriteObject(objId, string(content))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//oldから辿ってnewに行けるならfast-forward
+func IsFastForward(oldObjId, newObjId string, d *data.Database) (bool, error) {
+	if oldObjId == "" || oldObjId == newObjId {
+		return true, nil
+	}
+
+	bases, err := FindBCA(newObjId, oldObjId, d)
+	if err != nil {
+		return false, err
+	}
+
+	return len(bases) == 1 && bases[0] == oldObjId, nil
+}
+
+//push先での処理、本家のreceive-packと同じくrefごとに受け付けるかを決める
+func ReceiveRefUpdates(repo *Repository, bare bool, updates []*RefUpdate) error {
+	c, err := LoadConfig(repo)
+	if err != nil {
+		return err
+	}
+	deny, _ := c.Get("receive", "", "denyNonFastForwards")
+	denyNonFastForwards := deny == "true"
+
+	checkedOut := ""
+	if currentRef, err := repo.r.CurrentRef("HEAD"); err == nil && !currentRef.IsHead() {
+		checkedOut = filepath.ToSlash(currentRef.Path)
+	}
+
+	for _, u := range updates {
+		if !strings.HasPrefix(u.Name, "refs/") || data.CheckValidRef(strings.TrimPrefix(u.Name, "refs/")) != nil {
+			u.Reason = "funny refname"
+			continue
+		}
+
+		current, _ := data.ReadRefFile(filepath.Join(repo.r.Path, u.Name))
+		if current != u.OldObjId {
+			u.Reason = "stale info"
+			continue
+		}
+
+		//作業ディレクトリつきのrepositoryでcheckoutされているbranchを動かすとworkspaceとずれる
+		if !bare && u.Name == checkedOut {
+			u.Reason = "branch is currently checked out"
+			continue
+		}
+
+		if u.NewObjId == "" {
+			if err := repo.r.DeleteRef(u.Name); err != nil {
+				u.Reason = refUpdateReason(err, "failed to delete")
+			}
+			continue
+		}
+
+		if !repo.d.HasObject(u.NewObjId) {
+			u.Reason = "missing necessary objects"
+			continue
+		}
+
+		//forceかどうかは送る側で判断する、本家と同じくreceive.denyNonFastForwardsなら受ける側でも拒否する
+		if denyNonFastForwards {
+			ff, err := IsFastForward(u.OldObjId, u.NewObjId, repo.d)
+			if err != nil {
+				return err
+			}
+			if !ff {
+				u.Reason = "non-fast-forward"
+				continue
+			}
+		}
+
+		err := repo.r.WithReason("push").UpdateRef(u.Name, u.NewObjId)
+		if errors.Is(err, data.ErrorProtectedBranch) || errors.Is(err, data.ErrorRefTransactionAborted) {
+			u.Reason = refUpdateReason(err, "")
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//transactionで拒否された理由を本家のreceive-packと同じ言葉にする
+func refUpdateReason(err error, fallback string) string {
+	switch {
+	case errors.Is(err, data.ErrorProtectedBranch):
+		return "protected branch"
+	case errors.Is(err, data.ErrorRefTransactionAborted):
+		return "hook declined"
+	default:
+		return fallback
+	}
+}
+
+//refs/heads/masterをmaster、refs/remotes/origin/masterをorigin/masterにする
+func ShortRefName(name string) string {
+	for _, prefix := range []string{"refs/heads/", "refs/tags/", "refs/remotes/"} {
+		if strings.HasPrefix(name, prefix) {
+			return strings.TrimPrefix(name, prefix)
+		}
+	}
+
+	return name
+}
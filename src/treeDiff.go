@@ -2,6 +2,7 @@ package src
 
 import (
 	con "mygit/src/database/content"
+	"path/filepath"
 	"reflect"
 )
 
@@ -45,11 +46,11 @@ func (t *TreeDiff) Compare(fromObjId, toObjId string, filter *PathFilter) error
 		return nil
 	}
 
-	aTree, err := GetTree(aObjId, t.repo)
+	aTree, err := GetTree(aObjId, filter.path, t.repo)
 	if err != nil {
 		return err
 	}
-	bTree, err := GetTree(bObjId, t.repo)
+	bTree, err := GetTree(bObjId, filter.path, t.repo)
 	if err != nil {
 		return err
 	}
@@ -87,7 +88,7 @@ func (t *TreeDiff) DetectDeletions(aEntries, bEntries map[string]con.Object, fil
 			return ErrorObjeToEntryConvError
 		}
 
-		subFilter := filter.Join(k)
+		subFilter := filter.Join(filepath.Base(k))
 
 		if !ok {
 			var aObjId string
@@ -169,7 +170,7 @@ func (t *TreeDiff) DetectAddtions(aEntries, bEntries map[string]con.Object, filt
 			return nil
 		}
 
-		subFilter := filter.Join(k)
+		subFilter := filter.Join(filepath.Base(k))
 
 		//ここから先はaEntriesにないもの
 		if ev.IsTree() {
@@ -193,7 +194,8 @@ func (t *TreeDiff) DetectAddtions(aEntries, bEntries map[string]con.Object, filt
 	return nil
 }
 
-func GetTree(objId string, repo *Repository) (*con.Tree, error) {
+//entryのpathはprefixからになる
+func GetTree(objId, prefix string, repo *Repository) (*con.Tree, error) {
 	if objId == "" {
 		return nil, nil
 	}
@@ -207,21 +209,11 @@ func GetTree(objId string, repo *Repository) (*con.Tree, error) {
 	switch v := o.(type) {
 	case *con.CommitFromMem:
 		{
-			o2, err := repo.d.ReadObject(v.Tree)
-			if err != nil {
-				return nil, err
-			}
-
-			t, ok := o2.(*con.Tree)
-			if !ok {
-				return nil, ErrorObjeToEntryConvError
-			}
-
-			return t, nil
+			return repo.d.ReadTree(v.Tree, prefix)
 		}
 	case *con.Tree:
 		{
-			return v, nil
+			return repo.d.ReadTree(objId, prefix)
 		}
 	default:
 		return nil, ErrorObjeToEntryConvError
@@ -0,0 +1,321 @@
+package src
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mygit/src/crypt"
+	"strings"
+)
+
+//本家のupload-pack(fetchされる側)とそれに話しかけるclient側、smart HTTPとpipe(ssh)で共通に使う
+//refを広告し、wantとhaveを受け取って相手にないobjectをpackで返す
+//multi_ackなどは使わず、共通のcommitがあればACK、なければNAKを1回返す
+
+const (
+	UPLOAD_PACK  = "git-upload-pack"
+	RECEIVE_PACK = "git-receive-pack"
+	AGENT        = "agent=mygit/1.0"
+	//refがまだない時や削除の時に使う、sha256のrepositoryではHash.ZeroObjId
+	ZERO_OBJ_ID = "0000000000000000000000000000000000000000"
+	//sha1以外のrepositoryはobject-format=sha256を広告する
+	OBJECT_FORMAT_CAP = "object-format="
+)
+
+var (
+	ErrorUnknownService       = errors.New("unknown service")
+	ErrorNotOurRef            = errors.New("not our ref")
+	ErrorProtocol             = errors.New("protocol error")
+	ErrorObjectFormatMismatch = errors.New("mismatched object format")
+)
+
+//1行目だけNULのあとにcapabilityをつける、refがなければcapabilities^{}を送る
+func writeRefAdvertisement(w io.Writer, refs []*RemoteRef, caps string, h crypt.Hash) error {
+	if h != crypt.SHA1 {
+		caps = fmt.Sprintf("%s %s%s", caps, OBJECT_FORMAT_CAP, h.Name())
+	}
+
+	if len(refs) == 0 {
+		err := WritePktLine(w, fmt.Sprintf("%s capabilities^{}\x00%s\n", h.ZeroObjId(), caps))
+		if err != nil {
+			return err
+		}
+		return WritePktFlush(w)
+	}
+
+	for i, ref := range refs {
+		line := fmt.Sprintf("%s %s", ref.ObjId, ref.Name)
+		if i == 0 {
+			line += "\x00" + caps
+		}
+		if err := WritePktLine(w, line+"\n"); err != nil {
+			return err
+		}
+	}
+
+	return WritePktFlush(w)
+}
+
+//flushまでのrefの広告を読む、1行目のcapabilityも返す
+func readRefAdvertisement(pr *PktReader) ([]*RemoteRef, []string, error) {
+	var refs []*RemoteRef
+	var caps []string
+
+	for {
+		line, isFlush, err := pr.ReadLine()
+		if err != nil {
+			return nil, nil, err
+		}
+		if isFlush {
+			break
+		}
+		if strings.HasPrefix(line, "ERR ") {
+			return nil, nil, fmt.Errorf("remote error: %s", strings.TrimSpace(line[4:]))
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+		if body, capLine, found := strings.Cut(line, "\x00"); found {
+			line = body
+			caps = strings.Fields(capLine)
+		}
+
+		objId, name, found := strings.Cut(line, " ")
+		if !found {
+			return nil, nil, ErrorProtocol
+		}
+		if name == "capabilities^{}" {
+			continue
+		}
+
+		refs = append(refs, &RemoteRef{
+			Name:  name,
+			ObjId: objId,
+		})
+	}
+
+	return refs, caps, nil
+}
+
+//object-formatがなければsha1
+func remoteObjectFormat(caps []string) (crypt.Hash, error) {
+	for _, c := range caps {
+		if name, ok := strings.CutPrefix(c, OBJECT_FORMAT_CAP); ok {
+			return crypt.HashByName(name)
+		}
+	}
+
+	return crypt.SHA1, nil
+}
+
+//fetch,pushはremoteとlocalのobjIdの形が同じでなければできない
+func checkObjectFormat(t Transport, local *Repository) error {
+	if h := t.ObjectFormat(); h != local.Hash() {
+		return fmt.Errorf("remote is %s but local is %s: %w", h.Name(), local.Hash().Name(), ErrorObjectFormatMismatch)
+	}
+
+	return nil
+}
+
+//symref=HEAD:refs/heads/xxxのcapabilityからHEADの指すbranchを決める
+func setHeadTarget(refs []*RemoteRef, caps []string) {
+	for _, c := range caps {
+		if !strings.HasPrefix(c, "symref=HEAD:") {
+			continue
+		}
+		for _, ref := range refs {
+			if ref.Name == "HEAD" {
+				ref.Target = strings.TrimPrefix(c, "symref=HEAD:")
+			}
+		}
+	}
+}
+
+//mgit upload-pack <dir>、sshなどの先で起動されstdin/stdoutで話す
+func StartUploadPack(path string, r io.Reader, w io.Writer) error {
+	repo, _, err := OpenRepositoryAt(path)
+	if err != nil {
+		return err
+	}
+
+	err = AdvertiseUploadPack(w, repo)
+	if err != nil {
+		return err
+	}
+
+	return ServeUploadPack(r, w, repo)
+}
+
+func AdvertiseUploadPack(w io.Writer, repo *Repository) error {
+	refs, err := AdvertiseRefs(repo)
+	if err != nil {
+		return err
+	}
+
+	caps := AGENT
+	for _, ref := range refs {
+		if ref.Name == "HEAD" && ref.Target != "" {
+			caps = fmt.Sprintf("symref=HEAD:%s %s", ref.Target, AGENT)
+		}
+	}
+
+	return writeRefAdvertisement(w, refs, caps, repo.Hash())
+}
+
+//want,flush,have...,doneを読み、ACKかNAKのあとにpackを書く
+func ServeUploadPack(r io.Reader, w io.Writer, repo *Repository) error {
+	pr := GeneratePktReader(r)
+
+	var wants []string
+	for {
+		line, isFlush, err := pr.ReadLine()
+		if err != nil {
+			return err
+		}
+		if isFlush {
+			break
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "want" {
+			return ErrorProtocol
+		}
+		if !repo.d.HasObject(fields[1]) {
+			WritePktLine(w, fmt.Sprintf("ERR upload-pack: not our ref %s\n", fields[1]))
+			return fmt.Errorf("%s %w", fields[1], ErrorNotOurRef)
+		}
+		wants = append(wants, fields[1])
+	}
+
+	//何もほしくなければ何も返さない
+	if len(wants) == 0 {
+		return nil
+	}
+
+	var commons []string
+	for {
+		line, isFlush, err := pr.ReadLine()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if isFlush {
+			continue
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+		if line == "done" {
+			break
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 || fields[0] != "have" {
+			return ErrorProtocol
+		}
+		if repo.d.HasObject(fields[1]) {
+			commons = append(commons, fields[1])
+		}
+	}
+
+	if len(commons) > 0 {
+		err := WritePktLine(w, fmt.Sprintf("ACK %s\n", commons[len(commons)-1]))
+		if err != nil {
+			return err
+		}
+	} else {
+		if err := WritePktLine(w, "NAK\n"); err != nil {
+			return err
+		}
+	}
+
+	//共通のcommitから辿れるobjectは相手も持っている
+	excludes, err := CollectMissingObjects(repo, commons, func(string) bool { return false })
+	if err != nil {
+		return err
+	}
+	excluded := make(map[string]bool)
+	for _, objId := range excludes {
+		excluded[objId] = true
+	}
+
+	objIds, err := CollectMissingObjects(repo, wants, func(objId string) bool { return excluded[objId] })
+	if err != nil {
+		return err
+	}
+
+	return repo.d.WritePackStream(w, objIds)
+}
+
+//want,flush,have...,doneを書く、手元にないwantがなければ何も書かずfalseを返す
+func writeFetchRequest(w io.Writer, wants []string, local *Repository) (bool, error) {
+	var body bytes.Buffer
+	sent := make(map[string]bool)
+	for _, want := range wants {
+		if sent[want] || local.d.HasObject(want) {
+			continue
+		}
+		sent[want] = true
+
+		line := fmt.Sprintf("want %s\n", want)
+		if len(sent) == 1 {
+			line = fmt.Sprintf("want %s %s\n", want, AGENT)
+		}
+		WritePktLine(&body, line)
+	}
+	if len(sent) == 0 {
+		return false, nil
+	}
+	WritePktFlush(&body)
+
+	haves, err := localHaves(local)
+	if err != nil {
+		return false, err
+	}
+	for _, have := range haves {
+		WritePktLine(&body, fmt.Sprintf("have %s\n", have))
+	}
+	WritePktLine(&body, "done\n")
+
+	_, err = w.Write(body.Bytes())
+	return true, err
+}
+
+//ACKかNAKのあとに続くpackを展開する
+func readFetchResponse(pr *PktReader, local *Repository) error {
+	line, _, err := pr.ReadLine()
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(line, "ERR ") {
+		return fmt.Errorf("remote error: %s", strings.TrimSpace(line[4:]))
+	}
+	if line != "NAK\n" && !strings.HasPrefix(line, "ACK ") {
+		return ErrorProtocol
+	}
+
+	_, err = local.d.ReadPackStream(pr.Reader())
+	return err
+}
+
+//手元のbranch,tag,remote-tracking branchの先をhaveとして送る
+func localHaves(local *Repository) ([]string, error) {
+	objIds, names, err := ListLocalRefs(local, "refs/heads", "refs/tags", "refs/remotes")
+	if err != nil {
+		return nil, err
+	}
+
+	var haves []string
+	seen := make(map[string]bool)
+	for _, name := range names {
+		objId := objIds[name]
+		if seen[objId] || !local.d.HasObject(objId) {
+			continue
+		}
+		seen[objId] = true
+		haves = append(haves, objId)
+	}
+
+	return haves, nil
+}
@@ -0,0 +1,97 @@
+package src
+
+import (
+	"fmt"
+	"io"
+	con "mygit/src/database/content"
+	"time"
+)
+
+//verify-commit,verify-tagは署名を検証して本家と同じGood "git" signature ...を出す
+//1つでも検証できなければそこでエラーにする
+
+func StartVerifyCommit(rootPath string, args []string, w io.Writer) error {
+	repo, err := DiscoverRepository(rootPath)
+	if err != nil {
+		return err
+	}
+
+	for _, arg := range args {
+		rev, err := ParseRev(arg)
+		if err != nil {
+			return err
+		}
+		objId, err := ResolveRev(rev, repo)
+		if err != nil {
+			return err
+		}
+
+		o, err := repo.d.ReadObject(objId)
+		if err != nil {
+			return err
+		}
+		c, ok := o.(*con.CommitFromMem)
+		if !ok {
+			return fmt.Errorf("%s: %w", arg, con.ErrorUndefinedGitObjectType)
+		}
+
+		signature, ok := c.Signature(repo.Hash())
+		if !ok {
+			return fmt.Errorf("%s: %w", arg, ErrorNoSignature)
+		}
+		if err := writeVerifyResult(signature, c.Payload(), c.Committer.GetUnixTime(), repo, w); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//revisionはtagをcommitまで剥がしてしまうので、refs/tagsかobjIdからtag objectを読む
+func StartVerifyTag(rootPath string, args []string, w io.Writer) error {
+	repo, err := DiscoverRepository(rootPath)
+	if err != nil {
+		return err
+	}
+
+	for _, arg := range args {
+		objId, err := repo.r.ReadRef(arg)
+		if err != nil {
+			objId = arg
+		}
+
+		o, err := repo.d.ReadObject(objId)
+		if err != nil {
+			return err
+		}
+		t, ok := o.(*con.Tag)
+		if !ok {
+			return fmt.Errorf("%s: cannot verify a non-tag object: %w", arg, con.ErrorUndefinedGitObjectType)
+		}
+
+		if t.Signature == "" {
+			return fmt.Errorf("%s: %w", arg, ErrorNoSignature)
+		}
+		//taggerのないtagは今の時刻で見る
+		at := time.Now()
+		if t.Tagger != nil {
+			at = t.Tagger.GetUnixTime()
+		}
+		if err := writeVerifyResult(t.Signature, t.Payload(), at, repo, w); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeVerifyResult(signature, payload string, at time.Time, repo *Repository, w io.Writer) error {
+	result, err := repo.VerifySignature(signature, payload, at)
+	if err != nil {
+		return err
+	}
+
+	w.Write([]byte(result.String() + "\n"))
+
+	return nil
+}
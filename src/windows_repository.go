@@ -0,0 +1,8 @@
+// +build windows
+
+package src
+
+//windowsではdeviceを比べずにdriveのrootまで探す
+func deviceOf(path string) (uint64, bool) {
+	return 0, false
+}
@@ -4,30 +4,91 @@ import (
 	"fmt"
 	"io/fs"
 	"io/ioutil"
+	data "mygit/src/database"
 	con "mygit/src/database/content"
 	"mygit/src/database/lock"
 	"mygit/util"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 )
 
-var ignoreList = []string{
-	".",
-	".git", ".vscode", "cmd", "src", "util",
-	".mygit.yml", "go.mod", "go.sum", "main.go", "testData"}
-
 type WorkSpace struct {
 	Path string
+	//indexに入っているファイルは.gitignoreにmatchしても除外しない(本家と同じ)、GenerateRepositoryでセットする
+	index *data.Index
+	//info/excludeを読む.gitの場所、gitfileやGIT_DIRのこともあるのでGenerateRepositoryでセットする
+	gitPath string
+
+	ignoreOnce sync.Once
+	ignore     *Ignore
+}
+
+//最初に使う時に一度だけ作り、Dirごとの.gitignoreと判定結果はその後も使い回す
+func (w *WorkSpace) Ignore() *Ignore {
+	w.ignoreOnce.Do(func() {
+		gitPath := w.gitPath
+		if gitPath == "" {
+			gitPath = filepath.Join(w.Path, ".git")
+		}
+		w.ignore = GenerateIgnore(w.Path, gitPath)
+	})
+	return w.ignore
+}
+
+//pathはworkSpaceからの相対path
+func (w *WorkSpace) IsIgnored(path string, isDir bool) bool {
+	return w.Ignore().IsIgnored(path, isDir)
+}
+
+func (w *WorkSpace) isExcluded(ig *Ignore, path string, isDir bool) bool {
+	if !ig.IsIgnored(path, isDir) {
+		return false
+	}
+
+	return w.index == nil || !w.index.IsIndexed(path)
+}
+
+//ListDirやListFilesは.git/refsや.git/objectsをlistするのにも使っているので、
+//rootがworkSpaceの外か.gitの中のときは.gitignoreを適用しない
+func (w *WorkSpace) ignoreFor(root string) *Ignore {
+	rel, err := filepath.Rel(w.Path, root)
+	if err != nil {
+		return nil
+	}
+
+	rel = filepath.ToSlash(rel)
+	if rel == ".." || strings.HasPrefix(rel, "../") || rel == ".git" || strings.HasPrefix(rel, ".git/") {
+		return nil
+	}
+
+	return w.Ignore()
+}
+
+//.gitがdirectoryかgitfileのdirectoryはsubmoduleなどの入れ子のrepositoryで、中はこのrepositoryでは見ない
+func (w *WorkSpace) IsNestedRepository(path string) bool {
+	if path == "" || path == "." {
+		return false
+	}
+
+	_, err := os.Lstat(filepath.Join(w.Path, path, ".git"))
+	return err == nil
 }
 
 func (w *WorkSpace) ReadFile(path string) (string, error) {
 
 	absPath := filepath.Join(w.Path, path)
-	if _, err := os.Stat(absPath); err != nil {
+	stat, err := os.Lstat(absPath)
+	if err != nil {
 		return "", err
 	}
 
+	//symlinkはlinkの先の中身ではなく、linkの先のpathをblobにする
+	if stat.Mode()&os.ModeSymlink != 0 {
+		return os.Readlink(absPath)
+	}
+
 	bytes, err := ioutil.ReadFile(absPath)
 
 	if err != nil {
@@ -38,7 +99,7 @@ func (w *WorkSpace) ReadFile(path string) (string, error) {
 }
 
 func (w *WorkSpace) ListDir(path string) (map[string]con.FileState, error) {
-	fileAndStat, err := w.FilePathWalkDirStat(path, ignoreList)
+	fileAndStat, err := w.FilePathWalkDirStat(path, nil)
 
 	if err != nil {
 		return nil, err
@@ -58,6 +119,8 @@ func (w *WorkSpace) FilePathWalkDirStat(root string, ignoreList []string) (map[s
 		return nil, err
 	}
 
+	ig := w.ignoreFor(root)
+
 	for _, f := range files {
 		match, er := pathMatch(ignoreList, f.Name())
 
@@ -65,9 +128,17 @@ func (w *WorkSpace) FilePathWalkDirStat(root string, ignoreList []string) (map[s
 			return nil, er
 		}
 
+		if !match && ig != nil {
+			relPath, er := filepath.Rel(w.Path, filepath.Join(root, f.Name()))
+			if er != nil {
+				return nil, er
+			}
+			match = w.isExcluded(ig, relPath, f.IsDir())
+		}
+
 		if !match {
 
-			stat, er := os.Stat(filepath.Join(root, f.Name()))
+			stat, er := os.Lstat(filepath.Join(root, f.Name()))
 
 			if er != nil {
 				return nil, er
@@ -88,7 +159,7 @@ func (w *WorkSpace) FilePathWalkDirStat(root string, ignoreList []string) (map[s
 }
 
 func (w *WorkSpace) ListFiles(path string) ([]string, error) {
-	files, err := w.FilePathWalkDir(path, ignoreList)
+	files, err := w.FilePathWalkDir(path, nil)
 
 	if err != nil {
 		return nil, err
@@ -101,6 +172,8 @@ func (w *WorkSpace) ListFiles(path string) ([]string, error) {
 func (w *WorkSpace) FilePathWalkDir(root string, ignoreList []string) ([]string, error) {
 	var files []string
 
+	ig := w.ignoreFor(root)
+
 	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
@@ -111,6 +184,28 @@ func (w *WorkSpace) FilePathWalkDir(root string, ignoreList []string) ([]string,
 		if er != nil {
 			return er
 		}
+
+		if ig != nil && path != root {
+			relPath, er := filepath.Rel(w.Path, path)
+			if er != nil {
+				return er
+			}
+
+			if w.isExcluded(ig, relPath, info.IsDir()) {
+				//除外されたDirの中はそもそも辿らない
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			//入れ子のrepositoryは中身ではなくdirectoryそのものをgitlinkとして返す
+			if info.IsDir() && w.IsNestedRepository(relPath) {
+				files = append(files, p)
+				return filepath.SkipDir
+			}
+		}
+
 		if !info.IsDir() {
 			//.git/xxx/yyyとあるときに
 			match, er := pathMatch(ignoreList, p)
@@ -161,6 +256,10 @@ func (w *WorkSpace) RunWriteFile(path, content string, mode int) error {
 		}
 	}
 
+	if mode != -1 && con.IsSymlink(uint32(mode)) {
+		return writeSymlink(absPath, content)
+	}
+
 	f, err := os.Create(absPath)
 
 	defer func() {
@@ -186,7 +285,17 @@ func (w *WorkSpace) RunWriteFile(path, content string, mode int) error {
 //os.FileInfoを独自の構造体にwrapした方がよさそう
 func (w *WorkSpace) StatFile(path string) (con.FileState, error) {
 	absPath := filepath.Join(w.Path, path)
-	return os.Stat(absPath)
+	return os.Lstat(absPath)
+}
+
+//すでにあるファイルやlinkは置き換える、contentはlinkの先のpath
+func writeSymlink(absPath, content string) error {
+	err := os.RemoveAll(absPath)
+	if err != nil {
+		return err
+	}
+
+	return os.Symlink(content, absPath)
 }
 
 func (w *WorkSpace) ApplyMigration(m *Migration) error {
@@ -232,7 +341,7 @@ func (w *WorkSpace) RemoveDir(path string) error {
 
 func (w *WorkSpace) MakeDir(path string) error {
 	absPath := filepath.Join(w.Path, path)
-	stat, nonExists := os.Stat(absPath)
+	stat, nonExists := os.Lstat(absPath)
 
 	if nonExists == nil {
 		if !stat.IsDir() {
@@ -256,6 +365,18 @@ func (w *WorkSpace) ApplyChangeList(m *Migration, action string) error {
 	for path, newItem := range m.Changes[action] {
 		absPath := filepath.Join(w.Path, path)
 
+		//cloneしてあるsubmoduleは消さずに、記録されたcommitにcheckoutし直す
+		//本家と同じく消されたsubmoduleの作業ディレクトリは残す
+		if w.IsNestedRepository(path) {
+			if newItem != nil && newItem.IsGitlink() {
+				err := CheckoutSubmodule(absPath, newItem.ObjId)
+				if err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
 		err := os.RemoveAll(absPath)
 		if err != nil {
 			return err
@@ -264,12 +385,28 @@ func (w *WorkSpace) ApplyChangeList(m *Migration, action string) error {
 		if action == MIGRATION_DELETE {
 			continue
 		}
+		if newItem.IsGitlink() {
+			//まだcloneしていないsubmoduleは空のdirectoryだけ置く
+			err := os.MkdirAll(absPath, os.ModePerm)
+			if err != nil {
+				return err
+			}
+			continue
+		}
 		//treeDiffからとってきたやつは全部blobの想定なので
 		content, err := m.BlobContent(newItem.ObjId)
 		if err != nil {
 			return err
 		}
 
+		if newItem.IsSymlink() {
+			err := writeSymlink(absPath, content)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
 		//おそらくfilePathがxxx/dummy.txtでxxxがないのでだめだった<-いまはok
 
 		//fileLock
@@ -251,3 +251,53 @@ func TestRecursiveDelete(t *testing.T) {
 	stat, _ = os.Stat(xxxPath)
 	assert.Nil(t, stat)
 }
+
+func TestListFilesWithGitIgnore(t *testing.T) {
+	cur, err := os.Getwd()
+	assert.NoError(t, err)
+	tempPath, err := ioutil.TempDir(cur, "")
+	assert.NoError(t, err)
+
+	t.Cleanup(func() {
+		os.RemoveAll(tempPath)
+	})
+
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(tempPath, "config"))
+
+	for _, dir := range []string{".git", "src", "cmd", "build", "docs"} {
+		err = os.MkdirAll(filepath.Join(tempPath, dir), os.ModePerm)
+		assert.NoError(t, err)
+	}
+
+	CreateFiles(t, tempPath, ".gitignore", "build/\n*.log\n")
+	CreateFiles(t, filepath.Join(tempPath, "docs"), ".gitignore", "draft.md\n")
+	CreateFiles(t, filepath.Join(tempPath, ".git"), "HEAD", "ref: refs/heads/master\n")
+	CreateFiles(t, filepath.Join(tempPath, "src"), "main.go", "package main\n")
+	CreateFiles(t, filepath.Join(tempPath, "cmd"), "root.go", "package cmd\n")
+	CreateFiles(t, filepath.Join(tempPath, "build"), "out", "binary\n")
+	CreateFiles(t, filepath.Join(tempPath, "docs"), "draft.md", "draft\n")
+	CreateFiles(t, filepath.Join(tempPath, "docs"), "readme.md", "readme\n")
+	CreateFiles(t, tempPath, "debug.log", "log\n")
+
+	w := &WorkSpace{
+		Path: tempPath,
+	}
+
+	fs, err := w.ListFiles(tempPath)
+	assert.NoError(t, err)
+
+	//src,cmdは普通のDirとしてlistされ、.gitと.gitignoreで除外したものは入らない
+	expected := []string{".gitignore", "cmd/root.go", "docs/.gitignore", "docs/readme.md", "src/main.go"}
+	if diff := cmp.Diff(expected, fs); diff != "" {
+		t.Errorf("diff is %s\n", diff)
+	}
+
+	dirs, err := w.ListDir(tempPath)
+	assert.NoError(t, err)
+	_, buildOk := dirs["build"]
+	_, gitOk := dirs[".git"]
+	_, srcOk := dirs["src"]
+	assert.False(t, buildOk)
+	assert.False(t, gitOk)
+	assert.True(t, srcOk)
+}